@@ -1,9 +1,12 @@
 package bacalhau
 
 import (
+	"fmt"
 	"sort"
 	"time"
 
+	"github.com/c2h5oh/datasize"
+
 	jobutils "github.com/filecoin-project/bacalhau/pkg/job"
 	"github.com/filecoin-project/bacalhau/pkg/model"
 	"github.com/filecoin-project/bacalhau/pkg/system"
@@ -57,14 +60,38 @@ type eventDescription struct {
 type localEventDescription struct {
 	Event      string `yaml:"Event"`
 	TargetNode string `yaml:"TargetNode"`
+	Reason     string `yaml:"Reason,omitempty"`
 }
 
 type shardNodeStateDescription struct {
 	Node     string `yaml:"Node"`
 	State    string `yaml:"State"`
 	Status   string `yaml:"Status"`
+	Progress string `yaml:"Progress,omitempty"`
 	Verified bool   `yaml:"Verified"`
 	ResultID string `yaml:"ResultID"`
+	// what the shard asked for next to what it used on this node
+	Resources *shardResourcesDescription `yaml:"Resources,omitempty"`
+}
+
+type shardResourcesDescription struct {
+	Requested requestedResourcesDescription `yaml:"Requested"`
+	Used      usedResourcesDescription      `yaml:"Used"`
+}
+
+type requestedResourcesDescription struct {
+	CPU    string `yaml:"CPU,omitempty"`
+	Memory string `yaml:"Memory,omitempty"`
+	Disk   string `yaml:"Disk,omitempty"`
+}
+
+type usedResourcesDescription struct {
+	// the average number of cpus the shard kept busy
+	CPU         string `yaml:"CPU"`
+	CPUTime     string `yaml:"CPU Time"`
+	PeakMemory  string `yaml:"Peak Memory"`
+	DiskWritten string `yaml:"Disk Written"`
+	WallTime    string `yaml:"Wall Time"`
 }
 
 type shardStateDescription struct {
@@ -193,12 +220,21 @@ var describeCmd = &cobra.Command{
 					Nodes:      []shardNodeStateDescription{},
 				}
 			}
+			// running shards relay the progress the job reported in their status
+			progress := ""
+			if shard.State == model.JobStateRunning {
+				if shardProgress := model.ParseShardProgress(shard.Status); shardProgress.HasPercent() {
+					progress = model.ShardProgress{Percent: shardProgress.Percent}.String()
+				}
+			}
 			shardDescription.Nodes = append(shardDescription.Nodes, shardNodeStateDescription{
-				Node:     shard.NodeID,
-				State:    shard.State.String(),
-				Status:   shard.Status,
-				Verified: shard.VerificationResult.Result,
-				ResultID: shard.PublishedResult.Cid,
+				Node:      shard.NodeID,
+				State:     shard.State.String(),
+				Status:    shard.Status,
+				Progress:  progress,
+				Verified:  shard.VerificationResult.Result,
+				ResultID:  shard.PublishedResult.Cid,
+				Resources: describeShardResources(j.Spec.Resources, shard.ResourceUsage),
 			})
 			shardDescriptions[shard.ShardIndex] = shardDescription
 		}
@@ -235,6 +271,7 @@ var describeCmd = &cobra.Command{
 			jobDesc.LocalEvents = append(jobDesc.LocalEvents, localEventDescription{
 				Event:      event.EventName.String(),
 				TargetNode: event.TargetNodeID,
+				Reason:     event.Reason,
 			})
 		}
 
@@ -249,3 +286,32 @@ var describeCmd = &cobra.Command{
 		return nil
 	},
 }
+
+// describeShardResources puts what a shard used next to what the job asked
+// for, or returns nil if the node didn't measure it.
+func describeShardResources(
+	requested model.ResourceUsageConfig,
+	used model.ResourceUsageMeasurement,
+) *shardResourcesDescription {
+	if used.IsEmpty() {
+		return nil
+	}
+	averageCPU := 0.0
+	if used.WallTimeSeconds > 0 {
+		averageCPU = used.CPUSeconds / used.WallTimeSeconds
+	}
+	return &shardResourcesDescription{
+		Requested: requestedResourcesDescription{
+			CPU:    requested.CPU,
+			Memory: requested.Memory,
+			Disk:   requested.Disk,
+		},
+		Used: usedResourcesDescription{
+			CPU:         fmt.Sprintf("%.2f", averageCPU),
+			CPUTime:     (time.Duration(used.CPUSeconds * float64(time.Second))).Round(time.Millisecond).String(),
+			PeakMemory:  datasize.ByteSize(used.PeakMemory).HR(),
+			DiskWritten: datasize.ByteSize(used.DiskWritten).HR(),
+			WallTime:    (time.Duration(used.WallTimeSeconds * float64(time.Second))).Round(time.Millisecond).String(),
+		},
+	}
+}
@@ -59,6 +59,20 @@ type DockerRunOptions struct {
 	GPU           string
 	WorkingDir    string   // Working directory for docker
 	Labels        []string // Labels for the job on the Bacalhau network (for searching)
+	Network       string   // Network access for the job (none, allowlist or full)
+	AllowHosts    []string // Hosts and CIDRs the job can reach with the allowlist network
+
+	InputURLIndexes []string // Array of index files listing URLs to download, in 'URL:path' form
+	InputGit        []string // Array of git repositories to check out, in 'repo@commit:path' form
+	ExtractInputs   []string // Array of paths of inputs whose archives are extracted
+
+	S3Publisher model.JobSpecS3Publisher // Where the s3 publisher uploads results
+
+	Relaxations model.JobSpecDockerRelaxations // Security hardening the job needs relaxed
+	PullPolicy  string                         // When compute nodes should pull the image
+
+	CheckpointPath        string // Where the job writes checkpoints inside the container
+	CheckpointRestorePath string // Where the latest checkpoint is mounted when the job is rescheduled
 
 	Image      string   // Image to execute
 	Entrypoint []string // Entrypoint to the docker image
@@ -76,25 +90,33 @@ type DockerRunOptions struct {
 
 func NewDockerRunOptions() *DockerRunOptions {
 	return &DockerRunOptions{
-		Engine:             "docker",
-		Verifier:           "noop",
-		Publisher:          "estuary",
-		Inputs:             []string{},
-		InputUrls:          []string{},
-		InputVolumes:       []string{},
-		OutputVolumes:      []string{},
-		Env:                []string{},
-		Concurrency:        1,
-		Confidence:         0,
-		MinBids:            0, // 0 means no minimum before bidding
-		CPU:                "",
-		Memory:             "",
-		GPU:                "",
-		SkipSyntaxChecking: false,
-		WorkingDir:         "",
-		Labels:             []string{},
-		DownloadFlags:      *ipfs.NewIPFSDownloadSettings(),
-		RunTimeSettings:    *NewRunTimeSettings(),
+		Engine:                "docker",
+		Verifier:              "noop",
+		Publisher:             "estuary",
+		Inputs:                []string{},
+		InputUrls:             []string{},
+		InputURLIndexes:       []string{},
+		InputGit:              []string{},
+		ExtractInputs:         []string{},
+		InputVolumes:          []string{},
+		OutputVolumes:         []string{},
+		Env:                   []string{},
+		Concurrency:           1,
+		Confidence:            0,
+		MinBids:               0, // 0 means no minimum before bidding
+		CPU:                   "",
+		Memory:                "",
+		GPU:                   "",
+		SkipSyntaxChecking:    false,
+		WorkingDir:            "",
+		Labels:                []string{},
+		Network:               "none",
+		AllowHosts:            []string{},
+		PullPolicy:            "if-not-present",
+		CheckpointPath:        "",
+		CheckpointRestorePath: "/checkpoint_restore",
+		DownloadFlags:         *ipfs.NewIPFSDownloadSettings(),
+		RunTimeSettings:       *NewRunTimeSettings(),
 
 		ShardingGlobPattern: "",
 		ShardingBasePath:    "/inputs",
@@ -118,9 +140,18 @@ func init() { //nolint:gochecknoinits,funlen // Using init in cobra command is i
 		&ODR.Publisher, "publisher", ODR.Publisher,
 		`What publisher engine to use to publish the job results`,
 	)
+	dockerRunCmd.PersistentFlags().StringVar(
+		&ODR.S3Publisher.Bucket, "s3-bucket", ODR.S3Publisher.Bucket,
+		`The bucket the s3 publisher uploads the results to.`,
+	)
+	dockerRunCmd.PersistentFlags().StringVar(
+		&ODR.S3Publisher.Prefix, "s3-prefix", ODR.S3Publisher.Prefix,
+		`The prefix in the bucket the s3 publisher uploads the results under.`,
+	)
 	dockerRunCmd.PersistentFlags().StringSliceVarP(
 		&ODR.Inputs, "inputs", "i", ODR.Inputs,
-		`CIDs to use on the job. Mounts them at '/inputs' in the execution.`,
+		`CIDs to use on the job. Mounts them at '/inputs' in the execution. Small local files can be sent with the job
+		as 'inline:localPath:path' (e.g. '-i inline:./config.yaml:/config.yaml'), without a path they are mounted in '/inputs'.`,
 	)
 
 	//nolint:lll // Documentation, ok if long.
@@ -128,7 +159,22 @@ func init() { //nolint:gochecknoinits,funlen // Using init in cobra command is i
 		&ODR.InputUrls, "input-urls", "u", ODR.InputUrls,
 		`URL:path of the input data volumes downloaded from a URL source. Mounts data at 'path' (e.g. '-u http://foo.com/bar.tar.gz:/app/bar.tar.gz'
 		mounts 'http://foo.com/bar.tar.gz' at '/app/bar.tar.gz'). URL can specify a port number (e.g. 'https://foo.com:443/bar.tar.gz:/app/bar.tar.gz')
-		and supports HTTP and HTTPS.`,
+		and supports HTTP and HTTPS. S3 objects and prefixes can be given the same way (e.g. '-u s3://bucket/images/:/inputs').`,
+	)
+	dockerRunCmd.PersistentFlags().StringSliceVar(
+		&ODR.InputURLIndexes, "input-url-index", ODR.InputURLIndexes,
+		`URL:path of an index file listing URLs to download, one per line optionally followed by its SHA-256.
+		The files are downloaded into the folder at 'path' and can be sharded.`,
+	)
+	dockerRunCmd.PersistentFlags().StringSliceVar(
+		&ODR.InputGit, "input-git", ODR.InputGit,
+		`repo@commit:path of a git repository to check out at 'path' (e.g. 'https://github.com/foo/bar.git@<full commit hash>:/code').
+		The commit must be a full hash so every node checks out the same files.`,
+	)
+	dockerRunCmd.PersistentFlags().StringSliceVar(
+		&ODR.ExtractInputs, "extract", ODR.ExtractInputs,
+		`Path of an input that is a tar, tar.gz, tar.bz2 or zip archive to extract (e.g. '-u http://foo.com/bar.zip:/inputs/bar --extract /inputs/bar').
+		The files in the archive are mounted in the folder at the path and a sharding glob pattern matches them.`,
 	)
 	dockerRunCmd.PersistentFlags().StringSliceVarP(
 		&ODR.InputVolumes, "input-volumes", "v", ODR.InputVolumes,
@@ -181,6 +227,46 @@ func init() { //nolint:gochecknoinits,funlen // Using init in cobra command is i
 		`List of labels for the job. Enter multiple in the format '-l a -l 2'. All characters not matching /a-zA-Z0-9_:|-/ and all emojis will be stripped.`, //nolint:lll // Documentation, ok if long.
 	)
 
+	dockerRunCmd.PersistentFlags().StringVar(
+		&ODR.Network, "network", ODR.Network,
+		`Network access for the job: "none", "allowlist" (only the hosts given with --allow-host) or "full".`,
+	)
+
+	dockerRunCmd.PersistentFlags().StringSliceVar(
+		&ODR.AllowHosts, "allow-host", ODR.AllowHosts,
+		`Host the job can reach when using --network allowlist. Can be a host name, a wildcard domain (*.example.com), an IP or a CIDR. Enter multiple in the format '--allow-host a --allow-host b'.`, //nolint:lll // Documentation, ok if long.
+	)
+
+	dockerRunCmd.PersistentFlags().StringVar(
+		&ODR.PullPolicy, "pull", ODR.PullPolicy,
+		`When compute nodes should pull the image: "always", "if-not-present" or "never" (the image must already be on the node).`,
+	)
+
+	dockerRunCmd.PersistentFlags().BoolVar(
+		&ODR.Relaxations.RunAsRoot, "run-as-root", ODR.Relaxations.RunAsRoot,
+		`Ask compute nodes to run the job as the user in the image rather than an unprivileged user. Nodes may refuse the job.`,
+	)
+
+	dockerRunCmd.PersistentFlags().BoolVar(
+		&ODR.Relaxations.WritableRootFS, "writable-rootfs", ODR.Relaxations.WritableRootFS,
+		`Ask compute nodes not to make the root filesystem read only. Nodes may refuse the job.`,
+	)
+
+	dockerRunCmd.PersistentFlags().StringSliceVar(
+		&ODR.Relaxations.Capabilities, "cap-add", ODR.Relaxations.Capabilities,
+		`Linux capabilities the job needs (e.g. NET_BIND_SERVICE). Nodes may refuse the job.`,
+	)
+
+	dockerRunCmd.PersistentFlags().StringVar(
+		&ODR.CheckpointPath, "checkpoint-path", ODR.CheckpointPath,
+		`Folder inside the container the job writes checkpoints to. Compute nodes upload them periodically and, if the shard is rescheduled, the new node mounts the latest one at --checkpoint-restore-path.`, //nolint:lll // Documentation, ok if long.
+	)
+
+	dockerRunCmd.PersistentFlags().StringVar(
+		&ODR.CheckpointRestorePath, "checkpoint-restore-path", ODR.CheckpointRestorePath,
+		`Where the latest checkpoint is mounted when a checkpointed shard is rescheduled.`,
+	)
+
 	dockerRunCmd.Flags().IntVar(&ODR.DownloadFlags.TimeoutSecs, "download-timeout-secs",
 		ODR.DownloadFlags.TimeoutSecs, "Timeout duration for IPFS downloads.")
 	dockerRunCmd.Flags().StringVar(&ODR.DownloadFlags.OutputDir, "output-dir",
@@ -294,7 +380,22 @@ func CreateJobSpecAndDeal(ctx context.Context,
 		return &model.JobSpec{}, &model.JobDeal{}, err
 	}
 
+	networkType, err := model.ParseNetwork(odr.Network)
+	if err != nil {
+		return &model.JobSpec{}, &model.JobDeal{}, err
+	}
+
+	pullPolicy, err := model.ParseImagePullPolicy(odr.PullPolicy)
+	if err != nil {
+		return &model.JobSpec{}, &model.JobDeal{}, err
+	}
+
+	inlineFiles := []string{}
 	for _, i := range odr.Inputs {
+		if inlineFile := strings.TrimPrefix(i, "inline:"); inlineFile != i {
+			inlineFiles = append(inlineFiles, inlineFile)
+			continue
+		}
 		odr.InputVolumes = append(odr.InputVolumes, fmt.Sprintf("%s:/inputs", i))
 	}
 
@@ -333,5 +434,40 @@ func CreateJobSpecAndDeal(ctx context.Context,
 		return &model.JobSpec{}, &model.JobDeal{}, errors.Wrap(err, "CreateJobSpecAndDeal:")
 	}
 
+	urlIndexInputs, err := jobutils.BuildURLIndexInputs(odr.InputURLIndexes)
+	if err != nil {
+		return &model.JobSpec{}, &model.JobDeal{}, errors.Wrap(err, "CreateJobSpecAndDeal:")
+	}
+	jobSpec.Inputs = append(jobSpec.Inputs, urlIndexInputs...)
+
+	gitInputs, err := jobutils.BuildGitInputs(odr.InputGit)
+	if err != nil {
+		return &model.JobSpec{}, &model.JobDeal{}, errors.Wrap(err, "CreateJobSpecAndDeal:")
+	}
+	jobSpec.Inputs = append(jobSpec.Inputs, gitInputs...)
+
+	inlineInputs, err := jobutils.BuildInlineInputs(inlineFiles)
+	if err != nil {
+		return &model.JobSpec{}, &model.JobDeal{}, errors.Wrap(err, "CreateJobSpecAndDeal:")
+	}
+	jobSpec.Inputs = append(jobSpec.Inputs, inlineInputs...)
+
+	if err = jobutils.ExtractInputs(jobSpec.Inputs, odr.ExtractInputs); err != nil {
+		return &model.JobSpec{}, &model.JobDeal{}, errors.Wrap(err, "CreateJobSpecAndDeal:")
+	}
+
+	jobSpec.S3Publisher = odr.S3Publisher
+	jobSpec.Docker.Relaxations = odr.Relaxations
+	jobSpec.Docker.PullPolicy = pullPolicy
+	jobSpec.Network = model.JobSpecNetwork{
+		Type:      networkType,
+		AllowList: odr.AllowHosts,
+	}
+	if odr.CheckpointPath != "" {
+		jobSpec.Checkpoint = model.JobSpecCheckpoint{
+			Path:        odr.CheckpointPath,
+			RestorePath: odr.CheckpointRestorePath,
+		}
+	}
 	return jobSpec, jobDeal, nil
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"sort"
 	"strings"
 	"time"
@@ -256,6 +257,14 @@ func resolvingJobDetails(ctx context.Context,
 			return nil, err
 		}
 
+		progressSummary, err := resolver.ProgressSummary(ctx, jobArray[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		if progressSummary != "" {
+			stateSummary = fmt.Sprintf("%s (%s)", stateSummary, progressSummary)
+		}
+
 		resultSummary, err := resolver.ResultSummary(ctx, jobArray[i].ID)
 		if err != nil {
 			return nil, err
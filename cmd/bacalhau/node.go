@@ -0,0 +1,192 @@
+package bacalhau
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	"github.com/filecoin-project/bacalhau/pkg/util/templates"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"k8s.io/kubectl/pkg/util/i18n"
+)
+
+var (
+	//nolint:lll // Documentation
+	nodeDrainLong = templates.LongDesc(i18n.T(`
+		Stop the compute node at --api-host and --api-port from selecting new jobs. Bids that have not been accepted yet are cancelled and running shards are left to finish.
+
+		Draining and uncordoning are only accepted from the node itself, so run this on the node with --api-host localhost.
+`))
+
+	//nolint:lll // Documentation
+	nodeDrainExample = templates.Examples(i18n.T(`
+		# Drain a compute node and return straight away
+		bacalhau node drain
+
+		# Drain a compute node and wait until it has no running shards left
+		bacalhau node drain --wait
+
+		# Let the compute node select jobs again
+		bacalhau node uncordon`))
+
+	// Set Defaults (probably a better way to do this)
+	OND = NewNodeDrainOptions()
+)
+
+type NodeDrainOptions struct {
+	Wait        bool // Wait for the node to have no shards left
+	WaitTimeout int  // How many seconds to wait for the node to drain
+}
+
+func NewNodeDrainOptions() *NodeDrainOptions {
+	return &NodeDrainOptions{
+		Wait:        false,
+		WaitTimeout: DefaultDrainWaitTimeout,
+	}
+}
+
+const DefaultDrainWaitTimeout = 3600
+const DrainStatusPollIntervalMillis = 1000
+
+func init() { //nolint:gochecknoinits // Using init in cobra command is idomatic
+	nodeDrainCmd.PersistentFlags().BoolVar(&OND.Wait, "wait", OND.Wait,
+		`Wait until the node has no shards left before returning.`)
+	nodeDrainCmd.PersistentFlags().IntVar(&OND.WaitTimeout, "wait-timeout-secs", OND.WaitTimeout,
+		`When using --wait, how many seconds to wait for the node to drain.`)
+
+	nodeCmd.AddCommand(nodeDrainCmd)
+	nodeCmd.AddCommand(nodeUncordonCmd)
+	nodeCmd.AddCommand(nodeStatusCmd)
+}
+
+type nodeDrainStatusDescription struct {
+	NodeID          string   `yaml:"NodeID"`
+	Draining        bool     `yaml:"Draining"`
+	Drained         bool     `yaml:"Drained"`
+	BiddingShards   []string `yaml:"BiddingShards"`
+	ExecutingShards []string `yaml:"ExecutingShards"`
+}
+
+var nodeCmd = &cobra.Command{
+	Use:   "node",
+	Short: "Manage the compute node running on the API server",
+}
+
+var nodeDrainCmd = &cobra.Command{
+	Use:     "drain",
+	Short:   "Stop a compute node from selecting new jobs",
+	Long:    nodeDrainLong,
+	Example: nodeDrainExample,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, cmdArgs []string) error { // nolintunparam // incorrectly suggesting unused
+		ctx, cleanup := newNodeCommandContext(cmd, "cmd/bacalhau/node/drain")
+		defer cleanup()
+
+		status, err := getAPIClient().Drain(ctx)
+		if err != nil {
+			log.Error().Msgf("Failure draining node: %s", err)
+			return err
+		}
+
+		if OND.Wait {
+			status, err = waitForNodeToDrain(ctx, time.Duration(OND.WaitTimeout)*time.Second)
+			if err != nil {
+				return err
+			}
+		}
+
+		return printDrainStatus(cmd, status)
+	},
+}
+
+var nodeUncordonCmd = &cobra.Command{
+	Use:   "uncordon",
+	Short: "Let a drained compute node select new jobs again",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, cmdArgs []string) error { // nolintunparam // incorrectly suggesting unused
+		ctx, cleanup := newNodeCommandContext(cmd, "cmd/bacalhau/node/uncordon")
+		defer cleanup()
+
+		status, err := getAPIClient().Uncordon(ctx)
+		if err != nil {
+			log.Error().Msgf("Failure uncordoning node: %s", err)
+			return err
+		}
+
+		return printDrainStatus(cmd, status)
+	},
+}
+
+var nodeStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether a compute node is draining and which shards it is still busy with",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, cmdArgs []string) error { // nolintunparam // incorrectly suggesting unused
+		ctx, cleanup := newNodeCommandContext(cmd, "cmd/bacalhau/node/status")
+		defer cleanup()
+
+		status, err := getAPIClient().DrainStatus(ctx)
+		if err != nil {
+			log.Error().Msgf("Failure getting node drain status: %s", err)
+			return err
+		}
+
+		return printDrainStatus(cmd, status)
+	},
+}
+
+func newNodeCommandContext(cmd *cobra.Command, spanName string) (context.Context, func()) {
+	cm := system.NewCleanupManager()
+	ctx := cmd.Context()
+
+	t := system.GetTracer()
+	ctx, rootSpan := system.NewRootSpan(ctx, t, spanName)
+	cm.RegisterCallback(system.CleanupTraceProvider)
+
+	return ctx, func() {
+		rootSpan.End()
+		cm.Cleanup()
+	}
+}
+
+func waitForNodeToDrain(ctx context.Context, timeout time.Duration) (model.ComputeNodeDrainStatus, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		status, err := getAPIClient().DrainStatus(ctx)
+		if err != nil {
+			return status, err
+		}
+		if status.Drained {
+			return status, nil
+		}
+		if !status.Draining {
+			return status, fmt.Errorf("node %s was uncordoned while waiting for it to drain", status.NodeID)
+		}
+		if time.Now().After(deadline) {
+			return status, fmt.Errorf("timed out waiting for node %s to drain: %d shards left",
+				status.NodeID, len(status.BiddingShards)+len(status.ExecutingShards))
+		}
+		log.Debug().Msgf("Waiting for node %s to drain: %d bidding, %d executing",
+			status.NodeID, len(status.BiddingShards), len(status.ExecutingShards))
+		time.Sleep(time.Millisecond * DrainStatusPollIntervalMillis)
+	}
+}
+
+func printDrainStatus(cmd *cobra.Command, status model.ComputeNodeDrainStatus) error {
+	bytes, err := yaml.Marshal(nodeDrainStatusDescription{
+		NodeID:          status.NodeID,
+		Draining:        status.Draining,
+		Drained:         status.Drained,
+		BiddingShards:   status.BiddingShards,
+		ExecutingShards: status.ExecutingShards,
+	})
+	if err != nil {
+		return err
+	}
+	cmd.Print(string(bytes))
+	return nil
+}
@@ -48,6 +48,7 @@ func init() { //nolint:gochecknoinits // Using init in cobra command is idomatic
 	RootCmd.AddCommand(listCmd)
 	RootCmd.AddCommand(describeCmd)
 	RootCmd.AddCommand(devstackCmd)
+	RootCmd.AddCommand(nodeCmd)
 	RootCmd.PersistentFlags().StringVar(
 		&apiHost, "api-host", defaultAPIHost,
 		`The host for the client and server to communicate on (via REST). Ignored if BACALHAU_API_HOST environment variable is set.`,
@@ -9,6 +9,7 @@ import (
 //nolint:gochecknoinits
 func init() {
 	runCmd.AddCommand(runPythonCmd)
+	runCmd.AddCommand(runNodeCmd)
 }
 
 var runCmd = &cobra.Command{
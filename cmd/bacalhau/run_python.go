@@ -11,7 +11,9 @@ import (
 	"path/filepath"
 	"time"
 
+	executor_language "github.com/filecoin-project/bacalhau/pkg/executor/language"
 	"github.com/filecoin-project/bacalhau/pkg/job"
+	"github.com/filecoin-project/bacalhau/pkg/model"
 	"github.com/filecoin-project/bacalhau/pkg/system"
 	"github.com/filecoin-project/bacalhau/pkg/util/templates"
 	"github.com/rs/zerolog/log"
@@ -27,11 +29,17 @@ var (
 	languageRunExample = templates.Examples(i18n.T(`
 		TBD`))
 
-	OLR = NewLanguageRunOptions()
+	nodeRunLong = templates.LongDesc(i18n.T(`
+		Runs a javascript job with node on the compute node.
+		`))
+
+	OLR     = NewLanguageRunOptions()
+	OLRNode = NewNodeRunOptions()
 )
 
 // LanguageRunOptions declares the arguments accepted by the `'language' run` command
 type LanguageRunOptions struct {
+	Version       string   // The version of the language to run the job with
 	Deterministic bool     // Execute this job deterministically
 	Verifier      string   // Verifier - verifier.Verifier
 	Inputs        []string // Array of input CIDs
@@ -64,6 +72,7 @@ type LanguageRunOptions struct {
 
 func NewLanguageRunOptions() *LanguageRunOptions {
 	return &LanguageRunOptions{
+		Version:          "3.10",
 		Deterministic:    true,
 		Verifier:         "ipfs",
 		Inputs:           []string{},
@@ -80,6 +89,14 @@ func NewLanguageRunOptions() *LanguageRunOptions {
 	}
 }
 
+// node can't run deterministically so it runs on docker
+func NewNodeRunOptions() *LanguageRunOptions {
+	options := NewLanguageRunOptions()
+	options.Version = "20"
+	options.Deterministic = false
+	return options
+}
+
 //nolint:gochecknoinits
 func init() {
 	// determinism flag
@@ -88,57 +105,67 @@ func init() {
 		`Enforce determinism: run job in a single-threaded wasm runtime with `+
 			`no sources of entropy. NB: this will make the python runtime execute`+
 			`in an environment where only some librarie are supported, see `+
-			`https://pyodide.org/en/stable/usage/packages-in-pyodide.html`,
+			`https://pyodide.org/en/stable/usage/packages-in-pyodide.html. `+
+			`Without determinism the job runs in docker and can install packages from pypi.`,
+	)
+	setupLanguageRunFlags(runPythonCmd, OLR, "python")
+	setupLanguageRunFlags(runNodeCmd, OLRNode, "node")
+}
+
+func setupLanguageRunFlags(cmd *cobra.Command, options *LanguageRunOptions, language string) {
+	cmd.PersistentFlags().StringVar(
+		&options.Version, "version", options.Version,
+		fmt.Sprintf(`The version of %s to run the job with`, language),
 	)
-	runPythonCmd.PersistentFlags().StringSliceVarP(
-		&OLR.Inputs, "inputs", "i", OLR.Inputs,
+	cmd.PersistentFlags().StringSliceVarP(
+		&options.Inputs, "inputs", "i", options.Inputs,
 		`CIDs to use on the job. Mounts them at '/inputs' in the execution.`,
 	)
 
-	runPythonCmd.PersistentFlags().StringSliceVarP(
-		&OLR.InputVolumes, "input-volumes", "v", OLR.InputVolumes,
+	cmd.PersistentFlags().StringSliceVarP(
+		&options.InputVolumes, "input-volumes", "v", options.InputVolumes,
 		`CID:path of the input data volumes`,
 	)
-	runPythonCmd.PersistentFlags().StringSliceVarP(
-		&OLR.OutputVolumes, "output-volumes", "o", OLR.OutputVolumes,
+	cmd.PersistentFlags().StringSliceVarP(
+		&options.OutputVolumes, "output-volumes", "o", options.OutputVolumes,
 		`name:path of the output data volumes`,
 	)
-	runPythonCmd.PersistentFlags().StringSliceVarP(
-		&OLR.Env, "env", "e", OLR.Env,
+	cmd.PersistentFlags().StringSliceVarP(
+		&options.Env, "env", "e", options.Env,
 		`The environment variables to supply to the job (e.g. --env FOO=bar --env BAR=baz)`,
 	)
 	// TODO: concurrency should be factored out (at least up to run, maybe
 	// shared with docker and wasm raw commands too)
-	runPythonCmd.PersistentFlags().IntVar(
-		&OLR.Concurrency, "concurrency", OLR.Concurrency,
+	cmd.PersistentFlags().IntVar(
+		&options.Concurrency, "concurrency", options.Concurrency,
 		`How many nodes should run the job`,
 	)
-	runPythonCmd.PersistentFlags().IntVar(
-		&OLR.Confidence, "confidence", OLR.Confidence,
+	cmd.PersistentFlags().IntVar(
+		&options.Confidence, "confidence", options.Confidence,
 		`The minimum number of nodes that must agree on a verification result`,
 	)
-	runPythonCmd.PersistentFlags().StringVarP(
-		&OLR.Command, "command", "c", OLR.Command,
-		`Program passed in as string (like python)`,
+	cmd.PersistentFlags().StringVarP(
+		&options.Command, "command", "c", options.Command,
+		fmt.Sprintf(`Program passed in as string (like %s)`, language),
 	)
-	runPythonCmd.PersistentFlags().StringVarP(
-		&OLR.RequirementsPath, "requirement", "r", OLR.RequirementsPath,
-		`Install from the given requirements file. (like pip)`, // TODO: This option can be used multiple times.
+	cmd.PersistentFlags().StringVarP(
+		&options.RequirementsPath, "requirement", "r", options.RequirementsPath,
+		`Install from the given requirements file (a requirements.txt for python or a package.json for node).`, // TODO: This option can be used multiple times.
 	)
-	runPythonCmd.PersistentFlags().StringVar(
+	cmd.PersistentFlags().StringVar(
 		// TODO: consider replacing this with context-glob, default to
 		// "./**/*.py|./requirements.txt", OR .bacalhau_ignore
-		&OLR.ContextPath, "context-path", OLR.ContextPath,
+		&options.ContextPath, "context-path", options.ContextPath,
 		"Path to context (e.g. python code) to send to server (via public IPFS network) "+
 			"for execution (max 10MiB). Set to empty string to disable",
 	)
-	runPythonCmd.PersistentFlags().StringVar(
-		&OLR.Verifier, "verifier", OLR.Verifier,
+	cmd.PersistentFlags().StringVar(
+		&options.Verifier, "verifier", options.Verifier,
 		`What verification engine to use to run the job`,
 	)
 
-	runPythonCmd.PersistentFlags().StringSliceVarP(
-		&OLR.Labels, "labels", "l", OLR.Labels,
+	cmd.PersistentFlags().StringSliceVarP(
+		&options.Labels, "labels", "l", options.Labels,
 		`List of labels for the job. Enter multiple in the format '-l a -l 2'. All characters not matching /a-zA-Z0-9_:|-/ and all emojis will be stripped.`, //nolint:lll // Documentation, ok if long.
 	)
 }
@@ -154,96 +181,115 @@ var runPythonCmd = &cobra.Command{
 	Long:    languageRunLong,
 	Example: languageRunExample,
 	Args:    cobra.MinimumNArgs(0),
-	RunE: func(cmd *cobra.Command, cmdArgs []string) error { //nolint
-		cm := system.NewCleanupManager()
-		defer cm.Cleanup()
-		ctx := cmd.Context()
-
-		t := system.GetTracer()
-		ctx, rootSpan := system.NewRootSpan(ctx, t, "cmd/bacalhau/list")
-		defer rootSpan.End()
-		cm.RegisterCallback(system.CleanupTraceProvider)
-
-		// error if determinism is false
-		if !OLR.Deterministic {
-			return fmt.Errorf("determinism=false not supported yet " +
-				"(python only supports wasm backend with forced determinism)")
-		}
-
-		// TODO: prepare context
+	RunE: func(cmd *cobra.Command, cmdArgs []string) error {
+		return runLanguage(cmd, cmdArgs, "python", OLR)
+	},
+}
 
-		var programPath string
-		if len(cmdArgs) > 0 {
-			programPath = cmdArgs[0]
-		}
+var runNodeCmd = &cobra.Command{
+	Use:   "node",
+	Short: "Run a javascript job with node on the network",
+	Long:  nodeRunLong,
+	Args:  cobra.MinimumNArgs(0),
+	RunE: func(cmd *cobra.Command, cmdArgs []string) error {
+		return runLanguage(cmd, cmdArgs, "node", OLRNode)
+	},
+}
 
-		if OLR.Command == "" && programPath == "" {
-			return fmt.Errorf("must specify an inline command or a path to a python file")
-		}
+//nolint:funlen,gocyclo
+func runLanguage(cmd *cobra.Command, cmdArgs []string, language string, options *LanguageRunOptions) error {
+	cm := system.NewCleanupManager()
+	defer cm.Cleanup()
+	ctx := cmd.Context()
 
-		for _, i := range ODR.Inputs {
-			OLR.InputVolumes = append(OLR.InputVolumes, fmt.Sprintf("%s:/inputs", i))
-		}
+	t := system.GetTracer()
+	ctx, rootSpan := system.NewRootSpan(ctx, t, fmt.Sprintf("cmd/bacalhau/run/%s", language))
+	defer rootSpan.End()
+	cm.RegisterCallback(system.CleanupTraceProvider)
 
-		//nolint:lll // it's ok to be long
-		// TODO: #450 These two code paths make me nervous - the fact that we have ConstructLanguageJob and ConstructDockerJob as separate means manually keeping them in sync.
-		spec, deal, err := job.ConstructLanguageJob(
-			OLR.InputVolumes,
-			OLR.InputUrls,
-			OLR.OutputVolumes,
-			[]string{}, // no env vars (yet)
-			OLR.Concurrency,
-			OLR.Confidence,
-			OLR.MinBids,
-			"python",
-			"3.10",
-			OLR.Command,
-			programPath,
-			OLR.RequirementsPath,
-			OLR.ContextPath,
-			OLR.Deterministic,
-			OLR.Labels,
-			doNotTrack,
-		)
-		if err != nil {
-			return err
-		}
+	if options.Deterministic && (language != "python" || options.Version != "3.10") {
+		return fmt.Errorf("only python 3.10 can be run deterministically")
+	}
 
-		var buf bytes.Buffer
+	var programPath string
+	if len(cmdArgs) > 0 {
+		programPath = cmdArgs[0]
+	}
 
-		if OLR.ContextPath == "." && OLR.RequirementsPath == "" && programPath == "" {
-			log.Info().Msgf("no program or requirements specified, not uploading context - set --context-path to full path to force context upload")
-			OLR.ContextPath = ""
-		}
+	if options.Command == "" && programPath == "" {
+		return fmt.Errorf("must specify an inline command or a path to a %s file", language)
+	}
 
-		if OLR.ContextPath != "" {
-			// construct a tar file from the contextPath directory
-			// tar + gzip
-			log.Info().Msgf("uploading %s to server to execute command in context, press Ctrl+C to cancel", OLR.ContextPath)
-			time.Sleep(1 * time.Second)
-			err = compress(ctx, OLR.ContextPath, &buf)
-			if err != nil {
-				return err
-			}
+	for _, i := range options.Inputs {
+		options.InputVolumes = append(options.InputVolumes, fmt.Sprintf("%s:/inputs", i))
+	}
 
-			// check size of buf
-			if buf.Len() > 10*1024*1024 {
-				return fmt.Errorf("context tar file is too large (>10MiB)")
-			}
+	//nolint:lll // it's ok to be long
+	// TODO: #450 These two code paths make me nervous - the fact that we have ConstructLanguageJob and ConstructDockerJob as separate means manually keeping them in sync.
+	spec, deal, err := job.ConstructLanguageJob(
+		options.InputVolumes,
+		options.InputUrls,
+		options.OutputVolumes,
+		[]string{}, // no env vars (yet)
+		options.Concurrency,
+		options.Confidence,
+		options.MinBids,
+		language,
+		options.Version,
+		options.Command,
+		programPath,
+		options.RequirementsPath,
+		options.ContextPath,
+		options.Deterministic,
+		options.Labels,
+		doNotTrack,
+	)
+	if err != nil {
+		return err
+	}
 
+	// installing requirements in docker needs the package registry
+	if !options.Deterministic && options.RequirementsPath != "" {
+		spec.Network = model.JobSpecNetwork{
+			Type:      model.NetworkAllowList,
+			AllowList: executor_language.PackageRegistryHosts[language],
 		}
+	}
+
+	var buf bytes.Buffer
 
-		job, err := getAPIClient().Submit(ctx, spec, deal, &buf)
+	if options.ContextPath == "." && options.RequirementsPath == "" && programPath == "" {
+		log.Info().Msgf("no program or requirements specified, not uploading context - set --context-path to full path to force context upload")
+		options.ContextPath = ""
+	}
+
+	if options.ContextPath != "" {
+		// construct a tar file from the contextPath directory
+		// tar + gzip
+		log.Info().Msgf("uploading %s to server to execute command in context, press Ctrl+C to cancel", options.ContextPath)
+		time.Sleep(1 * time.Second)
+		err = compress(ctx, options.ContextPath, &buf)
 		if err != nil {
 			return err
 		}
 
-		log.Debug().Msgf(
-			"submitting job with spec %+v", spec)
+		// check size of buf
+		if buf.Len() > 10*1024*1024 {
+			return fmt.Errorf("context tar file is too large (>10MiB)")
+		}
 
-		cmd.Printf("%s\n", job.ID)
-		return nil
-	},
+	}
+
+	job, err := getAPIClient().Submit(ctx, spec, deal, &buf)
+	if err != nil {
+		return err
+	}
+
+	log.Debug().Msgf(
+		"submitting job with spec %+v", spec)
+
+	cmd.Printf("%s\n", job.ID)
+	return nil
 }
 
 // from https://github.com/mimoo/eureka/blob/master/folders.go under Apache 2
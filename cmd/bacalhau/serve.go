@@ -3,13 +3,24 @@ package bacalhau
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/filecoin-project/bacalhau/pkg/capacitymanager"
 	"github.com/filecoin-project/bacalhau/pkg/computenode"
+	"github.com/filecoin-project/bacalhau/pkg/config"
+	docker_util "github.com/filecoin-project/bacalhau/pkg/docker"
+	"github.com/filecoin-project/bacalhau/pkg/executor/docker"
+	"github.com/filecoin-project/bacalhau/pkg/executor/language"
+	"github.com/filecoin-project/bacalhau/pkg/executor/native"
+	pythonwasm "github.com/filecoin-project/bacalhau/pkg/executor/python_wasm"
 	"github.com/filecoin-project/bacalhau/pkg/ipfs"
 	"github.com/filecoin-project/bacalhau/pkg/node"
 	"github.com/filecoin-project/bacalhau/pkg/requesternode"
+	"github.com/filecoin-project/bacalhau/pkg/storage/cache"
+	"github.com/filecoin-project/bacalhau/pkg/storage/filecoin"
+	"github.com/filecoin-project/bacalhau/pkg/storage/s3"
 
 	"github.com/filecoin-project/bacalhau/pkg/model"
 	"github.com/filecoin-project/bacalhau/pkg/system"
@@ -41,23 +52,48 @@ var (
 )
 
 type ServeOptions struct {
-	PeerConnect                     string // The libp2p multiaddress to connect to.
-	IPFSConnect                     string // The IPFS multiaddress to connect to.
-	FilecoinUnsealedPath            string // The go template that can turn a filecoin CID into a local filepath with the unsealed data.
-	EstuaryAPIKey                   string // The API key used when using the estuary API.
-	HostAddress                     string // The host address to listen on.
-	SwarmPort                       int    // The host port for libp2p network.
-	JobSelectionDataLocality        string // The data locality to use for job selection.
-	JobSelectionDataRejectStateless bool   // Whether to reject jobs that don't specify any data.
-	JobSelectionProbeHTTP           string // The HTTP URL to use for job selection.
-	JobSelectionProbeExec           string // The executable to use for job selection.
-	MetricsPort                     int    // The port to listen on for metrics.
-	LimitTotalCPU                   string // The total amount of CPU the system can be using at one time.
-	LimitTotalMemory                string // The total amount of memory the system can be using at one time.
-	LimitTotalGPU                   string // The total amount of GPU the system can be using at one time.
-	LimitJobCPU                     string // The amount of CPU the system can be using at one time for a single job.
-	LimitJobMemory                  string // The amount of memory the system can be using at one time for a single job.
-	LimitJobGPU                     string // The amount of GPU the system can be using at one time for a single job.
+	PeerConnect                     string        // The libp2p multiaddress to connect to.
+	IPFSConnect                     string        // The IPFS multiaddress to connect to.
+	FilecoinUnsealedPath            string        // The go template that can turn a filecoin CID into a local filepath with the unsealed data.
+	EstuaryAPIKey                   string        // The API key used when using the estuary API.
+	HostAddress                     string        // The host address to listen on.
+	SwarmPort                       int           // The host port for libp2p network.
+	JobSelectionDataLocality        string        // The data locality to use for job selection.
+	JobSelectionDataRejectStateless bool          // Whether to reject jobs that don't specify any data.
+	JobSelectionProbeHTTP           string        // The HTTP URL to use for job selection.
+	JobSelectionProbeExec           string        // The executable to use for job selection.
+	JobSelectionAcceptNetworked     bool          // Whether to accept jobs that require network access.
+	JobSelectionAcceptRelaxations   bool          // Whether to accept jobs that ask for docker security hardening to be relaxed.
+	MetricsPort                     int           // The port to listen on for metrics.
+	ComputeStateDir                 string        // The directory to persist compute shard state in so it survives a restart.
+	CheckpointInterval              time.Duration // How often to upload the checkpoints of running shards.
+	LimitTotalCPU                   string        // The total amount of CPU the system can be using at one time.
+	LimitTotalMemory                string        // The total amount of memory the system can be using at one time.
+	LimitTotalGPU                   string        // The total amount of GPU the system can be using at one time.
+	LimitJobCPU                     string        // The amount of CPU the system can be using at one time for a single job.
+	LimitJobMemory                  string        // The amount of memory the system can be using at one time for a single job.
+	LimitJobGPU                     string        // The amount of GPU the system can be using at one time for a single job.
+
+	JobSelectionImages              computenode.JobSelectionImagePolicy // The docker images we will run.
+	JobSelectionAllowedCapabilities []string                            // The linux capabilities relaxed jobs can keep.
+
+	DockerSecurityProfile   docker.SecurityProfile // The hardening applied to docker job containers.
+	DockerRegistryAuthFile  string                 // A docker config.json with logins for private registries.
+	DockerAllowLocalNetwork bool                   // Whether jobs with a network allow list can reach the node itself.
+	ResolveImageDigests     bool                   // Whether to pin the images of submitted jobs to digests.
+
+	LanguageImages         map[string]string // The docker images non-deterministic language jobs run on.
+	PythonWasmPackageIndex string            // A PEP 503 index that deterministic python jobs get wheels from.
+
+	Native native.ExecutorConfig // Whether and how jobs can run as local processes.
+
+	S3 s3.ClientConfig // The S3 compatible service s3:// inputs are read from and results published to.
+
+	FilecoinRetrieval filecoin.StorageProviderConfig // The lotus client and price limit filecoin inputs are retrieved with.
+
+	InputCacheSize    string // How much disk the inputs of recent jobs can use, 0 turns the cache off.
+	PrefetchInputSize string // How much of the inputs of shards we have bid on to fetch before the bid is accepted.
+	GitRepoCacheSize  string // How much disk the git repositories inputs are checked out from can use.
 }
 
 func NewServeOptions() *ServeOptions {
@@ -69,16 +105,32 @@ func NewServeOptions() *ServeOptions {
 		HostAddress:                     "0.0.0.0",
 		SwarmPort:                       DefaultSwarmPort,
 		MetricsPort:                     2112,
+		ComputeStateDir:                 "",
+		CheckpointInterval:              computenode.DefaultCheckpointInterval,
 		JobSelectionDataLocality:        "local",
 		JobSelectionDataRejectStateless: false,
 		JobSelectionProbeHTTP:           "",
 		JobSelectionProbeExec:           "",
+		JobSelectionAcceptNetworked:     false,
+		JobSelectionAcceptRelaxations:   false,
 		LimitTotalCPU:                   "",
 		LimitTotalMemory:                "",
 		LimitTotalGPU:                   "",
 		LimitJobCPU:                     "",
 		LimitJobMemory:                  "",
 		LimitJobGPU:                     "",
+		DockerSecurityProfile:           docker.NewDefaultSecurityProfile(),
+		DockerRegistryAuthFile:          "",
+		DockerAllowLocalNetwork:         false,
+		ResolveImageDigests:             true,
+		LanguageImages:                  map[string]string{},
+		PythonWasmPackageIndex:          "",
+		Native:                          native.NewDefaultExecutorConfig(),
+		S3:                              s3.NewClientConfigFromEnv(),
+		FilecoinRetrieval:               filecoin.StorageProviderConfig{MaxPrice: filecoin.DefaultMaxPrice},
+		InputCacheSize:                  "10Gb",
+		PrefetchInputSize:               "0",
+		GitRepoCacheSize:                "5Gb",
 	}
 }
 
@@ -99,6 +151,129 @@ func setupJobSelectionCLIFlags(cmd *cobra.Command) {
 		&OS.JobSelectionProbeExec, "job-selection-probe-exec", OS.JobSelectionProbeExec,
 		`Use the result of a exec an external program to decide if we should take on the job.`,
 	)
+	cmd.PersistentFlags().BoolVar(
+		&OS.JobSelectionAcceptNetworked, "job-selection-accept-networked", OS.JobSelectionAcceptNetworked,
+		`Accept jobs that require network access.`,
+	)
+	cmd.PersistentFlags().BoolVar(
+		&OS.JobSelectionAcceptRelaxations, "job-selection-accept-relaxations", OS.JobSelectionAcceptRelaxations,
+		`Accept jobs that ask for some of the docker security hardening to be relaxed.`,
+	)
+	cmd.PersistentFlags().StringSliceVar(
+		&OS.JobSelectionAllowedCapabilities, "job-selection-allowed-capabilities", OS.JobSelectionAllowedCapabilities,
+		`The linux capabilities relaxed jobs can ask to keep (defaults to, and can't be more than, docker's default capabilities).`,
+	)
+	cmd.PersistentFlags().StringSliceVar(
+		&OS.JobSelectionImages.AllowedRegistries, "job-selection-allowed-registries", OS.JobSelectionImages.AllowedRegistries,
+		`Only run images from registries matching these glob patterns (e.g. docker.io,*.mycompany.com).`,
+	)
+	cmd.PersistentFlags().StringSliceVar(
+		&OS.JobSelectionImages.DeniedRegistries, "job-selection-denied-registries", OS.JobSelectionImages.DeniedRegistries,
+		`Never run images from registries matching these glob patterns.`,
+	)
+	cmd.PersistentFlags().StringSliceVar(
+		&OS.JobSelectionImages.AllowedRepositories, "job-selection-allowed-repositories", OS.JobSelectionImages.AllowedRepositories,
+		`Only run images from repositories matching these glob patterns (e.g. ubuntu,ghcr.io/myorg/**).`,
+	)
+	cmd.PersistentFlags().StringSliceVar(
+		&OS.JobSelectionImages.DeniedRepositories, "job-selection-denied-repositories", OS.JobSelectionImages.DeniedRepositories,
+		`Never run images from repositories matching these glob patterns.`,
+	)
+	cmd.PersistentFlags().StringSliceVar(
+		&OS.JobSelectionImages.AllowedDigests, "job-selection-allowed-digests", OS.JobSelectionImages.AllowedDigests,
+		`Only run images pinned to digests matching these glob patterns.`,
+	)
+	cmd.PersistentFlags().StringSliceVar(
+		&OS.JobSelectionImages.DeniedDigests, "job-selection-denied-digests", OS.JobSelectionImages.DeniedDigests,
+		`Never run images with digests matching these glob patterns.`,
+	)
+}
+
+func setupDockerImageCLIFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(
+		&OS.DockerRegistryAuthFile, "docker-registry-auth-file", OS.DockerRegistryAuthFile,
+		`A docker config.json (e.g. ~/.docker/config.json) with the logins to use for private registries.`,
+	)
+	cmd.PersistentFlags().BoolVar(
+		&OS.ResolveImageDigests, "resolve-image-digests", OS.ResolveImageDigests,
+		`Pin the images of submitted docker jobs to the digest their tag points to, so every shard runs the same image.`,
+	)
+}
+
+func setupLanguageCLIFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringToStringVar(
+		&OS.LanguageImages, "language-images", OS.LanguageImages,
+		`The docker images to run non-deterministic language jobs on as language/version=image `+
+			`(e.g. python/3.10=python:3.10-slim). These are added to the built in images.`,
+	)
+	cmd.PersistentFlags().StringVar(
+		&OS.PythonWasmPackageIndex, "python-wasm-package-index", OS.PythonWasmPackageIndex,
+		`A PEP 503 simple package index (e.g. http://localhost:8080/simple) to get pure python wheels from `+
+			`for the requirements of deterministic python jobs that don't vendor them in their context.`,
+	)
+}
+
+func setupNativeCLIFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().BoolVar(
+		&OS.Native.Enabled, "native-executor", OS.Native.Enabled,
+		`Run native jobs as local processes on this node. They are not isolated like docker jobs, `+
+			`so only enable this on clusters that trust their workloads.`,
+	)
+	cmd.PersistentFlags().BoolVar(
+		&OS.Native.MountNamespace, "native-mount-namespace", OS.Native.MountNamespace,
+		`Bind mount the volumes of native jobs at their paths in a private mount namespace (needs root) `+
+			`rather than symlinking them into the job's working dir.`,
+	)
+	cmd.PersistentFlags().StringVar(
+		&OS.Native.CgroupParent, "native-cgroup-parent", OS.Native.CgroupParent,
+		`The cgroup (e.g. bacalhau) native jobs get a child cgroup of to enforce their cpu and memory limits. `+
+			`Limits are not enforced if this is not set.`,
+	)
+}
+
+func setupDockerSecurityCLIFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().BoolVar(
+		&OS.DockerSecurityProfile.DropCapabilities, "docker-drop-capabilities", OS.DockerSecurityProfile.DropCapabilities,
+		`Drop all linux capabilities from job containers apart from the ones given with --docker-keep-capabilities.`,
+	)
+	cmd.PersistentFlags().StringSliceVar(
+		&OS.DockerSecurityProfile.KeepCapabilities, "docker-keep-capabilities", OS.DockerSecurityProfile.KeepCapabilities,
+		`Linux capabilities to keep when dropping capabilities (e.g. CHOWN,SETUID).`,
+	)
+	cmd.PersistentFlags().BoolVar(
+		&OS.DockerSecurityProfile.ReadOnlyRootFS, "docker-read-only-rootfs", OS.DockerSecurityProfile.ReadOnlyRootFS,
+		`Make the root filesystem of job containers read only - jobs can write to the scratch dirs and their outputs.`,
+	)
+	cmd.PersistentFlags().StringSliceVar(
+		&OS.DockerSecurityProfile.ScratchDirs, "docker-scratch-dirs", OS.DockerSecurityProfile.ScratchDirs,
+		`Where to mount writable tmpfs folders in job containers that have a read only root filesystem.`,
+	)
+	cmd.PersistentFlags().StringVar(
+		&OS.DockerSecurityProfile.ScratchSize, "docker-scratch-size", OS.DockerSecurityProfile.ScratchSize,
+		`The most each scratch dir can hold (e.g. 64m, 1g).`,
+	)
+	cmd.PersistentFlags().StringVar(
+		&OS.DockerSecurityProfile.User, "docker-user", OS.DockerSecurityProfile.User,
+		`Run job containers as this user ("uid" or "uid:gid") rather than the user in the image. `+
+			`The node has to be able to chown folders to this user.`,
+	)
+	cmd.PersistentFlags().Int64Var(
+		&OS.DockerSecurityProfile.PidsLimit, "docker-pids-limit", OS.DockerSecurityProfile.PidsLimit,
+		`The most processes a job container can run (0 means no limit).`,
+	)
+	cmd.PersistentFlags().StringVar(
+		&OS.DockerSecurityProfile.SeccompProfile, "docker-seccomp-profile", OS.DockerSecurityProfile.SeccompProfile,
+		`Path to a seccomp profile to use for job containers instead of the docker default.`,
+	)
+	cmd.PersistentFlags().BoolVar(
+		&OS.DockerSecurityProfile.NoNewPrivileges, "docker-no-new-privileges", OS.DockerSecurityProfile.NoNewPrivileges,
+		`Stop processes in job containers from gaining privileges (e.g. via setuid binaries).`,
+	)
+	cmd.PersistentFlags().BoolVar(
+		&OS.DockerAllowLocalNetwork, "docker-allow-local-network", OS.DockerAllowLocalNetwork,
+		`Let jobs with a network allow list reach addresses on this node (e.g. 127.0.0.1) through their egress proxy. `+
+			`Only use this if nothing listening on the node should be kept from jobs.`,
+	)
 }
 
 func setupCapacityManagerCLIFlags(cmd *cobra.Command) {
@@ -158,6 +333,11 @@ func getJobSelectionConfig() computenode.JobSelectionPolicy {
 		RejectStatelessJobs: OS.JobSelectionDataRejectStateless,
 		ProbeHTTP:           OS.JobSelectionProbeHTTP,
 		ProbeExec:           OS.JobSelectionProbeExec,
+		AcceptNetworkedJobs: OS.JobSelectionAcceptNetworked,
+		AcceptRelaxedJobs:   OS.JobSelectionAcceptRelaxations,
+		AllowedCapabilities: OS.JobSelectionAllowedCapabilities,
+		Images:              OS.JobSelectionImages,
+		S3Buckets:           OS.S3.Buckets,
 	}
 
 	return jobSelectionPolicy
@@ -201,6 +381,26 @@ func init() { //nolint:gochecknoinits // Using init in cobra command is idomatic
 		&OS.EstuaryAPIKey, "estuary-api-key", OS.EstuaryAPIKey,
 		`The API key used when using the estuary API.`,
 	)
+	serveCmd.PersistentFlags().StringVar(
+		&OS.S3.Endpoint, "s3-endpoint", OS.S3.Endpoint,
+		`The S3 compatible service to read s3:// inputs from and publish results to (e.g. http://localhost:9000) - defaults to AWS. Credentials are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.`, //nolint:lll // Documentation, ok if long.
+	)
+	serveCmd.PersistentFlags().StringVar(
+		&OS.S3.Region, "s3-region", OS.S3.Region,
+		`The region of the S3 compatible service.`,
+	)
+	serveCmd.PersistentFlags().StringSliceVar(
+		&OS.S3.Buckets, "s3-buckets", OS.S3.Buckets,
+		`The S3 buckets jobs can read inputs from and publish results to with this node's credentials ("*" allows any bucket).`,
+	)
+	serveCmd.PersistentFlags().StringVar(
+		&OS.FilecoinRetrieval.ExecutablePath, "lotus-path", OS.FilecoinRetrieval.ExecutablePath,
+		`The lotus binary filecoin inputs are retrieved with (defaults to lotus on the PATH).`,
+	)
+	serveCmd.PersistentFlags().StringVar(
+		&OS.FilecoinRetrieval.MaxPrice, "filecoin-max-retrieval-price", OS.FilecoinRetrieval.MaxPrice,
+		`The most to pay for a retrieval deal for a filecoin input, in FIL. The default of 0 only allows free retrievals.`,
+	)
 	serveCmd.PersistentFlags().StringVar(
 		&OS.HostAddress, "host", OS.HostAddress,
 		`The host to listen on (for both api and swarm connections).`,
@@ -213,9 +413,33 @@ func init() { //nolint:gochecknoinits // Using init in cobra command is idomatic
 		&OS.MetricsPort, "metrics-port", OS.MetricsPort,
 		`The port to serve prometheus metrics on.`,
 	)
+	serveCmd.PersistentFlags().StringVar(
+		&OS.ComputeStateDir, "compute-state-dir", OS.ComputeStateDir,
+		`The directory to persist the state of running shards in, so they can be resumed after a restart (defaults to a folder in the bacalhau config dir).`,
+	)
+	serveCmd.PersistentFlags().StringVar(
+		&OS.InputCacheSize, "input-cache-size", OS.InputCacheSize,
+		`How much disk the ipfs and url inputs of recent jobs can use so later jobs don't fetch them again (e.g. 500Mb, 10Gb). 0 turns the cache off.`,
+	)
+	serveCmd.PersistentFlags().StringVar(
+		&OS.GitRepoCacheSize, "git-repo-cache-size", OS.GitRepoCacheSize,
+		`How much disk the git repositories that git inputs are checked out from can use before the least recently used are removed (e.g. 5Gb).`,
+	)
+	serveCmd.PersistentFlags().StringVar(
+		&OS.PrefetchInputSize, "prefetch-input-size", OS.PrefetchInputSize,
+		`How much of the inputs of shards we have bid on can be fetched into the input cache before the bid is accepted (e.g. 5Gb). 0 turns prefetching off.`,
+	)
+	serveCmd.PersistentFlags().DurationVar(
+		&OS.CheckpointInterval, "checkpoint-interval", OS.CheckpointInterval,
+		`How often to upload the latest checkpoint of running shards whose jobs write checkpoints.`,
+	)
 
 	setupJobSelectionCLIFlags(serveCmd)
 	setupCapacityManagerCLIFlags(serveCmd)
+	setupDockerSecurityCLIFlags(serveCmd)
+	setupDockerImageCLIFlags(serveCmd)
+	setupLanguageCLIFlags(serveCmd)
+	setupNativeCLIFlags(serveCmd)
 }
 
 var serveCmd = &cobra.Command{
@@ -263,19 +487,85 @@ var serveCmd = &cobra.Command{
 			return err
 		}
 
+		// Persist the state of the shards we are working on so we can
+		// resume them after a restart
+		computeStateDir := OS.ComputeStateDir
+		if computeStateDir == "" {
+			computeStateDir = filepath.Join(config.GetConfigPath(), "compute-state", transport.HostID())
+		}
+		shardStateStore, err := computenode.NewFileShardStateStore(computeStateDir)
+		if err != nil {
+			return err
+		}
+
+		registryCredentials := docker_util.RegistryCredentials{}
+		if OS.DockerRegistryAuthFile != "" {
+			registryCredentials, err = docker_util.LoadRegistryCredentials(OS.DockerRegistryAuthFile)
+			if err != nil {
+				return err
+			}
+		}
+
+		languageImages, err := language.ParseImages(OS.LanguageImages)
+		if err != nil {
+			return err
+		}
+
+		var inputCache *cache.Cache
+		inputCacheSize := capacitymanager.ConvertMemoryString(OS.InputCacheSize)
+		if OS.InputCacheSize != "" && OS.InputCacheSize != "0" && inputCacheSize == 0 {
+			return fmt.Errorf("invalid input-cache-size: %s", OS.InputCacheSize)
+		}
+		if inputCacheSize > 0 {
+			inputCache, err = cache.NewCache(cm, inputCacheSize)
+			if err != nil {
+				return err
+			}
+		}
+
+		prefetchBudget := capacitymanager.ConvertMemoryString(OS.PrefetchInputSize)
+		if OS.PrefetchInputSize != "" && OS.PrefetchInputSize != "0" && prefetchBudget == 0 {
+			return fmt.Errorf("invalid prefetch-input-size: %s", OS.PrefetchInputSize)
+		}
+
+		gitMaxRepoSize := capacitymanager.ConvertMemoryString(OS.GitRepoCacheSize)
+		if gitMaxRepoSize == 0 {
+			return fmt.Errorf("invalid git-repo-cache-size: %s", OS.GitRepoCacheSize)
+		}
+
 		// Create node config from cmd arguments
 		nodeConfig := node.NodeConfig{
 			IPFSClient:           ipfs,
 			CleanupManager:       cm,
 			Transport:            transport,
 			FilecoinUnsealedPath: OS.FilecoinUnsealedPath,
+			S3Config:             OS.S3,
+			InputCache:           inputCache,
+			GitMaxRepoSize:       gitMaxRepoSize,
 			EstuaryAPIKey:        OS.EstuaryAPIKey,
 			HostAddress:          OS.HostAddress,
 			APIPort:              apiPort,
 			MetricsPort:          OS.MetricsPort,
+			DockerConfig: docker.ExecutorConfig{
+				SecurityProfile:     OS.DockerSecurityProfile,
+				RegistryCredentials: registryCredentials,
+				AllowLocalNetwork:   OS.DockerAllowLocalNetwork,
+			},
+			ResolveImageDigests: OS.ResolveImageDigests,
+			LanguageConfig: language.ExecutorConfig{
+				Images: languageImages,
+			},
+			PythonWasmConfig: pythonwasm.ExecutorConfig{
+				PackageIndexURL: OS.PythonWasmPackageIndex,
+			},
+			NativeConfig:            OS.Native,
+			FilecoinRetrievalConfig: OS.FilecoinRetrieval,
 			ComputeNodeConfig: computenode.ComputeNodeConfig{
 				JobSelectionPolicy:    getJobSelectionConfig(),
 				CapacityManagerConfig: getCapacityManagerConfig(),
+				ShardStateStore:       shardStateStore,
+				CheckpointInterval:    OS.CheckpointInterval,
+				PrefetchBudget:        prefetchBudget,
 			},
 			RequesterNodeConfig: requesternode.RequesterNodeConfig{},
 		}
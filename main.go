@@ -5,6 +5,7 @@ import (
 
 	_ "github.com/filecoin-project/bacalhau/pkg/version"
 
+	"github.com/docker/docker/pkg/reexec"
 	"github.com/filecoin-project/bacalhau/cmd/bacalhau"
 	"github.com/filecoin-project/bacalhau/pkg/system"
 	"github.com/joho/godotenv"
@@ -12,6 +13,11 @@ import (
 )
 
 func main() {
+	// the native executor starts jobs through a re-exec of this binary
+	if reexec.Init() {
+		return
+	}
+
 	_ = godotenv.Load()
 	if err := system.InitConfig(); err != nil {
 		log.Error().Msgf("Failed to initialize config: %s", err)
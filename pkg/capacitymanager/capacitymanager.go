@@ -21,6 +21,10 @@ type Config struct {
 	// if a job does not state how much CPU or Memory is used
 	// what values should we assume?
 	ResourceRequirementsDefault model.ResourceUsageConfig
+	// the GPU device IDs we can hand out to jobs
+	// if this is nil we will ask nvidia-container-cli what we have
+	// (setting it is mainly useful to fake a GPU inventory in tests)
+	GPUDevices []string
 }
 
 type CapacityManagerItem struct {
@@ -58,6 +62,9 @@ type CapacityManager struct {
 	resourceLimitsJob              model.ResourceUsageData
 	resourceRequirementsJobDefault model.ResourceUsageData
 
+	// hands out distinct GPU devices to running shards
+	gpuAllocator *GPUAllocator
+
 	capacityTracker CapacityTracker
 }
 
@@ -82,11 +89,26 @@ func NewCapacityManager( //nolint:funlen,gocyclo
 		useConfig.ResourceRequirementsDefault.GPU = DefaultJobGPU
 	}
 
-	resourceLimitsTotal, err := getSystemResources(useConfig.ResourceLimitTotal)
+	gpuDevices := useConfig.GPUDevices
+	if gpuDevices == nil {
+		var err error
+		gpuDevices, err = systemGPUDevices()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resourceLimitsTotal, err := getSystemResourcesWithGPUs(useConfig.ResourceLimitTotal, uint64(len(gpuDevices)))
 	if err != nil {
 		return nil, err
 	}
 
+	// if the total GPU limit is lower than what we have then only
+	// hand out the first devices up to that limit
+	if uint64(len(gpuDevices)) > resourceLimitsTotal.GPU {
+		gpuDevices = gpuDevices[:resourceLimitsTotal.GPU]
+	}
+
 	// this is the per job resource limit - i.e. no job can use more than this
 	// if no values are given - then we will use the system available resources
 	resourceLimitsJob := ParseResourceUsageConfig(useConfig.ResourceLimitJob)
@@ -178,6 +200,7 @@ func NewCapacityManager( //nolint:funlen,gocyclo
 		resourceLimitsTotal:            resourceLimitsTotal,
 		resourceLimitsJob:              resourceLimitsJob,
 		resourceRequirementsJobDefault: resourceRequirementsJobDefault,
+		gpuAllocator:                   NewGPUAllocator(gpuDevices),
 	}, nil
 }
 
@@ -215,6 +238,32 @@ func (manager *CapacityManager) GetFreeSpace() model.ResourceUsageData {
 	return subtractResourceUsage(currentResourceUsage, manager.resourceLimitsTotal)
 }
 
+// the total resources this capacity manager is allowed to hand out
+func (manager *CapacityManager) GetTotalCapacity() model.ResourceUsageData {
+	return manager.resourceLimitsTotal
+}
+
+// reserve distinct GPU devices for a shard that is about to run
+// the devices are held until ReleaseGPUs is called for the same shard
+func (manager *CapacityManager) AllocateGPUs(shard model.JobShard, count uint64) ([]string, error) {
+	return manager.gpuAllocator.Allocate(shard.ID(), count)
+}
+
+// give back the GPU devices held by a shard once it has finished running
+func (manager *CapacityManager) ReleaseGPUs(shard model.JobShard) {
+	manager.gpuAllocator.Release(shard.ID())
+}
+
+// the GPU device IDs this capacity manager can hand out
+func (manager *CapacityManager) GetGPUDevices() []string {
+	return manager.gpuAllocator.Devices()
+}
+
+// map of shard ID to the GPU device IDs currently allocated to it
+func (manager *CapacityManager) GetGPUAllocations() map[string][]string {
+	return manager.gpuAllocator.Allocations()
+}
+
 // get the jobs we have capacity to bid on
 // this is done FIFO order from the order jobs have arrived
 //   - calculate "remaining resources"
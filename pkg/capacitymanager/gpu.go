@@ -0,0 +1,111 @@
+package capacitymanager
+
+import (
+	"fmt"
+	"time"
+
+	sync "github.com/lukemarsden/golang-mutex-tracer"
+)
+
+// GPUAllocator keeps track of which GPU device IDs on this compute node
+// are assigned to which shard, so that two shards running at the same
+// time are never handed the same card.
+type GPUAllocator struct {
+	// the device IDs we are allowed to hand out, in the order we prefer
+	// to hand them out
+	devices []string
+
+	// map of shard ID to the device IDs that shard is currently using
+	allocations map[string][]string
+
+	mu sync.Mutex
+}
+
+func NewGPUAllocator(devices []string) *GPUAllocator {
+	allocator := &GPUAllocator{
+		devices:     append([]string{}, devices...),
+		allocations: map[string][]string{},
+	}
+	allocator.mu.EnableTracerWithOpts(sync.Opts{
+		Threshold: 10 * time.Millisecond,
+		Id:        "GPUAllocator.mu",
+	})
+	return allocator
+}
+
+// Allocate reserves count devices for the given shard and returns their IDs.
+// Asking again for a shard that already holds devices returns the existing
+// allocation so that retries don't leak cards.
+func (a *GPUAllocator) Allocate(shardID string, count uint64) ([]string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if existing, ok := a.allocations[shardID]; ok {
+		return append([]string{}, existing...), nil
+	}
+
+	if count == 0 {
+		return []string{}, nil
+	}
+
+	free := a.freeDevices()
+	if uint64(len(free)) < count {
+		return nil, fmt.Errorf(
+			"not enough free GPUs for shard %s: requested %d, free %d of %d",
+			shardID, count, len(free), len(a.devices),
+		)
+	}
+
+	allocated := free[:count]
+	a.allocations[shardID] = allocated
+	return append([]string{}, allocated...), nil
+}
+
+// Release gives back the devices held by the given shard, if any.
+func (a *GPUAllocator) Release(shardID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.allocations, shardID)
+}
+
+// Devices returns every device ID this allocator manages.
+func (a *GPUAllocator) Devices() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string{}, a.devices...)
+}
+
+// Free returns the device IDs not currently held by any shard.
+func (a *GPUAllocator) Free() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.freeDevices()
+}
+
+// Allocations returns a copy of the map of shard ID to device IDs.
+func (a *GPUAllocator) Allocations() map[string][]string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ret := make(map[string][]string, len(a.allocations))
+	for shardID, devices := range a.allocations {
+		ret[shardID] = append([]string{}, devices...)
+	}
+	return ret
+}
+
+// must be called with the lock held
+func (a *GPUAllocator) freeDevices() []string {
+	used := map[string]bool{}
+	for _, devices := range a.allocations {
+		for _, device := range devices {
+			used[device] = true
+		}
+	}
+	free := []string{}
+	for _, device := range a.devices {
+		if !used[device] {
+			free = append(free, device)
+		}
+	}
+	return free
+}
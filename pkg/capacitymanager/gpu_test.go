@@ -0,0 +1,92 @@
+package capacitymanager
+
+import (
+	"os"
+	"testing"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGPUAllocatorDistinctDevices(t *testing.T) {
+	allocator := NewGPUAllocator([]string{"0", "1", "2"})
+
+	first, err := allocator.Allocate("job1:0", 2)
+	require.NoError(t, err)
+	require.Equal(t, []string{"0", "1"}, first)
+
+	second, err := allocator.Allocate("job2:0", 1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"2"}, second)
+
+	// asking again for the same shard gives back the same devices
+	again, err := allocator.Allocate("job1:0", 2)
+	require.NoError(t, err)
+	require.Equal(t, first, again)
+
+	_, err = allocator.Allocate("job3:0", 1)
+	require.Error(t, err)
+
+	allocator.Release("job1:0")
+	require.Equal(t, []string{"0", "1"}, allocator.Free())
+
+	third, err := allocator.Allocate("job3:0", 1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"0"}, third)
+
+	require.Equal(t, map[string][]string{
+		"job2:0": {"2"},
+		"job3:0": {"0"},
+	}, allocator.Allocations())
+}
+
+func TestGPUAllocatorZeroCount(t *testing.T) {
+	allocator := NewGPUAllocator([]string{})
+
+	devices, err := allocator.Allocate("job1:0", 0)
+	require.NoError(t, err)
+	require.Empty(t, devices)
+}
+
+func TestCapacityManagerFakeGPUInventory(t *testing.T) {
+	os.Setenv("BACALHAU_CAPACITY_MANAGER_OVER_COMMIT", "1")
+	defer os.Setenv("BACALHAU_CAPACITY_MANAGER_OVER_COMMIT", "")
+
+	m, err := NewCapacityManager(&MockCapacityTracker{}, Config{
+		ResourceLimitTotal: model.ResourceUsageConfig{
+			CPU:    "4",
+			Memory: "4Gb",
+			GPU:    "2",
+		},
+		GPUDevices: []string{"0", "1", "2"},
+	})
+	require.NoError(t, err)
+
+	// the total limit caps how many of the devices we hand out
+	require.Equal(t, uint64(2), m.GetTotalCapacity().GPU)
+	require.Equal(t, []string{"0", "1"}, m.GetGPUDevices())
+
+	shard1 := model.JobShard{Job: model.Job{ID: "job1"}, Index: 0}
+	shard2 := model.JobShard{Job: model.Job{ID: "job2"}, Index: 0}
+
+	devices1, err := m.AllocateGPUs(shard1, 1)
+	require.NoError(t, err)
+	devices2, err := m.AllocateGPUs(shard2, 1)
+	require.NoError(t, err)
+	require.NotEqual(t, devices1, devices2)
+
+	m.ReleaseGPUs(shard1)
+	require.Equal(t, map[string][]string{shard2.ID(): devices2}, m.GetGPUAllocations())
+}
+
+func TestParseNvidiaDeviceIDs(t *testing.T) {
+	output := `NVRM version,470.57.02
+CUDA version,11.4
+
+Device Index,Device Minor,Model,Brand,GPU UUID,Bus Location,Architecture
+0,0,Tesla T4,Nvidia,GPU-aaaa,00000000:00:04.0,7.5
+1,1,Tesla T4,Nvidia,GPU-bbbb,00000000:00:05.0,7.5
+`
+	require.Equal(t, []string{"0", "1"}, parseNvidiaDeviceIDs(output))
+	require.Empty(t, parseNvidiaDeviceIDs(""))
+}
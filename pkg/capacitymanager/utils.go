@@ -98,13 +98,23 @@ func getFreeDiskSpace(path string) (uint64, error) {
 
 // numSystemGPUs wraps nvidia-container-cli to get the number of GPUs
 func numSystemGPUs() (uint64, error) {
+	devices, err := systemGPUDevices()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(len(devices)), nil
+}
+
+// systemGPUDevices wraps nvidia-container-cli to get the device IDs of the GPUs
+// these are the indexes docker expects in a DeviceRequest
+func systemGPUDevices() ([]string, error) {
 	nvidiaPath, err := exec.LookPath(NvidiaCLI)
 	if err != nil {
 		// If the NVIDIA CLI is not installed, we can't know the number of GPUs, assume zero
 		if (err.(*exec.Error)).Unwrap() == exec.ErrNotFound {
-			return 0, nil
+			return []string{}, nil
 		}
-		return 0, err
+		return nil, err
 	}
 	args := []string{
 		"info",
@@ -113,13 +123,18 @@ func numSystemGPUs() (uint64, error) {
 	cmd := exec.Command(nvidiaPath, args...)
 	resp, err := cmd.Output()
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
+	return parseNvidiaDeviceIDs(string(resp)), nil
+}
 
-	// Parse output of nvidia-container-cli command
-	lines := strings.Split(string(resp), "\n")
+// Parse output of nvidia-container-cli info --csv
+// the device section starts with a "Device Index" header line
+// and the first column of each following line is the device index
+func parseNvidiaDeviceIDs(output string) []string {
+	lines := strings.Split(output, "\n")
 	deviceInfoFlag := false
-	numDevices := uint64(0)
+	devices := []string{}
 	for _, line := range lines {
 		if strings.TrimSpace(line) == "" {
 			continue
@@ -129,16 +144,28 @@ func numSystemGPUs() (uint64, error) {
 			continue
 		}
 		if deviceInfoFlag {
-			numDevices += 1
+			deviceID := strings.TrimSpace(strings.Split(line, ",")[0])
+			if deviceID == "" {
+				deviceID = strconv.Itoa(len(devices))
+			}
+			devices = append(devices, deviceID)
 		}
 	}
-
-	fmt.Println(numDevices)
-	return numDevices, nil
+	return devices
 }
 
 // what resources does this compute node actually have?
 func getSystemResources(limitConfig model.ResourceUsageConfig) (model.ResourceUsageData, error) {
+	gpus, err := numSystemGPUs()
+	if err != nil {
+		return model.ResourceUsageData{}, err
+	}
+	return getSystemResourcesWithGPUs(limitConfig, gpus)
+}
+
+// same as getSystemResources but with the number of GPUs already known
+// which lets the GPU inventory be faked in tests
+func getSystemResourcesWithGPUs(limitConfig model.ResourceUsageConfig, gpus uint64) (model.ResourceUsageData, error) {
 	// this is used mainly for tests to be deterministic
 	allowOverCommit := os.Getenv("BACALHAU_CAPACITY_MANAGER_OVER_COMMIT") != ""
 
@@ -146,10 +173,6 @@ func getSystemResources(limitConfig model.ResourceUsageConfig) (model.ResourceUs
 	if err != nil {
 		return model.ResourceUsageData{}, err
 	}
-	gpus, err := numSystemGPUs()
-	if err != nil {
-		return model.ResourceUsageData{}, err
-	}
 
 	// the actual resources we have
 	physcialResources := model.ResourceUsageData{
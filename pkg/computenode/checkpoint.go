@@ -0,0 +1,147 @@
+package computenode
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+const DefaultCheckpointInterval = 5 * time.Minute
+
+// withCheckpointVolumes returns the shard with a volume for the job to
+// write checkpoints into and, if the shard has been run before, the latest
+// checkpoint mounted for it to carry on from.
+func (n *ComputeNode) withCheckpointVolumes(ctx context.Context, shard model.JobShard) (model.JobShard, error) {
+	events, err := n.controller.GetJobEvents(ctx, shard.Job.ID)
+	if err != nil {
+		return shard, err
+	}
+
+	// copy the volumes so we don't change the job everyone else sees - the
+	// checkpoint output is removed once the shard has finished so
+	// checkpoints are not part of the results
+	spec := shard.Job.Spec
+	spec.Outputs = append(append([]model.StorageSpec{}, spec.Outputs...), model.StorageSpec{
+		Name: model.CheckpointOutputName,
+		Path: spec.Checkpoint.Path,
+	})
+	if checkpoint, ok := latestCheckpoint(events, shard.Index); ok {
+		log.Info().Msgf("node %s is restoring shard %s from checkpoint %s", n.ID, shard, checkpoint.Cid)
+		checkpoint.Path = spec.Checkpoint.RestorePath
+		spec.Contexts = append(append([]model.StorageSpec{}, spec.Contexts...), checkpoint)
+	}
+	shard.Job.Spec = spec
+	return shard, nil
+}
+
+// the checkpoint most recently uploaded for a shard by any node
+func latestCheckpoint(events []model.JobEvent, shardIndex int) (model.StorageSpec, bool) {
+	var latest model.JobEvent
+	found := false
+	for _, event := range events { //nolint:gocritic
+		if event.EventName != model.JobEventCheckpointed || event.ShardIndex != shardIndex {
+			continue
+		}
+		if !found || event.EventTime.After(latest.EventTime) {
+			latest = event
+			found = true
+		}
+	}
+	return latest.Checkpoint, found
+}
+
+// upload the checkpoints the job writes periodically until the returned
+// function is called, which then removes them from the results
+func (n *ComputeNode) startShardCheckpoints(ctx context.Context, shard model.JobShard, resultsDir string) func() {
+	checkpointDir := filepath.Join(resultsDir, model.CheckpointOutputName)
+	removeCheckpoints := func() {
+		if err := os.RemoveAll(checkpointDir); err != nil {
+			log.Warn().Msgf("node %s could not remove the checkpoints of shard %s: %s", n.ID, shard, err)
+		}
+	}
+	if n.config.CheckpointStorage == nil {
+		log.Warn().Msgf("node %s has no checkpoint storage so shard %s will not be checkpointed", n.ID, shard)
+		return removeCheckpoints
+	}
+
+	interval := n.config.CheckpointInterval
+	if interval <= 0 {
+		interval = DefaultCheckpointInterval
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		// only upload a checkpoint when the job has written a new one
+		lastUploaded := ""
+		for {
+			select {
+			case <-ticker.C:
+				signature := checkpointSignature(checkpointDir)
+				if signature == "" || signature == lastUploaded {
+					continue
+				}
+				err := n.uploadCheckpoint(ctx, shard, checkpointDir)
+				if err != nil {
+					log.Warn().Msgf("node %s failed to upload checkpoint of shard %s: %s", n.ID, shard, err)
+					continue
+				}
+				lastUploaded = signature
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+		removeCheckpoints()
+	}
+}
+
+// upload a copy of the checkpoint folder, so the job can carry on writing
+// to it, and tell the network about it
+func (n *ComputeNode) uploadCheckpoint(ctx context.Context, shard model.JobShard, checkpointDir string) error {
+	snapshotDir, err := os.MkdirTemp("", "bacalhau-checkpoint")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(snapshotDir)
+
+	err = copyDir(checkpointDir, snapshotDir)
+	if err != nil {
+		return fmt.Errorf("could not copy checkpoint: %w", err)
+	}
+	checkpoint, err := n.config.CheckpointStorage.Upload(ctx, snapshotDir)
+	if err != nil {
+		return err
+	}
+	log.Debug().Msgf("node %s uploaded checkpoint %s of shard %s", n.ID, checkpoint.Cid, shard)
+	return n.controller.ShardCheckpointed(ctx, shard.Job.ID, shard.Index, checkpoint)
+}
+
+// checkpointSignature changes whenever a file in the checkpoint folder does
+// and is empty if the job hasn't written a checkpoint yet
+func checkpointSignature(checkpointDir string) string {
+	var signature strings.Builder
+	_ = filepath.Walk(checkpointDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		fmt.Fprintf(&signature, "%s:%d:%d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return signature.String()
+}
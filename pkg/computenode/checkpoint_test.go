@@ -0,0 +1,33 @@
+package computenode
+
+import (
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatestCheckpoint(t *testing.T) {
+	now := time.Now()
+	checkpointed := func(shardIndex int, cid string, at time.Time) model.JobEvent {
+		return model.JobEvent{
+			EventName:  model.JobEventCheckpointed,
+			ShardIndex: shardIndex,
+			EventTime:  at,
+			Checkpoint: model.StorageSpec{Cid: cid},
+		}
+	}
+
+	_, ok := latestCheckpoint([]model.JobEvent{{EventName: model.JobEventBid}}, 0)
+	require.False(t, ok)
+
+	events := []model.JobEvent{
+		checkpointed(0, "second", now.Add(time.Minute)),
+		checkpointed(0, "first", now),
+		checkpointed(1, "other shard", now.Add(time.Hour)),
+	}
+	checkpoint, ok := latestCheckpoint(events, 0)
+	require.True(t, ok)
+	require.Equal(t, "second", checkpoint.Cid)
+}
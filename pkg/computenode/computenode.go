@@ -16,6 +16,7 @@ import (
 	jobutils "github.com/filecoin-project/bacalhau/pkg/job"
 	"github.com/filecoin-project/bacalhau/pkg/model"
 	"github.com/filecoin-project/bacalhau/pkg/publisher"
+	"github.com/filecoin-project/bacalhau/pkg/storage"
 	"github.com/filecoin-project/bacalhau/pkg/system"
 	"github.com/filecoin-project/bacalhau/pkg/verifier"
 	"github.com/prometheus/client_golang/prometheus"
@@ -26,6 +27,7 @@ const DefaultJobCPU = "100m"
 const DefaultJobMemory = "100Mb"
 const ControlLoopIntervalMillis = 100
 const DelayBeforeBidMillisecondRange = 100
+const DefaultHeartbeatInterval = 10 * time.Second
 
 type ComputeNodeConfig struct {
 	// this contains things like data locality and per
@@ -35,6 +37,30 @@ type ComputeNodeConfig struct {
 	// configure the resource capacity we are allowing for
 	// this compute node
 	CapacityManagerConfig capacitymanager.Config
+
+	// where to persist the state of the shards we are working on so
+	// we can resume them after a restart - nil means memory only
+	ShardStateStore ShardStateStore
+
+	// how often to tell the requester we are still running a shard
+	// zero means DefaultHeartbeatInterval
+	HeartbeatInterval time.Duration
+
+	// where to upload the checkpoints of jobs that write them - nil means
+	// checkpoints are not uploaded
+	CheckpointStorage storage.StorageProvider
+
+	// how often to look for a new checkpoint to upload
+	// zero means DefaultCheckpointInterval
+	CheckpointInterval time.Duration
+
+	// where to fetch the inputs of shards we have bid on from before the
+	// bid is accepted - this only helps when they share the input cache
+	// with the executors, nil means inputs are not prefetched
+	PrefetchStorage map[model.StorageSourceType]storage.StorageProvider
+
+	// how many bytes of inputs can be prefetched at once
+	PrefetchBudget uint64
 }
 
 type ComputeNode struct {
@@ -55,11 +81,29 @@ type ComputeNode struct {
 	capacityManager          *capacitymanager.CapacityManager
 	componentMu              sync.Mutex
 	bidMu                    sync.Mutex
+
+	// when draining we don't select any new jobs and only let
+	// the shards we are already running finish
+	draining bool
+	drainMu  sync.Mutex
+
+	// the inputs we are fetching for shards we have bid on
+	prefetches   map[string]*shardPrefetch
+	prefetchUsed uint64
+	prefetchMu   sync.Mutex
+
+	// how much disk pulling each job's image will use, keyed by job ID - the
+	// registry is only asked once for a job however many of its shards we
+	// bid on, and the job is forgotten once we have no shards of it left
+	imageSizes   map[string]uint64
+	imageSizesMu sync.Mutex
 }
 
 func NewDefaultComputeNodeConfig() ComputeNodeConfig {
 	return ComputeNodeConfig{
 		JobSelectionPolicy: NewDefaultJobSelectionPolicy(),
+		HeartbeatInterval:  DefaultHeartbeatInterval,
+		CheckpointInterval: DefaultCheckpointInterval,
 	}
 }
 
@@ -81,6 +125,11 @@ func NewComputeNode(
 		return nil, err
 	}
 
+	err = computeNode.restoreShardStates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	computeNode.subscriptionSetup(ctx)
 	go computeNode.controlLoopSetup(ctx, cm)
 
@@ -101,7 +150,12 @@ func constructComputeNode(
 
 	nodeID := c.HostID()
 
-	shardStateManager, err := NewShardComputeStateMachineManager()
+	err := config.JobSelectionPolicy.Images.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	shardStateManager, err := NewShardComputeStateMachineManager(config.ShardStateStore)
 	if err != nil {
 		return nil, err
 	}
@@ -123,6 +177,8 @@ func constructComputeNode(
 		publishers:               publishers,
 		publishersInstalledCache: map[model.PublisherType]bool{},
 		capacityManager:          capacityManager,
+		prefetches:               map[string]*shardPrefetch{},
+		imageSizes:               map[string]uint64{},
 	}
 
 	computeNode.componentMu.EnableTracerWithOpts(sync.Opts{
@@ -133,6 +189,18 @@ func constructComputeNode(
 		Threshold: 10 * time.Millisecond,
 		Id:        "ComputeNode.bidMu",
 	})
+	computeNode.drainMu.EnableTracerWithOpts(sync.Opts{
+		Threshold: 10 * time.Millisecond,
+		Id:        "ComputeNode.drainMu",
+	})
+	computeNode.prefetchMu.EnableTracerWithOpts(sync.Opts{
+		Threshold: 10 * time.Millisecond,
+		Id:        "ComputeNode.prefetchMu",
+	})
+	computeNode.imageSizesMu.EnableTracerWithOpts(sync.Opts{
+		Threshold: 10 * time.Millisecond,
+		Id:        "ComputeNode.imageSizesMu",
+	})
 
 	return computeNode, nil
 }
@@ -176,6 +244,9 @@ func (n *ComputeNode) controlLoopBidOnJobs(ctx context.Context) {
 	// TODO: #557 Should we trace every control loop, even when there is no work to do?
 	n.bidMu.Lock()
 	defer n.bidMu.Unlock()
+	if n.IsDraining() {
+		return
+	}
 	bidShards := n.capacityManager.GetNextItems()
 
 	if len(bidShards) > 0 {
@@ -260,6 +331,16 @@ func (n *ComputeNode) subscriptionSetup(ctx context.Context) {
 		if jobEvent.EventName == model.JobEventCreated {
 			log.Debug().Msgf("[%s] job created: %s", n.ID, j.ID)
 			n.subscriptionEventCreated(ctx, jobEvent, j)
+		} else if jobEvent.EventName == model.JobEventRescheduled {
+			if jobEvent.TargetNodeID == n.ID {
+				// the shard has been taken off us so stop running it
+				if shardState, ok := n.shardStateManager.Get(model.JobShard{Job: j, Index: jobEvent.ShardIndex}.ID()); ok {
+					shardState.Stop(ctx, jobEvent.Status)
+				}
+			} else {
+				// the shard has been taken off another node so we can bid on it
+				n.subscriptionEventRescheduled(ctx, jobEvent, j)
+			}
 		} else {
 			// we only care if the event is related to us
 			if jobEvent.TargetNodeID != n.ID {
@@ -280,6 +361,9 @@ func (n *ComputeNode) subscriptionSetup(ctx context.Context) {
 				n.subscriptionEventResultsAccepted(ctx, jobEvent, shard)
 			case model.JobEventResultsRejected:
 				n.subscriptionEventResultsRejected(ctx, jobEvent, shard)
+			// the requester has marked the shard as failed on our behalf
+			case model.JobEventError:
+				n.subscriptionEventError(ctx, jobEvent, shard)
 			}
 		}
 	})
@@ -300,6 +384,11 @@ func (n *ComputeNode) subscriptionEventCreated(ctx context.Context, jobEvent mod
 		"client_id": j.ClientID,
 	}).Inc()
 
+	if n.IsDraining() {
+		log.Debug().Msgf("[%s] not selecting job %s because the node is draining", n.ID, j.ID)
+		return
+	}
+
 	Max := func(x, y int) int {
 		if x < y {
 			return y
@@ -364,6 +453,44 @@ func (n *ComputeNode) subscriptionEventCreated(ctx context.Context, jobEvent mod
 	}
 }
 
+/*
+subscriptions -> rescheduled
+*/
+func (n *ComputeNode) subscriptionEventRescheduled(ctx context.Context, jobEvent model.JobEvent, j model.Job) {
+	ctx, span := system.GetTracer().Start(ctx, "pkg/compute/ComputeNode.subscriptionEventRescheduled")
+	defer span.End()
+	system.AddJobIDFromBaggageToSpan(ctx, span)
+	system.AddNodeIDFromBaggageToSpan(ctx, span)
+
+	if n.IsDraining() {
+		log.Debug().Msgf("[%s] not selecting rescheduled job %s because the node is draining", n.ID, j.ID)
+		return
+	}
+
+	selected, processedRequirements, err := n.SelectJob(ctx, JobSelectionPolicyProbeData{
+		NodeID:        n.ID,
+		JobID:         j.ID,
+		Spec:          j.Spec,
+		ExecutionPlan: j.ExecutionPlan,
+	})
+	if err != nil {
+		log.Error().Msgf("Error checking job policy: %v", err)
+		return
+	}
+	if !selected {
+		return
+	}
+
+	err = n.controller.SelectJob(ctx, j.ID)
+	if err != nil {
+		log.Error().Msgf("Error selecting job on host %s: %v", n.ID, err)
+		return
+	}
+	shard := model.JobShard{Job: j, Index: jobEvent.ShardIndex}
+	log.Debug().Msgf("[%s] adding rescheduled shard %s to the backlog", n.ID, shard)
+	n.shardStateManager.RestartShardState(shard, n, processedRequirements)
+}
+
 func hash(s string) int {
 	h := fnv.New32a()
 	h.Write([]byte(s))
@@ -427,7 +554,21 @@ func (n *ComputeNode) subscriptionEventBidAccepted(ctx context.Context, jobEvent
 		"client_id":   shard.Job.ClientID,
 	}).Inc()
 
-	if shardState, ok := n.shardStateManager.Get(shard.ID()); ok {
+	shardState, ok := n.shardStateManager.Get(shard.ID())
+
+	// we may have cancelled the bid because we started draining but the
+	// requester accepted it before hearing about the cancellation - tell it
+	// we won't run the shard so it is not left waiting for us
+	if n.IsDraining() && (!ok || shardState.state() != shardBidding) {
+		log.Debug().Msgf("node %s is draining, refusing accepted bid for shard %s", n.ID, shard)
+		err := n.controller.ShardError(ctx, shard.Job.ID, shard.Index, "compute node is draining")
+		if err != nil {
+			log.Error().Msgf("error reporting refused bid for shard %s: %s", shard, err.Error())
+		}
+		return
+	}
+
+	if ok {
 		shardState.Execute(ctx)
 	} else {
 		log.Error().Msgf("Received bid accepted for unknown shard %s", shard)
@@ -451,6 +592,23 @@ func (n *ComputeNode) subscriptionEventBidRejected(ctx context.Context, jobEvent
 	}
 }
 
+/*
+subscriptions -> error
+*/
+func (n *ComputeNode) subscriptionEventError(ctx context.Context, jobEvent model.JobEvent, shard model.JobShard) {
+	//nolint:ineffassign,staticcheck
+	ctx, span := system.GetTracer().Start(ctx, "pkg/computenode/subscribe.subscriptionEventError")
+	defer span.End()
+	system.AddNodeIDFromBaggageToSpan(ctx, span)
+	system.AddJobIDFromBaggageToSpan(ctx, span)
+
+	// the requester won't take anything more from us for the shard so
+	// there's no point carrying on with it
+	if shardState, ok := n.shardStateManager.Get(shard.ID()); ok {
+		shardState.Stop(ctx, jobEvent.Status)
+	}
+}
+
 func (n *ComputeNode) subscriptionEventResultsAccepted(ctx context.Context, jobEvent model.JobEvent, shard model.JobShard) {
 	//nolint:ineffassign,staticcheck
 	ctx, span := system.GetTracer().Start(ctx, "pkg/computenode/subscribe.subscriptionEventBidRejected")
@@ -512,7 +670,7 @@ func (n *ComputeNode) SelectJob(ctx context.Context, data JobSelectionPolicyProb
 
 	// calculate the disk space we would require if we ran this job
 	// this is asking the executor for GetVolumeSize
-	diskSpace, err := n.getJobDiskspaceRequirements(ctx, data.Spec)
+	diskSpace, err := n.getJobDiskspaceRequirements(ctx, data.JobID, data.Spec)
 	if err != nil {
 		return false, requirements, fmt.Errorf("error getting job disk space requirements: %v", err)
 	}
@@ -531,12 +689,13 @@ func (n *ComputeNode) SelectJob(ctx context.Context, data JobSelectionPolicyProb
 	if !withinCapacityLimits {
 		log.Debug().Msgf("Compute node %s skipped bidding on job because resource requirements were too much: %+v",
 			n.ID, data.Spec)
+		n.forgetImageSize(data.JobID)
 		return false, processedRequirements, nil
 	}
 
 	// decide if we want to take on the job based on
 	// our selection policy
-	acceptedByPolicy, err := ApplyJobSelectionPolicy(
+	acceptedByPolicy, reason, err := ApplyJobSelectionPolicy(
 		ctx,
 		n.config.JobSelectionPolicy,
 		e,
@@ -548,8 +707,15 @@ func (n *ComputeNode) SelectJob(ctx context.Context, data JobSelectionPolicyProb
 	}
 
 	if !acceptedByPolicy {
-		log.Debug().Msgf("Compute node %s skipped bidding on job because policy did not pass: %s",
-			n.ID, data.JobID)
+		log.Debug().Msgf("Compute node %s skipped bidding on job because policy did not pass: %s: %s",
+			n.ID, data.JobID, reason)
+		// leave a note for the operator - the job might not be in our
+		// local db if we are being asked about it directly
+		err = n.controller.RejectJob(ctx, data.JobID, reason)
+		if err != nil {
+			log.Debug().Msgf("Could not record job rejection: %s", err.Error())
+		}
+		n.forgetImageSize(data.JobID)
 		return false, processedRequirements, nil
 	}
 
@@ -588,7 +754,33 @@ func (n *ComputeNode) RunShard(ctx context.Context, shard model.JobShard) ([]byt
 		return shardProposal, err
 	}
 
-	containerRunError := n.RunShardExecution(ctx, shard, resultFolder)
+	// reserve our own GPU devices for this shard so concurrent shards
+	// don't end up on the same card - they are given back once the shard
+	// has finished running
+	requirements := capacitymanager.ParseResourceUsageConfig(shard.Job.Spec.Resources)
+	gpuDevices, err := n.capacityManager.AllocateGPUs(shard, requirements.GPU)
+	if err != nil {
+		return shardProposal, err
+	}
+	defer n.capacityManager.ReleaseGPUs(shard)
+	if len(gpuDevices) > 0 {
+		log.Debug().Msgf("node %s allocated GPUs %v to shard %s", n.ID, gpuDevices, shard)
+		ctx = executor.WithGPUDevices(ctx, gpuDevices)
+	}
+
+	// the job is only given its checkpoint volumes while it runs
+	executionShard := shard
+	stopCheckpoints := func() {}
+	if shard.Job.Spec.Checkpoint.IsEnabled() {
+		executionShard, err = n.withCheckpointVolumes(ctx, shard)
+		if err != nil {
+			return shardProposal, err
+		}
+		stopCheckpoints = n.startShardCheckpoints(ctx, shard, resultFolder)
+	}
+
+	containerRunError := n.RunShardExecution(ctx, executionShard, resultFolder)
+	stopCheckpoints()
 	if containerRunError != nil {
 		jobsFailed.With(prometheus.Labels{
 			"node_id":     n.ID,
@@ -612,6 +804,205 @@ func (n *ComputeNode) RunShard(ctx context.Context, shard model.JobShard) ([]byt
 	return shardProposal, containerRunError
 }
 
+// what the executor measured the shard using - empty if it didn't
+func (n *ComputeNode) getShardResourceUsage(ctx context.Context, shard model.JobShard) model.ResourceUsageMeasurement {
+	resultFolder, err := n.getShardResultPath(ctx, shard)
+	if err != nil {
+		return model.ResourceUsageMeasurement{}
+	}
+	usage, _, err := executor.ReadResourceUsage(resultFolder)
+	if err != nil {
+		log.Warn().Msgf("node %s could not read the resource usage of shard %s: %s", n.ID, shard, err)
+	}
+	return usage
+}
+
+func (n *ComputeNode) getShardResultPath(ctx context.Context, shard model.JobShard) (string, error) {
+	verifier, err := n.getVerifier(ctx, shard.Job.Spec.Verifier)
+	if err != nil {
+		return "", err
+	}
+	return verifier.GetShardResultPath(ctx, shard)
+}
+
+/*
+
+  restore after restart
+
+*/
+// pick up the shards we were working on before the compute node restarted
+func (n *ComputeNode) restoreShardStates(ctx context.Context) error {
+	ctx, span := system.GetTracer().Start(ctx, "pkg/computenode.restoreShardStates")
+	defer span.End()
+
+	records, err := n.shardStateManager.store.List(ctx)
+	if err != nil {
+		return fmt.Errorf("could not list persisted shard states: %w", err)
+	}
+
+	for _, record := range records {
+		// the controller doesn't keep jobs across restarts, so make sure it
+		// knows about this one otherwise we'll ignore events for it
+		_, err = n.controller.GetJob(ctx, record.Shard.Job.ID)
+		if err != nil {
+			err = n.controller.GetLocalDB().AddJob(ctx, record.Shard.Job)
+			if err != nil {
+				return fmt.Errorf("could not restore job %s: %w", record.Shard.Job.ID, err)
+			}
+		}
+		err = n.shardStateManager.ResumeShardState(record, n)
+		if err != nil {
+			log.Error().Msgf("node %s could not resume shard %s: %s", n.ID, record.Shard, err)
+		}
+	}
+	return nil
+}
+
+// wait for a shard that was running before the restart to finish and
+// return the proposal for its results
+func (n *ComputeNode) ReattachShard(ctx context.Context, shard model.JobShard, oldResultsDir string) ([]byte, error) {
+	e, err := n.getExecutor(ctx, shard.Job.Spec.Engine)
+	if err != nil {
+		return nil, err
+	}
+	reattacher, ok := e.(executor.ShardReattacher)
+	if !ok {
+		return nil, fmt.Errorf("executor %s cannot reattach to shard %s after a restart", shard.Job.Spec.Engine, shard)
+	}
+
+	// the execution is still writing its outputs to the old results folder
+	stopCheckpoints := func() {}
+	if shard.Job.Spec.Checkpoint.IsEnabled() {
+		stopCheckpoints = n.startShardCheckpoints(ctx, shard, oldResultsDir)
+	}
+	found, err := reattacher.ReattachShard(ctx, shard, oldResultsDir)
+	stopCheckpoints()
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("execution of shard %s was lost when the compute node restarted", shard)
+	}
+
+	resultFolder, err := n.restoreShardResults(ctx, shard, oldResultsDir)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := n.getVerifier(ctx, shard.Job.Spec.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	return verifier.GetShardProposal(ctx, shard, resultFolder)
+}
+
+// copy results written before the restart into the folder the verifier
+// now uses for the shard, returning that folder
+func (n *ComputeNode) restoreShardResults(ctx context.Context, shard model.JobShard, oldResultsDir string) (string, error) {
+	resultFolder, err := n.getShardResultPath(ctx, shard)
+	if err != nil {
+		return "", err
+	}
+	if oldResultsDir == "" || oldResultsDir == resultFolder {
+		return resultFolder, nil
+	}
+	err = copyDir(oldResultsDir, resultFolder)
+	if err != nil {
+		return "", fmt.Errorf("could not restore results of shard %s: %w", shard, err)
+	}
+	return resultFolder, nil
+}
+
+// the latest thing the storage providers have said about preparing the
+// inputs of a running shard
+type inputProgress struct {
+	mu     sync.Mutex
+	latest string
+}
+
+func (p *inputProgress) set(progress string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.latest = progress
+}
+
+func (p *inputProgress) get() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.latest
+}
+
+// send a heartbeat for the shard straight away and then periodically until
+// the returned function is called, so the requester knows we are alive
+func (n *ComputeNode) startShardHeartbeat(ctx context.Context, shard model.JobShard, inputs *inputProgress) func() {
+	interval := n.config.HeartbeatInterval
+	if interval <= 0 {
+		interval = DefaultHeartbeatInterval
+	}
+
+	started := time.Now()
+	sendHeartbeat := func() {
+		status := fmt.Sprintf("running for %s", time.Since(started).Round(time.Second))
+		// the progress goes first so that it can be parsed back out of the status
+		progress, ok := n.getShardProgress(ctx, shard)
+		// until the job says otherwise it is waiting for its inputs
+		if !ok && inputs != nil {
+			progress = model.ParseShardProgress(inputs.get())
+			ok = !progress.IsEmpty()
+		}
+		if ok {
+			status = fmt.Sprintf("%s (%s)", progress, status)
+		}
+		err := n.controller.ShardRunning(ctx, shard.Job.ID, shard.Index, status)
+		if err != nil {
+			log.Warn().Msgf("node %s failed to send heartbeat for shard %s: %s", n.ID, shard, err)
+		}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		sendHeartbeat()
+		for {
+			select {
+			case <-ticker.C:
+				sendHeartbeat()
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// wait for the goroutine to exit so no heartbeat is sent after
+	// we've told the requester the shard has finished
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// ask the executor how far through the shard the job says it is
+func (n *ComputeNode) getShardProgress(ctx context.Context, shard model.JobShard) (model.ShardProgress, bool) {
+	e, err := n.getExecutor(ctx, shard.Job.Spec.Engine)
+	if err != nil {
+		return model.ShardProgress{}, false
+	}
+	reporter, ok := e.(executor.ShardProgressReporter)
+	if !ok {
+		return model.ShardProgress{}, false
+	}
+	progress, ok, err := reporter.GetShardProgress(ctx, shard)
+	if err != nil {
+		log.Debug().Msgf("node %s could not get progress of shard %s: %s", n.ID, shard, err)
+		return model.ShardProgress{}, false
+	}
+	return progress, ok
+}
+
 func (n *ComputeNode) PublishShard(ctx context.Context, shard model.JobShard) error {
 	verifier, err := n.getVerifier(ctx, shard.Job.Spec.Verifier)
 	if err != nil {
@@ -636,6 +1027,86 @@ func (n *ComputeNode) PublishShard(ctx context.Context, shard model.JobShard) er
 	return nil
 }
 
+/*
+
+  drain
+
+*/
+// Drain stops this compute node from selecting new jobs.
+// Shards we have selected but not yet bid on are dropped, bids that have
+// not been answered yet are cancelled and running shards are left to finish.
+func (n *ComputeNode) Drain(ctx context.Context) model.ComputeNodeDrainStatus {
+	// stop the control loop from bidding while we hand back the shards
+	n.bidMu.Lock()
+	defer n.bidMu.Unlock()
+
+	func() {
+		n.drainMu.Lock()
+		defer n.drainMu.Unlock()
+		n.draining = true
+	}()
+	log.Info().Msgf("compute node %s is draining", n.ID)
+
+	for _, shardState := range n.shardStateManager.GetEnqueued() {
+		shardState.Fail(ctx, "compute node is draining")
+	}
+	for _, shardState := range n.shardStateManager.GetBidding() {
+		shardState.CancelBid(ctx)
+	}
+
+	return n.GetDrainStatus(ctx)
+}
+
+// Uncordon lets a drained compute node select new jobs again.
+func (n *ComputeNode) Uncordon(ctx context.Context) model.ComputeNodeDrainStatus {
+	func() {
+		n.drainMu.Lock()
+		defer n.drainMu.Unlock()
+		n.draining = false
+	}()
+	log.Info().Msgf("compute node %s is accepting jobs again", n.ID)
+	return n.GetDrainStatus(ctx)
+}
+
+func (n *ComputeNode) IsDraining() bool {
+	n.drainMu.Lock()
+	defer n.drainMu.Unlock()
+	return n.draining
+}
+
+// GetDrainStatus reports which shards are still keeping a draining node busy.
+func (n *ComputeNode) GetDrainStatus(ctx context.Context) model.ComputeNodeDrainStatus {
+	biddingShards := []string{}
+	for _, shardState := range n.shardStateManager.GetBidding() {
+		biddingShards = append(biddingShards, shardState.Shard.ID())
+	}
+	executingShards := []string{}
+	for _, shardState := range n.shardStateManager.GetExecuting() {
+		executingShards = append(executingShards, shardState.Shard.ID())
+	}
+	draining := n.IsDraining()
+	return model.ComputeNodeDrainStatus{
+		NodeID:          n.ID,
+		Draining:        draining,
+		Drained:         draining && len(biddingShards) == 0 && len(executingShards) == 0,
+		BiddingShards:   biddingShards,
+		ExecutingShards: executingShards,
+	}
+}
+
+// GetNodeInfo reports the capacity of this compute node and which
+// GPU devices are allocated to which running shards
+func (n *ComputeNode) GetNodeInfo(ctx context.Context) model.ComputeNodeInfo {
+	return model.ComputeNodeInfo{
+		NodeID:         n.ID,
+		Draining:       n.IsDraining(),
+		TotalCapacity:  n.capacityManager.GetTotalCapacity(),
+		FreeCapacity:   n.capacityManager.GetFreeSpace(),
+		GPUDevices:     n.capacityManager.GetGPUDevices(),
+		GPUAllocations: n.capacityManager.GetGPUAllocations(),
+	}
+}
+
 //nolint:dupl // methods are not duplicates
 func (n *ComputeNode) getExecutor(ctx context.Context, typ model.EngineType) (executor.Executor, error) {
 	e := func() *executor.Executor {
@@ -655,7 +1126,10 @@ func (n *ComputeNode) getExecutor(ctx context.Context, typ model.EngineType) (ex
 	executorEngine := *e
 
 	// cache it being installed so we're not hammering it
-	if n.executorsInstalledCache[typ] {
+	n.componentMu.Lock()
+	installedCached := n.executorsInstalledCache[typ]
+	n.componentMu.Unlock()
+	if installedCached {
 		return executorEngine, nil
 	}
 
@@ -667,7 +1141,9 @@ func (n *ComputeNode) getExecutor(ctx context.Context, typ model.EngineType) (ex
 		return nil, fmt.Errorf("executor is not installed: %s", typ.String())
 	}
 
+	n.componentMu.Lock()
 	n.executorsInstalledCache[typ] = true
+	n.componentMu.Unlock()
 
 	return executorEngine, nil
 }
@@ -691,7 +1167,10 @@ func (n *ComputeNode) getVerifier(ctx context.Context, typ model.VerifierType) (
 	verifier := *v
 
 	// cache it being installed so we're not hammering it
-	if n.verifiersInstalledCache[typ] {
+	n.componentMu.Lock()
+	installedCached := n.verifiersInstalledCache[typ]
+	n.componentMu.Unlock()
+	if installedCached {
 		return verifier, nil
 	}
 
@@ -703,7 +1182,9 @@ func (n *ComputeNode) getVerifier(ctx context.Context, typ model.VerifierType) (
 		return nil, fmt.Errorf("verifier is not installed: %s", typ.String())
 	}
 
+	n.componentMu.Lock()
 	n.verifiersInstalledCache[typ] = true
+	n.componentMu.Unlock()
 
 	return verifier, nil
 }
@@ -727,7 +1208,10 @@ func (n *ComputeNode) getPublisher(ctx context.Context, typ model.PublisherType)
 	publisher := *p
 
 	// cache it being installed so we're not hammering it
-	if n.publishersInstalledCache[typ] {
+	n.componentMu.Lock()
+	installedCached := n.publishersInstalledCache[typ]
+	n.componentMu.Unlock()
+	if installedCached {
 		return publisher, nil
 	}
 
@@ -739,12 +1223,14 @@ func (n *ComputeNode) getPublisher(ctx context.Context, typ model.PublisherType)
 		return nil, fmt.Errorf("verifier is not installed: %s", typ.String())
 	}
 
+	n.componentMu.Lock()
 	n.publishersInstalledCache[typ] = true
+	n.componentMu.Unlock()
 
 	return publisher, nil
 }
 
-func (n *ComputeNode) getJobDiskspaceRequirements(ctx context.Context, spec model.JobSpec) (uint64, error) {
+func (n *ComputeNode) getJobDiskspaceRequirements(ctx context.Context, jobID string, spec model.JobSpec) (uint64, error) {
 	e, err := n.getExecutor(ctx, spec.Engine)
 	if err != nil {
 		return 0, err
@@ -760,5 +1246,46 @@ func (n *ComputeNode) getJobDiskspaceRequirements(ctx context.Context, spec mode
 		total += volumeSize
 	}
 
+	// the image has to fit on disk too - if the registry won't tell us how
+	// big it is we find out when we pull it
+	if sizer, ok := e.(executor.ImageSizer); ok {
+		total += n.getImageSize(ctx, jobID, sizer, spec)
+	}
+
 	return total, nil
 }
+
+// getImageSize asks the executor how big the job's image is the first time
+// we look at the job, and remembers the answer for as long as we have shards
+// of it - asking means a round trip to the registry, and we look again every
+// time one of the job's shards is rescheduled.
+func (n *ComputeNode) getImageSize(ctx context.Context, jobID string, sizer executor.ImageSizer, spec model.JobSpec) uint64 {
+	n.imageSizesMu.Lock()
+	imageSize, ok := n.imageSizes[jobID]
+	n.imageSizesMu.Unlock()
+	if ok {
+		return imageSize
+	}
+
+	// don't hold up other jobs while we wait for the registry
+	imageSize, err := sizer.GetImageSize(ctx, spec)
+	if err != nil {
+		// try again next time in case the registry was just unavailable
+		log.Warn().Msgf("Could not get the image size for job: %s", err.Error())
+		return imageSize
+	}
+	n.imageSizesMu.Lock()
+	n.imageSizes[jobID] = imageSize
+	n.imageSizesMu.Unlock()
+	return imageSize
+}
+
+// forgetImageSize drops the image size we remembered for a job once we have
+// no shards of it left.
+func (n *ComputeNode) forgetImageSize(jobID string) {
+	n.imageSizesMu.Lock()
+	defer n.imageSizesMu.Unlock()
+	if !n.shardStateManager.HasJob(jobID) {
+		delete(n.imageSizes, jobID)
+	}
+}
@@ -0,0 +1,109 @@
+package computenode
+
+import (
+	"fmt"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/docker/distribution/reference"
+)
+
+// JobSelectionImagePolicy restricts which docker images a compute node will
+// run. Every field is a list of glob patterns ("*" matches within a path
+// segment, "**" across them). An image is rejected if it matches any of the
+// denied patterns, or if an allow list is given and it matches nothing in it.
+type JobSelectionImagePolicy struct {
+	// registries e.g. "docker.io" or "*.mycompany.com"
+	AllowedRegistries []string `json:"allowed_registries,omitempty"`
+	DeniedRegistries  []string `json:"denied_registries,omitempty"`
+	// repositories with or without the registry e.g. "ubuntu",
+	// "library/*" or "ghcr.io/myorg/**"
+	AllowedRepositories []string `json:"allowed_repositories,omitempty"`
+	DeniedRepositories  []string `json:"denied_repositories,omitempty"`
+	// digests e.g. "sha256:abc..." - if any digests are allowed then images
+	// that aren't pinned to a digest are rejected
+	AllowedDigests []string `json:"allowed_digests,omitempty"`
+	DeniedDigests  []string `json:"denied_digests,omitempty"`
+}
+
+func (p JobSelectionImagePolicy) IsEmpty() bool {
+	return len(p.AllowedRegistries) == 0 && len(p.DeniedRegistries) == 0 &&
+		len(p.AllowedRepositories) == 0 && len(p.DeniedRepositories) == 0 &&
+		len(p.AllowedDigests) == 0 && len(p.DeniedDigests) == 0
+}
+
+// check returns why the image is rejected or an empty string if it isn't
+func (p JobSelectionImagePolicy) check(image string) string {
+	if p.IsEmpty() {
+		return ""
+	}
+
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return fmt.Sprintf("the image %q is not a valid image reference", image)
+	}
+
+	registry := reference.Domain(named)
+	if reason := checkImageRule("registry", registry, []string{registry}, p.AllowedRegistries, p.DeniedRegistries); reason != "" {
+		return reason
+	}
+
+	// people write repositories all sorts of ways so we match all of them
+	// e.g. "ubuntu", "library/ubuntu" and "docker.io/library/ubuntu"
+	repositories := []string{reference.FamiliarName(named), reference.Path(named), named.Name()}
+	if reason := checkImageRule("repository", named.Name(), repositories, p.AllowedRepositories, p.DeniedRepositories); reason != "" {
+		return reason
+	}
+
+	digest := ""
+	if canonical, ok := named.(reference.Canonical); ok {
+		digest = canonical.Digest().String()
+	}
+	if digest == "" {
+		if len(p.AllowedDigests) > 0 {
+			return fmt.Sprintf("the image %s is not pinned to a digest and the policy only allows certain digests", image)
+		}
+		return ""
+	}
+	return checkImageRule("digest", digest, []string{digest}, p.AllowedDigests, p.DeniedDigests)
+}
+
+// check the different ways of writing one part of an image name against
+// the allow and deny patterns for it
+func checkImageRule(part, display string, values, allowed, denied []string) string {
+	if pattern := matchAnyPattern(denied, values); pattern != "" {
+		return fmt.Sprintf("the image %s %s is denied by the pattern %q", part, display, pattern)
+	}
+	if len(allowed) > 0 && matchAnyPattern(allowed, values) == "" {
+		return fmt.Sprintf("the image %s %s is not in the allowed %s patterns", part, display, part)
+	}
+	return ""
+}
+
+// returns the first pattern that matches any of the values
+func matchAnyPattern(patterns, values []string) string {
+	for _, pattern := range patterns {
+		for _, value := range values {
+			// a bad pattern just doesn't match - we check them when the node starts
+			if matched, _ := doublestar.Match(pattern, value); matched {
+				return pattern
+			}
+		}
+	}
+	return ""
+}
+
+// Validate makes sure all the patterns are valid globs.
+func (p JobSelectionImagePolicy) Validate() error {
+	for _, patterns := range [][]string{
+		p.AllowedRegistries, p.DeniedRegistries,
+		p.AllowedRepositories, p.DeniedRepositories,
+		p.AllowedDigests, p.DeniedDigests,
+	} {
+		for _, pattern := range patterns {
+			if !doublestar.ValidatePattern(pattern) {
+				return fmt.Errorf("invalid image pattern: %q", pattern)
+			}
+		}
+	}
+	return nil
+}
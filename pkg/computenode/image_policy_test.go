@@ -0,0 +1,50 @@
+package computenode
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testDigest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+
+func TestJobSelectionImagePolicy(t *testing.T) {
+	testCases := []struct {
+		name     string
+		policy   JobSelectionImagePolicy
+		image    string
+		accepted bool
+	}{
+		{"empty policy", JobSelectionImagePolicy{}, "anything/goes:latest", true},
+		{"allowed registry", JobSelectionImagePolicy{AllowedRegistries: []string{"docker.io"}}, "ubuntu", true},
+		{"registry not allowed", JobSelectionImagePolicy{AllowedRegistries: []string{"docker.io"}}, "ghcr.io/org/app", false},
+		{"registry glob", JobSelectionImagePolicy{AllowedRegistries: []string{"*.example.com"}}, "registry.example.com/app", true},
+		{"denied registry", JobSelectionImagePolicy{DeniedRegistries: []string{"ghcr.io"}}, "ghcr.io/org/app", false},
+		{"familiar repository", JobSelectionImagePolicy{AllowedRepositories: []string{"ubuntu"}}, "ubuntu:22.04", true},
+		{"library repository", JobSelectionImagePolicy{AllowedRepositories: []string{"library/*"}}, "ubuntu", true},
+		{"full repository", JobSelectionImagePolicy{AllowedRepositories: []string{"ghcr.io/org/**"}}, "ghcr.io/org/team/app", true},
+		{"single segment glob", JobSelectionImagePolicy{AllowedRepositories: []string{"ghcr.io/org/*"}}, "ghcr.io/org/team/app", false},
+		{"deny wins", JobSelectionImagePolicy{
+			AllowedRepositories: []string{"org/**"},
+			DeniedRepositories:  []string{"org/miner"},
+		}, "org/miner", false},
+		{"allowed digest", JobSelectionImagePolicy{AllowedDigests: []string{testDigest}}, "ubuntu@" + testDigest, true},
+		{"unpinned with allowed digests", JobSelectionImagePolicy{AllowedDigests: []string{testDigest}}, "ubuntu", false},
+		{"denied digest", JobSelectionImagePolicy{DeniedDigests: []string{"sha256:1*"}}, "ubuntu:22.04@" + testDigest, false},
+		{"invalid image", JobSelectionImagePolicy{AllowedRegistries: []string{"**"}}, "Not A Valid Image", false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			reason := testCase.policy.check(testCase.image)
+			if testCase.accepted {
+				require.Empty(t, reason)
+			} else {
+				require.NotEmpty(t, reason)
+			}
+		})
+	}
+
+	require.Error(t, JobSelectionImagePolicy{DeniedRepositories: []string{"[unclosed"}}.Validate())
+	require.NoError(t, JobSelectionImagePolicy{DeniedRepositories: []string{"org/**"}}.Validate())
+}
@@ -4,12 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"os/exec"
 	"strings"
 
 	"github.com/filecoin-project/bacalhau/pkg/executor"
 	"github.com/filecoin-project/bacalhau/pkg/model"
+	s3storage "github.com/filecoin-project/bacalhau/pkg/storage/s3"
 	"github.com/rs/zerolog/log"
 )
 
@@ -29,6 +31,24 @@ type JobSelectionPolicy struct {
 	// should we reject jobs that don't specify any data
 	// the default is "accept"
 	RejectStatelessJobs bool `json:"reject_stateless_jobs"`
+	// should we accept jobs that want network access
+	// the default is "reject" - this is checked before any probes run
+	AcceptNetworkedJobs bool `json:"accept_networked_jobs"`
+	// should we accept docker jobs that ask for some of our security
+	// hardening to be relaxed
+	// the default is "reject" - this is checked before any probes run
+	AcceptRelaxedJobs bool `json:"accept_relaxed_jobs"`
+	// the linux capabilities a relaxed job can ask to keep
+	// the default is docker's default capabilities, and jobs can't have
+	// anything outside of those whatever this says
+	AllowedCapabilities []string `json:"allowed_capabilities,omitempty"`
+	// which docker images we are willing to run
+	// this is checked before any probes run
+	Images JobSelectionImagePolicy `json:"images"`
+	// the s3 buckets jobs can read inputs from and publish results to with
+	// our credentials - "*" allows any bucket
+	// this is checked before any probes run
+	S3Buckets []string `json:"s3_buckets,omitempty"`
 	// external hooks that decide if we should take on the job or not
 	// if either of these are given they will override the data locality settings
 	ProbeHTTP string `json:"probe_http,omitempty"`
@@ -107,22 +127,22 @@ func applyJobSelectionPolicySettings(
 	policy JobSelectionPolicy,
 	e executor.Executor,
 	job model.JobSpec,
-) (bool, error) {
+) (bool, string, error) {
 	// Accept jobs where there are no cids specified
 	// if policy.RejectStatelessJobs is set then we reject this job
 	if len(job.Inputs) == 0 {
 		if policy.RejectStatelessJobs {
 			log.Trace().Msgf("Found policy of RejectStatelessJobs - rejecting job")
-			return false, nil
+			return false, "the job has no inputs and the policy rejects stateless jobs", nil
 		} else {
-			return true, nil
+			return true, "", nil
 		}
 	}
 
 	// if we have an "anywhere" policy for the data then we accept the job
 	if policy.Locality == Anywhere {
 		log.Trace().Msgf("Found policy of anywhere - accepting job")
-		return true, nil
+		return true, "", nil
 	}
 
 	// otherwise we are checking that all of the named inputs in the job
@@ -134,7 +154,7 @@ func applyJobSelectionPolicySettings(
 		hasStorage, err := e.HasStorageLocally(ctx, input)
 		if err != nil {
 			log.Error().Msgf("Error checking for storage resource locality: %s", err.Error())
-			return false, err
+			return false, "", err
 		}
 		if hasStorage {
 			foundInputs++
@@ -143,27 +163,114 @@ func applyJobSelectionPolicySettings(
 
 	if foundInputs >= len(job.Inputs) {
 		log.Trace().Msgf("Found %d of %d inputs - accepting job", foundInputs, len(job.Inputs))
-		return true, nil
+		return true, "", nil
 	} else {
 		log.Trace().Msgf("Found %d of %d inputs - passing on job", foundInputs, len(job.Inputs))
-		return false, nil
+		return false, fmt.Sprintf("only %d of %d inputs are local and the policy only accepts local data", foundInputs, len(job.Inputs)), nil
+	}
+}
+
+// the rules that apply whatever else the policy says - they are checked
+// before any probes get to see the job
+// returns why the job was rejected or an empty string if it wasn't
+func applyJobSelectionPolicyRules(policy JobSelectionPolicy, job model.JobSpec, image string) string {
+	if job.Network.Type != model.NetworkNone && !policy.AcceptNetworkedJobs {
+		return fmt.Sprintf("the job wants %s network access but the policy does not accept networked jobs", job.Network.Type)
+	}
+
+	if !job.Docker.Relaxations.IsEmpty() && !policy.AcceptRelaxedJobs {
+		return fmt.Sprintf("the job asks for security relaxations %+v but the policy does not accept them", job.Docker.Relaxations)
+	}
+
+	allowedCapabilities := policy.AllowedCapabilities
+	if len(allowedCapabilities) == 0 {
+		allowedCapabilities = model.DefaultDockerCapabilities
+	}
+	for _, capability := range job.Docker.Relaxations.Capabilities {
+		if !model.HasCapability(model.DefaultDockerCapabilities, capability) ||
+			!model.HasCapability(allowedCapabilities, capability) {
+			return fmt.Sprintf("the job asks for the %s capability but the policy does not allow it", capability)
+		}
+	}
+
+	if reason := checkS3Buckets(policy.S3Buckets, job); reason != "" {
+		return reason
+	}
+
+	if job.Engine == model.EngineDocker || image != "" {
+		return policy.Images.check(image)
 	}
+
+	return ""
+}
+
+// checkS3Buckets returns why the job can't have the s3 buckets it reads
+// from or publishes to, or "" if it uses none we don't allow.
+func checkS3Buckets(buckets []string, job model.JobSpec) string {
+	for _, input := range append(append([]model.StorageSpec{}, job.Inputs...), job.Contexts...) {
+		if input.Engine != model.StorageSourceS3 {
+			continue
+		}
+		bucket, _, err := s3storage.ParseURL(input.URL)
+		if err != nil {
+			return fmt.Sprintf("the job reads from an invalid s3 url %s: %s", input.URL, err)
+		}
+		if !s3storage.AllowsBucket(buckets, bucket) {
+			return fmt.Sprintf("the job reads from the s3 bucket %s but the policy does not allow it", bucket)
+		}
+	}
+	if job.Publisher == model.PublisherS3 && !s3storage.AllowsBucket(buckets, job.S3Publisher.Bucket) {
+		return fmt.Sprintf("the job publishes to the s3 bucket %s but the policy does not allow it", job.S3Publisher.Bucket)
+	}
+	return ""
+}
+
+// jobImage returns the docker image the job will run in, including the
+// images executors like the language one pick for the jobs they run on
+// docker - "" if the job doesn't run in one.
+func jobImage(ctx context.Context, e executor.Executor, job model.JobSpec) (string, error) {
+	if job.Engine == model.EngineDocker {
+		return job.Docker.Image, nil
+	}
+	if imager, ok := e.(executor.JobImager); ok {
+		return imager.GetJobImage(ctx, job)
+	}
+	return "", nil
 }
 
 // the compute node "SelectJob" function will call out to this to handle
 // applying the policy to the incoming job
 // we are also given the executor so we can enquire about data locality
+// if the job is rejected we also return the reason why
 func ApplyJobSelectionPolicy(
 	ctx context.Context,
 	policy JobSelectionPolicy,
 	e executor.Executor,
 	data JobSelectionPolicyProbeData,
-) (bool, error) {
+) (bool, string, error) {
+	image, err := jobImage(ctx, e, data.Spec)
+	if err != nil {
+		return false, "", err
+	}
+	if reason := applyJobSelectionPolicyRules(policy, data.Spec, image); reason != "" {
+		log.Trace().Msgf("%s - rejecting job", reason)
+		return false, reason, nil
+	}
+
 	if policy.ProbeExec != "" {
-		return applyJobSelectionPolicyExecProbe(ctx, policy.ProbeExec, data)
+		accepted, err := applyJobSelectionPolicyExecProbe(ctx, policy.ProbeExec, data)
+		return accepted, probeRejectionReason(accepted, "exec"), err
 	} else if policy.ProbeHTTP != "" {
-		return applyJobSelectionPolicyHTTPProbe(ctx, policy.ProbeHTTP, data)
+		accepted, err := applyJobSelectionPolicyHTTPProbe(ctx, policy.ProbeHTTP, data)
+		return accepted, probeRejectionReason(accepted, "http"), err
 	} else {
 		return applyJobSelectionPolicySettings(ctx, policy, e, data.Spec)
 	}
 }
+
+func probeRejectionReason(accepted bool, probe string) string {
+	if accepted {
+		return ""
+	}
+	return fmt.Sprintf("the %s job selection probe rejected the job", probe)
+}
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/filecoin-project/bacalhau/pkg/computenode/tooling"
+	"github.com/filecoin-project/bacalhau/pkg/executor"
 	"github.com/filecoin-project/bacalhau/pkg/model"
 	"github.com/stretchr/testify/require"
 )
@@ -27,6 +28,44 @@ func getProbeDataWithVolume() JobSelectionPolicyProbeData {
 	}
 }
 
+func getProbeDataWithNetwork(networkType model.Network) JobSelectionPolicyProbeData {
+	data := getProbeDataWithVolume()
+	data.Spec.Network = model.JobSpecNetwork{
+		Type:      networkType,
+		AllowList: []string{"pypi.org"},
+	}
+	return data
+}
+
+func getProbeDataWithCapabilities(capabilities ...string) JobSelectionPolicyProbeData {
+	data := getProbeDataWithVolume()
+	data.Spec.Docker.Relaxations = model.JobSpecDockerRelaxations{
+		Capabilities: capabilities,
+	}
+	return data
+}
+
+func getProbeDataWithS3(inputURL, publishBucket string) JobSelectionPolicyProbeData {
+	data := getProbeDataWithVolume()
+	data.Spec.Inputs = append(data.Spec.Inputs, model.StorageSpec{
+		Engine: model.StorageSourceS3,
+		URL:    inputURL,
+	})
+	if publishBucket != "" {
+		data.Spec.Publisher = model.PublisherS3
+		data.Spec.S3Publisher = model.JobSpecS3Publisher{Bucket: publishBucket}
+	}
+	return data
+}
+
+func getProbeDataWithRelaxations() JobSelectionPolicyProbeData {
+	data := getProbeDataWithVolume()
+	data.Spec.Docker.Relaxations = model.JobSpecDockerRelaxations{
+		RunAsRoot: true,
+	}
+	return data
+}
+
 func TestJobSelectionPolicy(t *testing.T) {
 
 	testCases := []struct {
@@ -105,6 +144,142 @@ func TestJobSelectionPolicy(t *testing.T) {
 			},
 			getProbeDataWithVolume(),
 		},
+
+		// we have not opted into networked jobs - we should reject
+		{
+			"networked job -> not accepted -> should reject",
+			false,
+			true,
+			JobSelectionPolicy{
+				Locality: Anywhere,
+			},
+			getProbeDataWithNetwork(model.NetworkAllowList),
+		},
+
+		// we have opted into networked jobs - we should accept
+		{
+			"networked job -> accepted -> should accept",
+			true,
+			true,
+			JobSelectionPolicy{
+				Locality:            Anywhere,
+				AcceptNetworkedJobs: true,
+			},
+			getProbeDataWithNetwork(model.NetworkFull),
+		},
+
+		// the opt in is checked before any probe gets to see the job
+		{
+			"networked job -> not accepted -> probe is not asked",
+			false,
+			true,
+			JobSelectionPolicy{
+				ProbeExec: "exit 0",
+			},
+			getProbeDataWithNetwork(model.NetworkFull),
+		},
+
+		// we have not opted into relaxed jobs - we should reject
+		{
+			"relaxed job -> not accepted -> should reject",
+			false,
+			true,
+			JobSelectionPolicy{
+				Locality: Anywhere,
+			},
+			getProbeDataWithRelaxations(),
+		},
+
+		// we have opted into relaxed jobs - we should accept
+		{
+			"relaxed job -> accepted -> should accept",
+			true,
+			true,
+			JobSelectionPolicy{
+				Locality:          Anywhere,
+				AcceptRelaxedJobs: true,
+			},
+			getProbeDataWithRelaxations(),
+		},
+
+		// capabilities docker gives containers anyway are allowed by default
+		{
+			"default capability -> accepted",
+			true,
+			true,
+			JobSelectionPolicy{
+				Locality:          Anywhere,
+				AcceptRelaxedJobs: true,
+			},
+			getProbeDataWithCapabilities("net_bind_service"),
+		},
+
+		// nothing outside docker's defaults is allowed, even if the policy says so
+		{
+			"extra capability -> should reject",
+			false,
+			true,
+			JobSelectionPolicy{
+				Locality:            Anywhere,
+				AcceptRelaxedJobs:   true,
+				AllowedCapabilities: []string{"SYS_ADMIN"},
+			},
+			getProbeDataWithCapabilities("SYS_ADMIN"),
+		},
+
+		// the policy can narrow the defaults
+		{
+			"capability not in the allow list -> should reject",
+			false,
+			true,
+			JobSelectionPolicy{
+				Locality:            Anywhere,
+				AcceptRelaxedJobs:   true,
+				AllowedCapabilities: []string{"CHOWN"},
+			},
+			getProbeDataWithCapabilities("NET_RAW"),
+		},
+
+		// jobs can only use the s3 buckets we allow
+		{
+			"s3 buckets in the allow list -> should accept",
+			true,
+			true,
+			JobSelectionPolicy{
+				Locality:  Anywhere,
+				S3Buckets: []string{"data", "results"},
+			},
+			getProbeDataWithS3("s3://data/inputs", "results"),
+		},
+		{
+			"s3 input bucket not in the allow list -> should reject",
+			false,
+			true,
+			JobSelectionPolicy{
+				Locality:  Anywhere,
+				S3Buckets: []string{"results"},
+			},
+			getProbeDataWithS3("s3://data/inputs", "results"),
+		},
+		{
+			"s3 publisher bucket not in the allow list -> should reject",
+			false,
+			true,
+			JobSelectionPolicy{
+				Locality:  Anywhere,
+				S3Buckets: []string{"data"},
+			},
+			getProbeDataWithS3("s3://data/inputs", "results"),
+		},
+		{
+			"s3 buckets without an allow list -> should reject",
+			false,
+			true,
+			JobSelectionPolicy{
+				Locality: Anywhere,
+			},
+			getProbeDataWithS3("s3://data/inputs", ""),
+		},
 	}
 
 	for _, test := range testCases {
@@ -112,7 +287,7 @@ func TestJobSelectionPolicy(t *testing.T) {
 			suite := tooling.NewTestSuite()
 			executor, err := tooling.NewNoopExecutor(suite.Cm, tooling.HasStorageNoopExecutorConfig(test.hasStorageLocally))
 			require.NoError(t, err)
-			result, err := ApplyJobSelectionPolicy(
+			result, _, err := ApplyJobSelectionPolicy(
 				context.Background(),
 				test.policy,
 				executor,
@@ -170,7 +345,7 @@ func TestJobSelectionHttp(t *testing.T) {
 			}))
 			defer svr.Close()
 			require.NoError(t, err)
-			result, err := ApplyJobSelectionPolicy(
+			result, _, err := ApplyJobSelectionPolicy(
 				context.Background(),
 				JobSelectionPolicy{
 					ProbeHTTP: svr.URL,
@@ -214,7 +389,7 @@ func TestJobSelectionExec(t *testing.T) {
 			if test.failMode {
 				command = "exit 1"
 			}
-			result, err := ApplyJobSelectionPolicy(
+			result, _, err := ApplyJobSelectionPolicy(
 				context.Background(),
 				JobSelectionPolicy{
 					ProbeExec: command,
@@ -227,3 +402,36 @@ func TestJobSelectionExec(t *testing.T) {
 		})
 	}
 }
+
+// imagerExecutor is an executor that runs jobs in an image of its choosing,
+// like the language executor does
+type imagerExecutor struct {
+	executor.Executor
+	image string
+}
+
+func (e imagerExecutor) GetJobImage(ctx context.Context, spec model.JobSpec) (string, error) {
+	return e.image, nil
+}
+
+func TestJobSelectionImagePolicyAppliesToJobImages(t *testing.T) {
+	suite := tooling.NewTestSuite()
+	noopExecutor, err := tooling.NewNoopExecutor(suite.Cm, tooling.BlankNoopExecutorConfig())
+	require.NoError(t, err)
+	policy := JobSelectionPolicy{
+		Images: JobSelectionImagePolicy{AllowedRepositories: []string{"python"}},
+	}
+	data := getProbeDataWithVolume()
+	data.Spec.Engine = model.EngineLanguage
+
+	for image, expected := range map[string]bool{
+		"python:3.9-slim": true,
+		"node:18-slim":    false,
+		// the job doesn't run in an image so there's nothing to check
+		"": true,
+	} {
+		result, _, err := ApplyJobSelectionPolicy(context.Background(), policy, imagerExecutor{noopExecutor, image}, data)
+		require.NoError(t, err)
+		require.Equal(t, expected, result, image)
+	}
+}
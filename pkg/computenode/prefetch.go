@@ -0,0 +1,161 @@
+package computenode
+
+import (
+	"context"
+	"fmt"
+
+	jobutils "github.com/filecoin-project/bacalhau/pkg/job"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// the inputs of a shard we are fetching while we wait to hear if our bid
+// has been accepted
+type shardPrefetch struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	// how much of the prefetch budget the inputs use, and whether the bid
+	// has been accepted so they no longer count against it - both guarded
+	// by prefetchMu
+	size     uint64
+	accepted bool
+	// what has been prepared so far, so it can be cleaned up - only read
+	// once done is closed
+	prepared []preparedInput
+}
+
+type preparedInput struct {
+	provider storage.StorageProvider
+	spec     model.StorageSpec
+	volume   storage.StorageVolume
+}
+
+// startPrefetch starts preparing the inputs of a shard we have bid on so
+// that, with the input cache, they are already there when the bid is
+// accepted. Nothing is fetched if prefetching is off or the inputs would
+// take us over the prefetch budget. Working out the size of the inputs can
+// mean asking other nodes, so it all happens in the background.
+func (n *ComputeNode) startPrefetch(ctx context.Context, shard model.JobShard) {
+	if n.config.PrefetchStorage == nil || n.config.PrefetchBudget == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	prefetch := &shardPrefetch{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	n.prefetchMu.Lock()
+	n.prefetches[shard.ID()] = prefetch
+	n.prefetchMu.Unlock()
+
+	go func() {
+		defer close(prefetch.done)
+		n.prefetch(ctx, shard, prefetch)
+	}()
+}
+
+func (n *ComputeNode) prefetch(ctx context.Context, shard model.JobShard, prefetch *shardPrefetch) {
+	inputs, err := n.getShardInputs(ctx, shard)
+	if err != nil {
+		log.Debug().Msgf("node %s not prefetching shard %s: %s", n.ID, shard, err)
+		return
+	}
+	var size uint64
+	for _, input := range inputs {
+		inputSize, err := input.provider.GetVolumeSize(ctx, input.spec)
+		if err != nil {
+			log.Debug().Msgf("node %s not prefetching shard %s: %s", n.ID, shard, err)
+			return
+		}
+		size += inputSize
+	}
+
+	n.prefetchMu.Lock()
+	// the shard is already running, or has gone, so it's too late
+	if current, ok := n.prefetches[shard.ID()]; !ok || current != prefetch || prefetch.accepted {
+		n.prefetchMu.Unlock()
+		return
+	}
+	if n.prefetchUsed+size > n.config.PrefetchBudget {
+		n.prefetchMu.Unlock()
+		log.Debug().Msgf("node %s not prefetching shard %s: %d bytes would go over the prefetch budget", n.ID, shard, size)
+		return
+	}
+	prefetch.size = size
+	n.prefetchUsed += size
+	n.prefetchMu.Unlock()
+
+	for _, input := range inputs {
+		volume, err := input.provider.PrepareStorage(ctx, input.spec)
+		if err != nil {
+			log.Debug().Msgf("node %s stopped prefetching shard %s: %s", n.ID, shard, err)
+			return
+		}
+		input.volume = volume
+		prefetch.prepared = append(prefetch.prepared, input)
+	}
+	log.Debug().Msgf("node %s prefetched the inputs of shard %s", n.ID, shard)
+}
+
+// acceptPrefetch is for when the bid has been accepted. The inputs of the
+// shard are the job's now, so they stop counting against the prefetch
+// budget and it can be used for the shards we are still bidding on.
+func (n *ComputeNode) acceptPrefetch(shard model.JobShard) {
+	n.prefetchMu.Lock()
+	defer n.prefetchMu.Unlock()
+	prefetch, ok := n.prefetches[shard.ID()]
+	if !ok {
+		return
+	}
+	prefetch.accepted = true
+	n.prefetchUsed -= prefetch.size
+	prefetch.size = 0
+}
+
+// stopPrefetch cleans up what was prefetched for a shard. When the bid has
+// been rejected the prefetch is aborted, otherwise it is left to finish as
+// the job is waiting on the same inputs.
+func (n *ComputeNode) stopPrefetch(ctx context.Context, shard model.JobShard, abort bool) {
+	n.prefetchMu.Lock()
+	prefetch, ok := n.prefetches[shard.ID()]
+	delete(n.prefetches, shard.ID())
+	n.prefetchMu.Unlock()
+	if !ok {
+		return
+	}
+
+	if abort {
+		prefetch.cancel()
+	}
+	<-prefetch.done
+	prefetch.cancel()
+	for _, input := range prefetch.prepared {
+		if err := input.provider.CleanupStorage(ctx, input.spec, input.volume); err != nil {
+			log.Warn().Msgf("node %s could not clean up prefetched input of shard %s: %s", n.ID, shard, err)
+		}
+	}
+
+	n.prefetchMu.Lock()
+	n.prefetchUsed -= prefetch.size
+	prefetch.size = 0
+	n.prefetchMu.Unlock()
+}
+
+// the contexts and input volumes the shard will be given when it runs
+func (n *ComputeNode) getShardInputs(ctx context.Context, shard model.JobShard) ([]preparedInput, error) {
+	shardStorageSpecs, err := jobutils.GetShardStorageSpec(ctx, shard, n.config.PrefetchStorage)
+	if err != nil {
+		return nil, err
+	}
+	inputs := []preparedInput{}
+	for _, spec := range append(append([]model.StorageSpec{}, shard.Job.Spec.Contexts...), shardStorageSpecs...) {
+		provider, ok := n.config.PrefetchStorage[spec.Engine]
+		if !ok {
+			return nil, fmt.Errorf("no storage provider for %s", spec.Engine)
+		}
+		inputs = append(inputs, preparedInput{provider: provider, spec: spec})
+	}
+	return inputs, nil
+}
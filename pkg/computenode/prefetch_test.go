@@ -0,0 +1,169 @@
+package computenode
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage"
+	noop_storage "github.com/filecoin-project/bacalhau/pkg/storage/noop"
+	"github.com/stretchr/testify/require"
+)
+
+// records what the prefetcher asks of the storage provider
+type prefetchRecorder struct {
+	mu       sync.Mutex
+	prepared []string
+	cleaned  []string
+	// when set GetVolumeSize and PrepareStorage wait until it is closed or
+	// cancelled
+	block chan struct{}
+}
+
+func (r *prefetchRecorder) wait(ctx context.Context) error {
+	if r.block == nil {
+		return nil
+	}
+	select {
+	case <-r.block:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *prefetchRecorder) provider(t *testing.T) storage.StorageProvider {
+	provider, err := noop_storage.NewStorageProvider(context.Background(), nil, noop_storage.StorageConfig{
+		ExternalHooks: noop_storage.StorageConfigExternalHooks{
+			GetVolumeSize: func(ctx context.Context, volume model.StorageSpec) (uint64, error) {
+				return 10, r.wait(ctx)
+			},
+			PrepareStorage: func(ctx context.Context, spec model.StorageSpec) (storage.StorageVolume, error) {
+				if err := r.wait(ctx); err != nil {
+					return storage.StorageVolume{}, err
+				}
+				r.mu.Lock()
+				defer r.mu.Unlock()
+				r.prepared = append(r.prepared, spec.Cid)
+				return storage.StorageVolume{Source: spec.Cid}, nil
+			},
+			CleanupStorage: func(ctx context.Context, spec model.StorageSpec, volume storage.StorageVolume) error {
+				r.mu.Lock()
+				defer r.mu.Unlock()
+				r.cleaned = append(r.cleaned, volume.Source)
+				return nil
+			},
+		},
+	})
+	require.NoError(t, err)
+	return provider
+}
+
+func newPrefetchTestNode(t *testing.T, recorder *prefetchRecorder, budget uint64) *ComputeNode {
+	return &ComputeNode{
+		ID: "prefetch-test-node",
+		config: ComputeNodeConfig{
+			PrefetchStorage: map[model.StorageSourceType]storage.StorageProvider{
+				model.StorageSourceIPFS: recorder.provider(t),
+			},
+			PrefetchBudget: budget,
+		},
+		prefetches: map[string]*shardPrefetch{},
+	}
+}
+
+func prefetchTestShard(id string) model.JobShard {
+	return model.JobShard{
+		Job: model.Job{
+			ID: id,
+			Spec: model.JobSpec{
+				Contexts: []model.StorageSpec{{Engine: model.StorageSourceIPFS, Cid: id + "-context"}},
+				Inputs:   []model.StorageSpec{{Engine: model.StorageSourceIPFS, Cid: id + "-input"}},
+			},
+		},
+	}
+}
+
+// wait for the prefetch of the shard to finish without stopping it
+func waitForPrefetch(n *ComputeNode, shard model.JobShard) {
+	n.prefetchMu.Lock()
+	prefetch := n.prefetches[shard.ID()]
+	n.prefetchMu.Unlock()
+	<-prefetch.done
+}
+
+func TestPrefetch(t *testing.T) {
+	ctx := context.Background()
+	recorder := &prefetchRecorder{}
+	n := newPrefetchTestNode(t, recorder, 30)
+
+	shard := prefetchTestShard("job-a")
+	n.startPrefetch(ctx, shard)
+	waitForPrefetch(n, shard)
+	// the second shard's 20 bytes would take us over the budget
+	other := prefetchTestShard("job-b")
+	n.startPrefetch(ctx, other)
+	waitForPrefetch(n, other)
+	require.Equal(t, uint64(20), n.prefetchUsed)
+	n.stopPrefetch(ctx, other, true)
+
+	n.stopPrefetch(ctx, shard, false)
+	require.Equal(t, []string{"job-a-context", "job-a-input"}, recorder.prepared)
+	require.Equal(t, []string{"job-a-context", "job-a-input"}, recorder.cleaned)
+	require.Equal(t, uint64(0), n.prefetchUsed)
+	require.Empty(t, n.prefetches)
+
+	// stopping again does nothing
+	n.stopPrefetch(ctx, shard, true)
+	require.Len(t, recorder.cleaned, 2)
+}
+
+func TestPrefetchAccepted(t *testing.T) {
+	ctx := context.Background()
+	recorder := &prefetchRecorder{}
+	n := newPrefetchTestNode(t, recorder, 30)
+
+	shard := prefetchTestShard("job-a")
+	n.startPrefetch(ctx, shard)
+	waitForPrefetch(n, shard)
+	n.acceptPrefetch(shard)
+	require.Equal(t, uint64(0), n.prefetchUsed)
+
+	// the budget can be used for the next shard while the first one runs
+	other := prefetchTestShard("job-b")
+	n.startPrefetch(ctx, other)
+	waitForPrefetch(n, other)
+	require.Equal(t, uint64(20), n.prefetchUsed)
+
+	n.stopPrefetch(ctx, shard, false)
+	require.Equal(t, []string{"job-a-context", "job-a-input"}, recorder.cleaned)
+	require.Equal(t, uint64(20), n.prefetchUsed)
+	n.stopPrefetch(ctx, other, false)
+	require.Equal(t, uint64(0), n.prefetchUsed)
+}
+
+func TestPrefetchAbort(t *testing.T) {
+	ctx := context.Background()
+	recorder := &prefetchRecorder{block: make(chan struct{})}
+	n := newPrefetchTestNode(t, recorder, 100)
+
+	// working out the size of the inputs doesn't hold up the bid
+	shard := prefetchTestShard("job-a")
+	n.startPrefetch(ctx, shard)
+	n.stopPrefetch(ctx, shard, true)
+	require.Empty(t, recorder.prepared)
+	require.Empty(t, recorder.cleaned)
+	require.Equal(t, uint64(0), n.prefetchUsed)
+}
+
+func TestPrefetchOff(t *testing.T) {
+	ctx := context.Background()
+	recorder := &prefetchRecorder{}
+	n := newPrefetchTestNode(t, recorder, 0)
+
+	shard := prefetchTestShard("job-a")
+	n.startPrefetch(ctx, shard)
+	n.stopPrefetch(ctx, shard, false)
+	require.Empty(t, recorder.prepared)
+}
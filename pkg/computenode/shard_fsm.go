@@ -7,6 +7,7 @@ import (
 
 	"github.com/filecoin-project/bacalhau/pkg/capacitymanager"
 	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage"
 	"github.com/filecoin-project/bacalhau/pkg/system"
 	sync "github.com/lukemarsden/golang-mutex-tracer"
 	"github.com/rs/zerolog/log"
@@ -30,10 +31,17 @@ const (
 
 	// results were verified, and do publish them
 	actionPublish
+
+	// the compute node no longer wants the shard, and do cancel the bid
+	actionCancel
+
+	// the requester has given up on the shard running here, and do stop
+	// without telling it anything more
+	actionStop
 )
 
 func (a shardStateAction) String() string {
-	return [...]string{"ActionBid", "ActionRejected", "ActionFail", "ActionRun"}[a]
+	return [...]string{"ActionBid", "ActionRejected", "ActionFail", "ActionRun", "ActionPublish", "ActionCancel", "ActionStop"}[a]
 }
 
 // request to change the state of the fsm
@@ -75,10 +83,21 @@ const (
 	shardCompleted
 )
 
+var shardStateTypeNames = [...]string{
+	"InitialState", "Enqueued", "Bidding", "Running", "PublishingToVerifier",
+	"VerifyingResults", "PublishingToRequester", "Error", "Completed"}
+
 func (s shardStateType) String() string {
-	return [...]string{
-		"InitialState", "Enqueued", "Bidding", "Running", "PublishingToVerifier",
-		"VerifyingResults", "PublishingToRequester", "Error", "Completed"}[s]
+	return shardStateTypeNames[s]
+}
+
+func parseShardStateType(str string) (shardStateType, error) {
+	for typ, name := range shardStateTypeNames {
+		if name == str {
+			return shardStateType(typ), nil
+		}
+	}
+	return shardInitialState, fmt.Errorf("unknown shard state: %s", str)
 }
 
 type shardStateMachineManager struct {
@@ -90,13 +109,20 @@ type shardStateMachineManager struct {
 	// according the priority defined by the capacity manager
 	shardStatesList []*shardStateMachine
 
+	// where we persist the state of each shard so it survives a restart
+	store ShardStateStore
+
 	mu sync.Mutex
 }
 
-func NewShardComputeStateMachineManager() (*shardStateMachineManager, error) {
+func NewShardComputeStateMachineManager(store ShardStateStore) (*shardStateMachineManager, error) {
+	if store == nil {
+		store = noopShardStateStore{}
+	}
 	stateManager := &shardStateMachineManager{
 		shardStates:     make(map[string]*shardStateMachine),
 		shardStatesList: []*shardStateMachine{},
+		store:           store,
 	}
 
 	stateManager.mu.EnableTracerWithOpts(sync.Opts{
@@ -116,21 +142,86 @@ func (m *shardStateMachineManager) StartShardStateIfNecessery(
 
 	if _, ok := m.shardStates[shard.ID()]; !ok {
 		shardState := m.newStateMachine(shard, n, requirements)
-
-		// ANCHOR: Start of the shard state machine span
-		ctx, span := system.GetTracer().Start(context.Background(), "pkg/computenode/ShardStateMachineManager.StartShardStateIfNecessery")
-		defer span.End()
-		ctx = system.AddNodeIDToBaggage(ctx, n.ID)
-		system.AddNodeIDFromBaggageToSpan(ctx, span)
-
-		go func() {
-			shardState.Run(ctx)
-		}()
-		m.shardStates[shard.ID()] = shardState
-		m.shardStatesList = append(m.shardStatesList, shardState)
+		m.startStateMachine(shardState, n)
 	} // else, fsm was already running
 }
 
+// Start a new state machine for a shard we have already finished with, e.g.
+// because our bid lost but the shard has since been rescheduled.
+func (m *shardStateMachineManager) RestartShardState(
+	shard model.JobShard, n *ComputeNode, requirements model.ResourceUsageData) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.shardStates[shard.ID()]; ok && existing.state() != shardCompleted {
+		return
+	}
+	shardState := m.newStateMachine(shard, n, requirements)
+	m.startStateMachine(shardState, n)
+}
+
+// Start a shard state machine from a record persisted before the compute
+// node restarted, picking up from the state it was last in.
+func (m *shardStateMachineManager) ResumeShardState(record ShardStateRecord, n *ComputeNode) error {
+	state, err := parseShardStateType(record.State)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.shardStates[record.Shard.ID()]; ok {
+		return nil
+	}
+
+	shardState := m.newStateMachine(record.Shard, n, record.Requirements)
+	shardState.bidSent = record.BidSent
+	shardState.resultsDir = record.ResultsDir
+	shardState.resultProposal = record.ResultProposal
+
+	switch state {
+	case shardInitialState, shardEnqueued:
+		shardState.initialState = enqueuedState
+	case shardBidding:
+		// we can't know if our bid was accepted while we were down
+		shardState.errorMsg = "compute node restarted before the bid was answered"
+		shardState.initialState = errorState
+	case shardRunning:
+		shardState.initialState = reattachingState
+	case shardPublishingToVerifier:
+		shardState.initialState = restoringResultsState(publishingToVerifierState)
+	case shardVerifyingResults:
+		shardState.initialState = restoringResultsState(verifyingResultsState)
+	case shardPublishingToRequester:
+		shardState.initialState = restoringResultsState(publishingToRequesterState)
+	case shardError:
+		shardState.errorMsg = "compute node restarted while reporting an error"
+		shardState.initialState = errorState
+	case shardCompleted:
+		return m.store.Delete(context.Background(), record.Shard.ID())
+	}
+
+	log.Info().Msgf("%s resuming after restart", shardState)
+	m.startStateMachine(shardState, n)
+	return nil
+}
+
+// must be called with the lock held
+func (m *shardStateMachineManager) startStateMachine(shardState *shardStateMachine, n *ComputeNode) {
+	// ANCHOR: Start of the shard state machine span
+	ctx, span := system.GetTracer().Start(context.Background(), "pkg/computenode/ShardStateMachineManager.StartShardStateIfNecessery")
+	defer span.End()
+	ctx = system.AddNodeIDToBaggage(ctx, n.ID)
+	system.AddNodeIDFromBaggageToSpan(ctx, span)
+
+	go func() {
+		shardState.Run(ctx)
+	}()
+	m.shardStates[shardState.Shard.ID()] = shardState
+	m.shardStatesList = append(m.shardStatesList, shardState)
+}
+
 // Implements CapacityTracker interface to apply the handler on enqueued shards.
 func (m *shardStateMachineManager) BacklogIterator(handler func(item capacitymanager.CapacityManagerItem)) {
 	for _, item := range m.GetEnqueued() {
@@ -151,7 +242,7 @@ func (m *shardStateMachineManager) GetEnqueued() []*shardStateMachine {
 	m.cleanupCompleted()
 	enqueud := []*shardStateMachine{}
 	for _, i := range m.shardStatesList {
-		if i.currentState == shardEnqueued {
+		if i.state() == shardEnqueued {
 			enqueud = append(enqueud, i)
 		}
 	}
@@ -164,13 +255,54 @@ func (m *shardStateMachineManager) GetActive() []*shardStateMachine {
 	m.cleanupCompleted()
 	active := []*shardStateMachine{}
 	for _, i := range m.shardStatesList {
-		if i.currentState == shardBidding || i.currentState == shardRunning {
+		if i.state() == shardBidding || i.state() == shardRunning {
 			active = append(active, i)
 		}
 	}
 	return active
 }
 
+func (m *shardStateMachineManager) GetBidding() []*shardStateMachine {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cleanupCompleted()
+	bidding := []*shardStateMachine{}
+	for _, i := range m.shardStatesList {
+		if i.state() == shardBidding {
+			bidding = append(bidding, i)
+		}
+	}
+	return bidding
+}
+
+// all shards that have made it past bidding and have not completed yet
+// i.e. running, or publishing and verifying their results
+func (m *shardStateMachineManager) GetExecuting() []*shardStateMachine {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cleanupCompleted()
+	executing := []*shardStateMachine{}
+	for _, i := range m.shardStatesList {
+		switch i.state() {
+		case shardRunning, shardPublishingToVerifier, shardVerifyingResults, shardPublishingToRequester, shardError:
+			executing = append(executing, i)
+		}
+	}
+	return executing
+}
+
+// HasJob returns true if we have a shard of the job that hasn't completed.
+func (m *shardStateMachineManager) HasJob(jobID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, shardState := range m.shardStates {
+		if shardState.Shard.Job.ID == jobID && shardState.state() != shardCompleted {
+			return true
+		}
+	}
+	return false
+}
+
 func (m *shardStateMachineManager) Get(flatID string) (*shardStateMachine, bool) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -187,11 +319,14 @@ func (m *shardStateMachineManager) Get(flatID string) (*shardStateMachine, bool)
 func (m *shardStateMachineManager) cleanupCompleted() {
 	firstActive := len(m.shardStatesList)
 	for index, item := range m.shardStatesList {
-		if item.currentState != shardCompleted {
+		if item.state() != shardCompleted {
 			firstActive = index
 			break
 		}
-		delete(m.shardStates, item.Shard.ID())
+		// the shard may have been restarted with a new state machine
+		if m.shardStates[item.Shard.ID()] == item {
+			delete(m.shardStates, item.Shard.ID())
+		}
 	}
 	m.shardStatesList = m.shardStatesList[firstActive:]
 }
@@ -205,11 +340,17 @@ type shardStateMachine struct {
 	mu      sync.Mutex
 	req     chan shardStateRequest
 
+	initialState   StateFn
 	currentState   shardStateType
 	previousState  shardStateType
+	resultsDir     string
 	resultProposal []byte
 	bidSent        bool
 	errorMsg       string
+	// cancels the execution while the shard is running
+	cancelRun context.CancelFunc
+	// the requester has given up on the shard running here
+	stopped bool
 }
 
 func (m *shardStateMachineManager) newStateMachine(
@@ -220,6 +361,7 @@ func (m *shardStateMachineManager) newStateMachine(
 		node:         node,
 		capacity:     capacitymanager.CapacityManagerItem{Shard: shard, Requirements: requirements},
 		req:          make(chan shardStateRequest),
+		initialState: enqueuedState,
 		currentState: shardInitialState,
 	}
 
@@ -237,7 +379,7 @@ func (m *shardStateMachine) String() string {
 
 // run the state machineuntil it is completed.
 func (m *shardStateMachine) Run(ctx context.Context) {
-	for state := enqueuedState; state != nil; {
+	for state := m.initialState; state != nil; {
 		// TODO: #559 Should we create a new context and span for each state execution?
 		state = state(ctx, m)
 	}
@@ -266,6 +408,44 @@ func (m *shardStateMachine) Fail(ctx context.Context, reason string) {
 	m.sendRequest(ctx, shardStateRequest{action: actionFail, failureReason: reason})
 }
 
+func (m *shardStateMachine) CancelBid(ctx context.Context) {
+	m.sendRequest(ctx, shardStateRequest{action: actionCancel})
+}
+
+// Stop is for when the requester has given up on the shard running on this
+// node, e.g. it stopped hearing from us. Whatever the shard is doing stops
+// and nothing more is reported for it.
+func (m *shardStateMachine) Stop(ctx context.Context, reason string) {
+	m.mu.Lock()
+	m.stopped = true
+	cancelRun := m.cancelRun
+	m.mu.Unlock()
+
+	// a running shard isn't listening for requests
+	if cancelRun != nil {
+		log.Info().Msgf("%s stopping execution: %s", m, reason)
+		cancelRun()
+		return
+	}
+	m.sendRequest(ctx, shardStateRequest{action: actionStop, failureReason: reason})
+}
+
+// setCancelRun remembers how to stop the execution of the shard, or forgets
+// it if cancelRun is nil - it returns false if the shard has been stopped
+func (m *shardStateMachine) setCancelRun(cancelRun context.CancelFunc) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cancelRun = cancelRun
+	return !m.stopped
+}
+
+// state is where the state machine has got to, safe to call from outside it
+func (m *shardStateMachine) state() shardStateType {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.currentState
+}
+
 // send a request to the state machine by enquing it in the request channel.
 // it is possible due to race condition or duplicate network events that a
 // request is sent after the fsm is completed and no longer a goroutin is
@@ -290,22 +470,59 @@ func (m *shardStateMachine) transitionedTo(ctx context.Context, newState shardSt
 	log.Debug().Msgf("%s transitioning from %s -> %s", m, m.currentState, newState)
 	m.previousState = m.currentState
 	m.currentState = newState
+	m.persist(ctx)
+}
+
+// must be called with the lock held
+func (m *shardStateMachine) persist(ctx context.Context) {
+	var err error
+	if m.currentState == shardCompleted {
+		err = m.manager.store.Delete(ctx, m.Shard.ID())
+	} else {
+		err = m.manager.store.Save(ctx, ShardStateRecord{
+			Shard:          m.Shard,
+			Requirements:   m.capacity.Requirements,
+			State:          m.currentState.String(),
+			BidSent:        m.bidSent,
+			ResultsDir:     m.resultsDir,
+			ResultProposal: m.resultProposal,
+		})
+	}
+	if err != nil {
+		log.Error().Msgf("%s failed to persist shard state: %s", m, err)
+	}
 }
 
 // the computeNode has sent a bid and is waiting for the bid to be accepted or rejected.
 func biddingState(ctx context.Context, m *shardStateMachine) StateFn {
 	m.transitionedTo(ctx, shardBidding)
 
+	// make a start on the inputs while we wait
+	m.node.startPrefetch(ctx, m.Shard)
+
 	for {
 		req := <-m.req
 		switch req.action {
 		case actionRun:
 			return runningState
 		case actionRejected:
+			m.node.stopPrefetch(ctx, m.Shard, true)
+			return completedState
+		case actionCancel:
+			m.node.stopPrefetch(ctx, m.Shard, true)
+			err := m.node.controller.CancelJobBid(ctx, m.Shard)
+			if err != nil {
+				m.errorMsg = err.Error()
+				return errorState
+			}
 			return completedState
 		case actionFail:
+			m.node.stopPrefetch(ctx, m.Shard, true)
 			m.errorMsg = req.failureReason
 			return errorState
+		case actionStop:
+			m.node.stopPrefetch(ctx, m.Shard, true)
+			return completedState
 		default:
 			log.Warn().Msgf("%s ignoring unknown action: %s", m, req.action)
 		}
@@ -339,6 +556,8 @@ func enqueuedState(ctx context.Context, m *shardStateMachine) StateFn {
 		case actionFail:
 			m.errorMsg = req.failureReason
 			return errorState
+		case actionStop:
+			return completedState
 		default:
 			log.Warn().Msgf("%s ignoring unknown action: %s", m, req.action)
 		}
@@ -347,6 +566,19 @@ func enqueuedState(ctx context.Context, m *shardStateMachine) StateFn {
 
 // the bid has been accepted and now we trigger the execution of the job.
 func runningState(ctx context.Context, m *shardStateMachine) StateFn {
+	// the job takes its own hold on any prefetched inputs when it runs, so
+	// they only need to be kept until then
+	m.node.acceptPrefetch(m.Shard)
+	defer m.node.stopPrefetch(ctx, m.Shard, false)
+
+	// remember where the results are going in case we restart while running
+	resultsDir, err := m.node.getShardResultPath(ctx, m.Shard)
+	if err != nil {
+		m.errorMsg = err.Error()
+		return errorState
+	}
+	m.resultsDir = resultsDir
+
 	// TODO: #558 Should we create a new span every time there's a state transition?
 	m.transitionedTo(ctx, shardRunning)
 
@@ -358,7 +590,20 @@ func runningState(ctx context.Context, m *shardStateMachine) StateFn {
 	// we get a "proposal" from this method which is not the results
 	// but what the compute node verifier wants to pass to the requester
 	// node verifier
-	proposal, err := m.node.RunShard(ctx, m.Shard)
+	runCtx, cancelRun := context.WithCancel(ctx)
+	defer cancelRun()
+	if !m.setCancelRun(cancelRun) {
+		return completedState
+	}
+	inputs := &inputProgress{}
+	runCtx = storage.WithProgress(runCtx, inputs.set)
+	stopHeartbeat := m.node.startShardHeartbeat(ctx, m.Shard, inputs)
+	proposal, err := m.node.RunShard(runCtx, m.Shard)
+	stopHeartbeat()
+	if !m.setCancelRun(nil) {
+		log.Info().Msgf("%s stopped while running", m)
+		return completedState
+	}
 	if err == nil {
 		m.resultProposal = proposal
 		return publishingToVerifierState
@@ -368,6 +613,51 @@ func runningState(ctx context.Context, m *shardStateMachine) StateFn {
 	}
 }
 
+// the compute node restarted while the shard was running, so we find the
+// execution we started before and wait for it to finish.
+func reattachingState(ctx context.Context, m *shardStateMachine) StateFn {
+	m.transitionedTo(ctx, shardRunning)
+
+	ctx, span := system.GetTracer().Start(ctx, "pkg/computenode/ShardFSM.reattachingState")
+	defer span.End()
+	ctx = system.AddJobIDToBaggage(ctx, m.Shard.Job.ID)
+	system.AddJobIDFromBaggageToSpan(ctx, span)
+
+	runCtx, cancelRun := context.WithCancel(ctx)
+	defer cancelRun()
+	if !m.setCancelRun(cancelRun) {
+		return completedState
+	}
+	stopHeartbeat := m.node.startShardHeartbeat(ctx, m.Shard, nil)
+	proposal, err := m.node.ReattachShard(runCtx, m.Shard, m.resultsDir)
+	stopHeartbeat()
+	if !m.setCancelRun(nil) {
+		log.Info().Msgf("%s stopped while running", m)
+		return completedState
+	}
+	if err != nil {
+		m.errorMsg = err.Error()
+		return errorState
+	}
+	m.resultProposal = proposal
+	return publishingToVerifierState
+}
+
+// the compute node restarted after the shard had finished running, so we
+// move the results to where the verifier and publisher now expect them
+// before carrying on from the given state.
+func restoringResultsState(next StateFn) StateFn {
+	return func(ctx context.Context, m *shardStateMachine) StateFn {
+		resultsDir, err := m.node.restoreShardResults(ctx, m.Shard, m.resultsDir)
+		if err != nil {
+			m.errorMsg = err.Error()
+			return errorState
+		}
+		m.resultsDir = resultsDir
+		return next
+	}
+}
+
 // the job has been executed and now we verify the results.
 func publishingToVerifierState(ctx context.Context, m *shardStateMachine) StateFn {
 	m.transitionedTo(ctx, shardPublishingToVerifier)
@@ -383,6 +673,7 @@ func publishingToVerifierState(ctx context.Context, m *shardStateMachine) StateF
 		m.Shard.Index,
 		fmt.Sprintf("Got results proposal of length: %d", len(m.resultProposal)),
 		m.resultProposal,
+		m.node.getShardResourceUsage(ctx, m.Shard),
 	)
 
 	if err != nil {
@@ -410,6 +701,8 @@ func verifyingResultsState(ctx context.Context, m *shardStateMachine) StateFn {
 		case actionFail:
 			m.errorMsg = req.failureReason
 			return errorState
+		case actionStop:
+			return completedState
 		default:
 			log.Warn().Msgf("%s ignoring unknown action: %s", m, req.action)
 		}
@@ -464,5 +757,6 @@ func errorState(ctx context.Context, m *shardStateMachine) StateFn {
 // we always reach this state, whether the job completed successfully or due to a failure.
 func completedState(ctx context.Context, m *shardStateMachine) StateFn {
 	m.transitionedTo(ctx, shardCompleted)
+	m.node.forgetImageSize(m.Shard.Job.ID)
 	return nil
 }
@@ -0,0 +1,174 @@
+package computenode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage/util"
+	sync "github.com/lukemarsden/golang-mutex-tracer"
+)
+
+// ShardStateRecord is what we remember about a shard state machine so that
+// we can pick it back up if the compute node restarts.
+type ShardStateRecord struct {
+	Shard          model.JobShard          `json:"Shard"`
+	Requirements   model.ResourceUsageData `json:"Requirements"`
+	State          string                  `json:"State"`
+	BidSent        bool                    `json:"BidSent"`
+	ResultsDir     string                  `json:"ResultsDir"`
+	ResultProposal []byte                  `json:"ResultProposal"`
+}
+
+// ShardStateStore persists the state of the shards a compute node is
+// working on.
+type ShardStateStore interface {
+	// save (or overwrite) the record for a shard
+	Save(ctx context.Context, record ShardStateRecord) error
+	// forget about a shard once it has completed
+	Delete(ctx context.Context, shardID string) error
+	// list every shard we still have a record for
+	List(ctx context.Context) ([]ShardStateRecord, error)
+}
+
+// noopShardStateStore is used when no store is configured, in which case
+// shard state is only kept in memory.
+type noopShardStateStore struct{}
+
+func (noopShardStateStore) Save(ctx context.Context, record ShardStateRecord) error {
+	return nil
+}
+
+func (noopShardStateStore) Delete(ctx context.Context, shardID string) error {
+	return nil
+}
+
+func (noopShardStateStore) List(ctx context.Context) ([]ShardStateRecord, error) {
+	return []ShardStateRecord{}, nil
+}
+
+// FileShardStateStore writes one JSON file per shard into a directory.
+type FileShardStateStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewFileShardStateStore(dir string) (*FileShardStateStore, error) {
+	err := os.MkdirAll(dir, util.OS_USER_RWX)
+	if err != nil {
+		return nil, fmt.Errorf("could not create shard state dir %s: %w", dir, err)
+	}
+	store := &FileShardStateStore{
+		dir: dir,
+	}
+	store.mu.EnableTracerWithOpts(sync.Opts{
+		Threshold: 10 * time.Millisecond,
+		Id:        "FileShardStateStore.mu",
+	})
+	return store, nil
+}
+
+func (s *FileShardStateStore) Save(ctx context.Context, record ShardStateRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	// write to a temp file and rename so a crash never leaves half a record
+	path := s.recordPath(record.Shard.ID())
+	tmpPath := path + ".tmp"
+	err = os.WriteFile(tmpPath, data, util.OS_USER_RW)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func (s *FileShardStateStore) Delete(ctx context.Context, shardID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := os.Remove(s.recordPath(shardID))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileShardStateStore) List(ctx context.Context) ([]ShardStateRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []ShardStateRecord{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var record ShardStateRecord
+		err = json.Unmarshal(data, &record)
+		if err != nil {
+			return nil, fmt.Errorf("could not read shard state %s: %w", entry.Name(), err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (s *FileShardStateStore) recordPath(shardID string) string {
+	// shard IDs are "<jobID>:<index>" - keep the filename portable
+	return filepath.Join(s.dir, strings.ReplaceAll(shardID, ":", "_")+".json")
+}
+
+// copy the contents of one directory into another, creating it if needed
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, relPath)
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm()|util.OS_USER_RWX)
+		}
+		return copyFile(path, target, info.Mode().Perm())
+	})
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// Compile-time interface check:
+var _ ShardStateStore = (*FileShardStateStore)(nil)
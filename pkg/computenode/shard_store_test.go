@@ -0,0 +1,67 @@
+package computenode
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileShardStateStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileShardStateStore(t.TempDir())
+	require.NoError(t, err)
+
+	shard := model.JobShard{Job: model.Job{ID: "job-id"}, Index: 2}
+	record := ShardStateRecord{
+		Shard:          shard,
+		State:          shardVerifyingResults.String(),
+		BidSent:        true,
+		ResultsDir:     "/tmp/results",
+		ResultProposal: []byte("proposal"),
+	}
+	require.NoError(t, store.Save(ctx, record))
+
+	// saving again overwrites the record
+	record.State = shardPublishingToRequester.String()
+	require.NoError(t, store.Save(ctx, record))
+
+	records, err := store.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, shard.ID(), records[0].Shard.ID())
+	require.Equal(t, "PublishingToRequester", records[0].State)
+	require.Equal(t, []byte("proposal"), records[0].ResultProposal)
+
+	state, err := parseShardStateType(records[0].State)
+	require.NoError(t, err)
+	require.Equal(t, shardPublishingToRequester, state)
+
+	require.NoError(t, store.Delete(ctx, shard.ID()))
+	// deleting twice is fine
+	require.NoError(t, store.Delete(ctx, shard.ID()))
+
+	records, err = store.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, records, 0)
+}
+
+func TestCopyDir(t *testing.T) {
+	src := t.TempDir()
+	dst := filepath.Join(t.TempDir(), "results")
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "outputs"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "stdout"), []byte("hello"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "outputs", "file.txt"), []byte("world"), 0600))
+
+	require.NoError(t, copyDir(src, dst))
+
+	data, err := os.ReadFile(filepath.Join(dst, "stdout"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+	data, err = os.ReadFile(filepath.Join(dst, "outputs", "file.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "world", string(data))
+}
@@ -313,6 +313,58 @@ func (ctrl *Controller) RejectResults(
 	return ctrl.writeEvent(jobCtx, ev)
 }
 
+// can only be done by the requestor node that is responsible for the job
+// when a compute node has stopped sending heartbeats for a shard it was
+// running - we mark the shard as errored on that node's behalf
+func (ctrl *Controller) ShardHeartbeatTimeout(
+	ctx context.Context,
+	jobID, nodeID string,
+	shardIndex int,
+	status string,
+) error {
+	if jobID == "" {
+		return fmt.Errorf("ShardHeartbeatTimeout: jobID cannot be empty")
+	}
+	if nodeID == "" {
+		return fmt.Errorf("ShardHeartbeatTimeout: nodeID cannot be empty")
+	}
+	jobCtx := ctrl.getJobNodeContext(ctx, jobID)
+	ctrl.addJobLifecycleEvent(jobCtx, jobID, "write_ShardHeartbeatTimeout")
+	ev := ctrl.constructEvent(jobID, model.JobEventError)
+	// the target node is the "nodeID" because the error is about the
+	// compute node running the shard and not the requester node
+	ev.TargetNodeID = nodeID
+	ev.ShardIndex = shardIndex
+	ev.Status = status
+	return ctrl.writeEvent(jobCtx, ev)
+}
+
+// can only be done by the requestor node that is responsible for the job
+// when a compute node has stopped sending heartbeats for a shard - the shard
+// is taken off that node and other nodes can bid to run it (from the latest
+// checkpoint if the job checkpoints)
+func (ctrl *Controller) RescheduleShard(
+	ctx context.Context,
+	jobID, nodeID string,
+	shardIndex int,
+	status string,
+) error {
+	if jobID == "" {
+		return fmt.Errorf("RescheduleShard: jobID cannot be empty")
+	}
+	if nodeID == "" {
+		return fmt.Errorf("RescheduleShard: nodeID cannot be empty")
+	}
+	jobCtx := ctrl.getJobNodeContext(ctx, jobID)
+	ctrl.addJobLifecycleEvent(jobCtx, jobID, "write_RescheduleShard")
+	ev := ctrl.constructEvent(jobID, model.JobEventRescheduled)
+	// the target node is the node the shard is being taken off
+	ev.TargetNodeID = nodeID
+	ev.ShardIndex = shardIndex
+	ev.Status = status
+	return ctrl.writeEvent(jobCtx, ev)
+}
+
 // local event for requester to know it has already verified this job
 func (ctrl *Controller) CompleteVerification(
 	ctx context.Context,
@@ -337,6 +389,17 @@ func (ctrl *Controller) SelectJob(ctx context.Context, jobID string) error {
 	return err
 }
 
+// done by compute nodes when their job selection policy turns a job down
+// so operators can see why the node didn't bid
+func (ctrl *Controller) RejectJob(ctx context.Context, jobID, reason string) error {
+	jobCtx := ctrl.getJobNodeContext(ctx, jobID)
+	return ctrl.localdb.AddLocalEvent(jobCtx, jobID, model.JobLocalEvent{
+		EventName: model.JobLocalEventRejected,
+		JobID:     jobID,
+		Reason:    reason,
+	})
+}
+
 // done by compute nodes when they hear about the job
 func (ctrl *Controller) BidJob(ctx context.Context, shard model.JobShard) error {
 	jobCtx := ctrl.getJobNodeContext(ctx, shard.Job.ID)
@@ -355,10 +418,43 @@ func (ctrl *Controller) BidJob(ctx context.Context, shard model.JobShard) error
 }
 
 // called by a compute node who has already bid
-func (ctrl *Controller) CancelJobBid(ctx context.Context, jobID string) error {
+func (ctrl *Controller) CancelJobBid(ctx context.Context, shard model.JobShard) error {
+	jobCtx := ctrl.getJobNodeContext(ctx, shard.Job.ID)
+	ctrl.addJobLifecycleEvent(jobCtx, shard.Job.ID, "write_CancelJobBid")
+	ev := ctrl.constructEvent(shard.Job.ID, model.JobEventBidCancelled)
+	ev.ShardIndex = shard.Index
+	return ctrl.writeEvent(jobCtx, ev)
+}
+
+// sent periodically by the compute node while it is running a shard
+// so the requester knows it is still alive
+func (ctrl *Controller) ShardRunning(
+	ctx context.Context,
+	jobID string,
+	shardIndex int,
+	status string,
+) error {
 	jobCtx := ctrl.getJobNodeContext(ctx, jobID)
-	ctrl.addJobLifecycleEvent(jobCtx, jobID, "write_CancelJobBid")
-	ev := ctrl.constructEvent(jobID, model.JobEventBidCancelled)
+	ctrl.addJobLifecycleEvent(jobCtx, jobID, "write_ShardRunning")
+	ev := ctrl.constructEvent(jobID, model.JobEventRunning)
+	ev.Status = status
+	ev.ShardIndex = shardIndex
+	return ctrl.writeEvent(jobCtx, ev)
+}
+
+// sent by the compute node each time it uploads a new checkpoint of a
+// shard it is running
+func (ctrl *Controller) ShardCheckpointed(
+	ctx context.Context,
+	jobID string,
+	shardIndex int,
+	checkpoint model.StorageSpec,
+) error {
+	jobCtx := ctrl.getJobNodeContext(ctx, jobID)
+	ctrl.addJobLifecycleEvent(jobCtx, jobID, "write_ShardCheckpointed")
+	ev := ctrl.constructEvent(jobID, model.JobEventCheckpointed)
+	ev.ShardIndex = shardIndex
+	ev.Checkpoint = checkpoint
 	return ctrl.writeEvent(jobCtx, ev)
 }
 
@@ -368,12 +464,14 @@ func (ctrl *Controller) ShardExecutionFinished(
 	shardIndex int,
 	status string,
 	proposal []byte,
+	usage model.ResourceUsageMeasurement,
 ) error {
 	jobCtx := ctrl.getJobNodeContext(ctx, jobID)
 	ctrl.addJobLifecycleEvent(jobCtx, jobID, "write_ShardExecutionFinished")
 	ev := ctrl.constructEvent(jobID, model.JobEventResultsProposed)
 	ev.Status = status
 	ev.VerificationProposal = proposal
+	ev.ResourceUsage = usage
 	ev.ShardIndex = shardIndex
 	return ctrl.writeEvent(jobCtx, ev)
 }
@@ -543,6 +641,7 @@ func (ctrl *Controller) mutateDatastore(ctx context.Context, ev model.JobEvent)
 				VerificationProposal: ev.VerificationProposal,
 				VerificationResult:   ev.VerificationResult,
 				PublishedResult:      ev.PublishedResult,
+				ResourceUsage:        ev.ResourceUsage,
 			},
 		)
 		if err != nil {
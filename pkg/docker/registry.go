@@ -0,0 +1,406 @@
+package docker
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+)
+
+// docker hub goes by a few names depending on who you ask
+const dockerHubDomain = "docker.io"
+const dockerHubRegistry = "registry-1.docker.io"
+
+var dockerHubAliases = []string{dockerHubDomain, "index.docker.io", dockerHubRegistry}
+
+const (
+	mediaTypeManifestList  = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeManifest      = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeOCIIndex      = "application/vnd.oci.image.index.v1+json"
+	mediaTypeOCIManifest   = "application/vnd.oci.image.manifest.v1+json"
+	headerContentDigest    = "Docker-Content-Digest"
+	headerWWWAuthenticate  = "Www-Authenticate"
+	maxManifestSize        = 4 * 1024 * 1024
+	bearerChallengePrefix  = "bearer "
+	basicChallengePrefix   = "basic "
+	defaultImageTag        = "latest"
+	registryProtocolPrefix = "/v2/"
+)
+
+var manifestMediaTypes = []string{
+	mediaTypeManifestList,
+	mediaTypeOCIIndex,
+	mediaTypeManifest,
+	mediaTypeOCIManifest,
+}
+
+// RegistryCredentials are the logins for private registries, keyed by the
+// registry domain (e.g. "ghcr.io" or "docker.io").
+type RegistryCredentials map[string]types.AuthConfig
+
+// LoadRegistryCredentials reads credentials from a file in the same format
+// as the "auths" section of a docker config.json, so operators can point us
+// at the file `docker login` writes.
+func LoadRegistryCredentials(path string) (RegistryCredentials, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read registry credentials %s: %w", path, err)
+	}
+
+	var config struct {
+		Auths map[string]types.AuthConfig `json:"auths"`
+	}
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse registry credentials %s: %w", path, err)
+	}
+
+	credentials := RegistryCredentials{}
+	for registry, auth := range config.Auths {
+		// `docker login` only stores the combined base64 "user:password"
+		if auth.Auth != "" && auth.Username == "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("invalid auth for registry %s: %w", registry, err)
+			}
+			username, password, ok := strings.Cut(string(decoded), ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid auth for registry %s: expected user:password", registry)
+			}
+			auth.Username = username
+			auth.Password = password
+		}
+		domain := registryDomain(registry)
+		auth.ServerAddress = registry
+		credentials[domain] = auth
+	}
+	return credentials, nil
+}
+
+// ForImage returns the credentials for the registry the image lives in,
+// or nil if we don't have any.
+func (c RegistryCredentials) ForImage(image string) *types.AuthConfig {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return nil
+	}
+	auth, ok := c[registryDomain(reference.Domain(named))]
+	if !ok {
+		return nil
+	}
+	return &auth
+}
+
+// EncodeRegistryAuth encodes credentials the way the docker API wants them.
+func EncodeRegistryAuth(auth *types.AuthConfig) (string, error) {
+	if auth == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(auth)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(data), nil
+}
+
+// turn the various ways of writing a registry into just its domain
+// e.g. "https://index.docker.io/v1/" -> "docker.io"
+func registryDomain(registry string) string {
+	registry = strings.TrimPrefix(registry, "https://")
+	registry = strings.TrimPrefix(registry, "http://")
+	registry, _, _ = strings.Cut(registry, "/")
+	registry = strings.ToLower(registry)
+	for _, alias := range dockerHubAliases {
+		if registry == alias {
+			return dockerHubDomain
+		}
+	}
+	return registry
+}
+
+// RegistryClient talks to registries directly (without needing a docker
+// daemon) to find out what an image tag points to and how big it is.
+type RegistryClient struct {
+	Credentials RegistryCredentials
+	// registries to talk plain http to (e.g. a local test registry)
+	InsecureRegistries []string
+	HTTPClient         *http.Client
+}
+
+func NewRegistryClient(credentials RegistryCredentials) *RegistryClient {
+	return &RegistryClient{
+		Credentials: credentials,
+		HTTPClient:  http.DefaultClient,
+	}
+}
+
+// ResolveImageDigest pins an image to the digest its tag currently points
+// to e.g. "ubuntu:22.04" -> "docker.io/library/ubuntu:22.04@sha256:...".
+// Images that are already pinned are returned unchanged.
+func (c *RegistryClient) ResolveImageDigest(ctx context.Context, image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", fmt.Errorf("invalid image %s: %w", image, err)
+	}
+	if _, ok := named.(reference.Canonical); ok {
+		return image, nil
+	}
+	named = reference.TagNameOnly(named)
+
+	resp, err := c.getManifest(ctx, named, manifestReference(named), http.MethodHead)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	digest := resp.Header.Get(headerContentDigest)
+	if digest == "" {
+		return "", fmt.Errorf("registry did not return a digest for %s", image)
+	}
+	return fmt.Sprintf("%s@%s", reference.FamiliarString(named), digest), nil
+}
+
+// ImageSize adds up the compressed size of the layers of an image, which is
+// roughly how much we will download when we pull it. For multi platform
+// images we use the image for the platform we are running on.
+func (c *RegistryClient) ImageSize(ctx context.Context, image string) (uint64, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return 0, fmt.Errorf("invalid image %s: %w", image, err)
+	}
+	named = reference.TagNameOnly(named)
+
+	manifest, err := c.fetchManifest(ctx, named, manifestReference(named))
+	if err != nil {
+		return 0, err
+	}
+
+	if manifest.MediaType == mediaTypeManifestList || manifest.MediaType == mediaTypeOCIIndex {
+		platformDigest := ""
+		for _, platformManifest := range manifest.Manifests {
+			if platformManifest.Platform.OS == runtime.GOOS && platformManifest.Platform.Architecture == runtime.GOARCH {
+				platformDigest = platformManifest.Digest
+				break
+			}
+		}
+		if platformDigest == "" {
+			return 0, fmt.Errorf("image %s has no manifest for %s/%s", image, runtime.GOOS, runtime.GOARCH)
+		}
+		manifest, err = c.fetchManifest(ctx, named, platformDigest)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	size := manifest.Config.Size
+	for _, layer := range manifest.Layers {
+		size += layer.Size
+	}
+	return uint64(size), nil
+}
+
+type registryDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+	Platform  struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+	} `json:"platform"`
+}
+
+// the bits of manifests and manifest lists we care about
+type registryManifest struct {
+	MediaType string               `json:"mediaType"`
+	Config    registryDescriptor   `json:"config"`
+	Layers    []registryDescriptor `json:"layers"`
+	Manifests []registryDescriptor `json:"manifests"`
+}
+
+func (c *RegistryClient) fetchManifest(ctx context.Context, named reference.Named, ref string) (registryManifest, error) {
+	resp, err := c.getManifest(ctx, named, ref, http.MethodGet)
+	if err != nil {
+		return registryManifest{}, err
+	}
+	defer resp.Body.Close()
+
+	var manifest registryManifest
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&manifest)
+	if err != nil {
+		return registryManifest{}, fmt.Errorf("could not parse manifest for %s: %w", named.String(), err)
+	}
+	if manifest.MediaType == "" {
+		manifest.MediaType = resp.Header.Get("Content-Type")
+	}
+	return manifest, nil
+}
+
+// getManifest requests a manifest, logging in to the registry if it asks
+// us to. The caller must close the body of the response.
+func (c *RegistryClient) getManifest(
+	ctx context.Context,
+	named reference.Named,
+	ref string,
+	method string,
+) (*http.Response, error) {
+	url := fmt.Sprintf("%s%s%s/manifests/%s", c.registryURL(named), registryProtocolPrefix, reference.Path(named), ref)
+	auth := c.Credentials[registryDomain(reference.Domain(named))]
+
+	resp, err := c.doManifestRequest(ctx, method, url, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get(headerWWWAuthenticate)
+		resp.Body.Close()
+
+		authorization, err := c.authorize(ctx, challenge, auth)
+		if err != nil {
+			return nil, fmt.Errorf("could not log in to registry for %s: %w", named.String(), err)
+		}
+		resp, err = c.doManifestRequest(ctx, method, url, authorization)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("registry returned %s for %s", resp.Status, named.String())
+	}
+	return resp, nil
+}
+
+func (c *RegistryClient) doManifestRequest(ctx context.Context, method, url, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return c.HTTPClient.Do(req)
+}
+
+// authorize works out the Authorization header to use from the challenge
+// the registry gave us. Registries either want basic auth straight away or
+// (like docker hub) want us to swap our credentials for a bearer token.
+func (c *RegistryClient) authorize(ctx context.Context, challenge string, auth types.AuthConfig) (string, error) {
+	lowerChallenge := strings.ToLower(challenge)
+	switch {
+	case strings.HasPrefix(lowerChallenge, basicChallengePrefix):
+		if auth.Username == "" {
+			return "", errors.New("registry wants a login but we have no credentials for it")
+		}
+		return basicAuthorization(auth), nil
+	case strings.HasPrefix(lowerChallenge, bearerChallengePrefix):
+		return c.fetchBearerToken(ctx, parseChallengeParams(challenge[len(bearerChallengePrefix):]), auth)
+	default:
+		return "", fmt.Errorf("unsupported registry auth challenge: %s", challenge)
+	}
+}
+
+func (c *RegistryClient) fetchBearerToken(ctx context.Context, params map[string]string, auth types.AuthConfig) (string, error) {
+	realm := params["realm"]
+	if realm == "" {
+		return "", errors.New("registry auth challenge has no realm")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm, nil)
+	if err != nil {
+		return "", err
+	}
+	query := req.URL.Query()
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			query.Set(key, params[key])
+		}
+	}
+	req.URL.RawQuery = query.Encode()
+	// anonymous tokens are fine for public images
+	if auth.Username != "" {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry token server returned %s", resp.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return "", err
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return "", errors.New("registry token server returned no token")
+	}
+	return "Bearer " + token.Token, nil
+}
+
+func (c *RegistryClient) registryURL(named reference.Named) string {
+	domain := reference.Domain(named)
+	if domain == dockerHubDomain {
+		domain = dockerHubRegistry
+	}
+	for _, insecure := range c.InsecureRegistries {
+		if insecure == domain {
+			return "http://" + domain
+		}
+	}
+	return "https://" + domain
+}
+
+// what to ask the registry for - the digest if the image is pinned,
+// otherwise its tag
+func manifestReference(named reference.Named) string {
+	if canonical, ok := named.(reference.Canonical); ok {
+		return canonical.Digest().String()
+	}
+	if tagged, ok := named.(reference.Tagged); ok {
+		return tagged.Tag()
+	}
+	return defaultImageTag
+}
+
+func basicAuthorization(auth types.AuthConfig) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(auth.Username+":"+auth.Password))
+}
+
+// parse `realm="https://auth.docker.io/token",service="registry.docker.io"`
+func parseChallengeParams(params string) map[string]string {
+	result := map[string]string{}
+	for params != "" {
+		var key, value string
+		key, params, _ = strings.Cut(params, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if strings.HasPrefix(params, `"`) {
+			value, params, _ = strings.Cut(params[1:], `"`)
+			_, params, _ = strings.Cut(params, ",")
+		} else {
+			value, params, _ = strings.Cut(params, ",")
+		}
+		result[key] = strings.TrimSpace(value)
+	}
+	return result
+}
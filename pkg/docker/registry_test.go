@@ -0,0 +1,127 @@
+package docker
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/filecoin-project/bacalhau/pkg/storage/util"
+	"github.com/stretchr/testify/require"
+)
+
+const testListDigest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+const testManifestDigest = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+
+// a registry that wants a bearer token from its own token endpoint, which
+// only hands them out to alice
+func newTestRegistry(t *testing.T) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			username, password, ok := r.BasicAuth()
+			if !ok || username != "alice" || password != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			require.Equal(t, "repository:team/app:pull", r.URL.Query().Get("scope"))
+			_ = json.NewEncoder(w).Encode(map[string]string{"token": "let-me-in"})
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer let-me-in" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(
+				`Bearer realm="%s/token",service="test",scope="repository:team/app:pull"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v2/team/app/manifests/v1":
+			w.Header().Set(headerContentDigest, testListDigest)
+			w.Header().Set("Content-Type", mediaTypeManifestList)
+			_, _ = fmt.Fprintf(w, `{"mediaType": %q, "manifests": [
+				{"digest": "sha256:other", "platform": {"os": "plan9", "architecture": "mips"}},
+				{"digest": %q, "platform": {"os": %q, "architecture": %q}}
+			]}`, mediaTypeManifestList, testManifestDigest, runtime.GOOS, runtime.GOARCH)
+		case "/v2/team/app/manifests/" + testManifestDigest:
+			w.Header().Set(headerContentDigest, testManifestDigest)
+			_, _ = fmt.Fprintf(w, `{"mediaType": %q, "config": {"size": 10}, "layers": [{"size": 100}, {"size": 1000}]}`,
+				mediaTypeManifest)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestRegistryClient(server *httptest.Server, credentials RegistryCredentials) (*RegistryClient, string) {
+	host := strings.TrimPrefix(server.URL, "http://")
+	client := NewRegistryClient(credentials)
+	client.InsecureRegistries = []string{host}
+	return client, host
+}
+
+func TestRegistryClient(t *testing.T) {
+	ctx := context.Background()
+	server := newTestRegistry(t)
+	client, host := newTestRegistryClient(server, RegistryCredentials{})
+	client.Credentials[host] = types.AuthConfig{Username: "alice", Password: "secret"}
+
+	image := host + "/team/app:v1"
+	pinned, err := client.ResolveImageDigest(ctx, image)
+	require.NoError(t, err)
+	require.Equal(t, image+"@"+testListDigest, pinned)
+
+	// pinned images are left alone
+	again, err := client.ResolveImageDigest(ctx, pinned)
+	require.NoError(t, err)
+	require.Equal(t, pinned, again)
+
+	size, err := client.ImageSize(ctx, image)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1110), size)
+
+	_, err = client.ResolveImageDigest(ctx, host+"/team/app:missing")
+	require.Error(t, err)
+}
+
+func TestRegistryClientWithoutCredentials(t *testing.T) {
+	server := newTestRegistry(t)
+	client, host := newTestRegistryClient(server, RegistryCredentials{})
+
+	_, err := client.ResolveImageDigest(context.Background(), host+"/team/app:v1")
+	require.Error(t, err)
+}
+
+func TestLoadRegistryCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := fmt.Sprintf(`{"auths": {
+		"https://index.docker.io/v1/": {"auth": %q},
+		"ghcr.io": {"username": "bob", "password": "hunter2"}
+	}}`, base64.StdEncoding.EncodeToString([]byte("alice:secret")))
+	require.NoError(t, os.WriteFile(path, []byte(config), util.OS_USER_RW))
+
+	credentials, err := LoadRegistryCredentials(path)
+	require.NoError(t, err)
+
+	hub := credentials.ForImage("ubuntu:22.04")
+	require.NotNil(t, hub)
+	require.Equal(t, "alice", hub.Username)
+	require.Equal(t, "secret", hub.Password)
+
+	ghcr := credentials.ForImage("ghcr.io/bob/app")
+	require.NotNil(t, ghcr)
+	require.Equal(t, "bob", ghcr.Username)
+
+	require.Nil(t, credentials.ForImage("quay.io/someone/app"))
+}
@@ -10,7 +10,9 @@ import (
 	"time"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
 	dockerclient "github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/filecoin-project/bacalhau/pkg/config"
 	"github.com/filecoin-project/bacalhau/pkg/system"
 	"github.com/moby/moby/pkg/stdcopy"
@@ -194,23 +196,50 @@ func WaitForContainerLogs(ctx context.Context,
 	return lastLogs, err
 }
 
-func PullImage(ctx context.Context, dockerClient *dockerclient.Client, image string) error {
+// PullImage pulls the image through the docker API, logging in to the
+// registry with auth if it isn't nil.
+func PullImage(ctx context.Context, dockerClient *dockerclient.Client, image string, auth *types.AuthConfig) error {
+	registryAuth, err := EncodeRegistryAuth(auth)
+	if err != nil {
+		return err
+	}
+
 	imagePullStream, err := dockerClient.ImagePull(
 		ctx,
 		image,
-		types.ImagePullOptions{},
+		types.ImagePullOptions{
+			RegistryAuth: registryAuth,
+		},
 	)
-
 	if err != nil {
 		return err
 	}
+	defer imagePullStream.Close()
 
+	// the pull only happens while we read the stream so we have to drain it
+	// even if we don't want to see the progress - it also carries any errors
+	var output io.Writer = io.Discard
 	if config.IsDebug() {
-		_, err = io.Copy(os.Stdout, imagePullStream)
+		output = os.Stdout
+	}
+	return jsonmessage.DisplayJSONMessagesStream(imagePullStream, output, 0, false, nil)
+}
+
+func RemoveNetworksWithLabel(ctx context.Context,
+	dockerClient *dockerclient.Client,
+	labelName, labelValue string) error {
+	networks, err := dockerClient.NetworkList(ctx, types.NetworkListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", labelName, labelValue))),
+	})
+	if err != nil {
+		return err
+	}
+	//nolint:gocritic // same as containers above
+	for _, network := range networks {
+		err = dockerClient.NetworkRemove(ctx, network.ID)
 		if err != nil {
 			return err
 		}
 	}
-
-	return imagePullStream.Close()
+	return nil
 }
@@ -0,0 +1,47 @@
+package executor
+
+import "context"
+
+type gpuDevicesContextKey struct{}
+
+// WithGPUDevices returns a context that tells the executor which GPU device
+// IDs the compute node has allocated to the shard it is about to run.
+func WithGPUDevices(ctx context.Context, devices []string) context.Context {
+	return context.WithValue(ctx, gpuDevicesContextKey{}, devices)
+}
+
+// GPUDevicesFromContext returns the GPU device IDs allocated to the shard,
+// or nil if the compute node did not allocate any.
+func GPUDevicesFromContext(ctx context.Context) []string {
+	devices, ok := ctx.Value(gpuDevicesContextKey{}).([]string)
+	if !ok {
+		return nil
+	}
+	return devices
+}
+
+type readOnlyMountsContextKey struct{}
+
+// ReadOnlyMount is a folder on the compute node to mount into a job.
+type ReadOnlyMount struct {
+	Source string
+	Target string
+}
+
+// WithReadOnlyMounts returns a context that tells the executor to mount
+// extra folders into the shard it is about to run. This is how executors
+// that wrap other executors hand them things they have prepared on the node
+// (e.g. the packages a python job needs) - it is never set from a job spec.
+func WithReadOnlyMounts(ctx context.Context, mounts []ReadOnlyMount) context.Context {
+	return context.WithValue(ctx, readOnlyMountsContextKey{}, mounts)
+}
+
+// ReadOnlyMountsFromContext returns the extra folders to mount into the
+// shard, or nil if there are none.
+func ReadOnlyMountsFromContext(ctx context.Context) []ReadOnlyMount {
+	mounts, ok := ctx.Value(readOnlyMountsContextKey{}).([]ReadOnlyMount)
+	if !ok {
+		return nil
+	}
+	return mounts
+}
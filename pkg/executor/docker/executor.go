@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"runtime/debug"
+	"time"
 
 	dockertypes "github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
@@ -20,15 +22,21 @@ import (
 	"github.com/filecoin-project/bacalhau/pkg/executor"
 	jobutils "github.com/filecoin-project/bacalhau/pkg/job"
 	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/proxy"
 	"github.com/filecoin-project/bacalhau/pkg/storage"
 	"github.com/filecoin-project/bacalhau/pkg/storage/util"
 	"github.com/filecoin-project/bacalhau/pkg/system"
+	sync "github.com/lukemarsden/golang-mutex-tracer"
 	"github.com/rs/zerolog/log"
 	"go.opentelemetry.io/otel/trace"
 )
 
 const NanoCPUCoefficient = 1000000000
 
+// where the progress folder is mounted inside the container
+const progressContainerDir = "/bacalhau_progress"
+const progressFileName = "progress"
+
 type Executor struct {
 	// used to allow multiple docker executors to run against the same docker server
 	ID string
@@ -40,6 +48,22 @@ type Executor struct {
 	StorageProviders map[model.StorageSourceType]storage.StorageProvider
 
 	Client *dockerclient.Client
+
+	// the hardening applied to job containers
+	SecurityProfile SecurityProfile
+	seccompProfile  string
+
+	// logins for private registries we pull images from
+	RegistryCredentials docker.RegistryCredentials
+	registry            *docker.RegistryClient
+
+	// whether egress proxies let jobs reach the compute node itself
+	AllowLocalNetwork bool
+
+	// egress proxies for running shards that have a network allow list,
+	// keyed by the name of the shard's network
+	proxies   map[string]*proxy.EgressProxy
+	proxiesMu sync.Mutex
 }
 
 func NewExecutor(
@@ -47,24 +71,45 @@ func NewExecutor(
 	cm *system.CleanupManager,
 	id string,
 	storageProviders map[model.StorageSourceType]storage.StorageProvider,
+	executorConfig ExecutorConfig,
 ) (*Executor, error) {
 	dockerClient, err := docker.NewDockerClient()
 	if err != nil {
 		return nil, err
 	}
 
+	seccompProfile, err := executorConfig.SecurityProfile.loadSeccompProfile()
+	if err != nil {
+		return nil, err
+	}
+	_, _, _, err = executorConfig.SecurityProfile.jobUser(model.JobSpecDockerRelaxations{})
+	if err != nil {
+		return nil, err
+	}
+
 	dir, err := ioutil.TempDir("", "bacalhau-docker-executor")
 	if err != nil {
 		return nil, err
 	}
 
 	de := &Executor{
-		ID:               id,
-		ResultsDir:       dir,
-		StorageProviders: storageProviders,
-		Client:           dockerClient,
+		ID:                  id,
+		ResultsDir:          dir,
+		StorageProviders:    storageProviders,
+		Client:              dockerClient,
+		SecurityProfile:     executorConfig.SecurityProfile,
+		seccompProfile:      seccompProfile,
+		RegistryCredentials: executorConfig.RegistryCredentials,
+		registry:            docker.NewRegistryClient(executorConfig.RegistryCredentials),
+		AllowLocalNetwork:   executorConfig.AllowLocalNetwork,
+		proxies:             map[string]*proxy.EgressProxy{},
 	}
 
+	de.proxiesMu.EnableTracerWithOpts(sync.Opts{
+		Threshold: 10 * time.Millisecond,
+		Id:        "DockerExecutor.proxiesMu",
+	})
+
 	cm.RegisterCallback(func() error {
 		de.cleanupAll(ctx)
 		return nil
@@ -117,6 +162,8 @@ func (e *Executor) RunShard(
 	// the actual mounts we will give to the container
 	// these are paths for both input and output data
 	mounts := []mount.Mount{}
+	volumes := &executor.PreparedVolumes{}
+	defer volumes.Cleanup(ctx)
 
 	shardStorageSpec, err := jobutils.GetShardStorageSpec(ctx, shard, e.StorageProviders)
 	if err != nil {
@@ -132,7 +179,7 @@ func (e *Executor) RunShard(
 			return err
 		}
 
-		volumeMount, err = storageProvider.PrepareStorage(ctx, spec)
+		volumeMount, err = volumes.Prepare(ctx, storageProvider, spec)
 		if err != nil {
 			return err
 		}
@@ -182,7 +229,8 @@ func (e *Executor) RunShard(
 		}
 
 		srcd := fmt.Sprintf("%s/%s", jobResultsDir, output.Name)
-		err = os.Mkdir(srcd, util.OS_ALL_R|util.OS_ALL_X|util.OS_USER_W)
+		// the job might run as a user that doesn't own the results folder
+		err = e.createJobDir(shard, srcd)
 		if err != nil {
 			return err
 		}
@@ -204,25 +252,32 @@ func (e *Executor) RunShard(
 		})
 	}
 
-	if os.Getenv("SKIP_IMAGE_PULL") == "" {
-		// TODO: #283 work out why this does not work in github actions
-		// err = docker.PullImage(e.Client, job.Spec.Vm.Image)
-		var im dockertypes.ImageInspect
-		im, _, err = e.Client.ImageInspectWithRaw(ctx, shard.Job.Spec.Docker.Image)
-		if err == nil {
-			log.Debug().Msgf("Not pulling image %s, already have %s", shard.Job.Spec.Docker.Image, im.ID)
-		} else if dockerclient.IsErrNotFound(err) {
-			stdout, err := system.RunCommandGetResults( //nolint:govet // shadowing ok
-				"docker",
-				[]string{"pull", shard.Job.Spec.Docker.Image},
-			)
-			if err != nil {
-				return fmt.Errorf("error pulling %s: %s, %s", shard.Job.Spec.Docker.Image, err, stdout)
-			}
-			log.Trace().Msgf("Pull image output: %s\n%s", shard.Job.Spec.Docker.Image, stdout)
-		} else {
-			return fmt.Errorf("error checking if we have %s locally: %s", shard.Job.Spec.Docker.Image, err)
-		}
+	// folders prepared for the job by executors that wrap this one
+	for _, readOnlyMount := range executor.ReadOnlyMountsFromContext(ctx) {
+		log.Trace().Msgf("Read only Volume: %+v", readOnlyMount)
+		mounts = append(mounts, mount.Mount{
+			Type:     "bind",
+			ReadOnly: true,
+			Source:   readOnlyMount.Source,
+			Target:   readOnlyMount.Target,
+		})
+	}
+
+	// give the job somewhere to report its progress
+	progressDir, err := e.ensureProgressDir(shard)
+	if err != nil {
+		return err
+	}
+	mounts = append(mounts, mount.Mount{
+		Type:     "bind",
+		ReadOnly: false,
+		Source:   progressDir,
+		Target:   progressContainerDir,
+	})
+
+	err = e.ensureImage(ctx, shard.Job.Spec.Docker)
+	if err != nil {
+		return err
 	}
 
 	// json the job spec and pass it into all containers
@@ -234,15 +289,15 @@ func (e *Executor) RunShard(
 	}
 
 	useEnv := append(shard.Job.Spec.Docker.Env, fmt.Sprintf("BACALHAU_JOB_SPEC=%s", string(jsonJobSpec))) //nolint:gocritic
+	useEnv = append(useEnv, fmt.Sprintf("%s=%s", executor.ProgressFileEnvVar, filepath.Join(progressContainerDir, progressFileName)))
 
 	containerConfig := &container.Config{
-		Image:           shard.Job.Spec.Docker.Image,
-		Tty:             false,
-		Env:             useEnv,
-		Entrypoint:      shard.Job.Spec.Docker.Entrypoint,
-		Labels:          e.jobContainerLabels(shard.Job),
-		NetworkDisabled: true,
-		WorkingDir:      shard.Job.Spec.Docker.WorkingDir,
+		Image:      shard.Job.Spec.Docker.Image,
+		Tty:        false,
+		Env:        useEnv,
+		Entrypoint: shard.Job.Spec.Docker.Entrypoint,
+		Labels:     e.shardContainerLabels(shard),
+		WorkingDir: shard.Job.Spec.Docker.WorkingDir,
 	}
 
 	log.Trace().Msgf("Container: %+v %+v", containerConfig, mounts)
@@ -252,31 +307,47 @@ func (e *Executor) RunShard(
 	// Create GPU request if the job requests it
 	var deviceRequests []container.DeviceRequest
 	if resourceRequirements.GPU > 0 {
-		deviceRequests = append(deviceRequests,
-			container.DeviceRequest{
-				DeviceIDs:    []string{"0"}, // TODO: how do we know which device ID to use?
-				Capabilities: [][]string{{"gpu"}},
-			},
-		)
-		log.Trace().Msgf("Adding %d GPUs to request", resourceRequirements.GPU)
+		deviceRequest := container.DeviceRequest{
+			Capabilities: [][]string{{"gpu"}},
+		}
+		// the compute node tells us which devices it has allocated to this shard
+		// if we are being run outside of a compute node we let docker pick
+		if gpuDevices := executor.GPUDevicesFromContext(ctx); len(gpuDevices) > 0 {
+			deviceRequest.DeviceIDs = gpuDevices
+		} else {
+			deviceRequest.Count = int(resourceRequirements.GPU)
+		}
+		deviceRequests = append(deviceRequests, deviceRequest)
+		log.Trace().Msgf("Adding %d GPUs to request: %+v", resourceRequirements.GPU, deviceRequest.DeviceIDs)
+	}
+
+	hostConfig := &container.HostConfig{
+		Mounts: mounts,
+		Resources: container.Resources{
+			Memory:         int64(resourceRequirements.Memory),
+			NanoCPUs:       int64(resourceRequirements.CPU * NanoCPUCoefficient),
+			DeviceRequests: deviceRequests,
+		},
+	}
+
+	e.SecurityProfile.apply(shard.Job.Spec.Docker.Relaxations, e.seccompProfile, containerConfig, hostConfig)
+
+	err = e.setupShardNetwork(ctx, shard, containerConfig, hostConfig)
+	if err != nil {
+		e.cleanupShardNetwork(ctx, shard)
+		return err
 	}
 
 	jobContainer, err := e.Client.ContainerCreate(
 		ctx,
 		containerConfig,
-		&container.HostConfig{
-			Mounts: mounts,
-			Resources: container.Resources{
-				Memory:         int64(resourceRequirements.Memory),
-				NanoCPUs:       int64(resourceRequirements.CPU * NanoCPUCoefficient),
-				DeviceRequests: deviceRequests,
-			},
-		},
+		hostConfig,
 		&network.NetworkingConfig{},
 		nil,
 		e.jobContainerName(shard),
 	)
 	if err != nil {
+		e.cleanupShardNetwork(ctx, shard)
 		return fmt.Errorf("failed to create container: %w", err)
 	}
 
@@ -289,19 +360,65 @@ func (e *Executor) RunShard(
 		return fmt.Errorf("failed to start container: %w", err)
 	}
 
+	return e.waitForShardContainer(ctx, shard, jobContainer.ID, jobResultsDir)
+}
+
+// ReattachShard picks up the container of a shard that was started before
+// the compute node restarted. If the container still exists we wait for it to
+// exit (which returns straight away if it already has) and write its results
+// exactly like RunShard would. We return false if there is no such container.
+func (e *Executor) ReattachShard(
+	ctx context.Context,
+	shard model.JobShard,
+	jobResultsDir string,
+) (bool, error) {
+	//nolint:ineffassign,staticcheck
+	ctx, span := system.GetTracer().Start(ctx, "pkg/executor/docker.ReattachShard")
+	defer span.End()
+
+	containers, err := docker.GetContainersWithLabel(ctx, e.Client, "bacalhau-executor", e.ID)
+	if err != nil {
+		return false, err
+	}
+
+	shardLabels := e.shardContainerLabels(shard)
+
+	//nolint:gocritic // will fix when we care
+	for _, container := range containers {
+		if labelsMatch(container.Labels, shardLabels) {
+			log.Info().Msgf("Reattaching to container %s for shard %s", container.ID, shard)
+			return true, e.waitForShardContainer(ctx, shard, container.ID, jobResultsDir)
+		}
+	}
+
+	return false, nil
+}
+
+// wait for the shard container to exit and write its stdout, stderr and
+// exit code into the results folder, then remove the container
+func (e *Executor) waitForShardContainer(
+	ctx context.Context,
+	shard model.JobShard,
+	containerID string,
+	jobResultsDir string,
+) error {
 	defer e.cleanupJob(ctx, shard)
 
+	statsCtx, stopStats := context.WithCancel(ctx)
+	defer stopStats()
+	sampledUsage := e.sampleContainerUsage(statsCtx, containerID)
+
 	// the idea here is even if the container errors
 	// we want to capture stdout, stderr and feed it back to the user
 	var containerError error
 	var containerExitStatusCode int64
 	statusCh, errCh := e.Client.ContainerWait(
 		ctx,
-		jobContainer.ID,
+		containerID,
 		container.WaitConditionNotRunning,
 	)
 	select {
-	case err = <-errCh:
+	case err := <-errCh:
 		containerError = err
 	case exitStatus := <-statusCh:
 		containerExitStatusCode = exitStatus.StatusCode
@@ -315,13 +432,15 @@ func (e *Executor) RunShard(
 		}
 		log.Info().Msgf("container error %s", containerError)
 	}
+	stopStats()
+	usage := e.getContainerUsage(ctx, shard, containerID, jobResultsDir, <-sampledUsage)
 
 	stdout, stderr, err := system.RunCommandGetStdoutAndStderr(
 		"docker",
 		[]string{
 			"logs",
 			"-f",
-			jobContainer.ID,
+			containerID,
 		},
 	)
 	if err != nil {
@@ -361,19 +480,91 @@ func (e *Executor) RunShard(
 		return errors.New(msg)
 	}
 
+	err = executor.WriteResourceUsage(jobResultsDir, usage)
+	if err != nil {
+		msg := fmt.Sprintf("could not write results to %s: %s", executor.ResourceUsageFileName, err)
+		log.Error().Msg(msg)
+		return errors.New(msg)
+	}
+
 	return containerError
 }
 
+// GetShardProgress reads the progress the job last wrote to its progress file.
+func (e *Executor) GetShardProgress(
+	ctx context.Context,
+	shard model.JobShard,
+) (model.ShardProgress, bool, error) {
+	data, err := os.ReadFile(filepath.Join(e.progressDir(shard), progressFileName))
+	if os.IsNotExist(err) {
+		return model.ShardProgress{}, false, nil
+	} else if err != nil {
+		return model.ShardProgress{}, false, err
+	}
+	progress := model.ParseShardProgress(string(data))
+	return progress, !progress.IsEmpty(), nil
+}
+
+// the host folder mounted into the container for the job to write its
+// progress into - kept out of the results so it isn't published
+func (e *Executor) progressDir(shard model.JobShard) string {
+	return filepath.Join(e.ResultsDir, "progress", e.jobContainerName(shard))
+}
+
+// ensureProgressDir creates the progress folder so that only the user the
+// job runs as can write to it, and we can still read it.
+func (e *Executor) ensureProgressDir(shard model.JobShard) (string, error) {
+	dir := e.progressDir(shard)
+	err := e.createJobDir(shard, dir)
+	if err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// createJobDir creates a folder the job writes to (0755) and gives it to
+// the user the job runs as if that isn't us, so only the job can write to
+// it and we can still read it.
+func (e *Executor) createJobDir(shard model.JobShard, dir string) error {
+	err := os.MkdirAll(dir, util.OS_USER_RWX|util.OS_ALL_R|util.OS_ALL_X)
+	if err != nil {
+		return err
+	}
+	// MkdirAll is subject to the umask
+	err = os.Chmod(dir, util.OS_USER_RWX|util.OS_ALL_R|util.OS_ALL_X)
+	if err != nil {
+		return err
+	}
+
+	uid, gid, ok, err := e.SecurityProfile.jobUser(shard.Job.Spec.Docker.Relaxations)
+	if err != nil || !ok {
+		return err
+	}
+	err = os.Chown(dir, uid, gid)
+	if err != nil {
+		return fmt.Errorf("could not give %s to the job's user %s: %w", dir, e.SecurityProfile.User, err)
+	}
+	return nil
+}
+
 func (e *Executor) cleanupJob(ctx context.Context, shard model.JobShard) {
 	if config.ShouldKeepStack() {
 		return
 	}
 
-	err := docker.RemoveContainer(ctx, e.Client, e.jobContainerName(shard))
+	err := os.RemoveAll(e.progressDir(shard))
+	if err != nil {
+		log.Debug().Msgf("Docker executor progress cleanup error: %s", err.Error())
+	}
+
+	err = docker.RemoveContainer(ctx, e.Client, e.jobContainerName(shard))
 	if err != nil {
 		log.Error().Msgf("Docker remove container error: %s", err.Error())
 		debug.PrintStack()
 	}
+
+	// the network can only go once nothing is attached to it
+	e.cleanupShardNetwork(ctx, shard)
 }
 
 func (e *Executor) cleanupAll(ctx context.Context) {
@@ -395,6 +586,18 @@ func (e *Executor) cleanupAll(ctx context.Context) {
 			log.Error().Msgf("Non-critical error cleaning up container: %s", err.Error())
 		}
 	}
+
+	e.proxiesMu.Lock()
+	for name, egressProxy := range e.proxies {
+		_ = egressProxy.Stop()
+		delete(e.proxies, name)
+	}
+	e.proxiesMu.Unlock()
+
+	err = docker.RemoveNetworksWithLabel(ctx, e.Client, "bacalhau-executor", e.ID)
+	if err != nil {
+		log.Error().Msgf("Non-critical error cleaning up networks: %s", err.Error())
+	}
 }
 
 func (e *Executor) jobContainerName(shard model.JobShard) string {
@@ -408,9 +611,27 @@ func (e *Executor) jobContainerLabels(job model.Job) map[string]string {
 	}
 }
 
+func (e *Executor) shardContainerLabels(shard model.JobShard) map[string]string {
+	labels := e.jobContainerLabels(shard.Job)
+	labels["bacalhau-shardIndex"] = fmt.Sprintf("%d", shard.Index)
+	return labels
+}
+
+func labelsMatch(labels, want map[string]string) bool {
+	for key, value := range want {
+		if labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
 func newSpan(ctx context.Context, apiName string) (context.Context, trace.Span) {
 	return system.Span(ctx, "executor/docker", apiName)
 }
 
 // Compile-time interface check:
 var _ executor.Executor = (*Executor)(nil)
+var _ executor.ShardReattacher = (*Executor)(nil)
+var _ executor.ShardProgressReporter = (*Executor)(nil)
+var _ executor.ImageSizer = (*Executor)(nil)
@@ -0,0 +1,95 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	dockerclient "github.com/docker/docker/client"
+	"github.com/filecoin-project/bacalhau/pkg/docker"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+// ExecutorConfig is how the node operator configures the docker executor.
+type ExecutorConfig struct {
+	// the hardening applied to job containers
+	SecurityProfile SecurityProfile
+	// logins for private registries we pull images from
+	RegistryCredentials docker.RegistryCredentials
+	// let jobs with a network allow list reach addresses on the compute
+	// node itself (e.g. 127.0.0.1) through their egress proxy
+	AllowLocalNetwork bool
+}
+
+func NewDefaultExecutorConfig() ExecutorConfig {
+	return ExecutorConfig{
+		SecurityProfile:     NewDefaultSecurityProfile(),
+		RegistryCredentials: docker.RegistryCredentials{},
+	}
+}
+
+// the pull policy of the job unless the node has been told never to pull
+// (this is mostly useful for tests that build images locally)
+func pullPolicy(spec model.JobSpecDocker) model.ImagePullPolicy {
+	if os.Getenv("SKIP_IMAGE_PULL") != "" {
+		return model.PullNever
+	}
+	return spec.PullPolicy
+}
+
+func (e *Executor) hasImage(ctx context.Context, image string) (bool, error) {
+	_, _, err := e.Client.ImageInspectWithRaw(ctx, image)
+	if err == nil {
+		return true, nil
+	}
+	if dockerclient.IsErrNotFound(err) {
+		return false, nil
+	}
+	return false, fmt.Errorf("error checking if we have %s locally: %w", image, err)
+}
+
+// ensureImage makes sure we have the job's image, pulling it if the job's
+// pull policy says we should.
+func (e *Executor) ensureImage(ctx context.Context, spec model.JobSpecDocker) error {
+	policy := pullPolicy(spec)
+	if policy != model.PullAlways {
+		haveImage, err := e.hasImage(ctx, spec.Image)
+		if err != nil {
+			return err
+		}
+		if haveImage {
+			log.Debug().Msgf("Not pulling image %s, we already have it", spec.Image)
+			return nil
+		}
+		if policy == model.PullNever {
+			return fmt.Errorf("image %s is not on this node and the pull policy is %s", spec.Image, policy)
+		}
+	}
+
+	log.Debug().Msgf("Pulling image %s", spec.Image)
+	err := docker.PullImage(ctx, e.Client, spec.Image, e.RegistryCredentials.ForImage(spec.Image))
+	if err != nil {
+		return fmt.Errorf("error pulling %s: %w", spec.Image, err)
+	}
+	return nil
+}
+
+// GetImageSize tells the compute node how much disk we will use pulling the
+// job's image. Images we already have (and won't pull again) cost nothing.
+func (e *Executor) GetImageSize(ctx context.Context, spec model.JobSpec) (uint64, error) {
+	policy := pullPolicy(spec.Docker)
+	if policy == model.PullNever {
+		return 0, nil
+	}
+	if policy == model.PullIfNotPresent {
+		haveImage, err := e.hasImage(ctx, spec.Docker.Image)
+		if err != nil {
+			return 0, err
+		}
+		if haveImage {
+			return 0, nil
+		}
+	}
+	return e.registry.ImageSize(ctx, spec.Docker.Image)
+}
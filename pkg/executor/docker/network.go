@@ -0,0 +1,115 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/proxy"
+	"github.com/rs/zerolog/log"
+)
+
+// setupShardNetwork connects the job container to the network the job spec
+// asks for. Jobs without networking keep docker networking disabled
+// altogether. Jobs with full networking get their own bridge network.
+// Jobs with an allow list get an internal network (no route out of the
+// host) and an egress proxy listening on the network gateway that only
+// lets through requests to the allowed hosts - the container is pointed at
+// it with the usual *_PROXY environment variables. The proxy never lets
+// jobs reach the node itself unless the operator has allowed it.
+func (e *Executor) setupShardNetwork(
+	ctx context.Context,
+	shard model.JobShard,
+	containerConfig *container.Config,
+	hostConfig *container.HostConfig,
+) error {
+	networkSpec := shard.Job.Spec.Network
+	if networkSpec.Type == model.NetworkNone {
+		containerConfig.NetworkDisabled = true
+		return nil
+	}
+
+	networkName := e.jobContainerName(shard)
+	_, err := e.Client.NetworkCreate(ctx, networkName, dockertypes.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         "bridge",
+		Internal:       networkSpec.Type == model.NetworkAllowList,
+		Labels:         e.shardContainerLabels(shard),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create network for job: %w", err)
+	}
+	hostConfig.NetworkMode = container.NetworkMode(networkName)
+
+	if networkSpec.Type != model.NetworkAllowList {
+		return nil
+	}
+
+	allowList, err := proxy.ParseAllowList(networkSpec.AllowList, e.AllowLocalNetwork)
+	if err != nil {
+		return err
+	}
+
+	gateway, err := e.networkGateway(ctx, networkName)
+	if err != nil {
+		return err
+	}
+
+	egressProxy := proxy.NewEgressProxy(allowList)
+	proxyAddress, err := egressProxy.Start(net.JoinHostPort(gateway, "0"))
+	if err != nil {
+		return err
+	}
+	e.proxiesMu.Lock()
+	e.proxies[networkName] = egressProxy
+	e.proxiesMu.Unlock()
+
+	log.Debug().Msgf("Job %s shard %d egress proxy listening on %s", shard.Job.ID, shard.Index, proxyAddress)
+
+	proxyURL := fmt.Sprintf("http://%s", proxyAddress)
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy"} {
+		containerConfig.Env = append(containerConfig.Env, fmt.Sprintf("%s=%s", name, proxyURL))
+	}
+	return nil
+}
+
+func (e *Executor) networkGateway(ctx context.Context, networkName string) (string, error) {
+	networkResource, err := e.Client.NetworkInspect(ctx, networkName, dockertypes.NetworkInspectOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect job network: %w", err)
+	}
+	for _, ipamConfig := range networkResource.IPAM.Config {
+		if ipamConfig.Gateway != "" {
+			return ipamConfig.Gateway, nil
+		}
+	}
+	return "", fmt.Errorf("job network %s has no gateway", networkName)
+}
+
+// cleanupShardNetwork stops the egress proxy and removes the network of a
+// shard if it had either.
+func (e *Executor) cleanupShardNetwork(ctx context.Context, shard model.JobShard) {
+	networkName := e.jobContainerName(shard)
+
+	e.proxiesMu.Lock()
+	egressProxy, ok := e.proxies[networkName]
+	delete(e.proxies, networkName)
+	e.proxiesMu.Unlock()
+	if ok {
+		err := egressProxy.Stop()
+		if err != nil {
+			log.Debug().Msgf("Docker executor egress proxy stop error: %s", err.Error())
+		}
+	}
+
+	if shard.Job.Spec.Network.Type == model.NetworkNone {
+		return
+	}
+	err := e.Client.NetworkRemove(ctx, networkName)
+	if err != nil {
+		log.Debug().Msgf("Docker executor network cleanup error: %s", err.Error())
+	}
+}
@@ -0,0 +1,133 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+)
+
+// SecurityProfile is the hardening the node operator wants applied to job
+// containers. The zero value leaves everything at the docker defaults.
+// Jobs can ask for some of it to be relaxed (see model.JobSpecDockerRelaxations)
+// and it's up to the job selection policy whether the node accepts them.
+type SecurityProfile struct {
+	// drop all linux capabilities apart from the ones listed in
+	// KeepCapabilities and the ones the job asks for
+	DropCapabilities bool
+	KeepCapabilities []string
+	// mount the root filesystem of the container read only and give the
+	// job tmpfs mounts at ScratchDirs to write to
+	ReadOnlyRootFS bool
+	ScratchDirs    []string
+	// how big each scratch dir can get e.g. "64m" - empty means no limit
+	ScratchSize string
+	// run the job as this user ("uid" or "uid:gid") rather than the user
+	// in the image
+	User string
+	// the most processes the container can have - 0 means no limit
+	PidsLimit int64
+	// path to a seccomp profile on the compute node to use instead of the
+	// docker default one
+	SeccompProfile string
+	// stop processes in the container gaining privileges (e.g. via setuid)
+	NoNewPrivileges bool
+}
+
+func NewDefaultSecurityProfile() SecurityProfile {
+	return SecurityProfile{
+		ScratchDirs: []string{"/tmp"},
+	}
+}
+
+// jobUser returns the uid and gid (-1 if not given) a job's container runs
+// as, or false if it runs as the user in the image.
+func (p SecurityProfile) jobUser(relaxations model.JobSpecDockerRelaxations) (uid, gid int, ok bool, err error) {
+	if p.User == "" || relaxations.RunAsRoot {
+		return 0, 0, false, nil
+	}
+	uidString, gidString, hasGID := strings.Cut(p.User, ":")
+	uid, err = strconv.Atoi(uidString)
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("docker user must be a uid or uid:gid: %s", p.User)
+	}
+	gid = -1
+	if hasGID {
+		gid, err = strconv.Atoi(gidString)
+		if err != nil {
+			return 0, 0, false, fmt.Errorf("docker user must be a uid or uid:gid: %s", p.User)
+		}
+	}
+	return uid, gid, true, nil
+}
+
+// loadSeccompProfile reads the seccomp profile from disk because the docker
+// API wants the contents rather than a path.
+func (p SecurityProfile) loadSeccompProfile() (string, error) {
+	if p.SeccompProfile == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(p.SeccompProfile)
+	if err != nil {
+		return "", fmt.Errorf("could not read seccomp profile %s: %w", p.SeccompProfile, err)
+	}
+	return string(data), nil
+}
+
+// apply hardens the container config for a job. seccompProfile is the
+// already loaded contents of p.SeccompProfile.
+func (p SecurityProfile) apply(
+	relaxations model.JobSpecDockerRelaxations,
+	seccompProfile string,
+	containerConfig *container.Config,
+	hostConfig *container.HostConfig,
+) {
+	if p.DropCapabilities {
+		hostConfig.CapDrop = []string{"ALL"}
+		// jobs are checked when they are submitted and bid on but never
+		// give one more than docker would have anyway
+		jobCapabilities := []string{}
+		for _, capability := range relaxations.Capabilities {
+			if model.HasCapability(model.DefaultDockerCapabilities, capability) {
+				jobCapabilities = append(jobCapabilities, capability)
+			}
+		}
+		for _, capabilities := range [][]string{p.KeepCapabilities, jobCapabilities} {
+			for _, capability := range capabilities {
+				hostConfig.CapAdd = append(hostConfig.CapAdd, model.NormalizeCapability(capability))
+			}
+		}
+	}
+
+	if p.ReadOnlyRootFS && !relaxations.WritableRootFS {
+		hostConfig.ReadonlyRootfs = true
+		options := "rw,exec"
+		if p.ScratchSize != "" {
+			options = fmt.Sprintf("%s,size=%s", options, p.ScratchSize)
+		}
+		hostConfig.Tmpfs = map[string]string{}
+		for _, dir := range p.ScratchDirs {
+			hostConfig.Tmpfs[dir] = options
+		}
+	}
+
+	if p.User != "" && !relaxations.RunAsRoot {
+		containerConfig.User = p.User
+	}
+
+	if p.PidsLimit > 0 {
+		pidsLimit := p.PidsLimit
+		hostConfig.Resources.PidsLimit = &pidsLimit
+	}
+
+	if seccompProfile != "" {
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, fmt.Sprintf("seccomp=%s", seccompProfile))
+	}
+
+	if p.NoNewPrivileges {
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "no-new-privileges:true")
+	}
+}
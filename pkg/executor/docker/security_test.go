@@ -0,0 +1,130 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecurityProfileDefaultChangesNothing(t *testing.T) {
+	containerConfig := &container.Config{}
+	hostConfig := &container.HostConfig{}
+	NewDefaultSecurityProfile().apply(model.JobSpecDockerRelaxations{}, "", containerConfig, hostConfig)
+	require.Equal(t, &container.Config{}, containerConfig)
+	require.Equal(t, &container.HostConfig{}, hostConfig)
+}
+
+func TestSecurityProfileApply(t *testing.T) {
+	profile := SecurityProfile{
+		DropCapabilities: true,
+		KeepCapabilities: []string{"chown"},
+		ReadOnlyRootFS:   true,
+		ScratchDirs:      []string{"/tmp", "/scratch"},
+		ScratchSize:      "64m",
+		User:             "1000:1000",
+		PidsLimit:        100,
+		NoNewPrivileges:  true,
+	}
+
+	containerConfig := &container.Config{}
+	hostConfig := &container.HostConfig{}
+	profile.apply(model.JobSpecDockerRelaxations{}, `{"defaultAction":"SCMP_ACT_ALLOW"}`, containerConfig, hostConfig)
+
+	require.Equal(t, []string{"ALL"}, []string(hostConfig.CapDrop))
+	require.Equal(t, []string{"CHOWN"}, []string(hostConfig.CapAdd))
+	require.True(t, hostConfig.ReadonlyRootfs)
+	require.Equal(t, map[string]string{
+		"/tmp":     "rw,exec,size=64m",
+		"/scratch": "rw,exec,size=64m",
+	}, hostConfig.Tmpfs)
+	require.Equal(t, "1000:1000", containerConfig.User)
+	require.Equal(t, int64(100), *hostConfig.Resources.PidsLimit)
+	require.Equal(t, []string{
+		`seccomp={"defaultAction":"SCMP_ACT_ALLOW"}`,
+		"no-new-privileges:true",
+	}, hostConfig.SecurityOpt)
+}
+
+func TestSecurityProfileRelaxations(t *testing.T) {
+	profile := SecurityProfile{
+		DropCapabilities: true,
+		ReadOnlyRootFS:   true,
+		ScratchDirs:      []string{"/tmp"},
+		User:             "1000",
+	}
+
+	containerConfig := &container.Config{}
+	hostConfig := &container.HostConfig{}
+	profile.apply(model.JobSpecDockerRelaxations{
+		RunAsRoot:      true,
+		WritableRootFS: true,
+		Capabilities:   []string{"cap_net_bind_service", "SYS_ADMIN"},
+	}, "", containerConfig, hostConfig)
+
+	require.Equal(t, []string{"ALL"}, []string(hostConfig.CapDrop))
+	require.Equal(t, []string{"NET_BIND_SERVICE"}, []string(hostConfig.CapAdd))
+	require.False(t, hostConfig.ReadonlyRootfs)
+	require.Empty(t, hostConfig.Tmpfs)
+	require.Empty(t, containerConfig.User)
+}
+
+func TestSecurityProfileJobUser(t *testing.T) {
+	_, _, ok, err := SecurityProfile{}.jobUser(model.JobSpecDockerRelaxations{})
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, _, ok, err = SecurityProfile{User: "1000"}.jobUser(model.JobSpecDockerRelaxations{RunAsRoot: true})
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	uid, gid, ok, err := SecurityProfile{User: "1000"}.jobUser(model.JobSpecDockerRelaxations{})
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 1000, uid)
+	require.Equal(t, -1, gid)
+
+	uid, gid, ok, err = SecurityProfile{User: "1000:2000"}.jobUser(model.JobSpecDockerRelaxations{})
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 1000, uid)
+	require.Equal(t, 2000, gid)
+
+	for _, bad := range []string{"nobody", "1000:users", ":1000"} {
+		_, _, _, err = SecurityProfile{User: bad}.jobUser(model.JobSpecDockerRelaxations{})
+		require.Error(t, err, bad)
+	}
+}
+
+func TestProgressDirIsOnlyWritableByTheJob(t *testing.T) {
+	e := &Executor{
+		ResultsDir:      t.TempDir(),
+		SecurityProfile: SecurityProfile{User: fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())},
+	}
+	shard := model.JobShard{Job: model.Job{ID: "test-job"}}
+	dir, err := e.ensureProgressDir(shard)
+	require.NoError(t, err)
+
+	for _, path := range []string{dir, filepath.Dir(dir)} {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0755), info.Mode().Perm(), path)
+	}
+}
+
+func TestOutputDirIsOnlyWritableByTheJob(t *testing.T) {
+	e := &Executor{
+		SecurityProfile: SecurityProfile{User: fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())},
+	}
+	shard := model.JobShard{Job: model.Job{ID: "test-job"}}
+	dir := filepath.Join(t.TempDir(), "outputs")
+	require.NoError(t, e.createJobDir(shard, dir))
+
+	info, err := os.Stat(dir)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0755), info.Mode().Perm())
+}
@@ -0,0 +1,108 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/filecoin-project/bacalhau/pkg/executor"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/rs/zerolog/log"
+)
+
+// containerUsage is the most a container has used so far according to the
+// stats docker streams while it runs.
+type containerUsage struct {
+	cpuNanoseconds uint64
+	peakMemory     uint64
+	diskWritten    uint64
+}
+
+// sampleContainerUsage follows the stats of a container until it stops or
+// the context is cancelled, then sends what it saw on the returned channel.
+func (e *Executor) sampleContainerUsage(ctx context.Context, containerID string) <-chan containerUsage {
+	result := make(chan containerUsage, 1)
+	go func() {
+		var usage containerUsage
+		defer func() {
+			result <- usage
+		}()
+
+		stats, err := e.Client.ContainerStats(ctx, containerID, true)
+		if err != nil {
+			log.Debug().Msgf("could not get stats for container %s: %s", containerID, err)
+			return
+		}
+		defer stats.Body.Close()
+
+		decoder := json.NewDecoder(stats.Body)
+		for {
+			var sample dockertypes.StatsJSON
+			if err := decoder.Decode(&sample); err != nil {
+				// the stream ends when the container stops
+				return
+			}
+			// the cpu and disk counters only go up, but a sample taken
+			// after the container stops has them zeroed
+			if sample.CPUStats.CPUUsage.TotalUsage > usage.cpuNanoseconds {
+				usage.cpuNanoseconds = sample.CPUStats.CPUUsage.TotalUsage
+			}
+			for _, memory := range []uint64{sample.MemoryStats.Usage, sample.MemoryStats.MaxUsage} {
+				if memory > usage.peakMemory {
+					usage.peakMemory = memory
+				}
+			}
+			var written uint64
+			for _, entry := range sample.BlkioStats.IoServiceBytesRecursive {
+				if strings.EqualFold(entry.Op, "write") {
+					written += entry.Value
+				}
+			}
+			if written > usage.diskWritten {
+				usage.diskWritten = written
+			}
+		}
+	}()
+	return result
+}
+
+// getContainerUsage combines the sampled stats of a stopped container with
+// what docker recorded about it.
+func (e *Executor) getContainerUsage(
+	ctx context.Context,
+	shard model.JobShard,
+	containerID string,
+	jobResultsDir string,
+	sampled containerUsage,
+) model.ResourceUsageMeasurement {
+	usage := model.ResourceUsageMeasurement{
+		CPUSeconds: float64(sampled.cpuNanoseconds) / NanoCPUCoefficient,
+		PeakMemory: sampled.peakMemory,
+	}
+
+	// block io doesn't see writes that are still in the page cache, so
+	// also count what the container left in its own layer and the outputs
+	diskWritten := executor.OutputsSize(jobResultsDir, shard.Job.Spec.Outputs)
+	containerJSON, _, err := e.Client.ContainerInspectWithRaw(ctx, containerID, true)
+	if err != nil {
+		log.Debug().Msgf("could not inspect container %s: %s", containerID, err)
+	} else {
+		if containerJSON.SizeRw != nil && *containerJSON.SizeRw > 0 {
+			diskWritten += uint64(*containerJSON.SizeRw)
+		}
+		if containerJSON.State != nil {
+			started, startedErr := time.Parse(time.RFC3339Nano, containerJSON.State.StartedAt)
+			finished, finishedErr := time.Parse(time.RFC3339Nano, containerJSON.State.FinishedAt)
+			if startedErr == nil && finishedErr == nil && finished.After(started) {
+				usage.WallTimeSeconds = finished.Sub(started).Seconds()
+			}
+		}
+	}
+	usage.DiskWritten = sampled.diskWritten
+	if diskWritten > usage.DiskWritten {
+		usage.DiskWritten = diskWritten
+	}
+	return usage
+}
@@ -3,6 +3,9 @@ package language
 /*
 The language executor wraps either the python_wasm executor or the generic
 docker executor, depending on whether determinism is required.
+Non-deterministic jobs run on a docker image for the language version that
+the node operator can configure (see ExecutorConfig), with the job context
+mounted at /job and any requirements installed before the program runs.
 */
 
 import (
@@ -19,6 +22,8 @@ import (
 type Executor struct {
 	Jobs []*model.Job
 
+	Config ExecutorConfig
+
 	executors map[model.EngineType]executor.Executor
 }
 
@@ -26,8 +31,10 @@ func NewExecutor(
 	ctx context.Context,
 	cm *system.CleanupManager,
 	executors map[model.EngineType]executor.Executor,
+	executorConfig ExecutorConfig,
 ) (*Executor, error) {
 	e := &Executor{
+		Config:    executorConfig,
 		executors: executors,
 	}
 	return e, nil
@@ -50,21 +57,112 @@ func (e *Executor) RunShard(
 	shard model.JobShard,
 	jobResultsDir string,
 ) error {
-	if shard.Job.Spec.Language.Language != "python" && shard.Job.Spec.Language.LanguageVersion != "3.10" {
-		return fmt.Errorf("only python 3.10 is supported")
+	spec := shard.Job.Spec.Language
+	if spec.Deterministic {
+		if spec.Language != "python" || spec.LanguageVersion != "3.10" {
+			return fmt.Errorf("only python 3.10 can be run deterministically")
+		}
+		log.Debug().Msgf("running deterministic python 3.10")
+		return e.executors[model.EnginePythonWasm].RunShard(ctx, shard, jobResultsDir)
+	}
+
+	log.Debug().Msgf("running arbitrary %s %s", spec.Language, spec.LanguageVersion)
+	dockerShard, err := e.dockerShard(shard)
+	if err != nil {
+		return err
+	}
+	return e.executors[model.EngineDocker].RunShard(ctx, dockerShard, jobResultsDir)
+}
+
+// GetJobImage returns the image a non-deterministic job runs in, so the
+// compute node can check it against its image policy.
+func (e *Executor) GetJobImage(ctx context.Context, spec model.JobSpec) (string, error) {
+	if spec.Language.Deterministic {
+		return "", nil
 	}
+	return e.Config.image(spec.Language.Language, spec.Language.LanguageVersion)
+}
 
+// GetImageSize asks the docker executor how much disk pulling the image of a
+// non-deterministic job will use.
+func (e *Executor) GetImageSize(ctx context.Context, spec model.JobSpec) (uint64, error) {
+	sizer, ok := e.executors[model.EngineDocker].(executor.ImageSizer)
+	if spec.Language.Deterministic || !ok {
+		return 0, nil
+	}
+	image, err := e.GetJobImage(ctx, spec)
+	if err != nil {
+		return 0, err
+	}
+	spec.Engine = model.EngineDocker
+	spec.Docker = model.JobSpecDocker{Image: image}
+	return sizer.GetImageSize(ctx, spec)
+}
+
+// ReattachShard hands a shard that was running before the compute node
+// restarted back to the executor that was running it.
+func (e *Executor) ReattachShard(
+	ctx context.Context,
+	shard model.JobShard,
+	jobResultsDir string,
+) (bool, error) {
+	engine := model.EngineDocker
 	if shard.Job.Spec.Language.Deterministic {
-		log.Debug().Msgf("running deterministic python 3.10")
-		// Instantiate a python_wasm
-		// TODO: mutate job as needed?
-		return e.executors[model.EnginePythonWasm].RunShard(ctx, shard, jobResultsDir)
+		engine = model.EnginePythonWasm
 	} else {
-		log.Debug().Msgf("running arbitrary python 3.10")
-		// TODO: Instantiate a docker with python:3.10 image
-		return fmt.Errorf("arbitrary python not supported yet")
+		var err error
+		shard, err = e.dockerShard(shard)
+		if err != nil {
+			return false, err
+		}
+	}
+	reattacher, ok := e.executors[engine].(executor.ShardReattacher)
+	if !ok {
+		return false, fmt.Errorf("executor %s cannot reattach to shard %s after a restart", engine, shard)
+	}
+	return reattacher.ReattachShard(ctx, shard, jobResultsDir)
+}
+
+// dockerShard translates a non-deterministic language shard into a docker
+// shard that runs it.
+func (e *Executor) dockerShard(shard model.JobShard) (model.JobShard, error) {
+	spec := shard.Job.Spec.Language
+	languageRuntime, ok := runtimes[spec.Language]
+	if !ok {
+		return model.JobShard{}, fmt.Errorf("language %s is not supported", spec.Language)
+	}
+	image, err := e.Config.image(spec.Language, spec.LanguageVersion)
+	if err != nil {
+		return model.JobShard{}, err
+	}
+	if spec.Command == "" && spec.ProgramPath == "" {
+		return model.JobShard{}, fmt.Errorf("the job has no command or program to run")
+	}
+
+	// the paths and command are passed as arguments so we never have to
+	// quote them into the script
+	shard.Job.Spec.Docker = model.JobSpecDocker{
+		Image: image,
+		Entrypoint: []string{
+			"sh", "-c", languageRuntime.script(spec), "sh",
+			contextPath(spec.RequirementsPath),
+			contextPath(spec.ProgramPath),
+			spec.Command,
+		},
+		Env: languageRuntime.env(),
+	}
+	// run from the context if the client uploaded one
+	for _, context := range shard.Job.Spec.Contexts {
+		if context.Path == contextMountPath {
+			shard.Job.Spec.Docker.WorkingDir = contextMountPath
+		}
 	}
+	shard.Job.Spec.Engine = model.EngineDocker
+	return shard, nil
 }
 
 // Compile-time check that Executor implements the Executor interface.
 var _ executor.Executor = (*Executor)(nil)
+var _ executor.JobImager = (*Executor)(nil)
+var _ executor.ImageSizer = (*Executor)(nil)
+var _ executor.ShardReattacher = (*Executor)(nil)
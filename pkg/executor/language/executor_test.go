@@ -0,0 +1,251 @@
+package language
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/bacalhau/pkg/executor"
+	noop_executor "github.com/filecoin-project/bacalhau/pkg/executor/noop"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestExecutor returns a language executor whose docker and python_wasm
+// executors record the shards they are given.
+func newTestExecutor(t *testing.T, config ExecutorConfig) (*Executor, map[model.EngineType][]model.JobShard) {
+	ran := map[model.EngineType][]model.JobShard{}
+	executors := map[model.EngineType]executor.Executor{}
+	for _, engine := range []model.EngineType{model.EngineDocker, model.EnginePythonWasm} {
+		engine := engine
+		noopExecutor, err := noop_executor.NewExecutorWithConfig(noop_executor.ExecutorConfig{
+			ExternalHooks: noop_executor.ExecutorConfigExternalHooks{
+				JobHandler: func(ctx context.Context, shard model.JobShard, resultsDir string) error {
+					ran[engine] = append(ran[engine], shard)
+					return nil
+				},
+			},
+		})
+		require.NoError(t, err)
+		executors[engine] = noopExecutor
+	}
+
+	e, err := NewExecutor(context.Background(), system.NewCleanupManager(), executors, config)
+	require.NoError(t, err)
+	return e, ran
+}
+
+func languageShard(spec model.JobSpecLanguage) model.JobShard {
+	return model.JobShard{
+		Job: model.Job{
+			ID: "test-job",
+			Spec: model.JobSpec{
+				Engine:   model.EngineLanguage,
+				Language: spec,
+				Contexts: []model.StorageSpec{{
+					Engine: model.StorageSourceIPFS,
+					Cid:    "QmContext",
+					Path:   "/job",
+				}},
+			},
+		},
+	}
+}
+
+func TestDeterministicPythonRunsOnWasm(t *testing.T) {
+	e, ran := newTestExecutor(t, ExecutorConfig{})
+	err := e.RunShard(context.Background(), languageShard(model.JobSpecLanguage{
+		Language:        "python",
+		LanguageVersion: "3.10",
+		Deterministic:   true,
+		Command:         "print(1)",
+	}), t.TempDir())
+	require.NoError(t, err)
+	require.Len(t, ran[model.EnginePythonWasm], 1)
+	require.Len(t, ran[model.EngineDocker], 0)
+
+	err = e.RunShard(context.Background(), languageShard(model.JobSpecLanguage{
+		Language:        "python",
+		LanguageVersion: "3.9",
+		Deterministic:   true,
+		Command:         "print(1)",
+	}), t.TempDir())
+	require.Error(t, err)
+}
+
+func TestNonDeterministicPythonRunsOnDocker(t *testing.T) {
+	e, ran := newTestExecutor(t, ExecutorConfig{})
+	err := e.RunShard(context.Background(), languageShard(model.JobSpecLanguage{
+		Language:         "python",
+		LanguageVersion:  "3.9",
+		ProgramPath:      "main.py",
+		RequirementsPath: "requirements.txt",
+	}), t.TempDir())
+	require.NoError(t, err)
+	require.Len(t, ran[model.EngineDocker], 1)
+
+	shard := ran[model.EngineDocker][0]
+	require.Equal(t, model.EngineDocker, shard.Job.Spec.Engine)
+	require.Equal(t, "python:3.9-slim", shard.Job.Spec.Docker.Image)
+	require.Equal(t, "/job", shard.Job.Spec.Docker.WorkingDir)
+	require.Equal(t, []string{
+		"sh", "-c",
+		`pip install --quiet --target /tmp/bacalhau_deps -r "$1" && exec python "$2"`,
+		"sh", "/job/requirements.txt", "/job/main.py", "",
+	}, shard.Job.Spec.Docker.Entrypoint)
+	require.Contains(t, shard.Job.Spec.Docker.Env, "PYTHONPATH=/tmp/bacalhau_deps")
+}
+
+func TestNonDeterministicNodeRunsOnDocker(t *testing.T) {
+	e, ran := newTestExecutor(t, ExecutorConfig{})
+	err := e.RunShard(context.Background(), languageShard(model.JobSpecLanguage{
+		Language:        "node",
+		LanguageVersion: "18",
+		Command:         "console.log(1)",
+	}), t.TempDir())
+	require.NoError(t, err)
+	require.Len(t, ran[model.EngineDocker], 1)
+
+	shard := ran[model.EngineDocker][0]
+	require.Equal(t, "node:18-slim", shard.Job.Spec.Docker.Image)
+	require.Equal(t, []string{
+		"sh", "-c", `exec node -e "$3"`, "sh", "", "", "console.log(1)",
+	}, shard.Job.Spec.Docker.Entrypoint)
+}
+
+func TestConfiguredImages(t *testing.T) {
+	e, ran := newTestExecutor(t, ExecutorConfig{
+		Images: map[string]map[string]string{
+			"python": {
+				"3.10": "myregistry/python:3.10",
+				"3.12": "myregistry/python:3.12",
+			},
+		},
+	})
+	for _, version := range []string{"3.10", "3.12"} {
+		err := e.RunShard(context.Background(), languageShard(model.JobSpecLanguage{
+			Language:        "python",
+			LanguageVersion: version,
+			Command:         "print(1)",
+		}), t.TempDir())
+		require.NoError(t, err)
+	}
+	require.Equal(t, "myregistry/python:3.10", ran[model.EngineDocker][0].Job.Spec.Docker.Image)
+	require.Equal(t, "myregistry/python:3.12", ran[model.EngineDocker][1].Job.Spec.Docker.Image)
+
+	for _, spec := range []model.JobSpecLanguage{
+		{Language: "python", LanguageVersion: "2.7", Command: "print 1"},
+		{Language: "ruby", LanguageVersion: "3", Command: "puts 1"},
+		{Language: "python", LanguageVersion: "3.10"},
+	} {
+		err := e.RunShard(context.Background(), languageShard(spec), t.TempDir())
+		require.Error(t, err)
+	}
+}
+
+func TestParseImages(t *testing.T) {
+	images, err := ParseImages(map[string]string{
+		"python/3.10": "myregistry/python:3.10",
+		"node/20":     "myregistry/node:20",
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]map[string]string{
+		"python": {"3.10": "myregistry/python:3.10"},
+		"node":   {"20": "myregistry/node:20"},
+	}, images)
+
+	for _, bad := range []map[string]string{
+		{"python": "python:3.10"},
+		{"python/": "python:3.10"},
+		{"python/3.10": ""},
+		{"ruby/3": "ruby:3"},
+	} {
+		_, err = ParseImages(bad)
+		require.Error(t, err)
+	}
+}
+
+func TestJobImage(t *testing.T) {
+	e, _ := newTestExecutor(t, ExecutorConfig{})
+	spec := languageShard(model.JobSpecLanguage{Language: "python", LanguageVersion: "3.9"}).Job.Spec
+	image, err := e.GetJobImage(context.Background(), spec)
+	require.NoError(t, err)
+	require.Equal(t, "python:3.9-slim", image)
+
+	spec.Language.Deterministic = true
+	image, err = e.GetJobImage(context.Background(), spec)
+	require.NoError(t, err)
+	require.Empty(t, image)
+
+	spec = languageShard(model.JobSpecLanguage{Language: "ruby", LanguageVersion: "3"}).Job.Spec
+	_, err = e.GetJobImage(context.Background(), spec)
+	require.Error(t, err)
+}
+
+func TestImageSizeOfDockerImage(t *testing.T) {
+	sized := []string{}
+	docker, err := noop_executor.NewExecutorWithConfig(noop_executor.ExecutorConfig{
+		ExternalHooks: noop_executor.ExecutorConfigExternalHooks{
+			GetImageSize: func(ctx context.Context, spec model.JobSpec) (uint64, error) {
+				sized = append(sized, spec.Docker.Image)
+				return 1024, nil
+			},
+		},
+	})
+	require.NoError(t, err)
+	e, err := NewExecutor(context.Background(), system.NewCleanupManager(), map[model.EngineType]executor.Executor{
+		model.EngineDocker: docker,
+	}, ExecutorConfig{})
+	require.NoError(t, err)
+
+	spec := languageShard(model.JobSpecLanguage{Language: "node", LanguageVersion: "18"}).Job.Spec
+	size, err := e.GetImageSize(context.Background(), spec)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1024), size)
+
+	spec.Language.Deterministic = true
+	size, err = e.GetImageSize(context.Background(), spec)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), size)
+	require.Equal(t, []string{"node:18-slim"}, sized)
+}
+
+// reattacher is an executor that records the shards it is asked to reattach
+type reattacher struct {
+	executor.Executor
+	reattached []model.JobShard
+}
+
+func (r *reattacher) ReattachShard(ctx context.Context, shard model.JobShard, resultsDir string) (bool, error) {
+	r.reattached = append(r.reattached, shard)
+	return true, nil
+}
+
+func TestReattachShard(t *testing.T) {
+	docker := &reattacher{}
+	e, err := NewExecutor(context.Background(), system.NewCleanupManager(), map[model.EngineType]executor.Executor{
+		model.EngineDocker:     docker,
+		model.EnginePythonWasm: &noop_executor.Executor{},
+	}, ExecutorConfig{})
+	require.NoError(t, err)
+
+	found, err := e.ReattachShard(context.Background(), languageShard(model.JobSpecLanguage{
+		Language:        "python",
+		LanguageVersion: "3.9",
+		Command:         "print(1)",
+	}), t.TempDir())
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Len(t, docker.reattached, 1)
+	// the docker executor looks for the container of the shard it ran
+	require.Equal(t, model.EngineDocker, docker.reattached[0].Job.Spec.Engine)
+	require.Equal(t, "python:3.9-slim", docker.reattached[0].Job.Spec.Docker.Image)
+
+	_, err = e.ReattachShard(context.Background(), languageShard(model.JobSpecLanguage{
+		Language:        "python",
+		LanguageVersion: "3.10",
+		Deterministic:   true,
+		Command:         "print(1)",
+	}), t.TempDir())
+	require.Error(t, err)
+}
@@ -0,0 +1,173 @@
+package language
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+)
+
+// where the job context (code, requirements) is mounted in the container
+const contextMountPath = "/job"
+
+// where requirements are installed - /tmp stays writable even when the node
+// makes the root filesystem of job containers read only
+const dependenciesPath = "/tmp/bacalhau_deps"
+
+// ExecutorConfig is how the node operator configures the language executor.
+type ExecutorConfig struct {
+	// docker images to run non-deterministic jobs on, keyed by language
+	// then version - these are added to (or replace) DefaultImages
+	Images map[string]map[string]string
+}
+
+func NewDefaultExecutorConfig() ExecutorConfig {
+	return ExecutorConfig{
+		Images: map[string]map[string]string{},
+	}
+}
+
+// DefaultImages are the images we run non-deterministic jobs on unless the
+// node operator says otherwise.
+var DefaultImages = map[string]map[string]string{
+	"python": {
+		"3.8":  "python:3.8-slim",
+		"3.9":  "python:3.9-slim",
+		"3.10": "python:3.10-slim",
+		"3.11": "python:3.11-slim",
+	},
+	"node": {
+		"16": "node:16-slim",
+		"18": "node:18-slim",
+		"20": "node:20-slim",
+	},
+}
+
+// the hosts a job installing requirements needs to reach, by language
+var PackageRegistryHosts = map[string][]string{
+	"python": {"pypi.org", "files.pythonhosted.org"},
+	"node":   {"registry.npmjs.org"},
+}
+
+// a runtime knows how to run a program in one language inside a container
+type runtime interface {
+	// the shell script that installs the requirements (if any) and runs
+	// the program - it is given the requirements path, the program path and
+	// the inline command as $1, $2 and $3
+	script(spec model.JobSpecLanguage) string
+	// the environment the script needs
+	env() []string
+}
+
+var runtimes = map[string]runtime{
+	"python": pythonRuntime{},
+	"node":   nodeRuntime{},
+}
+
+type pythonRuntime struct{}
+
+func (pythonRuntime) script(spec model.JobSpecLanguage) string {
+	steps := []string{}
+	if spec.RequirementsPath != "" {
+		steps = append(steps, fmt.Sprintf(`pip install --quiet --target %s -r "$1"`, dependenciesPath))
+	}
+	if spec.Command != "" {
+		steps = append(steps, `exec python -c "$3"`)
+	} else {
+		steps = append(steps, `exec python "$2"`)
+	}
+	return strings.Join(steps, " && ")
+}
+
+func (pythonRuntime) env() []string {
+	return []string{
+		fmt.Sprintf("PYTHONPATH=%s", dependenciesPath),
+		// pip wants somewhere to write its cache
+		"HOME=/tmp",
+	}
+}
+
+type nodeRuntime struct{}
+
+// node installs packages from a package.json so we copy the requirements
+// file into place first
+func (nodeRuntime) script(spec model.JobSpecLanguage) string {
+	steps := []string{}
+	if spec.RequirementsPath != "" {
+		steps = append(steps,
+			fmt.Sprintf(`mkdir -p %s`, dependenciesPath),
+			fmt.Sprintf(`cp "$1" %s/package.json`, dependenciesPath),
+			fmt.Sprintf(`npm install --silent --prefix %s`, dependenciesPath),
+		)
+	}
+	if spec.Command != "" {
+		steps = append(steps, `exec node -e "$3"`)
+	} else {
+		steps = append(steps, `exec node "$2"`)
+	}
+	return strings.Join(steps, " && ")
+}
+
+func (nodeRuntime) env() []string {
+	return []string{
+		fmt.Sprintf("NODE_PATH=%s/node_modules", dependenciesPath),
+		// npm wants somewhere to write its cache
+		"HOME=/tmp",
+	}
+}
+
+// image returns the image to run the given language version on.
+func (c ExecutorConfig) image(language, version string) (string, error) {
+	if image, ok := c.Images[language][version]; ok {
+		return image, nil
+	}
+	if image, ok := DefaultImages[language][version]; ok {
+		return image, nil
+	}
+	versions := c.versions(language)
+	if len(versions) == 0 {
+		return "", fmt.Errorf("language %s is not supported", language)
+	}
+	return "", fmt.Errorf("%s %s is not supported (try one of %s)", language, version, strings.Join(versions, ", "))
+}
+
+func (c ExecutorConfig) versions(language string) []string {
+	versions := []string{}
+	for _, images := range []map[string]map[string]string{DefaultImages, c.Images} {
+		for version := range images[language] {
+			versions = append(versions, version)
+		}
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// ParseImages reads images given as "language/version=image" e.g.
+// "python/3.10=python:3.10-slim".
+func ParseImages(values map[string]string) (map[string]map[string]string, error) {
+	images := map[string]map[string]string{}
+	for key, image := range values {
+		parts := strings.Split(key, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" || image == "" {
+			return nil, fmt.Errorf("invalid language image %q: must be language/version=image", key+"="+image)
+		}
+		if _, ok := runtimes[parts[0]]; !ok {
+			return nil, fmt.Errorf("invalid language image %q: language %s is not supported", key+"="+image, parts[0])
+		}
+		if images[parts[0]] == nil {
+			images[parts[0]] = map[string]string{}
+		}
+		images[parts[0]][parts[1]] = image
+	}
+	return images, nil
+}
+
+// contextPath is where a file in the job context is in the container.
+func contextPath(file string) string {
+	if file == "" {
+		return ""
+	}
+	return path.Join(contextMountPath, file)
+}
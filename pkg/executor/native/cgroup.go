@@ -0,0 +1,176 @@
+package native
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage/util"
+)
+
+const defaultCgroupRoot = "/sys/fs/cgroup"
+
+// the cpu period the quota of a shard is given in
+const cpuPeriodMicroseconds = 100000
+
+// cgroup is the cgroup of a shard, which is a folder per controller on
+// cgroup v1 and a single folder on cgroup v2.
+type cgroup struct {
+	dirs []string
+}
+
+// newCgroup creates a cgroup for a shard under the parent cgroup that
+// limits its cpu and memory to the given resources.
+func newCgroup(root, parent, name string, resources model.ResourceUsageData) (*cgroup, error) {
+	var limits map[string]map[string]string
+	quota := strconv.Itoa(int(resources.CPU * cpuPeriodMicroseconds))
+	period := strconv.Itoa(cpuPeriodMicroseconds)
+	memory := strconv.FormatUint(resources.Memory, 10)
+
+	_, err := os.Stat(filepath.Join(root, "cgroup.controllers"))
+	unified := err == nil
+	if unified {
+		// the controllers have to be enabled for the children of the parent
+		err = enableControllers(root, parent)
+		if err != nil {
+			return nil, err
+		}
+		limits = map[string]map[string]string{
+			filepath.Join(root, parent, name): {},
+		}
+		if resources.CPU > 0 {
+			limits[filepath.Join(root, parent, name)]["cpu.max"] = quota + " " + period
+		}
+		if resources.Memory > 0 {
+			limits[filepath.Join(root, parent, name)]["memory.max"] = memory
+		}
+	} else {
+		cpuDir := filepath.Join(root, "cpu", parent, name)
+		memoryDir := filepath.Join(root, "memory", parent, name)
+		limits = map[string]map[string]string{
+			cpuDir:    {},
+			memoryDir: {},
+		}
+		if resources.CPU > 0 {
+			limits[cpuDir]["cpu.cfs_period_us"] = period
+			limits[cpuDir]["cpu.cfs_quota_us"] = quota
+		}
+		if resources.Memory > 0 {
+			limits[memoryDir]["memory.limit_in_bytes"] = memory
+		}
+	}
+
+	group := &cgroup{}
+	for dir, files := range limits {
+		err = os.MkdirAll(dir, util.OS_USER_RWX|util.OS_ALL_R|util.OS_ALL_X)
+		if err != nil {
+			_ = group.remove()
+			return nil, err
+		}
+		group.dirs = append(group.dirs, dir)
+		// the period has to be set before the quota on cgroup v1
+		for _, file := range []string{"cpu.cfs_period_us", "cpu.cfs_quota_us", "cpu.max", "memory.max", "memory.limit_in_bytes"} {
+			value, ok := files[file]
+			if !ok {
+				continue
+			}
+			err = os.WriteFile(filepath.Join(dir, file), []byte(value), util.OS_USER_RW)
+			if err != nil {
+				_ = group.remove()
+				return nil, fmt.Errorf("could not set %s: %w", file, err)
+			}
+		}
+	}
+	return group, nil
+}
+
+// enableControllers turns on the cpu and memory controllers for the
+// children of the parent cgroup on cgroup v2.
+func enableControllers(root, parent string) error {
+	dir := root
+	for _, part := range strings.Split(filepath.Clean(parent), string(filepath.Separator)) {
+		if part == "" || part == "." {
+			continue
+		}
+		err := os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte("+cpu +memory"), util.OS_USER_RW)
+		if err != nil {
+			return fmt.Errorf("could not enable cgroup controllers in %s: %w", dir, err)
+		}
+		dir = filepath.Join(dir, part)
+		err = os.MkdirAll(dir, util.OS_USER_RWX|util.OS_ALL_R|util.OS_ALL_X)
+		if err != nil {
+			return err
+		}
+	}
+	err := os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte("+cpu +memory"), util.OS_USER_RW)
+	if err != nil {
+		return fmt.Errorf("could not enable cgroup controllers in %s: %w", dir, err)
+	}
+	return nil
+}
+
+// procsFiles are the files a process writes its pid to to join the cgroup.
+func (c *cgroup) procsFiles() []string {
+	files := []string{}
+	for _, dir := range c.dirs {
+		files = append(files, filepath.Join(dir, "cgroup.procs"))
+	}
+	return files
+}
+
+// peakMemory is the most memory the processes in the cgroup used at once,
+// or zero if the kernel doesn't record it.
+func (c *cgroup) peakMemory() uint64 {
+	var peak uint64
+	for _, dir := range c.dirs {
+		// memory.peak is cgroup v2 and memory.max_usage_in_bytes is v1
+		for _, file := range []string{"memory.peak", "memory.max_usage_in_bytes"} {
+			data, err := os.ReadFile(filepath.Join(dir, file))
+			if err != nil {
+				continue
+			}
+			value, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+			if err == nil && value > peak {
+				peak = value
+			}
+		}
+	}
+	return peak
+}
+
+// remove kills anything left in the cgroup and removes it.
+func (c *cgroup) remove() error {
+	var lastErr error
+	for _, dir := range c.dirs {
+		data, err := os.ReadFile(filepath.Join(dir, "cgroup.procs"))
+		if err == nil {
+			for _, line := range strings.Fields(string(data)) {
+				if pid, err := strconv.Atoi(line); err == nil {
+					_ = syscall.Kill(pid, syscall.SIGKILL)
+				}
+			}
+		}
+		// a cgroup can't be removed until its processes have gone
+		if err = removeCgroupDir(dir); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func removeCgroupDir(dir string) error {
+	var err error
+	for attempt := 0; attempt < 50; attempt++ {
+		err = os.Remove(dir)
+		if err == nil || os.IsNotExist(err) {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return err
+}
@@ -0,0 +1,425 @@
+package native
+
+/*
+The native executor runs the job's entrypoint as a plain process on the
+compute node, for private clusters that trust their workloads and don't
+want the overhead of docker. There is no isolation beyond what is described
+here, so it is only registered when the node operator enables it.
+
+Each shard gets its own working folder that the process starts in. Input
+and output volumes are either put into the working folder at their paths
+(e.g. an input at /inputs is at ./inputs) - outputs as symlinks and inputs as
+read only copies - or, with MountNamespace, bind mounted at their real paths
+in a private mount namespace. CPU and memory
+limits are enforced with a cgroup per shard when CgroupParent is set.
+
+The process is started through a re-exec of the bacalhau binary (see
+init.go) that joins the cgroup and sets up the volumes before exec'ing the
+entrypoint, so nothing the job runs escapes its limits. stdout, stderr and
+the exit code are written into the results folder just like the docker
+executor does - stdout and stderr go straight to their files so a chatty
+process doesn't pile its output up in the node's memory.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/docker/docker/pkg/reexec"
+	"github.com/filecoin-project/bacalhau/pkg/capacitymanager"
+	"github.com/filecoin-project/bacalhau/pkg/executor"
+	jobutils "github.com/filecoin-project/bacalhau/pkg/job"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage"
+	"github.com/filecoin-project/bacalhau/pkg/storage/util"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// the PATH processes get unless the job sets its own
+const defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+type ExecutorConfig struct {
+	// the native executor runs jobs without isolation so it is only
+	// registered when this is set
+	Enabled bool
+	// bind mount volumes at their paths in a private mount namespace rather
+	// than symlinking them into the working folder - this needs root, and
+	// creates any missing mount points on the node
+	MountNamespace bool
+	// the cgroup (relative to the root of the cgroup filesystem) each shard
+	// gets a child cgroup of to enforce its cpu and memory limits - limits
+	// are not enforced if this is empty
+	CgroupParent string
+}
+
+func NewDefaultExecutorConfig() ExecutorConfig {
+	return ExecutorConfig{
+		Enabled:        false,
+		MountNamespace: false,
+		CgroupParent:   "",
+	}
+}
+
+type Executor struct {
+	// where each shard gets its working folder
+	ScratchDir string
+
+	Config ExecutorConfig
+
+	// the storage providers we can implement for a job
+	StorageProviders map[model.StorageSourceType]storage.StorageProvider
+
+	// where the cgroup filesystem is mounted
+	cgroupRoot string
+}
+
+func NewExecutor(
+	ctx context.Context,
+	cm *system.CleanupManager,
+	storageProviders map[model.StorageSourceType]storage.StorageProvider,
+	executorConfig ExecutorConfig,
+) (*Executor, error) {
+	dir, err := os.MkdirTemp("", "bacalhau-native-executor")
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Executor{
+		ScratchDir:       dir,
+		Config:           executorConfig,
+		StorageProviders: storageProviders,
+		cgroupRoot:       defaultCgroupRoot,
+	}
+
+	cm.RegisterCallback(func() error {
+		return os.RemoveAll(dir)
+	})
+
+	return e, nil
+}
+
+func (e *Executor) getStorageProvider(ctx context.Context, engine model.StorageSourceType) (storage.StorageProvider, error) {
+	return util.GetStorageProvider(ctx, engine, e.StorageProviders)
+}
+
+// IsInstalled is true when the node operator has enabled the executor.
+func (e *Executor) IsInstalled(ctx context.Context) (bool, error) {
+	return e.Config.Enabled, nil
+}
+
+func (e *Executor) HasStorageLocally(ctx context.Context, volume model.StorageSpec) (bool, error) {
+	ctx, span := newSpan(ctx, "HasStorageLocally")
+	defer span.End()
+
+	s, err := e.getStorageProvider(ctx, volume.Engine)
+	if err != nil {
+		return false, err
+	}
+
+	return s.HasStorageLocally(ctx, volume)
+}
+
+func (e *Executor) GetVolumeSize(ctx context.Context, volume model.StorageSpec) (uint64, error) {
+	storageProvider, err := e.getStorageProvider(ctx, volume.Engine)
+	if err != nil {
+		return 0, err
+	}
+	return storageProvider.GetVolumeSize(ctx, volume)
+}
+
+//nolint:funlen,gocyclo // will clean up
+func (e *Executor) RunShard(
+	ctx context.Context,
+	shard model.JobShard,
+	jobResultsDir string,
+) error {
+	//nolint:ineffassign,staticcheck
+	ctx, span := system.GetTracer().Start(ctx, "pkg/executor/native.RunShard")
+	defer span.End()
+	system.AddJobIDFromBaggageToSpan(ctx, span)
+	system.AddNodeIDFromBaggageToSpan(ctx, span)
+
+	spec := shard.Job.Spec.Native
+	if len(spec.Entrypoint) == 0 {
+		return fmt.Errorf("native job has no entrypoint")
+	}
+
+	shardStorageSpec, err := jobutils.GetShardStorageSpec(ctx, shard, e.StorageProviders)
+	if err != nil {
+		return err
+	}
+
+	workingDir := filepath.Join(e.ScratchDir, e.shardName(shard))
+	err = os.MkdirAll(workingDir, util.OS_USER_RWX)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// read only inputs are copied in without write permission, which
+		// would stop us removing them
+		if err := setWritable(workingDir, true); err != nil {
+			log.Debug().Msgf("Native executor working dir cleanup error: %s", err.Error())
+		}
+		if err := os.RemoveAll(workingDir); err != nil {
+			log.Debug().Msgf("Native executor working dir cleanup error: %s", err.Error())
+		}
+	}()
+
+	volumes := &executor.PreparedVolumes{}
+	defer volumes.Cleanup(ctx)
+	config := initConfig{
+		WorkingDir:     workingDir,
+		MountNamespace: e.Config.MountNamespace,
+		Entrypoint:     spec.Entrypoint,
+	}
+
+	addInputStorageHandler := func(spec model.StorageSpec) error {
+		volume, err := e.prepareStorage(ctx, volumes, spec)
+		if err != nil {
+			return err
+		}
+		log.Trace().Msgf("Input Volume: %+v %+v", spec, volume)
+		config.Mounts = append(config.Mounts, initMount{
+			Source: volume.Source,
+			Target: volume.Target,
+			// this is an input volume so is read only
+			ReadOnly: true,
+		})
+		return nil
+	}
+
+	// loop over the job contexts and prepare them
+	for _, contextStorage := range shard.Job.Spec.Contexts {
+		err = addInputStorageHandler(contextStorage)
+		if err != nil {
+			return err
+		}
+	}
+
+	// loop over the job storage inputs and prepare them
+	for _, inputStorage := range shardStorageSpec {
+		err = addInputStorageHandler(inputStorage)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, output := range shard.Job.Spec.Outputs {
+		if output.Name == "" {
+			return fmt.Errorf("output volume has no name: %+v", output)
+		}
+
+		if output.Path == "" {
+			return fmt.Errorf("output volume has no path: %+v", output)
+		}
+
+		srcd := filepath.Join(jobResultsDir, output.Name)
+		err = os.Mkdir(srcd, util.OS_ALL_R|util.OS_ALL_X|util.OS_USER_W)
+		if err != nil {
+			return err
+		}
+
+		log.Trace().Msgf("Output Volume: %+v", output)
+
+		// this is an output volume so can be written to
+		config.Mounts = append(config.Mounts, initMount{
+			Source: srcd,
+			Target: output.Path,
+		})
+	}
+
+	resourceRequirements := capacitymanager.ParseResourceUsageConfig(shard.Job.Spec.Resources)
+	var group *cgroup
+	if e.Config.CgroupParent != "" {
+		group, err = newCgroup(e.cgroupRoot, e.Config.CgroupParent, e.shardName(shard), resourceRequirements)
+		if err != nil {
+			return fmt.Errorf("could not create cgroup for shard: %w", err)
+		}
+		defer func() {
+			if err := group.remove(); err != nil {
+				log.Debug().Msgf("Native executor cgroup cleanup error: %s", err.Error())
+			}
+		}()
+		config.CgroupProcs = group.procsFiles()
+	} else if resourceRequirements.CPU > 0 || resourceRequirements.Memory > 0 {
+		log.Warn().Msgf("Native executor has no cgroup parent so the cpu and memory limits of %s are not enforced", e.shardName(shard))
+	}
+
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	// the init process tells us why it failed over a pipe that closes when
+	// it execs the entrypoint
+	initErrorsReader, initErrorsWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer initErrorsReader.Close()
+
+	stdout, err := createResultFile(jobResultsDir, "stdout")
+	if err != nil {
+		initErrorsWriter.Close()
+		return err
+	}
+	defer stdout.Close()
+	stderr, err := createResultFile(jobResultsDir, "stderr")
+	if err != nil {
+		initErrorsWriter.Close()
+		return err
+	}
+	defer stderr.Close()
+
+	cmd := reexec.Command(initName, string(configJSON))
+	cmd.Dir = workingDir
+	cmd.Env = append([]string{"PATH=" + defaultPath, "HOME=" + workingDir}, spec.Env...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.ExtraFiles = []*os.File{initErrorsWriter}
+	err = setSysProcAttr(cmd, e.Config.MountNamespace)
+	if err != nil {
+		initErrorsWriter.Close()
+		return err
+	}
+
+	startTime := time.Now()
+	err = cmd.Start()
+	initErrorsWriter.Close()
+	if err != nil {
+		return fmt.Errorf("could not start native process: %w", err)
+	}
+
+	waitErr := make(chan error, 1)
+	go func() {
+		waitErr <- cmd.Wait()
+	}()
+
+	initError, err := io.ReadAll(initErrorsReader)
+	if err != nil {
+		return err
+	}
+
+	var usage model.ResourceUsageMeasurement
+	var processError error
+	select {
+	case processError = <-waitErr:
+		usage.WallTimeSeconds = time.Since(startTime).Seconds()
+	case <-ctx.Done():
+		killProcessGroup(cmd)
+		<-waitErr
+		// the shard was cancelled so there are no results to write
+		return ctx.Err()
+	}
+
+	if len(initError) > 0 {
+		return fmt.Errorf("could not start native process: %s", string(initError))
+	}
+
+	exitCode := 0
+	var exitError *exec.ExitError
+	if errors.As(processError, &exitError) {
+		exitCode = exitError.ExitCode()
+	} else if processError != nil {
+		return processError
+	}
+	// the process may have left children running in its group
+	killProcessGroup(cmd)
+
+	var containerError error
+	if exitCode != 0 {
+		containerError = fmt.Errorf("exit code was not zero: %d", exitCode)
+		log.Info().Msgf("native process error %s", containerError)
+	}
+
+	usage.CPUSeconds, usage.PeakMemory = processUsage(cmd.ProcessState)
+	if group != nil {
+		// the cgroup also counts children the process didn't wait for
+		if peakMemory := group.peakMemory(); peakMemory > usage.PeakMemory {
+			usage.PeakMemory = peakMemory
+		}
+	}
+	usage.DiskWritten = executor.OutputsSize(jobResultsDir, shard.Job.Spec.Outputs)
+
+	err = writeExitCode(jobResultsDir, exitCode)
+	if err != nil {
+		return err
+	}
+	err = executor.WriteResourceUsage(jobResultsDir, usage)
+	if err != nil {
+		return err
+	}
+	return containerError
+}
+
+// prepareStorage gets a volume ready to be mounted into a process.
+func (e *Executor) prepareStorage(
+	ctx context.Context,
+	volumes *executor.PreparedVolumes,
+	spec model.StorageSpec,
+) (storage.StorageVolume, error) {
+	storageProvider, err := e.getStorageProvider(ctx, spec.Engine)
+	if err != nil {
+		return storage.StorageVolume{}, err
+	}
+
+	volume, err := volumes.Prepare(ctx, storageProvider, spec)
+	if err != nil {
+		return storage.StorageVolume{}, err
+	}
+
+	if volume.Type != storage.StorageVolumeConnectorBind {
+		return storage.StorageVolume{}, fmt.Errorf("unknown storage volume type: %s", volume.Type)
+	}
+	return volume, nil
+}
+
+// createResultFile creates the file in the results folder that one of the
+// process's output streams is written to.
+func createResultFile(jobResultsDir, name string) (*os.File, error) {
+	file, err := os.OpenFile(
+		filepath.Join(jobResultsDir, name),
+		os.O_CREATE|os.O_WRONLY|os.O_TRUNC,
+		util.OS_ALL_R|util.OS_USER_RW,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not create results file %s: %w", name, err)
+	}
+	return file, nil
+}
+
+// write the exit code of the process into the results folder the same way
+// the docker executor does
+func writeExitCode(jobResultsDir string, exitCode int) error {
+	err := os.WriteFile(
+		filepath.Join(jobResultsDir, "exitCode"),
+		[]byte(fmt.Sprintf("%d", exitCode)),
+		util.OS_ALL_R|util.OS_USER_RW,
+	)
+	if err != nil {
+		msg := fmt.Sprintf("could not write results to exitCode: %s", err)
+		log.Error().Msg(msg)
+		return errors.New(msg)
+	}
+	return nil
+}
+
+func (e *Executor) shardName(shard model.JobShard) string {
+	return fmt.Sprintf("%s-%d", shard.Job.ID, shard.Index)
+}
+
+func newSpan(ctx context.Context, apiName string) (context.Context, trace.Span) {
+	return system.Span(ctx, "executor/native", apiName)
+}
+
+// Compile-time interface check:
+var _ executor.Executor = (*Executor)(nil)
@@ -0,0 +1,188 @@
+package native
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/pkg/reexec"
+	"github.com/filecoin-project/bacalhau/pkg/executor"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage"
+	noop_storage "github.com/filecoin-project/bacalhau/pkg/storage/noop"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	// the test binary starts the shard processes just like bacalhau does
+	if reexec.Init() {
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// newTestExecutor returns an executor whose storage treats the cid of a
+// storage spec as a path on this machine.
+func newTestExecutor(t *testing.T, config ExecutorConfig) *Executor {
+	ctx := context.Background()
+	cm := system.NewCleanupManager()
+	t.Cleanup(cm.Cleanup)
+
+	storageProvider, err := noop_storage.NewStorageProvider(ctx, cm, noop_storage.StorageConfig{
+		ExternalHooks: noop_storage.StorageConfigExternalHooks{
+			PrepareStorage: func(ctx context.Context, spec model.StorageSpec) (storage.StorageVolume, error) {
+				return storage.StorageVolume{
+					Type:   storage.StorageVolumeConnectorBind,
+					Source: spec.Cid,
+					Target: spec.Path,
+				}, nil
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	config.Enabled = true
+	e, err := NewExecutor(ctx, cm, map[model.StorageSourceType]storage.StorageProvider{
+		model.StorageSourceIPFS: storageProvider,
+	}, config)
+	require.NoError(t, err)
+	return e
+}
+
+func nativeShard(inputDir, inputPath, outputPath string, entrypoint ...string) model.JobShard {
+	return model.JobShard{
+		Job: model.Job{
+			ID: "test-job",
+			Spec: model.JobSpec{
+				Engine: model.EngineNative,
+				Native: model.JobSpecNative{
+					Entrypoint: entrypoint,
+					Env:        []string{"GREETING=hello"},
+				},
+				Inputs: []model.StorageSpec{{
+					Engine: model.StorageSourceIPFS,
+					Cid:    inputDir,
+					Path:   inputPath,
+				}},
+				Outputs: []model.StorageSpec{{
+					Name: "outputs",
+					Path: outputPath,
+				}},
+			},
+		},
+	}
+}
+
+func readResult(t *testing.T, resultsDir, name string) string {
+	data, err := os.ReadFile(filepath.Join(resultsDir, name))
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestRunShardLinksVolumes(t *testing.T) {
+	inputDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(inputDir, "data.txt"), []byte("some data"), 0644))
+
+	e := newTestExecutor(t, ExecutorConfig{})
+	resultsDir := t.TempDir()
+	err := e.RunShard(context.Background(), nativeShard(inputDir, "/inputs", "/outputs",
+		"sh", "-c", `cat inputs/data.txt; echo "$GREETING" > outputs/greeting.txt; echo oops >&2; `+
+			`echo changed > inputs/data.txt 2>/dev/null; touch inputs/new 2>/dev/null; exit 3`,
+	), resultsDir)
+	require.Error(t, err)
+
+	// the input was copied in read only so the process couldn't change it
+	require.Equal(t, "some data", readResult(t, inputDir, "data.txt"))
+	_, err = os.Stat(filepath.Join(inputDir, "new"))
+	require.True(t, os.IsNotExist(err))
+
+	require.Equal(t, "3", readResult(t, resultsDir, "exitCode"))
+	require.Equal(t, "some data", readResult(t, resultsDir, "stdout"))
+	require.Equal(t, "oops\n", readResult(t, resultsDir, "stderr"))
+	require.Equal(t, "hello\n", readResult(t, resultsDir, "outputs/greeting.txt"))
+
+	usage, ok, err := executor.ReadResourceUsage(resultsDir)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(len("hello\n")), usage.DiskWritten)
+	require.Greater(t, usage.WallTimeSeconds, 0.0)
+	require.Greater(t, usage.PeakMemory, uint64(0))
+}
+
+func TestRunShardMountNamespace(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("mount namespaces need root")
+	}
+	inputDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(inputDir, "data.txt"), []byte("some data"), 0644))
+	mountsDir := t.TempDir()
+
+	e := newTestExecutor(t, ExecutorConfig{MountNamespace: true})
+	resultsDir := t.TempDir()
+	err := e.RunShard(context.Background(), nativeShard(inputDir, mountsDir+"/inputs", mountsDir+"/outputs",
+		"sh", "-c", `cat "$0/inputs/data.txt" && echo done > "$0/outputs/done.txt" && ! touch "$0/inputs/nope"`, mountsDir,
+	), resultsDir)
+	if _, statErr := os.Stat(filepath.Join(resultsDir, "exitCode")); err != nil && os.IsNotExist(statErr) {
+		t.Skipf("mount namespaces are not available: %s", err)
+	}
+	require.NoError(t, err)
+	require.Equal(t, "some data", readResult(t, resultsDir, "stdout"))
+	require.Equal(t, "done\n", readResult(t, resultsDir, "outputs/done.txt"))
+
+	// the mounts only existed for the process
+	_, err = os.Stat(filepath.Join(mountsDir, "inputs", "data.txt"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestRunShardBadEntrypoint(t *testing.T) {
+	e := newTestExecutor(t, ExecutorConfig{})
+	resultsDir := t.TempDir()
+	err := e.RunShard(context.Background(), nativeShard(t.TempDir(), "/inputs", "/outputs",
+		"not-a-real-command",
+	), resultsDir)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not-a-real-command")
+	_, err = os.Stat(filepath.Join(resultsDir, "exitCode"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestRunShardCancel(t *testing.T) {
+	e := newTestExecutor(t, ExecutorConfig{})
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := e.RunShard(ctx, nativeShard(t.TempDir(), "/inputs", "/outputs",
+		"sh", "-c", "sleep 30 & sleep 30",
+	), t.TempDir())
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestNewCgroup(t *testing.T) {
+	resources := model.ResourceUsageData{CPU: 0.5, Memory: 1024 * 1024}
+
+	// cgroup v1 has a hierarchy per controller
+	root := t.TempDir()
+	group, err := newCgroup(root, "bacalhau", "job-0", resources)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{
+		filepath.Join(root, "cpu", "bacalhau", "job-0", "cgroup.procs"),
+		filepath.Join(root, "memory", "bacalhau", "job-0", "cgroup.procs"),
+	}, group.procsFiles())
+	require.Equal(t, "50000", readResult(t, root, "cpu/bacalhau/job-0/cpu.cfs_quota_us"))
+	require.Equal(t, "100000", readResult(t, root, "cpu/bacalhau/job-0/cpu.cfs_period_us"))
+	require.Equal(t, "1048576", readResult(t, root, "memory/bacalhau/job-0/memory.limit_in_bytes"))
+
+	// cgroup v2 has a single hierarchy
+	root = t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "cgroup.controllers"), []byte("cpu memory"), 0644))
+	group, err = newCgroup(root, "bacalhau", "job-0", resources)
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(root, "bacalhau", "job-0", "cgroup.procs")}, group.procsFiles())
+	require.Equal(t, "+cpu +memory", readResult(t, root, "bacalhau/cgroup.subtree_control"))
+	require.Equal(t, "50000 100000", readResult(t, root, "bacalhau/job-0/cpu.max"))
+	require.Equal(t, "1048576", readResult(t, root, "bacalhau/job-0/memory.max"))
+}
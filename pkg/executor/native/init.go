@@ -0,0 +1,184 @@
+package native
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/docker/docker/pkg/reexec"
+	"github.com/filecoin-project/bacalhau/pkg/storage/util"
+)
+
+// the name the bacalhau binary is re-executed under to start a native
+// process - main calls reexec.Init so this runs instead of the CLI
+const initName = "bacalhau-native-init"
+
+// the file descriptor the init process reports setup errors on
+const initErrorsFD = 3
+
+// initConfig is everything the init process needs to start a shard's process.
+type initConfig struct {
+	WorkingDir     string
+	MountNamespace bool
+	Mounts         []initMount
+	// the cgroup.procs files to add the process to
+	CgroupProcs []string
+	Entrypoint  []string
+}
+
+type initMount struct {
+	Source   string
+	Target   string
+	ReadOnly bool
+}
+
+//nolint:gochecknoinits
+func init() {
+	reexec.Register(initName, runInit)
+}
+
+// runInit is the main of the init process. It only returns control to the
+// parent by exec'ing the entrypoint or exiting.
+func runInit() {
+	initErrors := os.NewFile(initErrorsFD, "init-errors")
+	// the pipe closes when we exec so the parent knows we got that far
+	syscall.CloseOnExec(initErrorsFD)
+
+	err := startProcess()
+	// startProcess only returns if something went wrong
+	fmt.Fprint(initErrors, err.Error())
+	os.Exit(1)
+}
+
+func startProcess() error {
+	if len(os.Args) != 2 {
+		return fmt.Errorf("expected a config argument")
+	}
+	var config initConfig
+	err := json.Unmarshal([]byte(os.Args[1]), &config)
+	if err != nil {
+		return err
+	}
+
+	// join the cgroup first so everything from here on counts
+	for _, procs := range config.CgroupProcs {
+		err = os.WriteFile(procs, []byte(strconv.Itoa(os.Getpid())), util.OS_USER_RW)
+		if err != nil {
+			return fmt.Errorf("could not join cgroup: %w", err)
+		}
+	}
+
+	if config.MountNamespace {
+		err = makeMountsPrivate()
+		if err != nil {
+			return fmt.Errorf("could not make mounts private: %w", err)
+		}
+	}
+	for _, mount := range config.Mounts {
+		if config.MountNamespace {
+			err = bindMount(mount)
+		} else {
+			err = linkMount(config.WorkingDir, mount)
+		}
+		if err != nil {
+			return fmt.Errorf("could not mount %s: %w", mount.Target, err)
+		}
+	}
+
+	// look the entrypoint up on the job's PATH
+	path, err := exec.LookPath(config.Entrypoint[0])
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(path, config.Entrypoint, os.Environ())
+}
+
+// linkMount puts the volume into the working folder at its path. Writable
+// volumes are symlinked, but a symlink would let the process write through to
+// a read only volume so those are copied and the copy made read only.
+func linkMount(workingDir string, mount initMount) error {
+	target := filepath.Join(workingDir, filepath.Clean("/"+mount.Target))
+	if target == workingDir || !strings.HasPrefix(target, workingDir+string(filepath.Separator)) {
+		return fmt.Errorf("invalid mount path")
+	}
+	err := os.MkdirAll(filepath.Dir(target), util.OS_USER_RWX)
+	if err != nil {
+		return err
+	}
+	if !mount.ReadOnly {
+		return os.Symlink(mount.Source, target)
+	}
+	err = copyTree(mount.Source, target)
+	if err != nil {
+		return err
+	}
+	return setWritable(target, false)
+}
+
+// copyTree copies a file or folder, keeping any symlinks in it as they are.
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, relPath)
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|util.OS_USER_RWX)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		}
+		// devices, sockets and pipes aren't data a job can read
+		return nil
+	})
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm|util.OS_USER_RW)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// setWritable adds or removes write permission on everything under a path
+// (but not what its symlinks point to). The executor makes the working
+// folder writable again before removing it.
+func setWritable(root string, writable bool) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		mode := info.Mode().Perm() &^ util.OS_ALL_W
+		if writable {
+			mode |= util.OS_USER_W
+		}
+		return os.Chmod(path, mode)
+	})
+}
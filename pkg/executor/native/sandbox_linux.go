@@ -0,0 +1,82 @@
+package native
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	"github.com/filecoin-project/bacalhau/pkg/storage/util"
+)
+
+// setSysProcAttr puts the process in its own process group, so we can kill
+// everything it starts, and optionally its own mount namespace.
+func setSysProcAttr(cmd *exec.Cmd, mountNamespace bool) error {
+	cmd.SysProcAttr.Setpgid = true
+	if mountNamespace {
+		cmd.SysProcAttr.Cloneflags = syscall.CLONE_NEWNS
+	}
+	return nil
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// processUsage is the cpu time and peak memory of a process that has
+// exited, including the children it waited for.
+func processUsage(state *os.ProcessState) (float64, uint64) {
+	cpuSeconds := (state.UserTime() + state.SystemTime()).Seconds()
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return cpuSeconds, 0
+	}
+	// linux reports the max resident set size in kilobytes
+	return cpuSeconds, uint64(rusage.Maxrss) * 1024
+}
+
+// makeMountsPrivate stops the mounts the init process makes in its new
+// mount namespace propagating back to the node.
+func makeMountsPrivate() error {
+	return syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, "")
+}
+
+// bindMount mounts the volume at its path, after makeMountsPrivate.
+func bindMount(mount initMount) error {
+	info, err := os.Stat(mount.Source)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		err = os.MkdirAll(mount.Target, util.OS_ALL_R|util.OS_ALL_X|util.OS_USER_W)
+	} else {
+		err = createMountPointFile(mount.Target)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = syscall.Mount(mount.Source, mount.Target, "", syscall.MS_BIND|syscall.MS_REC, "")
+	if err != nil {
+		return err
+	}
+	if mount.ReadOnly {
+		return syscall.Mount("", mount.Target, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY, "")
+	}
+	return nil
+}
+
+func createMountPointFile(target string) error {
+	if _, err := os.Stat(target); err == nil {
+		return nil
+	}
+	err := os.MkdirAll(filepath.Dir(target), util.OS_ALL_R|util.OS_ALL_X|util.OS_USER_W)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY, util.OS_ALL_R|util.OS_USER_W)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,35 @@
+//go:build !linux
+
+package native
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// mount namespaces are linux only - elsewhere volumes can only be symlinked
+func setSysProcAttr(cmd *exec.Cmd, mountNamespace bool) error {
+	if mountNamespace {
+		return fmt.Errorf("mount namespaces are only supported on linux")
+	}
+	return nil
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	_ = cmd.Process.Kill()
+}
+
+// the peak memory isn't reported the same way everywhere so we only
+// measure cpu time here
+func processUsage(state *os.ProcessState) (float64, uint64) {
+	return (state.UserTime() + state.SystemTime()).Seconds(), 0
+}
+
+func makeMountsPrivate() error {
+	return fmt.Errorf("mount namespaces are only supported on linux")
+}
+
+func bindMount(mount initMount) error {
+	return fmt.Errorf("mount namespaces are only supported on linux")
+}
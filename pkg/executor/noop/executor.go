@@ -11,12 +11,16 @@ type ExecutorHandlerIsInstalled func(ctx context.Context) (bool, error)
 type ExecutorHandlerHasStorageLocally func(ctx context.Context, volume model.StorageSpec) (bool, error)
 type ExecutorHandlerGetVolumeSize func(ctx context.Context, volume model.StorageSpec) (uint64, error)
 type ExecutorHandlerJobHandler func(ctx context.Context, shard model.JobShard, resultsDir string) error
+type ExecutorHandlerGetShardProgress func(ctx context.Context, shard model.JobShard) (model.ShardProgress, bool, error)
+type ExecutorHandlerGetImageSize func(ctx context.Context, spec model.JobSpec) (uint64, error)
 
 type ExecutorConfigExternalHooks struct {
 	IsInstalled       ExecutorHandlerIsInstalled
 	HasStorageLocally ExecutorHandlerHasStorageLocally
 	GetVolumeSize     ExecutorHandlerGetVolumeSize
 	JobHandler        ExecutorHandlerJobHandler
+	GetShardProgress  ExecutorHandlerGetShardProgress
+	GetImageSize      ExecutorHandlerGetImageSize
 }
 
 type ExecutorConfig struct {
@@ -82,5 +86,26 @@ func (e *Executor) RunShard(
 	return nil
 }
 
+func (e *Executor) GetShardProgress(
+	ctx context.Context,
+	shard model.JobShard,
+) (model.ShardProgress, bool, error) {
+	if e.Config.ExternalHooks.GetShardProgress != nil {
+		handler := e.Config.ExternalHooks.GetShardProgress
+		return handler(ctx, shard)
+	}
+	return model.ShardProgress{}, false, nil
+}
+
+func (e *Executor) GetImageSize(ctx context.Context, spec model.JobSpec) (uint64, error) {
+	if e.Config.ExternalHooks.GetImageSize != nil {
+		handler := e.Config.ExternalHooks.GetImageSize
+		return handler(ctx, spec)
+	}
+	return 0, nil
+}
+
 // Compile-time check that Executor implements the Executor interface.
 var _ executor.Executor = (*Executor)(nil)
+var _ executor.ShardProgressReporter = (*Executor)(nil)
+var _ executor.ImageSizer = (*Executor)(nil)
@@ -4,22 +4,54 @@ package pythonwasm
 The python_wasm executor wraps the docker executor. The requestor will have
 automatically uploaded the execution context (python files, requirements.txt) to
 ipfs so that it can be mounted into the wasm runtime container.
+
+Pyodide can't build or load native extensions, so requirements are resolved
+on the compute node to pure python wheels - vendored in the context (in a
+wheels folder next to requirements.txt, or folders given with --find-links)
+or from a package index the node operator configures - and unpacked into a
+folder that is mounted into the container and put on sys.path.
 */
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/rs/zerolog/log"
 
 	"github.com/filecoin-project/bacalhau/pkg/executor"
 	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage"
 	"github.com/filecoin-project/bacalhau/pkg/system"
 )
 
+// where the installed packages are mounted in the container - n.js mounts
+// everything under /pyodide_inputs at the root of the pyodide filesystem
+const (
+	packagesContainerDir = "/pyodide_inputs/bacalhau_packages"
+	packagesPyodideDir   = "/bacalhau_packages"
+)
+
+type ExecutorConfig struct {
+	// a PEP 503 simple index (e.g. a local pypiserver or devpi) to look for
+	// wheels in when they aren't vendored in the job context
+	PackageIndexURL string
+}
+
+func NewDefaultExecutorConfig() ExecutorConfig {
+	return ExecutorConfig{}
+}
+
 type Executor struct {
 	Jobs []*model.Job
 
+	Config ExecutorConfig
+
+	// the storage providers used to read the job context for requirements
+	StorageProviders map[model.StorageSourceType]storage.StorageProvider
+
 	executors map[model.EngineType]executor.Executor
 }
 
@@ -27,9 +59,13 @@ func NewExecutor(
 	ctx context.Context,
 	cm *system.CleanupManager,
 	executors map[model.EngineType]executor.Executor,
+	storageProviders map[model.StorageSourceType]storage.StorageProvider,
+	executorConfig ExecutorConfig,
 ) (*Executor, error) {
 	e := &Executor{
-		executors: executors,
+		Config:           executorConfig,
+		StorageProviders: storageProviders,
+		executors:        executors,
 	}
 	return e, nil
 }
@@ -47,10 +83,24 @@ func (e *Executor) GetVolumeSize(ctx context.Context, volumes model.StorageSpec)
 }
 
 func (e *Executor) RunShard(ctx context.Context, shard model.JobShard, resultsDir string) error {
+	ctx, span := system.GetTracer().Start(ctx, "pkg/executor/python_wasm.RunShard")
+	defer span.End()
+
 	log.Debug().Msgf("in python_wasm executor!")
 	// translate language jobspec into a docker run command
 	shard.Job.Spec.Docker.Image = "quay.io/bacalhau/pyodide:e4b0eb7c1d81f320f5b43fc838b0f2a5b9003c9a"
-	if shard.Job.Spec.Language.Command != "" {
+	if shard.Job.Spec.Language.RequirementsPath != "" {
+		packagesDir, err := e.installRequirements(ctx, shard)
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(packagesDir)
+		ctx = executor.WithReadOnlyMounts(ctx, []executor.ReadOnlyMount{{
+			Source: packagesDir,
+			Target: packagesContainerDir,
+		}})
+		shard.Job.Spec.Docker.Entrypoint = []string{"node", "n.js", "-c", bootstrap(shard.Job.Spec.Language)}
+	} else if shard.Job.Spec.Language.Command != "" {
 		// pass command through to node wasm wrapper
 		shard.Job.Spec.Docker.Entrypoint = []string{"node", "n.js", "-c", shard.Job.Spec.Language.Command}
 	} else if shard.Job.Spec.Language.ProgramPath != "" {
@@ -77,5 +127,24 @@ func (e *Executor) RunShard(ctx context.Context, shard model.JobShard, resultsDi
 	return e.executors[model.EngineDocker].RunShard(ctx, shard, resultsDir)
 }
 
+// bootstrap returns python that puts the installed packages on sys.path
+// before running the job's program or command as __main__.
+func bootstrap(spec model.JobSpecLanguage) string {
+	script := fmt.Sprintf("import sys\nsys.path.insert(0, %q)\n", packagesPyodideDir)
+	if spec.Command != "" {
+		// the command is encoded so that it can't break out of the string
+		script += fmt.Sprintf(
+			"import base64\nexec(compile(base64.b64decode(%q).decode(), \"<string>\", \"exec\"), {\"__name__\": \"__main__\"})\n",
+			base64.StdEncoding.EncodeToString([]byte(spec.Command)),
+		)
+	} else {
+		script += fmt.Sprintf(
+			"import runpy\nrunpy.run_path(%q, run_name=\"__main__\")\n",
+			"/job/"+strings.TrimPrefix(spec.ProgramPath, "/"),
+		)
+	}
+	return script
+}
+
 // Compile-time check that Executor implements the Executor interface.
 var _ executor.Executor = (*Executor)(nil)
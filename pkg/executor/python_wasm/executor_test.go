@@ -0,0 +1,258 @@
+package pythonwasm
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/filecoin-project/bacalhau/pkg/executor"
+	noop_executor "github.com/filecoin-project/bacalhau/pkg/executor/noop"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage"
+	noop_storage "github.com/filecoin-project/bacalhau/pkg/storage/noop"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	"github.com/stretchr/testify/require"
+)
+
+// writeWheel writes a wheel containing a module for the package with the
+// given dependencies and returns its path.
+func writeWheel(t *testing.T, dir, filename string, dependencies ...string) string {
+	w, err := parseWheelFilename(filename)
+	require.NoError(t, err)
+	module := strings.ReplaceAll(w.name, "-", "_")
+
+	wheelPath := filepath.Join(dir, filename)
+	file, err := os.Create(wheelPath)
+	require.NoError(t, err)
+	defer file.Close()
+	archive := zip.NewWriter(file)
+	defer archive.Close()
+
+	metadata := fmt.Sprintf("Metadata-Version: 2.1\nName: %s\nVersion: %s\n", w.name, w.version)
+	for _, dependency := range dependencies {
+		metadata += "Requires-Dist: " + dependency + "\n"
+	}
+	metadata += "\nRequires-Dist: not-a-header\n"
+	for name, content := range map[string]string{
+		module + "/__init__.py": fmt.Sprintf("VERSION = %q\n", w.version),
+		fmt.Sprintf("%s-%s.dist-info/METADATA", module, w.version): metadata,
+	} {
+		writer, err := archive.Create(name)
+		require.NoError(t, err)
+		_, err = writer.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	return wheelPath
+}
+
+// newTestExecutor returns an executor whose storage treats the cid of the
+// job context as a path on this machine and whose docker executor records
+// the shards and mounts it is given.
+func newTestExecutor(t *testing.T, config ExecutorConfig) (*Executor, *[]model.JobShard, *[]executor.ReadOnlyMount) {
+	ctx := context.Background()
+	cm := system.NewCleanupManager()
+	t.Cleanup(cm.Cleanup)
+
+	storageProvider, err := noop_storage.NewStorageProvider(ctx, cm, noop_storage.StorageConfig{
+		ExternalHooks: noop_storage.StorageConfigExternalHooks{
+			PrepareStorage: func(ctx context.Context, spec model.StorageSpec) (storage.StorageVolume, error) {
+				return storage.StorageVolume{
+					Type:   storage.StorageVolumeConnectorBind,
+					Source: spec.Cid,
+					Target: spec.Path,
+				}, nil
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	shards := []model.JobShard{}
+	mounts := []executor.ReadOnlyMount{}
+	dockerExecutor, err := noop_executor.NewExecutorWithConfig(noop_executor.ExecutorConfig{
+		ExternalHooks: noop_executor.ExecutorConfigExternalHooks{
+			JobHandler: func(ctx context.Context, shard model.JobShard, resultsDir string) error {
+				shards = append(shards, shard)
+				for _, mount := range executor.ReadOnlyMountsFromContext(ctx) {
+					// the packages folder is removed when the shard finishes
+					_, err := os.Stat(filepath.Join(mount.Source, "six", "__init__.py"))
+					require.NoError(t, err)
+					mounts = append(mounts, mount)
+				}
+				return nil
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	e, err := NewExecutor(ctx, cm, map[model.EngineType]executor.Executor{
+		model.EngineDocker: dockerExecutor,
+	}, map[model.StorageSourceType]storage.StorageProvider{
+		model.StorageSourceIPFS: storageProvider,
+	}, config)
+	require.NoError(t, err)
+	return e, &shards, &mounts
+}
+
+func pythonShard(contextDir string, spec model.JobSpecLanguage) model.JobShard {
+	return model.JobShard{
+		Job: model.Job{
+			ID: "test-job",
+			Spec: model.JobSpec{
+				Engine:   model.EnginePythonWasm,
+				Language: spec,
+				Contexts: []model.StorageSpec{{
+					Engine: model.StorageSourceIPFS,
+					Cid:    contextDir,
+					Path:   "/job",
+				}},
+			},
+		},
+	}
+}
+
+func TestRunShardWithoutRequirements(t *testing.T) {
+	e, shards, mounts := newTestExecutor(t, ExecutorConfig{})
+	err := e.RunShard(context.Background(), pythonShard(t.TempDir(), model.JobSpecLanguage{
+		Command: "print(1)",
+	}), t.TempDir())
+	require.NoError(t, err)
+	require.Len(t, *shards, 1)
+	require.Empty(t, *mounts)
+	require.Equal(t, []string{"node", "n.js", "-c", "print(1)"}, (*shards)[0].Job.Spec.Docker.Entrypoint)
+	require.Equal(t, "/pyodide_inputs/job", (*shards)[0].Job.Spec.Contexts[0].Path)
+}
+
+func TestRunShardInstallsVendoredRequirements(t *testing.T) {
+	contextDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(contextDir, "requirements.txt"), []byte("six>=1.15\n"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(contextDir, "wheels"), 0755))
+	writeWheel(t, filepath.Join(contextDir, "wheels"), "six-1.14.0-py2.py3-none-any.whl")
+	writeWheel(t, filepath.Join(contextDir, "wheels"), "six-1.16.0-py2.py3-none-any.whl")
+
+	e, shards, mounts := newTestExecutor(t, ExecutorConfig{})
+	err := e.RunShard(context.Background(), pythonShard(contextDir, model.JobSpecLanguage{
+		ProgramPath:      "main.py",
+		RequirementsPath: "requirements.txt",
+	}), t.TempDir())
+	require.NoError(t, err)
+	require.Len(t, *shards, 1)
+	require.Len(t, *mounts, 1)
+	require.Equal(t, packagesContainerDir, (*mounts)[0].Target)
+	_, err = os.Stat((*mounts)[0].Source)
+	require.True(t, os.IsNotExist(err), "the packages folder should be removed after the shard")
+
+	entrypoint := (*shards)[0].Job.Spec.Docker.Entrypoint
+	require.Equal(t, []string{"node", "n.js", "-c"}, entrypoint[:3])
+	require.Contains(t, entrypoint[3], `sys.path.insert(0, "/bacalhau_packages")`)
+	require.Contains(t, entrypoint[3], `runpy.run_path("/job/main.py", run_name="__main__")`)
+}
+
+func TestRunShardRejectsNativeRequirements(t *testing.T) {
+	contextDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(contextDir, "requirements.txt"), []byte("numpy\n"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(contextDir, "wheels"), 0755))
+	writeWheel(t, filepath.Join(contextDir, "wheels"), "numpy-1.23.4-cp310-cp310-manylinux_2_17_x86_64.whl")
+
+	e, shards, _ := newTestExecutor(t, ExecutorConfig{})
+	err := e.RunShard(context.Background(), pythonShard(contextDir, model.JobSpecLanguage{
+		Command:          "import numpy",
+		RequirementsPath: "requirements.txt",
+	}), t.TempDir())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "native extensions")
+	require.Empty(t, *shards)
+}
+
+func TestResolveFromIndex(t *testing.T) {
+	ctx := context.Background()
+	wheelsDir := t.TempDir()
+	files := map[string]string{}
+	for _, filename := range []string{
+		"requests-2.28.1-py3-none-any.whl",
+		"requests-3.0.0rc1-py3-none-any.whl",
+		"urllib3-1.26.12-py2.py3-none-any.whl",
+		"urllib3-2.0.0-py3-none-any.whl",
+		"charset_normalizer-2.1.1-py3-none-any.whl",
+	} {
+		dependencies := []string{}
+		if strings.HasPrefix(filename, "requests-") {
+			dependencies = []string{"urllib3 (<1.27,>=1.21.1)", "charset-normalizer<3", `PySocks!=1.5.7; extra == "socks"`}
+		}
+		files[filename] = writeWheel(t, wheelsDir, filename, dependencies...)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/files/") {
+			http.ServeFile(w, r, files[strings.TrimPrefix(r.URL.Path, "/files/")])
+			return
+		}
+		name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/simple/"), "/")
+		page := "<html><body>\n"
+		for filename, filePath := range files {
+			if distributionName(filename) != name {
+				continue
+			}
+			data, err := os.ReadFile(filePath)
+			require.NoError(t, err)
+			hash := sha256.Sum256(data)
+			page += fmt.Sprintf("<a href=\"../../files/%s#sha256=%s\">%s</a><br/>\n", filename, hex.EncodeToString(hash[:]), filename)
+		}
+		if page == "<html><body>\n" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(page))
+	}))
+	defer server.Close()
+
+	index := indexSource{url: server.URL + "/simple", client: server.Client(), downloadDir: t.TempDir()}
+	wheels, err := newResolver([]wheelSource{index}).resolve(ctx, []requirement{{name: "requests"}})
+	require.NoError(t, err)
+	picked := []string{}
+	for _, w := range wheels {
+		picked = append(picked, w.name+"=="+w.version)
+	}
+	require.Equal(t, []string{"requests==2.28.1", "urllib3==1.26.12", "charset-normalizer==2.1.1"}, picked)
+
+	packagesDir := t.TempDir()
+	for _, w := range wheels {
+		require.NoError(t, installWheel(w.path, packagesDir))
+	}
+	_, err = os.Stat(filepath.Join(packagesDir, "charset_normalizer", "__init__.py"))
+	require.NoError(t, err)
+
+	_, err = newResolver([]wheelSource{index}).resolve(ctx, []requirement{{name: "missing"}})
+	require.Error(t, err)
+
+	_, err = newResolver([]wheelSource{index}).resolve(ctx, []requirement{
+		{name: "urllib3", specifiers: []specifier{{">=", "2"}}},
+		{name: "requests"},
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "conflicting requirements")
+}
+
+func TestResolvePrefersVendoredWheels(t *testing.T) {
+	vendored := t.TempDir()
+	writeWheel(t, vendored, "six-1.15.0-py2.py3-none-any.whl")
+	other := t.TempDir()
+	writeWheel(t, other, "six-1.16.0-py2.py3-none-any.whl")
+	require.NoError(t, os.WriteFile(filepath.Join(other, "attrs-22.1.0.tar.gz"), []byte{}, 0644))
+
+	r := newResolver([]wheelSource{dirSource{dir: vendored}, dirSource{dir: other}})
+	wheels, err := r.resolve(context.Background(), []requirement{{name: "six"}})
+	require.NoError(t, err)
+	require.Equal(t, "1.15.0", wheels[0].version)
+
+	_, err = r.resolve(context.Background(), []requirement{{name: "attrs"}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "source distribution")
+}
@@ -0,0 +1,225 @@
+package pythonwasm
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// markerEnvironment is what the PEP 508 marker variables are in the pyodide
+// image we run jobs in. We never install extras, so "extra" is always empty.
+var markerEnvironment = map[string]string{
+	"python_version":                 "3.10",
+	"python_full_version":            "3.10.2",
+	"implementation_version":         "3.10.2",
+	"implementation_name":            "cpython",
+	"platform_python_implementation": "CPython",
+	"os_name":                        "posix",
+	"sys_platform":                   "emscripten",
+	"platform_system":                "Emscripten",
+	"platform_machine":               "wasm32",
+	"extra":                          "",
+}
+
+// versionMarkers are the variables that are compared as versions rather than
+// as strings.
+var versionMarkers = map[string]bool{
+	"python_version":         true,
+	"python_full_version":    true,
+	"implementation_version": true,
+}
+
+// evaluateMarker returns whether a PEP 508 environment marker, e.g.
+// `python_version < "3.8" and sys_platform != "win32"`, holds in pyodide.
+func evaluateMarker(marker string) (bool, error) {
+	tokens, err := tokenizeMarker(marker)
+	if err != nil {
+		return false, fmt.Errorf("invalid marker %q: %w", marker, err)
+	}
+	p := &markerParser{tokens: tokens}
+	result, err := p.or()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos].value)
+	}
+	if err != nil {
+		return false, fmt.Errorf("invalid marker %q: %w", marker, err)
+	}
+	return result, nil
+}
+
+type markerToken struct {
+	value string
+	// true for quoted strings, which are never keywords or variables
+	quoted bool
+}
+
+func tokenizeMarker(marker string) ([]markerToken, error) {
+	tokens := []markerToken{}
+	for i := 0; i < len(marker); {
+		c := marker[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, markerToken{value: string(c)})
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(marker[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, markerToken{value: marker[i+1 : i+1+end], quoted: true})
+			i += end + 2
+		case strings.ContainsRune("=!<>~", rune(c)):
+			end := i
+			for end < len(marker) && strings.ContainsRune("=!<>~", rune(marker[end])) {
+				end++
+			}
+			tokens = append(tokens, markerToken{value: marker[i:end]})
+			i = end
+		case c == '_' || unicode.IsLetter(rune(c)):
+			end := i
+			for end < len(marker) && (marker[end] == '_' || marker[end] == '.' ||
+				unicode.IsLetter(rune(marker[end])) || unicode.IsDigit(rune(marker[end]))) {
+				end++
+			}
+			tokens = append(tokens, markerToken{value: marker[i:end]})
+			i = end
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return tokens, nil
+}
+
+// markerParser is a recursive descent parser for the marker grammar:
+//
+//	or    = and ("or" and)*
+//	and   = atom ("and" atom)*
+//	atom  = "(" or ")" | value op value
+type markerParser struct {
+	tokens []markerToken
+	pos    int
+}
+
+func (p *markerParser) peek(value string) bool {
+	return p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && p.tokens[p.pos].value == value
+}
+
+func (p *markerParser) next() (markerToken, error) {
+	if p.pos >= len(p.tokens) {
+		return markerToken{}, fmt.Errorf("unexpected end of marker")
+	}
+	p.pos++
+	return p.tokens[p.pos-1], nil
+}
+
+func (p *markerParser) or() (bool, error) {
+	result, err := p.and()
+	for err == nil && p.peek("or") {
+		p.pos++
+		var right bool
+		right, err = p.and()
+		result = result || right
+	}
+	return result, err
+}
+
+func (p *markerParser) and() (bool, error) {
+	result, err := p.atom()
+	for err == nil && p.peek("and") {
+		p.pos++
+		var right bool
+		right, err = p.atom()
+		result = result && right
+	}
+	return result, err
+}
+
+func (p *markerParser) atom() (bool, error) {
+	if p.peek("(") {
+		p.pos++
+		result, err := p.or()
+		if err != nil {
+			return false, err
+		}
+		if !p.peek(")") {
+			return false, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return result, nil
+	}
+	left, err := p.next()
+	if err != nil {
+		return false, err
+	}
+	op, err := p.next()
+	if err != nil {
+		return false, err
+	}
+	if op.quoted {
+		return false, fmt.Errorf("expected an operator, got %q", op.value)
+	}
+	if op.value == "not" {
+		if !p.peek("in") {
+			return false, fmt.Errorf("expected \"in\" after \"not\"")
+		}
+		p.pos++
+		op.value = "not in"
+	}
+	right, err := p.next()
+	if err != nil {
+		return false, err
+	}
+	return compareMarker(left, op.value, right)
+}
+
+// compareMarker evaluates a single comparison. Version variables are
+// compared as versions where the operator allows it and everything else as
+// strings, as PEP 508 describes.
+func compareMarker(left markerToken, op string, right markerToken) (bool, error) {
+	isVersion := (!left.quoted && versionMarkers[left.value]) || (!right.quoted && versionMarkers[right.value])
+	leftValue, err := markerValue(left)
+	if err != nil {
+		return false, err
+	}
+	rightValue, err := markerValue(right)
+	if err != nil {
+		return false, err
+	}
+	if !left.quoted && left.value == "extra" || !right.quoted && right.value == "extra" {
+		leftValue, rightValue = normalizeName(leftValue), normalizeName(rightValue)
+	}
+
+	switch op {
+	case "in":
+		return strings.Contains(rightValue, leftValue), nil
+	case "not in":
+		return !strings.Contains(rightValue, leftValue), nil
+	case "===":
+		return leftValue == rightValue, nil
+	case "==", "!=", "<", "<=", ">", ">=", "~=":
+		if isVersion {
+			return specifier{op: op, version: rightValue}.allows(leftValue), nil
+		}
+		switch op {
+		case "==":
+			return leftValue == rightValue, nil
+		case "!=":
+			return leftValue != rightValue, nil
+		}
+		return false, fmt.Errorf("%q can only compare versions", op)
+	}
+	return false, fmt.Errorf("unknown operator %q", op)
+}
+
+func markerValue(token markerToken) (string, error) {
+	if token.quoted {
+		return token.value, nil
+	}
+	value, ok := markerEnvironment[token.value]
+	if !ok {
+		return "", fmt.Errorf("unknown marker variable %q", token.value)
+	}
+	return value, nil
+}
@@ -0,0 +1,234 @@
+package pythonwasm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage/util"
+)
+
+// the folder next to requirements.txt that vendored wheels are found in
+// without needing a --find-links line
+const vendoredWheelsDir = "wheels"
+
+// resolvedWheel is the wheel picked for a package.
+type resolvedWheel struct {
+	wheel
+	path string
+}
+
+// resolver picks a pure python wheel for each requirement and its
+// dependencies, looking through the sources in order.
+type resolver struct {
+	sources  []wheelSource
+	resolved map[string]resolvedWheel
+}
+
+func newResolver(sources []wheelSource) *resolver {
+	return &resolver{
+		sources:  sources,
+		resolved: map[string]resolvedWheel{},
+	}
+}
+
+// resolve returns the wheels to install for the requirements, including
+// their dependencies.
+func (r *resolver) resolve(ctx context.Context, requirements []requirement) ([]resolvedWheel, error) {
+	results := []resolvedWheel{}
+	queue := append([]requirement{}, requirements...)
+	for len(queue) > 0 {
+		req := queue[0]
+		queue = queue[1:]
+
+		if existing, ok := r.resolved[req.name]; ok {
+			if !req.allows(existing.version) {
+				return nil, fmt.Errorf("conflicting requirements: %s %s was picked but %s is also required",
+					existing.name, existing.version, req)
+			}
+			continue
+		}
+
+		picked, err := r.pick(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		dependencies, err := wheelDependencies(picked.path)
+		if err != nil {
+			return nil, err
+		}
+		r.resolved[req.name] = picked
+		results = append(results, picked)
+		queue = append(queue, dependencies...)
+	}
+	return results, nil
+}
+
+// pick finds the newest pure python wheel that satisfies the requirement,
+// preferring earlier sources, and explains why if there isn't one.
+func (r *resolver) pick(ctx context.Context, req requirement) (resolvedWheel, error) {
+	nativeWheels := []string{}
+	sdists := []string{}
+	for _, source := range r.sources {
+		dists, err := source.distributions(ctx, req.name)
+		if err != nil {
+			return resolvedWheel{}, fmt.Errorf("looking for %s in %s: %w", req.name, source, err)
+		}
+
+		var best *distribution
+		var bestWheel wheel
+		for i := range dists {
+			dist := dists[i]
+			if isSdist(dist.filename) {
+				sdists = append(sdists, dist.filename)
+				continue
+			}
+			w, err := parseWheelFilename(dist.filename)
+			if err != nil || !req.allows(w.version) {
+				continue
+			}
+			if isPreRelease(w.version) && !req.pinsPreRelease() {
+				continue
+			}
+			if !w.isPure() {
+				nativeWheels = append(nativeWheels, dist.filename)
+				continue
+			}
+			if best == nil || compareVersions(w.version, bestWheel.version) > 0 {
+				best = &dist
+				bestWheel = w
+			}
+		}
+		if best == nil {
+			continue
+		}
+
+		wheelPath, err := best.fetch(ctx)
+		if err != nil {
+			return resolvedWheel{}, fmt.Errorf("fetching %s: %w", best.filename, err)
+		}
+		log.Debug().Msgf("python_wasm: using %s from %s for %s", best.filename, source, req)
+		return resolvedWheel{wheel: bestWheel, path: wheelPath}, nil
+	}
+
+	switch {
+	case len(nativeWheels) > 0:
+		return resolvedWheel{}, fmt.Errorf(
+			"%s has native extensions (%s) - only pure python packages can be installed for python_wasm jobs",
+			req, strings.Join(nativeWheels, ", "))
+	case len(sdists) > 0:
+		return resolvedWheel{}, fmt.Errorf(
+			"%s is only available as a source distribution (%s) - vendor a pure python wheel for it instead",
+			req, strings.Join(sdists, ", "))
+	default:
+		return resolvedWheel{}, fmt.Errorf("no wheel was found for %s in the job context or the package index", req)
+	}
+}
+
+// installRequirements resolves the requirements file of a job into a folder
+// of unpacked packages that can be put on sys.path. The caller is
+// responsible for removing the folder.
+func (e *Executor) installRequirements(ctx context.Context, shard model.JobShard) (string, error) {
+	spec := shard.Job.Spec.Language
+	var contextSpec *model.StorageSpec
+	for i := range shard.Job.Spec.Contexts {
+		if shard.Job.Spec.Contexts[i].Path == "/job" {
+			contextSpec = &shard.Job.Spec.Contexts[i]
+		}
+	}
+	if contextSpec == nil {
+		return "", fmt.Errorf("requirements file %s was given but the job has no context", spec.RequirementsPath)
+	}
+
+	storageProvider, err := util.GetStorageProvider(ctx, contextSpec.Engine, e.StorageProviders)
+	if err != nil {
+		return "", err
+	}
+	volume, err := storageProvider.PrepareStorage(ctx, *contextSpec)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if cleanupErr := storageProvider.CleanupStorage(ctx, *contextSpec, volume); cleanupErr != nil {
+			log.Warn().Err(cleanupErr).Msg("python_wasm: failed to clean up job context")
+		}
+	}()
+
+	requirementsPath := filepath.Join(volume.Source, filepath.Clean("/"+spec.RequirementsPath))
+	data, err := os.ReadFile(requirementsPath)
+	if err != nil {
+		return "", fmt.Errorf("reading requirements file %s: %w", spec.RequirementsPath, err)
+	}
+	requirements, err := parseRequirements(data)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", spec.RequirementsPath, err)
+	}
+
+	downloadDir, err := os.MkdirTemp("", "bacalhau-python-wasm-downloads")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(downloadDir)
+
+	sources := contextSources(volume.Source, filepath.Dir(requirementsPath), requirements.findLinks)
+	if e.Config.PackageIndexURL != "" {
+		sources = append(sources, indexSource{
+			url:         e.Config.PackageIndexURL,
+			client:      http.DefaultClient,
+			downloadDir: downloadDir,
+		})
+	}
+
+	wheels, err := newResolver(sources).resolve(ctx, requirements.requirements)
+	if err != nil {
+		return "", err
+	}
+
+	packagesDir, err := os.MkdirTemp("", "bacalhau-python-wasm-packages")
+	if err != nil {
+		return "", err
+	}
+	// the job might run as a user that doesn't own the folder
+	err = os.Chmod(packagesDir, util.OS_ALL_R|util.OS_ALL_X|util.OS_USER_W)
+	if err != nil {
+		os.RemoveAll(packagesDir)
+		return "", err
+	}
+	for _, w := range wheels {
+		if err = installWheel(w.path, packagesDir); err != nil {
+			os.RemoveAll(packagesDir)
+			return "", fmt.Errorf("installing %s: %w", filepath.Base(w.path), err)
+		}
+	}
+	return packagesDir, nil
+}
+
+// contextSources returns the folders in the job context to look for wheels
+// in - the find links of the requirements file and the vendored wheels
+// folder next to it. Folders outside the context are ignored.
+func contextSources(contextDir, requirementsDir string, findLinks []string) []wheelSource {
+	dirs := []string{}
+	for _, findLink := range findLinks {
+		dirs = append(dirs, filepath.Join(requirementsDir, findLink))
+	}
+	dirs = append(dirs, filepath.Join(requirementsDir, vendoredWheelsDir))
+
+	sources := []wheelSource{}
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(contextDir, dir)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			continue
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		sources = append(sources, dirSource{dir: dir})
+	}
+	return sources
+}
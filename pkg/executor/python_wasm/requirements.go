@@ -0,0 +1,303 @@
+package pythonwasm
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// requirement is a package a job needs and the versions of it that will do.
+type requirement struct {
+	// the normalized name of the package (see normalizeName)
+	name       string
+	specifiers []specifier
+}
+
+// specifier is a single version clause of a requirement, e.g. ">=1.2".
+type specifier struct {
+	op      string
+	version string
+}
+
+// requirementsFile is what we understand of a requirements.txt file.
+type requirementsFile struct {
+	requirements []requirement
+	// the folders given with -f / --find-links, relative to the file
+	findLinks []string
+}
+
+var (
+	requirementRegex = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)\s*(\[[^\]]*\])?\s*(.*)$`)
+	specifierRegex   = regexp.MustCompile(`^(===|==|!=|~=|>=|<=|>|<)\s*([A-Za-z0-9._*+!-]+)$`)
+	nameRegex        = regexp.MustCompile(`[-_.]+`)
+	versionRegex     = regexp.MustCompile(`^(\d+(?:\.\d+)*)[._-]?([a-z]*)[._-]?(\d*)(.*)$`)
+)
+
+// normalizeName returns the PEP 503 normalized form of a package name,
+// which is how it is compared and looked up in an index.
+func normalizeName(name string) string {
+	return strings.ToLower(nameRegex.ReplaceAllString(name, "-"))
+}
+
+// parseRequirements parses a requirements.txt file. Only the parts of the
+// format that make sense without pip are supported - anything else is an
+// error rather than being silently ignored.
+func parseRequirements(data []byte) (requirementsFile, error) {
+	result := requirementsFile{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if idx := strings.Index(line, "#"); idx == 0 || (idx > 0 && strings.ContainsAny(line[idx-1:idx], " \t")) {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "-") {
+			findLink, err := parseRequirementsOption(line)
+			if err != nil {
+				return result, fmt.Errorf("requirements line %d: %w", lineNumber, err)
+			}
+			result.findLinks = append(result.findLinks, findLink)
+			continue
+		}
+
+		if strings.Contains(line, ";") {
+			return result, fmt.Errorf("requirements line %d: environment markers are not supported: %s", lineNumber, line)
+		}
+		req, err := parseRequirement(line)
+		if err != nil {
+			return result, fmt.Errorf("requirements line %d: %w", lineNumber, err)
+		}
+		result.requirements = append(result.requirements, req)
+	}
+	return result, scanner.Err()
+}
+
+// parseRequirementsOption returns the folder given by a find links option,
+// which is the only option we support.
+func parseRequirementsOption(line string) (string, error) {
+	var value string
+	switch {
+	case strings.HasPrefix(line, "--find-links="):
+		value = strings.TrimPrefix(line, "--find-links=")
+	case strings.HasPrefix(line, "--find-links "), strings.HasPrefix(line, "-f "):
+		value = strings.TrimSpace(line[strings.Index(line, " "):])
+	default:
+		return "", fmt.Errorf("unsupported option (only -f / --find-links is supported): %s", line)
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", fmt.Errorf("find links option has no folder: %s", line)
+	}
+	if strings.Contains(value, "://") {
+		return "", fmt.Errorf("find links must be a folder in the job context: %s", value)
+	}
+	return value, nil
+}
+
+// parseRequirement parses a requirement in either requirements.txt form
+// ("requests>=2,<3") or wheel metadata form ("requests (>=2,<3)"). Extras are
+// accepted but their extra dependencies are not installed.
+func parseRequirement(line string) (requirement, error) {
+	if strings.Contains(line, "@") || strings.Contains(line, "://") {
+		return requirement{}, fmt.Errorf("direct references are not supported: %s", line)
+	}
+	matches := requirementRegex.FindStringSubmatch(strings.TrimSpace(line))
+	if matches == nil {
+		return requirement{}, fmt.Errorf("invalid requirement: %s", line)
+	}
+	req := requirement{
+		name: normalizeName(matches[1]),
+	}
+	rest := strings.TrimSpace(matches[3])
+	rest = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(rest, "("), ")"))
+	if rest == "" {
+		return req, nil
+	}
+	for _, clause := range strings.Split(rest, ",") {
+		clauseMatches := specifierRegex.FindStringSubmatch(strings.TrimSpace(clause))
+		if clauseMatches == nil {
+			return requirement{}, fmt.Errorf("invalid version specifier %q in requirement: %s", clause, line)
+		}
+		req.specifiers = append(req.specifiers, specifier{
+			op:      clauseMatches[1],
+			version: clauseMatches[2],
+		})
+	}
+	return req, nil
+}
+
+func (r requirement) String() string {
+	clauses := []string{}
+	for _, s := range r.specifiers {
+		clauses = append(clauses, s.op+s.version)
+	}
+	return r.name + strings.Join(clauses, ",")
+}
+
+// allows returns true if the given version satisfies all of the requirement's
+// specifiers.
+func (r requirement) allows(version string) bool {
+	for _, s := range r.specifiers {
+		if !s.allows(version) {
+			return false
+		}
+	}
+	return true
+}
+
+// pinsPreRelease returns true if the requirement explicitly asks for a
+// pre-release, in which case pre-releases can be picked.
+func (r requirement) pinsPreRelease() bool {
+	for _, s := range r.specifiers {
+		if isPreRelease(s.version) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s specifier) allows(version string) bool {
+	switch s.op {
+	case "===":
+		return version == s.version
+	case "==":
+		return versionMatches(version, s.version)
+	case "!=":
+		return !versionMatches(version, s.version)
+	case ">=":
+		return compareVersions(version, s.version) >= 0
+	case "<=":
+		return compareVersions(version, s.version) <= 0
+	case ">":
+		return compareVersions(version, s.version) > 0
+	case "<":
+		return compareVersions(version, s.version) < 0
+	case "~=":
+		// ~=1.4.5 means >=1.4.5 and ==1.4.*
+		parts := strings.Split(s.version, ".")
+		if len(parts) < 2 {
+			return false
+		}
+		prefix := strings.Join(parts[:len(parts)-1], ".") + ".*"
+		return compareVersions(version, s.version) >= 0 && versionMatches(version, prefix)
+	}
+	return false
+}
+
+// versionMatches implements == including trailing wildcards (e.g. "1.2.*").
+func versionMatches(version, pattern string) bool {
+	if !strings.HasSuffix(pattern, ".*") {
+		return compareVersions(version, pattern) == 0
+	}
+	prefix := parseVersion(strings.TrimSuffix(pattern, ".*")).release
+	release := parseVersion(version).release
+	for i, part := range prefix {
+		if i >= len(release) && part != 0 || i < len(release) && release[i] != part {
+			return false
+		}
+	}
+	return true
+}
+
+// parsedVersion is a version string. This covers the versions people
+// actually publish rather than all of PEP 440: a dotted release with an
+// optional pre, post or dev suffix.
+type parsedVersion struct {
+	release []int
+	// orders dev < alpha < beta < rc < release < post
+	suffixRank   int
+	suffixNumber int
+	rest         string
+}
+
+var suffixRanks = map[string]int{
+	"dev":     -4,
+	"a":       -3,
+	"alpha":   -3,
+	"b":       -2,
+	"beta":    -2,
+	"c":       -1,
+	"rc":      -1,
+	"pre":     -1,
+	"preview": -1,
+	"":        0,
+	"post":    1,
+	"rev":     1,
+	"r":       1,
+}
+
+func parseVersion(s string) parsedVersion {
+	s = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "v")
+	if idx := strings.Index(s, "+"); idx >= 0 {
+		s = s[:idx]
+	}
+	matches := versionRegex.FindStringSubmatch(s)
+	if matches == nil {
+		return parsedVersion{rest: s}
+	}
+	result := parsedVersion{}
+	for _, part := range strings.Split(matches[1], ".") {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return parsedVersion{rest: s}
+		}
+		result.release = append(result.release, number)
+	}
+	rank, ok := suffixRanks[matches[2]]
+	if !ok {
+		result.rest = matches[2] + matches[3] + matches[4]
+		return result
+	}
+	result.suffixRank = rank
+	result.suffixNumber, _ = strconv.Atoi(matches[3])
+	result.rest = matches[4]
+	return result
+}
+
+// compareVersions compares two version strings, returning -1, 0 or 1.
+// Missing release parts count as 0, so "1.0" == "1.0.0".
+func compareVersions(a, b string) int {
+	versionA, versionB := parseVersion(a), parseVersion(b)
+	for i := 0; i < len(versionA.release) || i < len(versionB.release); i++ {
+		partA, partB := 0, 0
+		if i < len(versionA.release) {
+			partA = versionA.release[i]
+		}
+		if i < len(versionB.release) {
+			partB = versionB.release[i]
+		}
+		if c := compareInts(partA, partB); c != 0 {
+			return c
+		}
+	}
+	if c := compareInts(versionA.suffixRank, versionB.suffixRank); c != 0 {
+		return c
+	}
+	if c := compareInts(versionA.suffixNumber, versionB.suffixNumber); c != 0 {
+		return c
+	}
+	return strings.Compare(versionA.rest, versionB.rest)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func isPreRelease(s string) bool {
+	return parseVersion(s).suffixRank < 0
+}
@@ -0,0 +1,140 @@
+package pythonwasm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRequirements(t *testing.T) {
+	result, err := parseRequirements([]byte(`
+# a comment
+requests>=2.0,<3  # trailing comment
+Typing_Extensions
+attrs[tests]==22.1.0
+--find-links ./vendor
+-f other
+--find-links=third
+`))
+	require.NoError(t, err)
+	require.Equal(t, []requirement{
+		{name: "requests", specifiers: []specifier{{">=", "2.0"}, {"<", "3"}}},
+		{name: "typing-extensions"},
+		{name: "attrs", specifiers: []specifier{{"==", "22.1.0"}}},
+	}, result.requirements)
+	require.Equal(t, []string{"./vendor", "other", "third"}, result.findLinks)
+
+	for _, bad := range []string{
+		"-e .",
+		"-r other.txt",
+		"--index-url https://pypi.org/simple",
+		"--find-links https://example.com/wheels",
+		`requests; python_version < "3.8"`,
+		"requests @ https://example.com/requests.whl",
+		"requests=>2",
+	} {
+		_, err = parseRequirements([]byte(bad))
+		require.Error(t, err, bad)
+	}
+}
+
+func TestRequirementAllows(t *testing.T) {
+	for _, test := range []struct {
+		requirement string
+		version     string
+		allowed     bool
+	}{
+		{"a", "1.0", true},
+		{"a==1.0", "1.0.0", true},
+		{"a==1.0", "1.0.1", false},
+		{"a==1.2.*", "1.2.9", true},
+		{"a==1.2.*", "1.3", false},
+		{"a!=1.2.*", "1.3", true},
+		{"a>=1.10", "1.9", false},
+		{"a>=1.10", "1.10", true},
+		{"a>1.0,<2", "1.5", true},
+		{"a>1.0,<2", "2.0", false},
+		{"a<=2.0", "2.0rc1", true},
+		{"a<2.0", "2.0.post1", false},
+		{"a~=1.4.5", "1.4.9", true},
+		{"a~=1.4.5", "1.5.0", false},
+		{"a~=1.4", "1.9", true},
+		{"a (>=2.0)", "2.1", true},
+	} {
+		req, err := parseRequirement(test.requirement)
+		require.NoError(t, err)
+		require.Equal(t, test.allowed, req.allows(test.version), "%s %s", test.requirement, test.version)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	ordered := []string{"1.0.dev1", "1.0a1", "1.0rc1", "1.0", "1.0.post1", "1.0.1", "1.2", "1.10", "2"}
+	for i := range ordered {
+		for j := range ordered {
+			expected := 0
+			if i < j {
+				expected = -1
+			} else if i > j {
+				expected = 1
+			}
+			require.Equal(t, expected, compareVersions(ordered[i], ordered[j]), "%s %s", ordered[i], ordered[j])
+		}
+	}
+	require.True(t, isPreRelease("1.0rc1"))
+	require.True(t, isPreRelease("1.0.dev1"))
+	require.False(t, isPreRelease("1.0.post1"))
+}
+
+func TestEvaluateMarker(t *testing.T) {
+	for _, test := range []struct {
+		marker  string
+		applies bool
+	}{
+		{`python_version < "3.8"`, false},
+		{`python_version >= "3.7"`, true},
+		{`"3.9" < python_version`, true},
+		{`python_full_version == "3.10.*"`, true},
+		{`sys_platform == "emscripten"`, true},
+		{`sys_platform == 'win32'`, false},
+		{`platform_system != "Windows"`, true},
+		{`extra == "tests"`, false},
+		{`extra != "tests"`, true},
+		{`os_name == "nt" or python_version < "3.11"`, true},
+		{`python_version > "3" and (sys_platform == "win32" or extra == "socks")`, false},
+		{`"linux" in sys_platform`, false},
+		{`"win" not in sys_platform`, true},
+	} {
+		applies, err := evaluateMarker(test.marker)
+		require.NoError(t, err, test.marker)
+		require.Equal(t, test.applies, applies, test.marker)
+	}
+
+	for _, bad := range []string{
+		`platform_release == "5.4"`,
+		`python_version <`,
+		`(python_version < "3.8"`,
+		`python_version < "3.8" sys_platform`,
+		`sys_platform < "linux"`,
+		`python_version < "3.8`,
+	} {
+		_, err := evaluateMarker(bad)
+		require.Error(t, err, bad)
+	}
+}
+
+func TestWheelDependencies(t *testing.T) {
+	wheel := writeWheel(t, t.TempDir(), "a-1.0-py3-none-any.whl",
+		"b",
+		`c (>=2) ; python_version >= "3.7"`,
+		`d ; python_version < "3.7"`,
+		`e ; extra == "tests"`,
+		`f ; sys_platform == "emscripten"`,
+	)
+	dependencies, err := wheelDependencies(wheel)
+	require.NoError(t, err)
+	require.Equal(t, []requirement{
+		{name: "b"},
+		{name: "c", specifiers: []specifier{{">=", "2"}}},
+		{name: "f"},
+	}, dependencies)
+}
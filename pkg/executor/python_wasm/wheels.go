@@ -0,0 +1,338 @@
+package pythonwasm
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/filecoin-project/bacalhau/pkg/storage/util"
+)
+
+// wheel is what the filename of a wheel tells us about it, e.g.
+// requests-2.28.1-py3-none-any.whl
+type wheel struct {
+	name        string
+	version     string
+	pythonTags  []string
+	abiTag      string
+	platformTag string
+}
+
+func parseWheelFilename(filename string) (wheel, error) {
+	if !strings.HasSuffix(filename, ".whl") {
+		return wheel{}, fmt.Errorf("not a wheel: %s", filename)
+	}
+	parts := strings.Split(strings.TrimSuffix(filename, ".whl"), "-")
+	// name-version[-build]-python-abi-platform
+	if len(parts) != 5 && len(parts) != 6 {
+		return wheel{}, fmt.Errorf("invalid wheel filename: %s", filename)
+	}
+	return wheel{
+		name:        normalizeName(parts[0]),
+		version:     parts[1],
+		pythonTags:  strings.Split(parts[len(parts)-3], "."),
+		abiTag:      parts[len(parts)-2],
+		platformTag: parts[len(parts)-1],
+	}, nil
+}
+
+// isPure returns true if the wheel is pure python 3 code that will run in
+// pyodide - anything tied to a platform has native extensions that won't.
+func (w wheel) isPure() bool {
+	if w.platformTag != "any" || w.abiTag != "none" {
+		return false
+	}
+	for _, tag := range w.pythonTags {
+		if strings.HasPrefix(tag, "py3") {
+			return true
+		}
+	}
+	return false
+}
+
+// sdistExtensions are the extensions of source distributions, which need
+// building and so can't be installed here.
+var sdistExtensions = []string{".tar.gz", ".zip", ".tar.bz2", ".tgz"}
+
+// distribution is a file that a wheelSource has for a package.
+type distribution struct {
+	filename string
+	// fetch returns the path to the file on the local filesystem
+	fetch func(ctx context.Context) (string, error)
+}
+
+// wheelSource is somewhere we look for the distributions of a package.
+type wheelSource interface {
+	// distributions returns the files the source has for the package with
+	// the given normalized name
+	distributions(ctx context.Context, name string) ([]distribution, error)
+	String() string
+}
+
+// dirSource is a folder of distributions, e.g. wheels vendored in the job
+// context.
+type dirSource struct {
+	dir string
+}
+
+func (s dirSource) distributions(ctx context.Context, name string) ([]distribution, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	results := []distribution{}
+	for _, entry := range entries {
+		if entry.IsDir() || distributionName(entry.Name()) != name {
+			continue
+		}
+		filePath := filepath.Join(s.dir, entry.Name())
+		results = append(results, distribution{
+			filename: entry.Name(),
+			fetch: func(ctx context.Context) (string, error) {
+				return filePath, nil
+			},
+		})
+	}
+	return results, nil
+}
+
+func (s dirSource) String() string {
+	return s.dir
+}
+
+// indexSource is a PEP 503 simple package index, e.g. a local pypiserver or
+// devpi the node operator runs.
+type indexSource struct {
+	url         string
+	client      *http.Client
+	downloadDir string
+}
+
+var anchorRegex = regexp.MustCompile(`(?is)<a\s[^>]*href\s*=\s*["']([^"']+)["'][^>]*>(.*?)</a>`)
+
+func (s indexSource) distributions(ctx context.Context, name string) ([]distribution, error) {
+	pageURL, err := url.Parse(strings.TrimSuffix(s.url, "/") + "/" + name + "/")
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("package index returned %s for %s", res.Status, pageURL)
+	}
+	page, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []distribution{}
+	for _, match := range anchorRegex.FindAllStringSubmatch(string(page), -1) {
+		fileURL, err := pageURL.Parse(strings.ReplaceAll(match[1], "&amp;", "&"))
+		if err != nil {
+			continue
+		}
+		filename := path.Base(fileURL.Path)
+		if distributionName(filename) != name {
+			continue
+		}
+		results = append(results, distribution{
+			filename: filename,
+			fetch: func(ctx context.Context) (string, error) {
+				return s.download(ctx, fileURL)
+			},
+		})
+	}
+	return results, nil
+}
+
+// download fetches a file from the index into the download folder, checking
+// the hash in the URL fragment if the index gave one.
+func (s indexSource) download(ctx context.Context, fileURL *url.URL) (string, error) {
+	expectedHash := ""
+	if strings.HasPrefix(fileURL.Fragment, "sha256=") {
+		expectedHash = strings.TrimPrefix(fileURL.Fragment, "sha256=")
+	}
+	downloadURL := *fileURL
+	downloadURL.Fragment = ""
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("package index returned %s for %s", res.Status, downloadURL.String())
+	}
+
+	filePath := filepath.Join(s.downloadDir, path.Base(fileURL.Path))
+	file, err := os.Create(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(file, hash), res.Body); err != nil {
+		return "", err
+	}
+	if expectedHash != "" && hex.EncodeToString(hash.Sum(nil)) != expectedHash {
+		return "", fmt.Errorf("sha256 of %s does not match the package index", downloadURL.String())
+	}
+	return filePath, nil
+}
+
+func (s indexSource) String() string {
+	return s.url
+}
+
+// distributionName returns the normalized name of the package a wheel or
+// source distribution is for, or "" if the file is neither.
+func distributionName(filename string) string {
+	if w, err := parseWheelFilename(filename); err == nil {
+		return w.name
+	}
+	for _, ext := range sdistExtensions {
+		if strings.HasSuffix(filename, ext) {
+			base := strings.TrimSuffix(filename, ext)
+			if idx := strings.LastIndex(base, "-"); idx > 0 {
+				return normalizeName(base[:idx])
+			}
+		}
+	}
+	return ""
+}
+
+func isSdist(filename string) bool {
+	for _, ext := range sdistExtensions {
+		if strings.HasSuffix(filename, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// wheelDependencies returns the dependencies of a wheel from its metadata
+// that apply in pyodide. Dependencies with environment markers are kept only
+// if the marker holds there, so extras and other platforms are skipped.
+func wheelDependencies(wheelPath string) ([]requirement, error) {
+	archive, err := zip.OpenReader(wheelPath)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	for _, file := range archive.File {
+		dir, name := path.Split(file.Name)
+		if name != "METADATA" || !strings.HasSuffix(strings.TrimSuffix(dir, "/"), ".dist-info") {
+			continue
+		}
+		metadata, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer metadata.Close()
+		requirements := []requirement{}
+		scanner := bufio.NewScanner(metadata)
+		for scanner.Scan() {
+			line := scanner.Text()
+			// the headers end at the first blank line, the rest is the description
+			if line == "" {
+				break
+			}
+			if !strings.HasPrefix(line, "Requires-Dist:") {
+				continue
+			}
+			line = strings.TrimSpace(strings.TrimPrefix(line, "Requires-Dist:"))
+			if idx := strings.Index(line, ";"); idx >= 0 {
+				applies, err := evaluateMarker(line[idx+1:])
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", filepath.Base(wheelPath), err)
+				}
+				if !applies {
+					continue
+				}
+				line = line[:idx]
+			}
+			req, err := parseRequirement(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", filepath.Base(wheelPath), err)
+			}
+			requirements = append(requirements, req)
+		}
+		return requirements, scanner.Err()
+	}
+	return nil, fmt.Errorf("%s has no metadata", filepath.Base(wheelPath))
+}
+
+// installWheel unpacks a wheel into a folder that can be put on sys.path.
+func installWheel(wheelPath, targetDir string) error {
+	archive, err := zip.OpenReader(wheelPath)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	for _, file := range archive.File {
+		name := path.Clean(file.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("%s contains an unsafe path: %s", filepath.Base(wheelPath), file.Name)
+		}
+		// code in <name>.data/purelib or platlib belongs with the rest of
+		// the package, scripts and headers are no use to us
+		if parts := strings.SplitN(name, "/", 3); len(parts) == 3 && strings.HasSuffix(parts[0], ".data") {
+			if parts[1] != "purelib" && parts[1] != "platlib" {
+				continue
+			}
+			name = parts[2]
+		}
+		if strings.HasSuffix(file.Name, "/") {
+			continue
+		}
+		if err = extractFile(file, filepath.Join(targetDir, filepath.FromSlash(name))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractFile(file *zip.File, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), util.OS_ALL_R|util.OS_ALL_X|util.OS_USER_W); err != nil {
+		return err
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	writer, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, util.OS_ALL_R|util.OS_USER_W)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+	_, err = io.Copy(writer, reader) //nolint:gosec // wheels come from the job context or the operator's index
+	return err
+}
@@ -29,3 +29,48 @@ type Executor interface {
 		resultsDir string,
 	) error
 }
+
+// ShardReattacher is implemented by executors that can pick a shard back up
+// after the compute node has restarted part way through running it.
+type ShardReattacher interface {
+	// wait for a shard started by a previous run of this executor to finish
+	// and write its results into resultsDir - returns false if the executor
+	// has no record of the shard (e.g. the container was removed)
+	ReattachShard(
+		ctx context.Context,
+		shard model.JobShard,
+		resultsDir string,
+	) (bool, error)
+}
+
+// the environment variable that tells a job where it can write its progress
+// (see model.ShardProgress for the format)
+const ProgressFileEnvVar = "BACALHAU_PROGRESS_FILE"
+
+// ShardProgressReporter is implemented by executors that let jobs report
+// how far through a shard they are.
+type ShardProgressReporter interface {
+	// the latest progress the job reported for the shard - returns false
+	// if the job has not reported any
+	GetShardProgress(
+		ctx context.Context,
+		shard model.JobShard,
+	) (model.ShardProgress, bool, error)
+}
+
+// ImageSizer is implemented by executors that have to download an image
+// before they can run a job, so the compute node can count it against the
+// disk space the job needs.
+type ImageSizer interface {
+	// how much disk pulling the job's image will use - 0 if the image is
+	// already on this node
+	GetImageSize(ctx context.Context, spec model.JobSpec) (uint64, error)
+}
+
+// JobImager is implemented by executors that run jobs of their engine in a
+// docker image they pick, so the compute node can hold the image to the same
+// policy as the images of docker jobs.
+type JobImager interface {
+	// the image the job will run in - "" if it doesn't run in one
+	GetJobImage(ctx context.Context, spec model.JobSpec) (string, error)
+}
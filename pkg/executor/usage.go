@@ -0,0 +1,54 @@
+package executor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage/util"
+)
+
+// the file in the results folder that executors write what a shard
+// actually used into - it differs between nodes so verifiers ignore it
+const ResourceUsageFileName = "usage.json"
+
+// WriteResourceUsage records what a shard used in its results folder.
+func WriteResourceUsage(resultsDir string, usage model.ResourceUsageMeasurement) error {
+	data, err := json.Marshal(usage)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(resultsDir, ResourceUsageFileName), data, util.OS_ALL_R|util.OS_USER_RW)
+}
+
+// ReadResourceUsage returns what a shard used from its results folder - it
+// returns false if the executor didn't measure it.
+func ReadResourceUsage(resultsDir string) (model.ResourceUsageMeasurement, bool, error) {
+	data, err := os.ReadFile(filepath.Join(resultsDir, ResourceUsageFileName))
+	if os.IsNotExist(err) {
+		return model.ResourceUsageMeasurement{}, false, nil
+	} else if err != nil {
+		return model.ResourceUsageMeasurement{}, false, err
+	}
+	var usage model.ResourceUsageMeasurement
+	err = json.Unmarshal(data, &usage)
+	if err != nil {
+		return model.ResourceUsageMeasurement{}, false, err
+	}
+	return usage, true, nil
+}
+
+// OutputsSize is how many bytes a shard wrote into its output volumes.
+func OutputsSize(resultsDir string, outputs []model.StorageSpec) uint64 {
+	var size uint64
+	for _, output := range outputs {
+		_ = filepath.Walk(filepath.Join(resultsDir, output.Name), func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() {
+				size += uint64(info.Size())
+			}
+			return nil
+		})
+	}
+	return size
+}
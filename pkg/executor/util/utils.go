@@ -6,14 +6,23 @@ import (
 	"github.com/filecoin-project/bacalhau/pkg/executor"
 	"github.com/filecoin-project/bacalhau/pkg/executor/docker"
 	"github.com/filecoin-project/bacalhau/pkg/executor/language"
+	"github.com/filecoin-project/bacalhau/pkg/executor/native"
 	noop_executor "github.com/filecoin-project/bacalhau/pkg/executor/noop"
 	pythonwasm "github.com/filecoin-project/bacalhau/pkg/executor/python_wasm"
+	"github.com/filecoin-project/bacalhau/pkg/executor/wasm"
 	"github.com/filecoin-project/bacalhau/pkg/model"
 	"github.com/filecoin-project/bacalhau/pkg/storage"
+	"github.com/filecoin-project/bacalhau/pkg/storage/archive"
+	"github.com/filecoin-project/bacalhau/pkg/storage/cache"
 	"github.com/filecoin-project/bacalhau/pkg/storage/combo"
+	"github.com/filecoin-project/bacalhau/pkg/storage/estuary"
+	"github.com/filecoin-project/bacalhau/pkg/storage/filecoin"
 	filecoinunsealed "github.com/filecoin-project/bacalhau/pkg/storage/filecoin_unsealed"
+	"github.com/filecoin-project/bacalhau/pkg/storage/git"
+	"github.com/filecoin-project/bacalhau/pkg/storage/inline"
 	apicopy "github.com/filecoin-project/bacalhau/pkg/storage/ipfs_apicopy"
 	noop_storage "github.com/filecoin-project/bacalhau/pkg/storage/noop"
+	"github.com/filecoin-project/bacalhau/pkg/storage/s3"
 	"github.com/filecoin-project/bacalhau/pkg/storage/url/urldownload"
 	"github.com/filecoin-project/bacalhau/pkg/system"
 )
@@ -21,12 +30,23 @@ import (
 type StandardStorageProviderOptions struct {
 	IPFSMultiaddress     string
 	FilecoinUnsealedPath string
+	S3                   s3.ClientConfig
+	Filecoin             filecoin.StorageProviderConfig
+	// when set, ipfs, estuary, filecoin, url and git inputs are kept in it to
+	// be shared between jobs
+	InputCache *cache.Cache
+	// how much disk git repositories can use, 0 for the default
+	GitMaxRepoSize uint64
 }
 
 type StandardExecutorOptions struct {
-	DockerID   string
-	IsBadActor bool
-	Storage    StandardStorageProviderOptions
+	DockerID         string
+	DockerConfig     docker.ExecutorConfig
+	LanguageConfig   language.ExecutorConfig
+	PythonWasmConfig pythonwasm.ExecutorConfig
+	NativeConfig     native.ExecutorConfig
+	IsBadActor       bool
+	Storage          StandardStorageProviderOptions
 }
 
 func NewStandardStorageProviders(
@@ -49,6 +69,34 @@ func NewStandardStorageProviders(
 		return nil, err
 	}
 
+	s3Storage, err := s3.NewStorageProvider(cm, options.S3)
+	if err != nil {
+		return nil, err
+	}
+
+	gitStorage, err := git.NewStorageProvider(cm)
+	if err != nil {
+		return nil, err
+	}
+	if options.GitMaxRepoSize > 0 {
+		gitStorage.MaxRepoSize = options.GitMaxRepoSize
+	}
+
+	inlineStorage, err := inline.NewStorageProvider(cm)
+	if err != nil {
+		return nil, err
+	}
+
+	estuaryStorage, err := estuary.NewStorageProvider(cm)
+	if err != nil {
+		return nil, err
+	}
+
+	filecoinStorage, err := filecoin.NewStorageProvider(cm, options.Filecoin)
+	if err != nil {
+		return nil, err
+	}
+
 	var useIPFSDriver storage.StorageProvider = ipfsAPICopyStorage
 
 	// if we are using a FilecoinUnsealedPath then construct a combo
@@ -86,10 +134,46 @@ func NewStandardStorageProviders(
 		useIPFSDriver = comboDriver
 	}
 
+	var useURLDownloadDriver storage.StorageProvider = urlDownloadStorage
+	var useGitDriver storage.StorageProvider = gitStorage
+	var useEstuaryDriver storage.StorageProvider = estuaryStorage
+	var useFilecoinDriver storage.StorageProvider = filecoinStorage
+	if options.InputCache != nil {
+		useIPFSDriver = cache.NewStorageProvider(useIPFSDriver, options.InputCache)
+		useURLDownloadDriver = cache.NewStorageProvider(urlDownloadStorage, options.InputCache)
+		useGitDriver = cache.NewStorageProvider(gitStorage, options.InputCache)
+		useEstuaryDriver = cache.NewStorageProvider(estuaryStorage, options.InputCache)
+		estuaryStorage.CarCache = options.InputCache
+		useFilecoinDriver = cache.NewStorageProvider(filecoinStorage, options.InputCache)
+	}
+
+	// archives are extracted from what the cache holds, so the shards of a
+	// job sharded over one archive only fetch it once
+	var useS3Driver storage.StorageProvider = s3Storage
+	archiveDrivers := []*storage.StorageProvider{
+		&useIPFSDriver,
+		&useURLDownloadDriver,
+		&useS3Driver,
+		&useEstuaryDriver,
+		&useFilecoinDriver,
+	}
+	for _, driver := range archiveDrivers {
+		archiveDriver, err := archive.NewStorageProvider(cm, *driver)
+		if err != nil {
+			return nil, err
+		}
+		*driver = archiveDriver
+	}
+
 	return map[model.StorageSourceType]storage.StorageProvider{
 		model.StorageSourceIPFS:             useIPFSDriver,
-		model.StorageSourceURLDownload:      urlDownloadStorage,
+		model.StorageSourceURLDownload:      useURLDownloadDriver,
 		model.StorageSourceFilecoinUnsealed: filecoinUnsealedStorage,
+		model.StorageSourceS3:               useS3Driver,
+		model.StorageSourceGit:              useGitDriver,
+		model.StorageSourceInline:           inlineStorage,
+		model.StorageSourceEstuary:          useEstuaryDriver,
+		model.StorageSourceFilecoin:         useFilecoinDriver,
 	}, nil
 }
 
@@ -118,24 +202,45 @@ func NewStandardExecutors(
 		return nil, err
 	}
 
-	dockerExecutor, err := docker.NewExecutor(ctx, cm, executorOptions.DockerID, storageProviders)
+	dockerExecutor, err := docker.NewExecutor(
+		ctx,
+		cm,
+		executorOptions.DockerID,
+		storageProviders,
+		executorOptions.DockerConfig,
+	)
 
 	if err != nil {
 		return nil, err
 	}
 
+	wasmExecutor, err := wasm.NewExecutor(ctx, cm, storageProviders)
+	if err != nil {
+		return nil, err
+	}
+
 	executors := map[model.EngineType]executor.Executor{
 		model.EngineDocker: dockerExecutor,
+		model.EngineWasm:   wasmExecutor,
+	}
+
+	// native jobs run without isolation so only if the operator says so
+	if executorOptions.NativeConfig.Enabled {
+		nativeExecutor, err := native.NewExecutor(ctx, cm, storageProviders, executorOptions.NativeConfig)
+		if err != nil {
+			return nil, err
+		}
+		executors[model.EngineNative] = nativeExecutor
 	}
 
 	// language executors wrap other executors, so pass them a reference to all
 	// the executors so they can look up the ones they need
-	exLang, err := language.NewExecutor(ctx, cm, executors)
+	exLang, err := language.NewExecutor(ctx, cm, executors, executorOptions.LanguageConfig)
 	executors[model.EngineLanguage] = exLang
 	if err != nil {
 		return nil, err
 	}
-	exPythonWasm, err := pythonwasm.NewExecutor(ctx, cm, executors)
+	exPythonWasm, err := pythonwasm.NewExecutor(ctx, cm, executors, storageProviders, executorOptions.PythonWasmConfig)
 	executors[model.EnginePythonWasm] = exPythonWasm
 	if err != nil {
 		return nil, err
@@ -0,0 +1,48 @@
+package executor
+
+import (
+	"context"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// PreparedVolumes remembers the storage an executor prepares for a shard
+// so it can all be cleaned up once the shard has run. Drivers such as the
+// input cache only give up what they are holding for a shard when they are
+// told to clean it up.
+type PreparedVolumes struct {
+	volumes []preparedVolume
+}
+
+type preparedVolume struct {
+	provider storage.StorageProvider
+	spec     model.StorageSpec
+	volume   storage.StorageVolume
+}
+
+// Prepare gets the storage ready with the provider and remembers it.
+func (p *PreparedVolumes) Prepare(
+	ctx context.Context,
+	provider storage.StorageProvider,
+	spec model.StorageSpec,
+) (storage.StorageVolume, error) {
+	volume, err := provider.PrepareStorage(ctx, spec)
+	if err != nil {
+		return storage.StorageVolume{}, err
+	}
+	p.volumes = append(p.volumes, preparedVolume{provider: provider, spec: spec, volume: volume})
+	return volume, nil
+}
+
+// Cleanup cleans up everything that has been prepared - errors are only
+// logged as the shard has already run by the time this is called.
+func (p *PreparedVolumes) Cleanup(ctx context.Context) {
+	for _, prepared := range p.volumes {
+		if err := prepared.provider.CleanupStorage(ctx, prepared.spec, prepared.volume); err != nil {
+			log.Warn().Msgf("Could not clean up storage for %s: %s", prepared.spec.Path, err)
+		}
+	}
+	p.volumes = nil
+}
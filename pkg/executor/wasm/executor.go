@@ -0,0 +1,435 @@
+package wasm
+
+/*
+The wasm executor runs WASI modules in-process using wazero, so it needs
+nothing installed on the compute node. Input volumes are mounted into the
+module read only and output volumes read/write as WASI preopens, and the
+module's stdout, stderr and exit code are written into the results folder
+just like the docker executor does so the deterministic verifier can compare
+them. wazero's clocks and random source are deterministic by default and we
+leave them that way.
+*/
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/filecoin-project/bacalhau/pkg/capacitymanager"
+	"github.com/filecoin-project/bacalhau/pkg/executor"
+	jobutils "github.com/filecoin-project/bacalhau/pkg/job"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage"
+	"github.com/filecoin-project/bacalhau/pkg/storage/util"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	"github.com/rs/zerolog/log"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/sys"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// the function WASI commands export as their main
+const defaultEntryPoint = "_start"
+
+// wasm memory is allocated in pages of 64KiB and a module can have at
+// most 4GiB of them
+const wasmPageSize = 65536
+const maxWasmPages = 65536
+
+type Executor struct {
+	// where we stage file volumes so they can be mounted as folders
+	ScratchDir string
+
+	// the storage providers we can implement for a job
+	StorageProviders map[model.StorageSourceType]storage.StorageProvider
+}
+
+func NewExecutor(
+	ctx context.Context,
+	cm *system.CleanupManager,
+	storageProviders map[model.StorageSourceType]storage.StorageProvider,
+) (*Executor, error) {
+	dir, err := os.MkdirTemp("", "bacalhau-wasm-executor")
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Executor{
+		ScratchDir:       dir,
+		StorageProviders: storageProviders,
+	}
+
+	cm.RegisterCallback(func() error {
+		return os.RemoveAll(dir)
+	})
+
+	return e, nil
+}
+
+func (e *Executor) getStorageProvider(ctx context.Context, engine model.StorageSourceType) (storage.StorageProvider, error) {
+	return util.GetStorageProvider(ctx, engine, e.StorageProviders)
+}
+
+// IsInstalled is always true because the wasm runtime is built in.
+func (e *Executor) IsInstalled(ctx context.Context) (bool, error) {
+	return true, nil
+}
+
+func (e *Executor) HasStorageLocally(ctx context.Context, volume model.StorageSpec) (bool, error) {
+	ctx, span := newSpan(ctx, "HasStorageLocally")
+	defer span.End()
+
+	s, err := e.getStorageProvider(ctx, volume.Engine)
+	if err != nil {
+		return false, err
+	}
+
+	return s.HasStorageLocally(ctx, volume)
+}
+
+func (e *Executor) GetVolumeSize(ctx context.Context, volume model.StorageSpec) (uint64, error) {
+	storageProvider, err := e.getStorageProvider(ctx, volume.Engine)
+	if err != nil {
+		return 0, err
+	}
+	return storageProvider.GetVolumeSize(ctx, volume)
+}
+
+//nolint:funlen // will clean up
+func (e *Executor) RunShard(
+	ctx context.Context,
+	shard model.JobShard,
+	jobResultsDir string,
+) error {
+	//nolint:ineffassign,staticcheck
+	ctx, span := system.GetTracer().Start(ctx, "pkg/executor/wasm.RunShard")
+	defer span.End()
+	system.AddJobIDFromBaggageToSpan(ctx, span)
+	system.AddNodeIDFromBaggageToSpan(ctx, span)
+
+	spec := shard.Job.Spec.Wasm
+
+	shardStorageSpec, err := jobutils.GetShardStorageSpec(ctx, shard, e.StorageProviders)
+	if err != nil {
+		return err
+	}
+
+	stagingDir := filepath.Join(e.ScratchDir, e.shardName(shard))
+	err = os.MkdirAll(stagingDir, util.OS_USER_RWX)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := os.RemoveAll(stagingDir); err != nil {
+			log.Debug().Msgf("Wasm executor staging cleanup error: %s", err.Error())
+		}
+	}()
+	mounts := newMountBuilder(stagingDir)
+	volumes := &executor.PreparedVolumes{}
+	defer volumes.Cleanup(ctx)
+
+	addInputStorageHandler := func(spec model.StorageSpec) error {
+		volume, err := e.prepareStorage(ctx, volumes, spec)
+		if err != nil {
+			return err
+		}
+		log.Trace().Msgf("Input Volume: %+v %+v", spec, volume)
+		// this is an input volume so is read only
+		return mounts.add(volume.Source, volume.Target, true)
+	}
+
+	// loop over the job contexts and prepare them
+	for _, contextStorage := range shard.Job.Spec.Contexts {
+		err = addInputStorageHandler(contextStorage)
+		if err != nil {
+			return err
+		}
+	}
+
+	// loop over the job storage inputs and prepare them
+	for _, inputStorage := range shardStorageSpec {
+		err = addInputStorageHandler(inputStorage)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, output := range shard.Job.Spec.Outputs {
+		if output.Name == "" {
+			return fmt.Errorf("output volume has no name: %+v", output)
+		}
+
+		if output.Path == "" {
+			return fmt.Errorf("output volume has no path: %+v", output)
+		}
+
+		srcd := filepath.Join(jobResultsDir, output.Name)
+		err = os.Mkdir(srcd, util.OS_ALL_R|util.OS_ALL_X|util.OS_USER_W)
+		if err != nil {
+			return err
+		}
+
+		log.Trace().Msgf("Output Volume: %+v", output)
+
+		// this is an output volume so can be written to
+		err = mounts.add(srcd, output.Path, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	modulePath, err := e.loadEntryModule(ctx, volumes, spec.EntryModule)
+	if err != nil {
+		return err
+	}
+	moduleBytes, err := os.ReadFile(modulePath)
+	if err != nil {
+		return fmt.Errorf("could not read wasm module %s: %w", modulePath, err)
+	}
+
+	resourceRequirements := capacitymanager.ParseResourceUsageConfig(shard.Job.Spec.Resources)
+	fuel, err := model.ParseFuel(shard.Job.Spec.Resources.Fuel)
+	if err != nil {
+		return err
+	}
+
+	runtimeConfig := wazero.NewRuntimeConfig().
+		WithCloseOnContextDone(true).
+		WithMemoryLimitPages(memoryLimitPages(resourceRequirements.Memory))
+
+	// the fuel meter cancels this context when the module runs out
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var meter *fuelMeter
+	if fuel > 0 {
+		meter = newFuelMeter(fuel, cancel)
+		ctx = meter.withListener(ctx)
+	}
+
+	runtime := wazero.NewRuntimeWithConfig(ctx, runtimeConfig)
+	defer func() {
+		if err := runtime.Close(ctx); err != nil {
+			log.Debug().Msgf("Wasm executor runtime close error: %s", err.Error())
+		}
+	}()
+
+	if err = instantiateWASI(ctx, runtime); err != nil {
+		return err
+	}
+
+	compiledModule, err := runtime.CompileModule(ctx, moduleBytes)
+	if err != nil {
+		return fmt.Errorf("could not compile wasm module %s: %w", modulePath, err)
+	}
+
+	entryPoint := spec.EntryPoint
+	if entryPoint == "" {
+		entryPoint = defaultEntryPoint
+	}
+
+	var stdout, stderr bytes.Buffer
+	moduleConfig := wazero.NewModuleConfig().
+		WithArgs(append([]string{filepath.Base(modulePath)}, spec.Parameters...)...).
+		WithStdout(&stdout).
+		WithStderr(&stderr).
+		WithFSConfig(mounts.fsConfig).
+		// we call the entry point ourselves so we can see the module's
+		// memory once it has finished
+		WithStartFunctions()
+
+	// sort the variables so every run sees them in the same order
+	envNames := make([]string, 0, len(spec.EnvironmentVariables))
+	for name := range spec.EnvironmentVariables {
+		envNames = append(envNames, name)
+	}
+	sort.Strings(envNames)
+	for _, name := range envNames {
+		moduleConfig = moduleConfig.WithEnv(name, spec.EnvironmentVariables[name])
+	}
+
+	// closing the runtime closes the module too
+	var moduleError error
+	var exitCode uint32
+	var usage model.ResourceUsageMeasurement
+	startTime := time.Now()
+	stopCPUTimer := startCPUTimer()
+	err = runModule(ctx, runtime, compiledModule, moduleConfig, entryPoint, &usage)
+	usage.CPUSeconds = stopCPUTimer().Seconds()
+	usage.WallTimeSeconds = time.Since(startTime).Seconds()
+	if err != nil {
+		var exitError *sys.ExitError
+		switch {
+		case meter != nil && meter.exhausted():
+			exitCode = 1
+			moduleError = fmt.Errorf("module ran out of fuel after %d function calls", fuel)
+		case errors.As(err, &exitError) && exitError.ExitCode() != sys.ExitCodeContextCanceled &&
+			exitError.ExitCode() != sys.ExitCodeDeadlineExceeded:
+			exitCode = exitError.ExitCode()
+		case ctx.Err() != nil:
+			// the shard was cancelled so there are no results to write
+			return ctx.Err()
+		default:
+			// a trap - we record it as a failure just like a crashed process
+			exitCode = 1
+			moduleError = err
+		}
+	}
+	if exitCode != 0 {
+		if moduleError == nil {
+			moduleError = fmt.Errorf("exit code was not zero: %d", exitCode)
+		}
+		fmt.Fprintln(&stderr, moduleError.Error())
+		log.Info().Msgf("wasm module error %s", moduleError)
+	}
+
+	usage.DiskWritten = executor.OutputsSize(jobResultsDir, shard.Job.Spec.Outputs)
+
+	err = writeResults(jobResultsDir, exitCode, stdout.Bytes(), stderr.Bytes())
+	if err != nil {
+		return err
+	}
+	err = executor.WriteResourceUsage(jobResultsDir, usage)
+	if err != nil {
+		return err
+	}
+	return moduleError
+}
+
+// runModule instantiates the module and calls its entry point, if it has
+// one, the way wazero does for start functions. Wasm memory never shrinks
+// so its size afterwards is the most the module used.
+func runModule(
+	ctx context.Context,
+	runtime wazero.Runtime,
+	compiledModule wazero.CompiledModule,
+	moduleConfig wazero.ModuleConfig,
+	entryPoint string,
+	usage *model.ResourceUsageMeasurement,
+) error {
+	module, err := runtime.InstantiateModule(ctx, compiledModule, moduleConfig)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if memory := module.Memory(); memory != nil {
+			usage.PeakMemory = uint64(memory.Size())
+		}
+	}()
+
+	start := module.ExportedFunction(entryPoint)
+	if start == nil {
+		return nil
+	}
+	_, err = start.Call(ctx)
+	var exitError *sys.ExitError
+	if errors.As(err, &exitError) && exitError.ExitCode() == 0 {
+		return nil
+	}
+	return err
+}
+
+// prepareStorage gets a volume ready to be mounted into a module.
+func (e *Executor) prepareStorage(
+	ctx context.Context,
+	volumes *executor.PreparedVolumes,
+	spec model.StorageSpec,
+) (storage.StorageVolume, error) {
+	storageProvider, err := e.getStorageProvider(ctx, spec.Engine)
+	if err != nil {
+		return storage.StorageVolume{}, err
+	}
+
+	volume, err := volumes.Prepare(ctx, storageProvider, spec)
+	if err != nil {
+		return storage.StorageVolume{}, err
+	}
+
+	if volume.Type != storage.StorageVolumeConnectorBind {
+		return storage.StorageVolume{}, fmt.Errorf("unknown storage volume type: %s", volume.Type)
+	}
+	return volume, nil
+}
+
+// loadEntryModule fetches the module the job wants to run and returns the
+// path of the .wasm file on this node.
+func (e *Executor) loadEntryModule(
+	ctx context.Context,
+	volumes *executor.PreparedVolumes,
+	spec model.StorageSpec,
+) (string, error) {
+	volume, err := e.prepareStorage(ctx, volumes, spec)
+	if err != nil {
+		return "", fmt.Errorf("could not prepare wasm module: %w", err)
+	}
+
+	info, err := os.Stat(volume.Source)
+	if err != nil {
+		return "", fmt.Errorf("could not prepare wasm module: %w", err)
+	}
+	if !info.IsDir() {
+		return volume.Source, nil
+	}
+
+	modules, err := filepath.Glob(filepath.Join(volume.Source, "*.wasm"))
+	if err != nil {
+		return "", err
+	}
+	if len(modules) != 1 {
+		return "", fmt.Errorf("expected exactly one .wasm file in the entry module but found %d", len(modules))
+	}
+	return modules[0], nil
+}
+
+// how many pages of memory the module can have given the memory the job
+// asked for - no limit apart from the wasm one if it didn't ask
+func memoryLimitPages(memory uint64) uint32 {
+	if memory == 0 {
+		return maxWasmPages
+	}
+	pages := memory / wasmPageSize
+	if pages == 0 {
+		pages = 1
+	}
+	if pages > maxWasmPages {
+		pages = maxWasmPages
+	}
+	return uint32(pages)
+}
+
+// write the stdout, stderr and exit code of the module into the results
+// folder the same way the docker executor does
+func writeResults(jobResultsDir string, exitCode uint32, stdout, stderr []byte) error {
+	for name, data := range map[string][]byte{
+		"exitCode": []byte(fmt.Sprintf("%d", exitCode)),
+		"stdout":   stdout,
+		"stderr":   stderr,
+	} {
+		err := os.WriteFile(
+			filepath.Join(jobResultsDir, name),
+			data,
+			util.OS_ALL_R|util.OS_USER_RW,
+		)
+		if err != nil {
+			msg := fmt.Sprintf("could not write results to %s: %s", name, err)
+			log.Error().Msg(msg)
+			return errors.New(msg)
+		}
+	}
+	return nil
+}
+
+func (e *Executor) shardName(shard model.JobShard) string {
+	return fmt.Sprintf("%s-%d", shard.Job.ID, shard.Index)
+}
+
+func newSpan(ctx context.Context, apiName string) (context.Context, trace.Span) {
+	return system.Span(ctx, "executor/wasm", apiName)
+}
+
+// Compile-time interface check:
+var _ executor.Executor = (*Executor)(nil)
@@ -0,0 +1,253 @@
+package wasm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/filecoin-project/bacalhau/pkg/executor"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage"
+	"github.com/filecoin-project/bacalhau/pkg/storage/cache"
+	noop_storage "github.com/filecoin-project/bacalhau/pkg/storage/noop"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	"github.com/stretchr/testify/require"
+)
+
+// the test modules are built from the .wat files next to them
+
+// newTestExecutor returns an executor whose storage treats the cid of a
+// storage spec as a path on this machine.
+func newTestExecutor(t *testing.T) *Executor {
+	ctx := context.Background()
+	cm := system.NewCleanupManager()
+	t.Cleanup(cm.Cleanup)
+
+	storageProvider, err := noop_storage.NewStorageProvider(ctx, cm, noop_storage.StorageConfig{
+		ExternalHooks: noop_storage.StorageConfigExternalHooks{
+			PrepareStorage: func(ctx context.Context, spec model.StorageSpec) (storage.StorageVolume, error) {
+				return storage.StorageVolume{
+					Type:   storage.StorageVolumeConnectorBind,
+					Source: spec.Cid,
+					Target: spec.Path,
+				}, nil
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	e, err := NewExecutor(ctx, cm, map[model.StorageSourceType]storage.StorageProvider{
+		model.StorageSourceIPFS: storageProvider,
+	})
+	require.NoError(t, err)
+	return e
+}
+
+func testShard(module string, resources model.ResourceUsageConfig) model.JobShard {
+	return model.JobShard{
+		Job: model.Job{
+			ID: "test-job",
+			Spec: model.JobSpec{
+				Engine: model.EngineWasm,
+				Wasm: model.JobSpecWasm{
+					EntryModule: model.StorageSpec{
+						Engine: model.StorageSourceIPFS,
+						Cid:    filepath.Join("testdata", module),
+					},
+				},
+				Resources: resources,
+			},
+		},
+	}
+}
+
+func readResult(t *testing.T, resultsDir, name string) string {
+	data, err := os.ReadFile(filepath.Join(resultsDir, name))
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestRunShardMountsInputsAndOutputs(t *testing.T) {
+	e := newTestExecutor(t)
+
+	inputFile := filepath.Join(t.TempDir(), "input.txt")
+	require.NoError(t, os.WriteFile(inputFile, []byte("hello world"), 0644))
+
+	shard := testShard("cat.wasm", model.ResourceUsageConfig{})
+	shard.Job.Spec.Inputs = []model.StorageSpec{{
+		Engine: model.StorageSourceIPFS,
+		Cid:    inputFile,
+		Path:   "/data/file.txt",
+	}}
+	shard.Job.Spec.Outputs = []model.StorageSpec{{
+		Name: "test",
+		Path: "/output_data",
+	}}
+
+	resultsDir := t.TempDir()
+	err := e.RunShard(context.Background(), shard, resultsDir)
+	require.NoError(t, err)
+
+	require.Equal(t, "0", readResult(t, resultsDir, "exitCode"))
+	require.Equal(t, "hello world", readResult(t, resultsDir, "stdout"))
+	require.Equal(t, "", readResult(t, resultsDir, "stderr"))
+	require.Equal(t, "hello world", readResult(t, resultsDir, "test/output_file.txt"))
+
+	usage, ok, err := executor.ReadResourceUsage(resultsDir)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(len("hello world")), usage.DiskWritten)
+	require.Greater(t, usage.PeakMemory, uint64(0))
+	require.Greater(t, usage.WallTimeSeconds, 0.0)
+}
+
+func TestRunShardRecordsExitCode(t *testing.T) {
+	e := newTestExecutor(t)
+
+	resultsDir := t.TempDir()
+	err := e.RunShard(context.Background(), testShard("exit.wasm", model.ResourceUsageConfig{}), resultsDir)
+	require.Error(t, err)
+
+	require.Equal(t, "3", readResult(t, resultsDir, "exitCode"))
+	require.Equal(t, "", readResult(t, resultsDir, "stdout"))
+	require.Contains(t, readResult(t, resultsDir, "stderr"), "oops\n")
+}
+
+func TestRunShardStopsWhenOutOfFuel(t *testing.T) {
+	e := newTestExecutor(t)
+
+	resultsDir := t.TempDir()
+	err := e.RunShard(context.Background(), testShard("spin.wasm", model.ResourceUsageConfig{
+		Fuel: "1000",
+	}), resultsDir)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "out of fuel")
+
+	require.Equal(t, "1", readResult(t, resultsDir, "exitCode"))
+}
+
+func TestRunShardEnforcesMemoryLimit(t *testing.T) {
+	e := newTestExecutor(t)
+
+	// the module wants 8MiB
+	err := e.RunShard(context.Background(), testShard("bigmemory.wasm", model.ResourceUsageConfig{
+		Memory: "1Mb",
+	}), t.TempDir())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "memory")
+
+	err = e.RunShard(context.Background(), testShard("bigmemory.wasm", model.ResourceUsageConfig{
+		Memory: "16Mb",
+	}), t.TempDir())
+	require.NoError(t, err)
+}
+
+func TestRunShardCannotLinkOutOfOutputs(t *testing.T) {
+	e := newTestExecutor(t)
+
+	shard := testShard("symlink.wasm", model.ResourceUsageConfig{})
+	shard.Job.Spec.Outputs = []model.StorageSpec{{
+		Name: "test",
+		Path: "/output_data",
+	}}
+
+	resultsDir := t.TempDir()
+	err := e.RunShard(context.Background(), shard, resultsDir)
+	require.Error(t, err)
+
+	// EPERM
+	require.Equal(t, "63", readResult(t, resultsDir, "exitCode"))
+	_, err = os.Lstat(filepath.Join(resultsDir, "test", "x"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestRunShardDoesNotFollowInputLinksOut(t *testing.T) {
+	e := newTestExecutor(t)
+
+	secret := filepath.Join(t.TempDir(), "secret.txt")
+	require.NoError(t, os.WriteFile(secret, []byte("secret"), 0600))
+	inputDir := t.TempDir()
+	require.NoError(t, os.Symlink(secret, filepath.Join(inputDir, "file.txt")))
+
+	shard := testShard("cat.wasm", model.ResourceUsageConfig{})
+	shard.Job.Spec.Inputs = []model.StorageSpec{{
+		Engine: model.StorageSourceIPFS,
+		Cid:    inputDir,
+		Path:   "/data",
+	}}
+	shard.Job.Spec.Outputs = []model.StorageSpec{{
+		Name: "test",
+		Path: "/output_data",
+	}}
+
+	resultsDir := t.TempDir()
+	err := e.RunShard(context.Background(), shard, resultsDir)
+	require.Error(t, err)
+	require.Equal(t, "2", readResult(t, resultsDir, "exitCode"))
+	require.Equal(t, "", readResult(t, resultsDir, "stdout"))
+
+	// links that stay inside the input are followed
+	require.NoError(t, os.Remove(filepath.Join(inputDir, "file.txt")))
+	require.NoError(t, os.WriteFile(filepath.Join(inputDir, "real.txt"), []byte("hello"), 0600))
+	require.NoError(t, os.Symlink("real.txt", filepath.Join(inputDir, "file.txt")))
+	resultsDir = t.TempDir()
+	require.NoError(t, e.RunShard(context.Background(), shard, resultsDir))
+	require.Equal(t, "hello", readResult(t, resultsDir, "stdout"))
+}
+
+func TestRunShardReleasesCachedInputs(t *testing.T) {
+	ctx := context.Background()
+	cm := system.NewCleanupManager()
+	t.Cleanup(cm.Cleanup)
+
+	// the cache moves what is prepared into it so prepare copies
+	storageProvider, err := noop_storage.NewStorageProvider(ctx, cm, noop_storage.StorageConfig{
+		ExternalHooks: noop_storage.StorageConfigExternalHooks{
+			PrepareStorage: func(ctx context.Context, spec model.StorageSpec) (storage.StorageVolume, error) {
+				data, err := os.ReadFile(spec.Cid)
+				if err != nil {
+					return storage.StorageVolume{}, err
+				}
+				source := filepath.Join(t.TempDir(), filepath.Base(spec.Cid))
+				return storage.StorageVolume{
+					Type:   storage.StorageVolumeConnectorBind,
+					Source: source,
+					Target: spec.Path,
+				}, os.WriteFile(source, data, 0600)
+			},
+		},
+	})
+	require.NoError(t, err)
+	// too small to keep anything that isn't in use
+	inputCache, err := cache.NewCache(cm, 1)
+	require.NoError(t, err)
+	e, err := NewExecutor(ctx, cm, map[model.StorageSourceType]storage.StorageProvider{
+		model.StorageSourceIPFS: cache.NewStorageProvider(storageProvider, inputCache),
+	})
+	require.NoError(t, err)
+
+	inputFile := filepath.Join(t.TempDir(), "input.txt")
+	require.NoError(t, os.WriteFile(inputFile, []byte("hello world"), 0644))
+	shard := testShard("cat.wasm", model.ResourceUsageConfig{})
+	input := model.StorageSpec{
+		Engine: model.StorageSourceIPFS,
+		Cid:    inputFile,
+		Path:   "/data/file.txt",
+	}
+	shard.Job.Spec.Inputs = []model.StorageSpec{input}
+	shard.Job.Spec.Outputs = []model.StorageSpec{{
+		Name: "test",
+		Path: "/output_data",
+	}}
+
+	resultsDir := t.TempDir()
+	require.NoError(t, e.RunShard(ctx, shard, resultsDir))
+	require.Equal(t, "hello world", readResult(t, resultsDir, "stdout"))
+
+	// nothing is using the input or the module any more so they are gone
+	key, ok := cache.Key(input)
+	require.True(t, ok)
+	require.False(t, inputCache.Has(key))
+	require.Equal(t, uint64(0), inputCache.Size())
+}
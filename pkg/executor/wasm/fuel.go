@@ -0,0 +1,59 @@
+package wasm
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/experimental"
+)
+
+// fuelMeter stops a module once it has made more function calls than the
+// job's fuel allows. wazero doesn't meter instructions so function calls are
+// the closest thing we have - a module stuck in a loop that makes no calls
+// is stopped when the shard is cancelled instead.
+type fuelMeter struct {
+	limit  uint64
+	used   uint64
+	cancel context.CancelFunc
+}
+
+func newFuelMeter(limit uint64, cancel context.CancelFunc) *fuelMeter {
+	return &fuelMeter{
+		limit:  limit,
+		cancel: cancel,
+	}
+}
+
+// withListener returns a context that makes wazero tell the meter about
+// every function call of modules compiled with it.
+func (m *fuelMeter) withListener(ctx context.Context) context.Context {
+	return context.WithValue(ctx, experimental.FunctionListenerFactoryKey{}, m)
+}
+
+func (m *fuelMeter) exhausted() bool {
+	return atomic.LoadUint64(&m.used) > m.limit
+}
+
+// NewListener implements experimental.FunctionListenerFactory
+func (m *fuelMeter) NewListener(api.FunctionDefinition) experimental.FunctionListener {
+	return m
+}
+
+// Before implements experimental.FunctionListener
+func (m *fuelMeter) Before(
+	ctx context.Context, _ api.Module, _ api.FunctionDefinition, _ []uint64,
+) context.Context {
+	if atomic.AddUint64(&m.used, 1) > m.limit {
+		// the runtime closes the module when the context is done
+		m.cancel()
+	}
+	return ctx
+}
+
+// After implements experimental.FunctionListener
+func (m *fuelMeter) After(context.Context, api.Module, api.FunctionDefinition, error, []uint64) {}
+
+// Compile-time interface check:
+var _ experimental.FunctionListenerFactory = (*fuelMeter)(nil)
+var _ experimental.FunctionListener = (*fuelMeter)(nil)
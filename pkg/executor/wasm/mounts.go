@@ -0,0 +1,165 @@
+package wasm
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/filecoin-project/bacalhau/pkg/storage/util"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// mountBuilder turns storage volumes into WASI preopens. WASI can only
+// preopen folders, so volumes that are single files are linked into a
+// staging folder that is mounted at the folder the file should appear in.
+type mountBuilder struct {
+	stagingDir string
+	fsConfig   wazero.FSConfig
+	// guest folders we have already mounted something at
+	mounted map[string]bool
+	// staging folders keyed by the guest folder they are mounted at
+	staged map[string]*confinedFS
+}
+
+func newMountBuilder(stagingDir string) *mountBuilder {
+	return &mountBuilder{
+		stagingDir: stagingDir,
+		fsConfig:   wazero.NewFSConfig(),
+		mounted:    map[string]bool{},
+		staged:     map[string]*confinedFS{},
+	}
+}
+
+func (m *mountBuilder) add(source, target string, readOnly bool) error {
+	target = path.Clean("/" + target)
+
+	info, err := os.Stat(source)
+	if err != nil {
+		return fmt.Errorf("could not mount %s: %w", target, err)
+	}
+
+	if info.IsDir() {
+		if m.mounted[target] {
+			return fmt.Errorf("more than one volume is mounted at %s", target)
+		}
+		m.mounted[target] = true
+		if readOnly {
+			inputFS, err := newConfinedFS(source)
+			if err != nil {
+				return err
+			}
+			m.fsConfig = m.fsConfig.WithFSMount(inputFS, target)
+		} else {
+			// the module can't make links (see instantiateWASI) so the
+			// wazero dir mount can't be led out of the folder
+			m.fsConfig = m.fsConfig.WithDirMount(source, target)
+		}
+		return nil
+	}
+
+	// files are only ever inputs so the staging folder is read only
+	guestDir := path.Dir(target)
+	stagedFS, ok := m.staged[guestDir]
+	if !ok {
+		if m.mounted[guestDir] {
+			return fmt.Errorf("cannot mount %s into %s as a folder is already mounted there", target, guestDir)
+		}
+		stagedDir := filepath.Join(m.stagingDir, fmt.Sprintf("%d", len(m.staged)))
+		err = os.Mkdir(stagedDir, util.OS_USER_RWX)
+		if err != nil {
+			return err
+		}
+		stagedFS, err = newConfinedFS(stagedDir)
+		if err != nil {
+			return err
+		}
+		m.staged[guestDir] = stagedFS
+		m.mounted[guestDir] = true
+		m.fsConfig = m.fsConfig.WithFSMount(stagedFS, guestDir)
+	}
+
+	resolvedSource, err := resolvePath(source)
+	if err != nil {
+		return err
+	}
+	stagedFS.allowed[resolvedSource] = true
+	return os.Symlink(resolvedSource, filepath.Join(stagedFS.root, path.Base(target)))
+}
+
+// confinedFS is os.DirFS for a folder, except that links are only followed
+// if they end up inside the folder - os.DirFS refuses paths that climb out
+// of it but follows links wherever they go
+type confinedFS struct {
+	root string
+	// files outside of root that links can point at
+	allowed map[string]bool
+}
+
+func newConfinedFS(dir string) (*confinedFS, error) {
+	root, err := resolvePath(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &confinedFS{root: root, allowed: map[string]bool{}}, nil
+}
+
+func (c *confinedFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(c.root, filepath.FromSlash(name)))
+	if err != nil {
+		return nil, err
+	}
+	if resolved != c.root && !strings.HasPrefix(resolved, c.root+string(filepath.Separator)) && !c.allowed[resolved] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return os.Open(resolved)
+}
+
+// resolvePath returns the absolute path with every link in it followed
+func resolvePath(name string) (string, error) {
+	absName, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(absName)
+}
+
+// instantiateWASI adds the WASI host functions to the runtime, except that
+// modules can't make links. wazero's dir mounts follow links on the host,
+// so a link made in an output folder could point anywhere on the node.
+func instantiateWASI(ctx context.Context, runtime wazero.Runtime) error {
+	builder := runtime.NewHostModuleBuilder(wasi_snapshot_preview1.ModuleName)
+	wasi_snapshot_preview1.NewFunctionExporter().ExportFunctions(builder)
+	links := map[string]int{
+		// old_path, old_path_len, fd, new_path, new_path_len
+		"path_symlink": 5, //nolint:gomnd
+		// old_fd, old_flags, old_path, old_path_len, new_fd, new_path, new_path_len
+		"path_link": 7, //nolint:gomnd
+	}
+	for name, params := range links {
+		paramTypes := make([]api.ValueType, params)
+		for i := range paramTypes {
+			paramTypes[i] = api.ValueTypeI32
+		}
+		builder.NewFunctionBuilder().
+			WithGoModuleFunction(api.GoModuleFunc(refuseLink), paramTypes, []api.ValueType{api.ValueTypeI32}).
+			Export(name)
+	}
+	_, err := builder.Instantiate(ctx)
+	return err
+}
+
+// the WASI errno for an operation that isn't permitted
+const wasiErrnoPerm = 63
+
+func refuseLink(_ context.Context, _ api.Module, stack []uint64) {
+	stack[0] = wasiErrnoPerm
+}
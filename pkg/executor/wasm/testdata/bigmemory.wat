@@ -0,0 +1,5 @@
+;; asks for 8MiB of memory up front
+(module
+  (memory (export "memory") 128)
+
+  (func (export "_start")))
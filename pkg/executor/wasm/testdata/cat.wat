@@ -0,0 +1,34 @@
+;; copies file.txt from the first preopen (the input folder) to stdout and
+;; to output_file.txt in the second preopen (the output folder)
+(module
+  (import "wasi_snapshot_preview1" "path_open"
+    (func $path_open (param i32 i32 i32 i32 i32 i64 i64 i32 i32) (result i32)))
+  (import "wasi_snapshot_preview1" "fd_read"
+    (func $fd_read (param i32 i32 i32 i32) (result i32)))
+  (import "wasi_snapshot_preview1" "fd_write"
+    (func $fd_write (param i32 i32 i32 i32) (result i32)))
+  (import "wasi_snapshot_preview1" "proc_exit"
+    (func $proc_exit (param i32)))
+
+  (memory (export "memory") 1)
+  (data (i32.const 0) "file.txt")
+  (data (i32.const 16) "output_file.txt")
+  ;; iovec pointing at a 1KiB buffer
+  (data (i32.const 32) "\00\04\00\00\00\04\00\00")
+
+  (func $check (param $errno i32)
+    (if (local.get $errno)
+      (then (call $proc_exit (i32.const 2)))))
+
+  (func (export "_start")
+    ;; open and read the input
+    (call $check (call $path_open (i32.const 3) (i32.const 0) (i32.const 0) (i32.const 8)
+      (i32.const 0) (i64.const -1) (i64.const -1) (i32.const 0) (i32.const 44)))
+    (call $check (call $fd_read (i32.load (i32.const 44)) (i32.const 32) (i32.const 1) (i32.const 40)))
+    ;; only write what we read
+    (i32.store (i32.const 36) (i32.load (i32.const 40)))
+    (call $check (call $fd_write (i32.const 1) (i32.const 32) (i32.const 1) (i32.const 40)))
+    ;; create the output (O_CREAT | O_TRUNC) and write it there too
+    (call $check (call $path_open (i32.const 4) (i32.const 0) (i32.const 16) (i32.const 15)
+      (i32.const 9) (i64.const -1) (i64.const -1) (i32.const 0) (i32.const 44)))
+    (call $check (call $fd_write (i32.load (i32.const 44)) (i32.const 32) (i32.const 1) (i32.const 40)))))
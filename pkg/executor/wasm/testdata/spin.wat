@@ -0,0 +1,10 @@
+;; calls a function forever
+(module
+  (memory (export "memory") 1)
+
+  (func $tick)
+
+  (func (export "_start")
+    (loop $forever
+      (call $tick)
+      (br $forever))))
@@ -0,0 +1,15 @@
+;; tries to link "x" in the first preopen to the root of the host and exits
+;; with the errno it gets back
+(module
+  (import "wasi_snapshot_preview1" "path_symlink"
+    (func $path_symlink (param i32 i32 i32 i32 i32) (result i32)))
+  (import "wasi_snapshot_preview1" "proc_exit"
+    (func $proc_exit (param i32)))
+
+  (memory (export "memory") 1)
+  (data (i32.const 0) "/")
+  (data (i32.const 16) "x")
+
+  (func (export "_start")
+    (call $proc_exit
+      (call $path_symlink (i32.const 0) (i32.const 1) (i32.const 3) (i32.const 16) (i32.const 1)))))
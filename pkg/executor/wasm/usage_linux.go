@@ -0,0 +1,34 @@
+package wasm
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// RUSAGE_THREAD from linux/resource.h
+const rusageThread = 1
+
+// startCPUTimer locks the goroutine running the module to its thread and
+// returns a function that unlocks it and returns the cpu time the thread
+// used in between - wazero runs modules on the calling goroutine.
+func startCPUTimer() func() time.Duration {
+	runtime.LockOSThread()
+	start, ok := threadCPUTime()
+	return func() time.Duration {
+		end, endOk := threadCPUTime()
+		runtime.UnlockOSThread()
+		if !ok || !endOk {
+			return 0
+		}
+		return end - start
+	}
+}
+
+func threadCPUTime() (time.Duration, bool) {
+	var rusage syscall.Rusage
+	if err := syscall.Getrusage(rusageThread, &rusage); err != nil {
+		return 0, false
+	}
+	return time.Duration(rusage.Utime.Nano() + rusage.Stime.Nano()), true
+}
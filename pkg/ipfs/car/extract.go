@@ -0,0 +1,171 @@
+package car
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	files "github.com/ipfs/go-ipfs-files"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-unixfs"
+	unixfile "github.com/ipfs/go-unixfs/file"
+	"github.com/ipld/go-car/v2"
+	"github.com/ipld/go-car/v2/blockstore"
+	"github.com/rs/zerolog/log"
+)
+
+// OpenCar checks that every block in a CAR file matches its CID and returns
+// a DAG service that reads them from the file - close it once done.
+func OpenCar(ctx context.Context, carFile string) (ipld.DAGService, io.Closer, error) {
+	file, err := os.Open(carFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	reader, err := car.NewBlockReader(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	for {
+		// the reader checks the block hashes as it goes
+		_, err = reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	store, err := blockstore.OpenReadOnly(carFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	blockService := blockservice.New(store, offline.Exchange(store))
+	return merkledag.NewDAGService(blockService), store, nil
+}
+
+// Extract writes the unixfs file or folder with the given CID to outputPath.
+func Extract(ctx context.Context, dag ipld.DAGService, root cid.Cid, outputPath string) error {
+	node, err := dag.Get(ctx, root)
+	if err != nil {
+		return err
+	}
+	fileNode, err := unixfile.NewUnixfsFile(ctx, dag, node)
+	if err != nil {
+		return err
+	}
+	defer fileNode.Close()
+	return writeNode(fileNode, outputPath)
+}
+
+// Size adds up the size of the unixfs files under the given CID.
+func Size(ctx context.Context, dag ipld.DAGService, root cid.Cid) (uint64, error) {
+	node, err := dag.Get(ctx, root)
+	if err != nil {
+		return 0, err
+	}
+	fileNode, err := unixfile.NewUnixfsFile(ctx, dag, node)
+	if err != nil {
+		return 0, err
+	}
+	defer fileNode.Close()
+	return nodeSize(fileNode)
+}
+
+// RootSize is the size of the unixfs file or folder with the given CID going
+// by its root block alone, so the rest of the DAG doesn't have to be there.
+// It is exact for a file - for a folder it is the cumulative size of its
+// links, which is a little more than its files as it counts the blocks that
+// hold them too.
+func RootSize(ctx context.Context, dag ipld.DAGService, root cid.Cid) (uint64, error) {
+	node, err := dag.Get(ctx, root)
+	if err != nil {
+		return 0, err
+	}
+	switch n := node.(type) {
+	case *merkledag.RawNode:
+		return uint64(len(n.RawData())), nil
+	case *merkledag.ProtoNode:
+		fsNode, err := unixfs.FSNodeFromBytes(n.Data())
+		if err != nil {
+			return 0, err
+		}
+		switch fsNode.Type() {
+		case unixfs.TFile, unixfs.TRaw:
+			return fsNode.FileSize(), nil
+		case unixfs.TDirectory, unixfs.THAMTShard:
+			var size uint64
+			for _, link := range n.Links() {
+				size += link.Size
+			}
+			return size, nil
+		default:
+			return 0, nil
+		}
+	default:
+		return 0, fmt.Errorf("%s is not a unixfs file or folder", root)
+	}
+}
+
+func nodeSize(node files.Node) (uint64, error) {
+	switch n := node.(type) {
+	case files.Directory:
+		var size uint64
+		entries := n.Entries()
+		for entries.Next() {
+			entrySize, err := nodeSize(entries.Node())
+			if err != nil {
+				return 0, err
+			}
+			size += entrySize
+		}
+		return size, entries.Err()
+	case files.File:
+		size, err := n.Size()
+		return uint64(size), err
+	default:
+		return 0, nil
+	}
+}
+
+// like files.WriteTo but the names in the DAG can't write outside of target
+func writeNode(node files.Node, target string) error {
+	switch n := node.(type) {
+	case *files.Symlink:
+		log.Debug().Msgf("not writing symlink %s to %s", target, n.Target)
+		return nil
+	case files.File:
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644) //nolint:gomnd // the same as ipfs get
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(file, n)
+		return err
+	case files.Directory:
+		if err := os.Mkdir(target, 0755); err != nil { //nolint:gomnd // the same as ipfs get
+			return err
+		}
+		entries := n.Entries()
+		for entries.Next() {
+			name := entries.Name()
+			if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\\x00") {
+				return fmt.Errorf("invalid file name in DAG: %q", name)
+			}
+			if err := writeNode(entries.Node(), filepath.Join(target, name)); err != nil {
+				return err
+			}
+		}
+		return entries.Err()
+	default:
+		return fmt.Errorf("unknown unixfs node type %T", node)
+	}
+}
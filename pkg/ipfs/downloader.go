@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage/s3"
 	"github.com/filecoin-project/bacalhau/pkg/system"
 	"github.com/rs/zerolog/log"
 )
@@ -54,6 +55,18 @@ func DownloadJob( //nolint:funlen,gocyclo
 		return nil
 	}
 
+	// results published to s3 are downloaded straight from the bucket so
+	// we only need an IPFS node for the rest
+	needsIPFS := false
+	for _, result := range results { //nolint:gocritic
+		if result.Engine != model.StorageSourceS3 {
+			needsIPFS = true
+		}
+	}
+	if !needsIPFS {
+		return loopOverResults(ctx, nil, results, settings, job)
+	}
+
 	switch system.GetEnvironment() {
 	case system.EnvironmentProd:
 		settings.IPFSSwarmAddrs = strings.Join(system.Envs[system.Production].IPFSSwarmAddresses, ",")
@@ -89,10 +102,14 @@ func loopOverResults(ctx context.Context,
 	ctx, span := system.GetTracer().Start(ctx, "pkg/ipfs.loopingOverResults")
 	defer span.End()
 
-	log.Debug().Msg("Connecting client to new IPFS node...")
-	cl, err := n.Client()
-	if err != nil {
-		return err
+	var cl *Client
+	if n != nil {
+		log.Debug().Msg("Connecting client to new IPFS node...")
+		var err error
+		cl, err = n.Client()
+		if err != nil {
+			return err
+		}
 	}
 
 	scratchFolder, err := ioutil.TempDir("", "bacalhau-ipfs-job-downloader")
@@ -158,12 +175,20 @@ func fetchResult(ctx context.Context,
 	defer span.End()
 
 	err := func() error {
-		log.Debug().Msgf("Downloading result CID %s '%s' to '%s'...", result.Name, result.Cid, shardDownloadDir)
-
 		innerCtx, cancel := context.WithDeadline(ctx,
 			time.Now().Add(time.Second*time.Duration(timeoutSecs)))
 		defer cancel()
 
+		if result.Engine == model.StorageSourceS3 {
+			log.Debug().Msgf("Downloading result %s '%s' to '%s'...", result.Name, result.URL, shardDownloadDir)
+			bucket, prefix, err := s3.ParseURL(result.URL)
+			if err != nil {
+				return err
+			}
+			return s3.NewClient(s3.NewClientConfigFromEnv()).DownloadFolder(innerCtx, bucket, prefix, shardDownloadDir)
+		}
+
+		log.Debug().Msgf("Downloading result CID %s '%s' to '%s'...", result.Name, result.Cid, shardDownloadDir)
 		return cl.Get(innerCtx, result.Cid, shardDownloadDir)
 	}()
 
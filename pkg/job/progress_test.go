@@ -0,0 +1,61 @@
+package job
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseShardProgress(t *testing.T) {
+	testCases := []struct {
+		input    string
+		percent  float64
+		message  string
+		asString string
+	}{
+		{input: "42", percent: 42, message: "", asString: "42%"},
+		{input: "42.5% processing file 3\n", percent: 42.5, message: "processing file 3", asString: "42.5% processing file 3"},
+		{input: "150 overshot", percent: 100, message: "overshot", asString: "100% overshot"},
+		{input: "downloading weights", percent: -1, message: "downloading weights", asString: "downloading weights"},
+		{input: "10 first line\n20 second line", percent: 10, message: "first line", asString: "10% first line"},
+		{input: "", percent: -1, message: "", asString: ""},
+	}
+
+	for _, testCase := range testCases {
+		progress := model.ParseShardProgress(testCase.input)
+		require.Equal(t, testCase.percent, progress.Percent, testCase.input)
+		require.Equal(t, testCase.message, progress.Message, testCase.input)
+		require.Equal(t, testCase.asString, progress.String(), testCase.input)
+	}
+}
+
+func TestProgressSummary(t *testing.T) {
+	jobState := model.JobState{
+		Nodes: map[string]model.JobNodeState{
+			"node-a": {Shards: map[int]model.JobShardState{
+				0: {NodeID: "node-a", ShardIndex: 0, State: model.JobStateRunning, Status: "42% halfway (running for 10s)"},
+				1: {NodeID: "node-a", ShardIndex: 1, State: model.JobStateRunning, Status: "running for 10s"},
+				2: {NodeID: "node-a", ShardIndex: 2, State: model.JobStateVerifying, Status: "100% done"},
+			}},
+			"node-b": {Shards: map[int]model.JobShardState{
+				0: {NodeID: "node-b", ShardIndex: 0, State: model.JobStateRunning, Status: "10% (running for 10s)"},
+				3: {NodeID: "node-b", ShardIndex: 3, State: model.JobStateRunning, Status: "5"},
+			}},
+		},
+	}
+
+	resolver := NewStateResolver(
+		func(ctx context.Context, id string) (model.Job, error) {
+			return model.Job{ID: id}, nil
+		},
+		func(ctx context.Context, id string) (model.JobState, error) {
+			return jobState, nil
+		},
+	)
+
+	summary, err := resolver.ProgressSummary(context.Background(), "job-id")
+	require.NoError(t, err)
+	require.Equal(t, "0: 42%, 3: 5%", summary)
+}
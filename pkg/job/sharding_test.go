@@ -1,11 +1,19 @@
 package job
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
 	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage"
+	"github.com/filecoin-project/bacalhau/pkg/storage/s3"
+	"github.com/filecoin-project/bacalhau/pkg/storage/s3/s3test"
+	"github.com/filecoin-project/bacalhau/pkg/storage/url/urldownload"
+	"github.com/filecoin-project/bacalhau/pkg/system"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
@@ -174,3 +182,71 @@ func (suite *JobShardingSuite) TestApplyGlobPattern() {
 	}
 
 }
+
+func (suite *JobShardingSuite) TestShardS3Objects() {
+	server := s3test.NewServer()
+	defer server.Close()
+	server.PutObject("data", "images/a/1.png", []byte("one"))
+	server.PutObject("data", "images/a/2.png", []byte("two"))
+	server.PutObject("data", "images/b/3.png", []byte("three"))
+
+	cm := system.NewCleanupManager()
+	defer cm.Cleanup()
+	s3Storage, err := s3.NewStorageProvider(cm, s3.ClientConfig{Endpoint: server.URL, Buckets: []string{"data"}})
+	require.NoError(suite.T(), err)
+	storageProviders := map[model.StorageSourceType]storage.StorageProvider{
+		model.StorageSourceS3: s3Storage,
+	}
+
+	spec := model.JobSpec{
+		Inputs: []model.StorageSpec{{
+			Engine: model.StorageSourceS3,
+			URL:    "s3://data/images",
+			Path:   "/inputs",
+		}},
+		Sharding: model.JobShardingConfig{
+			GlobPattern: "/inputs/*/*.png",
+			BatchSize:   2,
+		},
+	}
+	shards, err := GetShardsStorageSpecs(context.Background(), spec, storageProviders)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), shards, 2)
+	require.Equal(suite.T(), []string{"/inputs/a/1.png", "/inputs/a/2.png"}, joinStringArray(shards[0]))
+	require.Equal(suite.T(), []string{"/inputs/b/3.png"}, joinStringArray(shards[1]))
+	require.Equal(suite.T(), "s3://data/images/b/3.png", shards[1][0].URL)
+}
+
+func (suite *JobShardingSuite) TestShardURLIndex() {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/index.txt" {
+			fmt.Fprintf(w, "%s/1.csv\n%s/2.csv\n%s/3.csv\n", server.URL, server.URL, server.URL)
+		}
+	}))
+	defer server.Close()
+
+	cm := system.NewCleanupManager()
+	defer cm.Cleanup()
+	urlStorage, err := urldownload.NewStorageProvider(cm)
+	require.NoError(suite.T(), err)
+	storageProviders := map[model.StorageSourceType]storage.StorageProvider{
+		model.StorageSourceURLDownload: urlStorage,
+	}
+
+	inputs, err := BuildURLIndexInputs([]string{server.URL + "/index.txt:/inputs"})
+	require.NoError(suite.T(), err)
+	spec := model.JobSpec{
+		Inputs: inputs,
+		Sharding: model.JobShardingConfig{
+			GlobPattern: "/inputs/*.csv",
+			BatchSize:   2,
+		},
+	}
+	shards, err := GetShardsStorageSpecs(context.Background(), spec, storageProviders)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), shards, 2)
+	require.Equal(suite.T(), []string{"/inputs/1.csv", "/inputs/2.csv"}, joinStringArray(shards[0]))
+	require.Equal(suite.T(), []string{"/inputs/3.csv"}, joinStringArray(shards[1]))
+	require.Equal(suite.T(), server.URL+"/3.csv", shards[1][0].URL)
+}
@@ -3,6 +3,8 @@ package job
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/filecoin-project/bacalhau/pkg/model"
@@ -77,6 +79,48 @@ func (resolver *StateResolver) StateSummary(ctx context.Context, jobID string) (
 	return currentJobState.String(), nil
 }
 
+// ProgressSummary describes how far through each running shard the job has
+// got, based on the progress relayed in the compute node heartbeats
+// e.g. "0: 42%, 3: 10%" - it's empty if no running shard reported any
+func (resolver *StateResolver) ProgressSummary(ctx context.Context, jobID string) (string, error) {
+	ctx, span := system.GetTracer().Start(ctx, "pkg/job.ProgressSummary")
+	defer span.End()
+	system.AddJobIDFromBaggageToSpan(ctx, span)
+
+	jobState, err := resolver.stateLoader(ctx, jobID)
+	if err != nil {
+		return "", err
+	}
+
+	// if more than one node is running a shard we show the furthest along
+	shardPercents := map[int]float64{}
+	for _, shardState := range FlattenShardStates(jobState) { //nolint:gocritic
+		if shardState.State != model.JobStateRunning {
+			continue
+		}
+		progress := model.ParseShardProgress(shardState.Status)
+		if !progress.HasPercent() {
+			continue
+		}
+		if percent, ok := shardPercents[shardState.ShardIndex]; !ok || progress.Percent > percent {
+			shardPercents[shardState.ShardIndex] = progress.Percent
+		}
+	}
+
+	shardIndexes := []int{}
+	for shardIndex := range shardPercents {
+		shardIndexes = append(shardIndexes, shardIndex)
+	}
+	sort.Ints(shardIndexes)
+
+	summaries := []string{}
+	for _, shardIndex := range shardIndexes {
+		summaries = append(summaries, fmt.Sprintf("%d: %s",
+			shardIndex, model.ShardProgress{Percent: shardPercents[shardIndex]}))
+	}
+	return strings.Join(summaries, ", "), nil
+}
+
 func (resolver *StateResolver) VerifiedSummary(ctx context.Context, jobID string) (string, error) {
 	ctx, span := system.GetTracer().Start(ctx, "pkg/job.VerifiedSummary")
 	defer span.End()
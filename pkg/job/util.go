@@ -4,10 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"path"
 	"regexp"
 	"strings"
 
 	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage/archive"
+	"github.com/filecoin-project/bacalhau/pkg/storage/git"
+	"github.com/filecoin-project/bacalhau/pkg/storage/inline"
+	"github.com/filecoin-project/bacalhau/pkg/storage/s3"
 	"github.com/filecoin-project/bacalhau/pkg/storage/url/urldownload"
 	"github.com/rs/zerolog/log"
 )
@@ -47,12 +52,24 @@ func buildJobInputs(inputVolumes, inputUrls []string) ([]model.StorageSpec, erro
 	jobInputs := []model.StorageSpec{}
 
 	for _, inputURL := range inputUrls {
-		// split using LastIndex to support port numbers in URL
-		lastInd := strings.LastIndex(inputURL, ":")
-		rawURL := inputURL[:lastInd]
-		path := inputURL[lastInd+1:]
+		rawURL, path, err := splitInputURL(inputURL)
+		if err != nil {
+			return []model.StorageSpec{}, err
+		}
+		if s3.IsS3URL(rawURL) {
+			_, _, err := s3.ParseURL(rawURL)
+			if err != nil {
+				return []model.StorageSpec{}, err
+			}
+			jobInputs = append(jobInputs, model.StorageSpec{
+				Engine: model.StorageSourceS3,
+				URL:    rawURL,
+				Path:   path,
+			})
+			continue
+		}
 		// should loop through all available storage providers?
-		_, err := urldownload.IsURLSupported(rawURL)
+		_, err = urldownload.IsURLSupported(rawURL)
 		if err != nil {
 			return []model.StorageSpec{}, err
 		}
@@ -79,6 +96,93 @@ func buildJobInputs(inputVolumes, inputUrls []string) ([]model.StorageSpec, erro
 	return jobInputs, nil
 }
 
+// BuildURLIndexInputs turns index:path pairs into inputs that download every
+// URL listed in the index file into the folder at path.
+func BuildURLIndexInputs(indexURLs []string) ([]model.StorageSpec, error) {
+	jobInputs := []model.StorageSpec{}
+	for _, indexURL := range indexURLs {
+		rawURL, path, err := splitInputURL(indexURL)
+		if err != nil {
+			return []model.StorageSpec{}, err
+		}
+		if _, err = urldownload.IsURLSupported(rawURL); err != nil {
+			return []model.StorageSpec{}, err
+		}
+		jobInputs = append(jobInputs, model.StorageSpec{
+			Engine:   model.StorageSourceURLDownload,
+			URL:      rawURL,
+			Path:     path,
+			Metadata: map[string]string{urldownload.MetadataIndex: "true"},
+		})
+	}
+	return jobInputs, nil
+}
+
+// BuildGitInputs turns repo@commit:path references into inputs that check
+// out the repository at the commit at path.
+func BuildGitInputs(gitRefs []string) ([]model.StorageSpec, error) {
+	jobInputs := []model.StorageSpec{}
+	for _, gitRef := range gitRefs {
+		ref, path, err := splitInputURL(gitRef)
+		if err != nil {
+			return []model.StorageSpec{}, err
+		}
+		repo, commit, err := git.ParseRef(ref)
+		if err != nil {
+			return []model.StorageSpec{}, err
+		}
+		jobInputs = append(jobInputs, git.NewStorageSpec(repo, commit, path))
+	}
+	return jobInputs, nil
+}
+
+// BuildInlineInputs turns localPath:path pairs into inputs with the content
+// of the local file mounted at path - without a path the file is mounted in
+// /inputs.
+func BuildInlineInputs(inlineFiles []string) ([]model.StorageSpec, error) {
+	jobInputs := []model.StorageSpec{}
+	for _, inlineFile := range inlineFiles {
+		localPath, path, found := strings.Cut(inlineFile, ":")
+		if !found {
+			path = inline.DefaultPath(localPath)
+		}
+		spec, err := inline.NewStorageSpec(localPath, path)
+		if err != nil {
+			return []model.StorageSpec{}, err
+		}
+		jobInputs = append(jobInputs, spec)
+	}
+	return jobInputs, nil
+}
+
+// ExtractInputs sets the archives of the inputs mounted at the given paths
+// to be extracted.
+func ExtractInputs(inputs []model.StorageSpec, paths []string) error {
+	for _, extractPath := range paths {
+		found := false
+		for i, input := range inputs {
+			if path.Clean(input.Path) == path.Clean(extractPath) {
+				inputs[i] = archive.Extracted(input)
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("there is no input mounted at %s to extract", extractPath)
+		}
+	}
+	return nil
+}
+
+// splitInputURL splits url:path, using the last colon to support port
+// numbers in the URL
+func splitInputURL(inputURL string) (rawURL, path string, err error) {
+	lastInd := strings.LastIndex(inputURL, ":")
+	if lastInd < 0 {
+		return "", "", fmt.Errorf("invalid input url, expected url:path but got: %s", inputURL)
+	}
+	return inputURL[:lastInd], inputURL[lastInd+1:], nil
+}
+
 func buildJobOutputs(outputVolumes []string) ([]model.StorageSpec, error) {
 	outputVolumesMap := make(map[string]model.StorageSpec)
 	outputVolumes = append(outputVolumes, "outputs:/outputs")
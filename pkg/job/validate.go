@@ -2,9 +2,15 @@ package job
 
 import (
 	"fmt"
+	"path"
 	"reflect"
 
 	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/proxy"
+	"github.com/filecoin-project/bacalhau/pkg/storage/archive"
+	"github.com/filecoin-project/bacalhau/pkg/storage/git"
+	"github.com/filecoin-project/bacalhau/pkg/storage/inline"
+	"github.com/filecoin-project/bacalhau/pkg/storage/url/urldownload"
 )
 
 func VerifyJob(spec model.JobSpec, deal model.JobDeal) error {
@@ -28,6 +34,20 @@ func VerifyJob(spec model.JobSpec, deal model.JobDeal) error {
 		return fmt.Errorf("invalid publisher type: %s", spec.Publisher.String())
 	}
 
+	if !model.IsValidImagePullPolicy(spec.Docker.PullPolicy) {
+		return fmt.Errorf("invalid image pull policy: %s", spec.Docker.PullPolicy.String())
+	}
+
+	for _, capability := range spec.Docker.Relaxations.Capabilities {
+		if !model.HasCapability(model.DefaultDockerCapabilities, capability) {
+			return fmt.Errorf("the job asks for the %s capability but only docker's default capabilities can be kept", capability)
+		}
+	}
+
+	if spec.Publisher == model.PublisherS3 && spec.S3Publisher.Bucket == "" {
+		return fmt.Errorf("the s3 publisher needs a bucket to publish to")
+	}
+
 	if deal.Confidence > deal.Concurrency {
 		return fmt.Errorf("the deal confidence cannot be higher than the concurrency")
 	}
@@ -38,5 +58,148 @@ func VerifyJob(spec model.JobSpec, deal model.JobDeal) error {
 		}
 	}
 
+	err := verifyInputs(spec)
+	if err != nil {
+		return err
+	}
+
+	err = verifyWasm(spec)
+	if err != nil {
+		return err
+	}
+
+	if spec.Engine == model.EngineNative && len(spec.Native.Entrypoint) == 0 {
+		return fmt.Errorf("a native job needs an entrypoint")
+	}
+
+	err = verifyCheckpoint(spec)
+	if err != nil {
+		return err
+	}
+
+	return verifyNetwork(spec)
+}
+
+// check the inputs and contexts that carry what they need in their spec
+func verifyInputs(spec model.JobSpec) error {
+	var inlineSize uint64
+	for _, inputVolume := range append(append([]model.StorageSpec{}, spec.Inputs...), spec.Contexts...) {
+		switch inputVolume.Engine {
+		case model.StorageSourceGit:
+			if err := git.ValidateSpec(inputVolume); err != nil {
+				return err
+			}
+		case model.StorageSourceInline:
+			if inputVolume.Path == "" {
+				return fmt.Errorf("inline input %s needs a path to be mounted at", inputVolume.Name)
+			}
+			size, err := inline.DecodedSize(inputVolume)
+			if err != nil {
+				return err
+			}
+			inlineSize += size
+		}
+		if err := verifyExtract(inputVolume); err != nil {
+			return err
+		}
+	}
+	if inlineSize > inline.MaxSize {
+		return fmt.Errorf("the inline inputs of a job can be at most %d bytes but these are %d bytes", inline.MaxSize, inlineSize)
+	}
+	return nil
+}
+
+// only single files from IPFS, estuary, filecoin, URLs and S3 can be extracted
+func verifyExtract(spec model.StorageSpec) error {
+	if !archive.IsExtracted(spec) {
+		return nil
+	}
+	switch spec.Engine {
+	case model.StorageSourceIPFS, model.StorageSourceEstuary, model.StorageSourceFilecoin, model.StorageSourceS3:
+		return nil
+	case model.StorageSourceURLDownload:
+		if spec.Metadata[urldownload.MetadataIndex] == "true" {
+			return fmt.Errorf("the files downloaded from an index cannot be extracted: %s", spec.URL)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%s inputs cannot be extracted", spec.Engine)
+	}
+}
+
+func verifyCheckpoint(spec model.JobSpec) error {
+	if !spec.Checkpoint.IsEnabled() {
+		if spec.Checkpoint.RestorePath != "" {
+			return fmt.Errorf("a checkpoint restore path was given but no checkpoint path")
+		}
+		return nil
+	}
+	if spec.Checkpoint.RestorePath == "" {
+		return fmt.Errorf("a checkpointed job needs a restore path")
+	}
+	if !path.IsAbs(spec.Checkpoint.Path) || !path.IsAbs(spec.Checkpoint.RestorePath) {
+		return fmt.Errorf("the checkpoint paths must be absolute")
+	}
+	if path.Clean(spec.Checkpoint.Path) == path.Clean(spec.Checkpoint.RestorePath) {
+		return fmt.Errorf("the checkpoint path and restore path must be different")
+	}
+	for _, output := range spec.Outputs {
+		if output.Name == model.CheckpointOutputName {
+			return fmt.Errorf("a checkpointed job cannot have an output named %s", model.CheckpointOutputName)
+		}
+	}
+	return nil
+}
+
+func verifyWasm(spec model.JobSpec) error {
+	fuel, err := model.ParseFuel(spec.Resources.Fuel)
+	if err != nil {
+		return err
+	}
+	// only the wasm executor can meter fuel
+	if fuel > 0 && spec.Engine != model.EngineWasm {
+		return fmt.Errorf("a fuel limit is not supported by the %s executor", spec.Engine.String())
+	}
+
+	if spec.Engine != model.EngineWasm {
+		return nil
+	}
+	if !model.IsValidStorageSourceType(spec.Wasm.EntryModule.Engine) {
+		return fmt.Errorf("invalid wasm entry module type: %s", spec.Wasm.EntryModule.Engine.String())
+	}
+	return nil
+}
+
+func verifyNetwork(spec model.JobSpec) error {
+	if !model.IsValidNetwork(spec.Network.Type) {
+		return fmt.Errorf("invalid network type: %s", spec.Network.Type.String())
+	}
+
+	if spec.Network.Type == model.NetworkNone {
+		if len(spec.Network.AllowList) > 0 {
+			return fmt.Errorf("a network allow list was given but the network type is %s", spec.Network.Type.String())
+		}
+		return nil
+	}
+
+	// only the docker executor knows how to give jobs network access
+	// (non-deterministic language jobs run on it)
+	runsOnDocker := spec.Engine == model.EngineDocker ||
+		(spec.Engine == model.EngineLanguage && !spec.Language.Deterministic)
+	if !runsOnDocker {
+		return fmt.Errorf("network access is not supported by the %s executor", spec.Engine.String())
+	}
+
+	if spec.Network.Type == model.NetworkAllowList {
+		// whether jobs can reach local addresses is up to each compute node
+		allowList, err := proxy.ParseAllowList(spec.Network.AllowList, true)
+		if err != nil {
+			return err
+		}
+		if allowList.IsEmpty() {
+			return fmt.Errorf("the %s network type needs at least one host in the allow list", spec.Network.Type.String())
+		}
+	}
+
 	return nil
 }
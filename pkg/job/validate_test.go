@@ -0,0 +1,244 @@
+package job
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage/archive"
+	"github.com/filecoin-project/bacalhau/pkg/storage/git"
+	"github.com/filecoin-project/bacalhau/pkg/storage/inline"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyJobNetwork(t *testing.T) {
+	testCases := []struct {
+		name    string
+		engine  model.EngineType
+		network model.JobSpecNetwork
+		valid   bool
+	}{
+		{name: "no network", engine: model.EngineDocker, network: model.JobSpecNetwork{}, valid: true},
+		{name: "full", engine: model.EngineDocker, network: model.JobSpecNetwork{Type: model.NetworkFull}, valid: true},
+		{
+			name:    "allow list",
+			engine:  model.EngineDocker,
+			network: model.JobSpecNetwork{Type: model.NetworkAllowList, AllowList: []string{"pypi.org", "10.0.0.0/8"}},
+			valid:   true,
+		},
+		{name: "empty allow list", engine: model.EngineDocker, network: model.JobSpecNetwork{Type: model.NetworkAllowList}, valid: false},
+		{
+			name:    "bad allow list",
+			engine:  model.EngineDocker,
+			network: model.JobSpecNetwork{Type: model.NetworkAllowList, AllowList: []string{"https://pypi.org"}},
+			valid:   false,
+		},
+		{
+			name:    "allow list without network",
+			engine:  model.EngineDocker,
+			network: model.JobSpecNetwork{AllowList: []string{"pypi.org"}},
+			valid:   false,
+		},
+		{name: "unknown type", engine: model.EngineDocker, network: model.JobSpecNetwork{Type: model.Network(99)}, valid: false},
+		{name: "not docker", engine: model.EngineNoop, network: model.JobSpecNetwork{Type: model.NetworkFull}, valid: false},
+		{name: "language", engine: model.EngineLanguage, network: model.JobSpecNetwork{Type: model.NetworkFull}, valid: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			spec := model.JobSpec{
+				Engine:    testCase.engine,
+				Verifier:  model.VerifierNoop,
+				Publisher: model.PublisherNoop,
+				Network:   testCase.network,
+			}
+			err := VerifyJob(spec, model.JobDeal{Concurrency: 1})
+			if testCase.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestVerifyJobNative(t *testing.T) {
+	spec := model.JobSpec{
+		Engine:    model.EngineNative,
+		Verifier:  model.VerifierNoop,
+		Publisher: model.PublisherNoop,
+	}
+	require.Error(t, VerifyJob(spec, model.JobDeal{Concurrency: 1}))
+
+	spec.Native.Entrypoint = []string{"echo", "hello"}
+	require.NoError(t, VerifyJob(spec, model.JobDeal{Concurrency: 1}))
+}
+
+func TestVerifyJobWasm(t *testing.T) {
+	entryModule := model.StorageSpec{Engine: model.StorageSourceIPFS, Cid: "QmTest"}
+	testCases := []struct {
+		name   string
+		engine model.EngineType
+		wasm   model.JobSpecWasm
+		fuel   string
+		valid  bool
+	}{
+		{name: "module", engine: model.EngineWasm, wasm: model.JobSpecWasm{EntryModule: entryModule}, valid: true},
+		{name: "fuel", engine: model.EngineWasm, wasm: model.JobSpecWasm{EntryModule: entryModule}, fuel: "1000", valid: true},
+		{name: "no module", engine: model.EngineWasm, valid: false},
+		{name: "bad fuel", engine: model.EngineWasm, wasm: model.JobSpecWasm{EntryModule: entryModule}, fuel: "lots", valid: false},
+		{name: "fuel not wasm", engine: model.EngineDocker, fuel: "1000", valid: false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			spec := model.JobSpec{
+				Engine:    testCase.engine,
+				Verifier:  model.VerifierNoop,
+				Publisher: model.PublisherNoop,
+				Wasm:      testCase.wasm,
+				Resources: model.ResourceUsageConfig{Fuel: testCase.fuel},
+			}
+			err := VerifyJob(spec, model.JobDeal{Concurrency: 1})
+			if testCase.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestVerifyJobCheckpoint(t *testing.T) {
+	testCases := []struct {
+		name       string
+		checkpoint model.JobSpecCheckpoint
+		valid      bool
+		outputs    []model.StorageSpec
+	}{
+		{name: "disabled", checkpoint: model.JobSpecCheckpoint{}, valid: true},
+		{name: "enabled", checkpoint: model.JobSpecCheckpoint{Path: "/checkpoint", RestorePath: "/restore"}, valid: true},
+		{name: "no restore path", checkpoint: model.JobSpecCheckpoint{Path: "/checkpoint"}, valid: false},
+		{name: "only restore path", checkpoint: model.JobSpecCheckpoint{RestorePath: "/restore"}, valid: false},
+		{name: "relative", checkpoint: model.JobSpecCheckpoint{Path: "checkpoint", RestorePath: "/restore"}, valid: false},
+		{name: "same path", checkpoint: model.JobSpecCheckpoint{Path: "/checkpoint", RestorePath: "/checkpoint/"}, valid: false},
+		{name: "output clash", checkpoint: model.JobSpecCheckpoint{Path: "/checkpoint", RestorePath: "/restore"}, valid: false,
+			outputs: []model.StorageSpec{{Name: model.CheckpointOutputName, Path: "/outputs"}}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			spec := model.JobSpec{
+				Engine:     model.EngineDocker,
+				Verifier:   model.VerifierNoop,
+				Publisher:  model.PublisherNoop,
+				Checkpoint: testCase.checkpoint,
+				Outputs:    testCase.outputs,
+			}
+			err := VerifyJob(spec, model.JobDeal{Concurrency: 1})
+			if testCase.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestVerifyJobS3Publisher(t *testing.T) {
+	spec := model.JobSpec{
+		Engine:    model.EngineDocker,
+		Verifier:  model.VerifierNoop,
+		Publisher: model.PublisherS3,
+	}
+	require.Error(t, VerifyJob(spec, model.JobDeal{Concurrency: 1}))
+
+	spec.S3Publisher = model.JobSpecS3Publisher{Bucket: "results"}
+	require.NoError(t, VerifyJob(spec, model.JobDeal{Concurrency: 1}))
+}
+
+func TestVerifyJobGitInput(t *testing.T) {
+	spec := model.JobSpec{
+		Engine:    model.EngineDocker,
+		Verifier:  model.VerifierNoop,
+		Publisher: model.PublisherNoop,
+	}
+	spec.Contexts = []model.StorageSpec{git.NewStorageSpec("https://github.com/foo/bar.git", "main", "/code")}
+	require.Error(t, VerifyJob(spec, model.JobDeal{Concurrency: 1}))
+
+	inputs, err := BuildGitInputs([]string{"https://github.com/foo/bar.git@" + strings.Repeat("a", 40) + ":/code"})
+	require.NoError(t, err)
+	require.Equal(t, "/code", inputs[0].Path)
+	spec.Contexts = inputs
+	require.NoError(t, VerifyJob(spec, model.JobDeal{Concurrency: 1}))
+}
+
+func TestVerifyJobInlineInput(t *testing.T) {
+	dir := t.TempDir()
+	small := filepath.Join(dir, "small.txt")
+	require.NoError(t, os.WriteFile(small, []byte(strings.Repeat("a", inline.MaxSize/2)), 0644))
+	spec := model.JobSpec{
+		Engine:    model.EngineDocker,
+		Verifier:  model.VerifierNoop,
+		Publisher: model.PublisherNoop,
+	}
+
+	inputs, err := BuildInlineInputs([]string{small + ":/small.txt"})
+	require.NoError(t, err)
+	spec.Inputs = inputs
+	require.NoError(t, VerifyJob(spec, model.JobDeal{Concurrency: 1}))
+
+	// each file fits but together they are too big
+	inputs, err = BuildInlineInputs([]string{small, small + ":/other.txt", small + ":/another.txt"})
+	require.NoError(t, err)
+	require.Equal(t, "/inputs/small.txt", inputs[0].Path)
+	spec.Inputs = inputs
+	require.Error(t, VerifyJob(spec, model.JobDeal{Concurrency: 1}))
+
+	spec.Inputs = []model.StorageSpec{{Engine: model.StorageSourceInline, Path: "/broken", Data: "%%%"}}
+	require.Error(t, VerifyJob(spec, model.JobDeal{Concurrency: 1}))
+
+	spec.Inputs = []model.StorageSpec{{Engine: model.StorageSourceInline, Data: "aGk="}}
+	require.Error(t, VerifyJob(spec, model.JobDeal{Concurrency: 1}))
+}
+
+func TestVerifyJobExtractInput(t *testing.T) {
+	spec := model.JobSpec{
+		Engine:    model.EngineDocker,
+		Verifier:  model.VerifierNoop,
+		Publisher: model.PublisherNoop,
+		Inputs: []model.StorageSpec{
+			{Engine: model.StorageSourceURLDownload, URL: "https://example.com/data.zip", Path: "/inputs/data"},
+			git.NewStorageSpec("https://github.com/foo/bar.git", strings.Repeat("a", 40), "/code"),
+		},
+	}
+	require.Error(t, ExtractInputs(spec.Inputs, []string{"/inputs/other"}))
+
+	require.NoError(t, ExtractInputs(spec.Inputs, []string{"/inputs/data/"}))
+	require.True(t, archive.IsExtracted(spec.Inputs[0]))
+	require.NoError(t, VerifyJob(spec, model.JobDeal{Concurrency: 1}))
+
+	require.NoError(t, ExtractInputs(spec.Inputs, []string{"/code"}))
+	require.Error(t, VerifyJob(spec, model.JobDeal{Concurrency: 1}))
+
+	indexes, err := BuildURLIndexInputs([]string{"https://example.com/index.txt:/inputs/files"})
+	require.NoError(t, err)
+	require.NoError(t, ExtractInputs(indexes, []string{"/inputs/files"}))
+	spec.Inputs = indexes
+	require.Error(t, VerifyJob(spec, model.JobDeal{Concurrency: 1}))
+}
+
+func TestVerifyJobCapabilities(t *testing.T) {
+	spec := model.JobSpec{
+		Engine:    model.EngineDocker,
+		Verifier:  model.VerifierNoop,
+		Publisher: model.PublisherNoop,
+	}
+	spec.Docker.Relaxations.Capabilities = []string{"NET_BIND_SERVICE", "cap_chown"}
+	require.NoError(t, VerifyJob(spec, model.JobDeal{Concurrency: 1}))
+
+	spec.Docker.Relaxations.Capabilities = []string{"NET_BIND_SERVICE", "SYS_ADMIN"}
+	require.Error(t, VerifyJob(spec, model.JobDeal{Concurrency: 1}))
+}
@@ -244,6 +244,20 @@ func (d *InMemoryDatastore) UpdateShardState(
 		}
 	}
 
+	// once a shard has finished on a node events that arrive late (e.g. a
+	// heartbeat after it was cancelled, or results after it timed out)
+	// can't change it - only a new bid, which a node makes when the shard
+	// has been rescheduled, starts it over
+	if shardSate.State.IsTerminal() &&
+		(update.State != model.JobStateBidding || shardSate.State == model.JobStateCompleted) {
+		return nil
+	}
+
+	// heartbeats can arrive late, they never move a shard backwards
+	if update.State == model.JobStateRunning && shardSate.State > model.JobStateRunning {
+		return nil
+	}
+
 	shardSate.State = update.State
 	if update.Status != "" {
 		shardSate.Status = update.Status
@@ -261,6 +275,10 @@ func (d *InMemoryDatastore) UpdateShardState(
 		shardSate.PublishedResult = update.PublishedResult
 	}
 
+	if !update.ResourceUsage.IsEmpty() {
+		shardSate.ResourceUsage = update.ResourceUsage
+	}
+
 	nodeState.Shards[shardIndex] = shardSate
 	jobState.Nodes[nodeID] = nodeState
 	d.states[jobID] = jobState
@@ -75,3 +75,40 @@ func TestInMemoryDataStore(t *testing.T) {
 	require.Equal(t, model.JobStateBidding, shardState.State)
 	require.Equal(t, "hello", shardState.Status)
 }
+
+func TestInMemoryDataStoreFinalStates(t *testing.T) {
+	ctx := context.Background()
+	jobID := "123"
+	nodeID := "456"
+
+	store, err := NewInMemoryDatastore()
+	require.NoError(t, err)
+	require.NoError(t, store.AddJob(ctx, model.Job{ID: jobID}))
+
+	update := func(shardIndex int, state model.JobStateType) model.JobStateType {
+		require.NoError(t, store.UpdateShardState(ctx, jobID, nodeID, shardIndex, model.JobShardState{
+			NodeID:     nodeID,
+			ShardIndex: shardIndex,
+			State:      state,
+		}))
+		jobState, err := store.GetJobState(ctx, jobID)
+		require.NoError(t, err)
+		return jobState.Nodes[nodeID].Shards[shardIndex].State
+	}
+
+	// late results don't undo an error
+	update(0, model.JobStateRunning)
+	update(0, model.JobStateError)
+	require.Equal(t, model.JobStateError, update(0, model.JobStateVerifying))
+
+	// late heartbeats don't undo a cancellation
+	update(1, model.JobStateRunning)
+	update(1, model.JobStateCancelled)
+	require.Equal(t, model.JobStateCancelled, update(1, model.JobStateRunning))
+	// but the node can bid again once the shard is rescheduled
+	require.Equal(t, model.JobStateBidding, update(1, model.JobStateBidding))
+
+	update(2, model.JobStateCompleted)
+	require.Equal(t, model.JobStateCompleted, update(2, model.JobStateBidding))
+	require.Equal(t, model.JobStateCompleted, update(2, model.JobStateError))
+}
@@ -11,9 +11,10 @@ const (
 	engineUnknown EngineType = iota // must be first
 	EngineNoop
 	EngineDocker
-	EngineWasm       // raw wasm executor not implemented yet
+	EngineWasm       // runs WASI modules in-process
 	EngineLanguage   // wraps python_wasm
 	EnginePythonWasm // wraps docker
+	EngineNative     // runs a local process - for trusted clusters only
 	engineDone       // must be last
 )
 
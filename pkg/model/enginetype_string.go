@@ -14,12 +14,13 @@ func _() {
 	_ = x[EngineWasm-3]
 	_ = x[EngineLanguage-4]
 	_ = x[EnginePythonWasm-5]
-	_ = x[engineDone-6]
+	_ = x[EngineNative-6]
+	_ = x[engineDone-7]
 }
 
-const _EngineType_name = "engineUnknownNoopDockerWasmLanguagePythonWasmengineDone"
+const _EngineType_name = "engineUnknownNoopDockerWasmLanguagePythonWasmNativeengineDone"
 
-var _EngineType_index = [...]uint8{0, 13, 17, 23, 27, 35, 45, 55}
+var _EngineType_index = [...]uint8{0, 13, 17, 23, 27, 35, 45, 51, 61}
 
 func (i EngineType) String() string {
 	if i < 0 || i >= EngineType(len(_EngineType_index)-1) {
@@ -53,6 +53,15 @@ const (
 	// the compute node will publish them and issue this event
 	JobEventResultsPublished
 
+	// a compute node uploaded a checkpoint the job wrote while running
+	// a shard - it is given to the shard if it has to be run again
+	JobEventCheckpointed
+
+	// a requester node gave up on the compute node running a shard and
+	// wants another node to bid on it so it can carry on from the latest
+	// checkpoint
+	JobEventRescheduled
+
 	jobEventDone // must be last
 )
 
@@ -116,5 +125,10 @@ const (
 	// flag a job as having already had it's verification done
 	JobLocalEventVerified
 
+	// compute node
+	// this means "our job selection policy turned this job down"
+	// the reason is recorded on the event
+	JobLocalEventRejected
+
 	jobLocalEventDone // must be last
 )
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+//go:generate stringer -type=ImagePullPolicy --trimprefix=Pull
+type ImagePullPolicy int
+
+const (
+	// only pull the image if the compute node doesn't have it - this is the default
+	PullIfNotPresent ImagePullPolicy = iota // must be first
+	// pull the image before every run, even if the compute node has it
+	PullAlways
+	// never pull the image, it must already be on the compute node
+	PullNever
+	pullPolicyDone // must be last
+)
+
+func IsValidImagePullPolicy(policy ImagePullPolicy) bool {
+	return policy >= PullIfNotPresent && policy < pullPolicyDone
+}
+
+// ParseImagePullPolicy accepts the policy names with or without dashes
+// e.g. "if-not-present" or "IfNotPresent".
+func ParseImagePullPolicy(str string) (ImagePullPolicy, error) {
+	str = strings.ReplaceAll(str, "-", "")
+	for typ := PullIfNotPresent; typ < pullPolicyDone; typ++ {
+		if equal(typ.String(), str) {
+			return typ, nil
+		}
+	}
+
+	return PullIfNotPresent, fmt.Errorf(
+		"image pull policy: unknown type '%s'", str)
+}
+
+func ImagePullPolicies() []ImagePullPolicy {
+	var res []ImagePullPolicy
+	for typ := PullIfNotPresent; typ < pullPolicyDone; typ++ {
+		res = append(res, typ)
+	}
+
+	return res
+}
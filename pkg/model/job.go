@@ -2,6 +2,7 @@ package model
 
 import (
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -106,6 +107,8 @@ type JobShardState struct {
 	VerificationProposal []byte             `json:"verification_proposal"`
 	VerificationResult   VerificationResult `json:"verification_result"`
 	PublishedResult      StorageSpec        `json:"published_results"`
+	// what the shard actually used on this node
+	ResourceUsage ResourceUsageMeasurement `json:"resource_usage,omitempty"`
 }
 
 // The deal the client has made with the bacalhau network.
@@ -143,14 +146,25 @@ type JobSpec struct {
 	// there can be multiple publishers for the job
 	Publisher     PublisherType `json:"publisher" yaml:"publisher"`
 	PublisherName string        `json:"publisher_name" yaml:"publisher_name"`
+	// where the s3 publisher uploads the results
+	S3Publisher JobSpecS3Publisher `json:"s3_publisher,omitempty" yaml:"s3_publisher,omitempty"`
 
 	// executor specific data
 	Docker   JobSpecDocker   `json:"job_spec_docker,omitempty" yaml:"job_spec_docker,omitempty"`
 	Language JobSpecLanguage `json:"job_spec_language,omitempty" yaml:"job_spec_language,omitempty"`
+	Wasm     JobSpecWasm     `json:"job_spec_wasm,omitempty" yaml:"job_spec_wasm,omitempty"`
+	Native   JobSpecNative   `json:"job_spec_native,omitempty" yaml:"job_spec_native,omitempty"`
 
 	// the compute (cpy, ram) resources this job requires
 	Resources ResourceUsageConfig `json:"resources" yaml:"resources"`
 
+	// the network access the job needs - none by default
+	Network JobSpecNetwork `json:"network,omitempty" yaml:"network,omitempty"`
+
+	// where the job writes checkpoints so a long running shard can carry
+	// on from the latest one if it has to be run again - off by default
+	Checkpoint JobSpecCheckpoint `json:"checkpoint,omitempty" yaml:"checkpoint,omitempty"`
+
 	// the data volumes we will read in the job
 	// for example "read this ipfs cid"
 	Inputs []StorageSpec `json:"inputs" yaml:"inputs"`
@@ -185,8 +199,87 @@ type JobSpecDocker struct {
 	Env []string `json:"env" yaml:"env"`
 	// working directory inside the container
 	WorkingDir string `json:"workdir" yaml:"workdir"`
+	// when the compute node should pull the image
+	PullPolicy ImagePullPolicy `json:"pull_policy,omitempty" yaml:"pull_policy,omitempty"`
+	// parts of the compute node's security hardening the job needs
+	// switched off to run - nodes can refuse jobs that ask for these
+	Relaxations JobSpecDockerRelaxations `json:"relaxations,omitempty" yaml:"relaxations,omitempty"`
+}
+
+// the security hardening a docker job can ask to have relaxed
+type JobSpecDockerRelaxations struct {
+	// run as the user in the image rather than the node's unprivileged user
+	RunAsRoot bool `json:"run_as_root,omitempty" yaml:"run_as_root,omitempty"`
+	// don't make the root filesystem of the container read only
+	WritableRootFS bool `json:"writable_rootfs,omitempty" yaml:"writable_rootfs,omitempty"`
+	// linux capabilities (e.g. NET_BIND_SERVICE) to keep when the node
+	// drops capabilities
+	Capabilities []string `json:"capabilities,omitempty" yaml:"capabilities,omitempty"`
+}
+
+func (r JobSpecDockerRelaxations) IsEmpty() bool {
+	return !r.RunAsRoot && !r.WritableRootFS && len(r.Capabilities) == 0
+}
+
+// DefaultDockerCapabilities are the linux capabilities docker gives a
+// container unless it is told otherwise - a job can ask to keep some of
+// these when a node drops capabilities but never for any others
+var DefaultDockerCapabilities = []string{
+	"AUDIT_WRITE", "CHOWN", "DAC_OVERRIDE", "FOWNER", "FSETID", "KILL", "MKNOD",
+	"NET_BIND_SERVICE", "NET_RAW", "SETFCAP", "SETGID", "SETPCAP", "SETUID", "SYS_CHROOT",
+}
+
+// NormalizeCapability turns e.g. "cap_net_raw" into "NET_RAW"
+func NormalizeCapability(capability string) string {
+	return strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(capability)), "CAP_")
+}
+
+// HasCapability tells you if the capability is in the list, however either
+// of them are written
+func HasCapability(capabilities []string, capability string) bool {
+	capability = NormalizeCapability(capability)
+	for _, c := range capabilities {
+		if NormalizeCapability(c) == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// where the s3 publisher uploads the results of a job - each shard is
+// uploaded under <prefix>/<job id>/shard-<index>/<node id>/
+type JobSpecS3Publisher struct {
+	Bucket string `json:"bucket,omitempty" yaml:"bucket,omitempty"`
+	Prefix string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+}
+
+// what network access a job is given
+type JobSpecNetwork struct {
+	Type Network `json:"type" yaml:"type"`
+	// the hosts (e.g. pypi.org or *.example.com) and CIDRs
+	// (e.g. 10.0.0.0/8) the job can reach when Type is NetworkAllowList
+	AllowList []string `json:"allow_list,omitempty" yaml:"allow_list,omitempty"`
+}
+
+// the checkpointing contract of a job - the job writes checkpoints into a
+// folder which compute nodes upload periodically, and when a shard is run
+// again the latest checkpoint is mounted (read only) for it to carry on from
+type JobSpecCheckpoint struct {
+	// the folder the job writes its checkpoints into
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// the folder the latest checkpoint is mounted at
+	RestorePath string `json:"restore_path,omitempty" yaml:"restore_path,omitempty"`
+}
+
+func (checkpoint JobSpecCheckpoint) IsEnabled() bool {
+	return checkpoint.Path != ""
 }
 
+// CheckpointOutputName is the output volume compute nodes add for a job to
+// write its checkpoints into, so jobs can't have an output of their own
+// with the same name.
+const CheckpointOutputName = "checkpoints"
+
 // for language style executors (can target docker or wasm)
 type JobSpecLanguage struct {
 	Language        string `json:"language" yaml:"language"`                 // e.g. python
@@ -203,6 +296,28 @@ type JobSpecLanguage struct {
 	RequirementsPath string `json:"requirements_path" yaml:"requirements_path"`
 }
 
+// for jobs that run a WASI module with the wasm executor
+type JobSpecWasm struct {
+	// the module to run - either a single .wasm file or a folder
+	// containing exactly one
+	EntryModule StorageSpec `json:"entry_module" yaml:"entry_module"`
+	// the exported function to call - defaults to the WASI _start function
+	EntryPoint string `json:"entry_point,omitempty" yaml:"entry_point,omitempty"`
+	// arguments passed to the module (after the module name)
+	Parameters []string `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	// environment variables visible to the module
+	EnvironmentVariables map[string]string `json:"environment_variables,omitempty" yaml:"environment_variables,omitempty"`
+}
+
+// for jobs that run as a plain process on the compute node with the native
+// executor - only nodes that trust their workloads enable it
+type JobSpecNative struct {
+	// the command to run - the first item is looked up on the PATH
+	Entrypoint []string `json:"entrypoint" yaml:"entrypoint"`
+	// the environment to run the process with as KEY=VALUE
+	Env []string `json:"env,omitempty" yaml:"env,omitempty"`
+}
+
 // gives us a way to keep local data against a job
 // so our compute node and requester node control loops
 // can keep state against a job without broadcasting it
@@ -212,6 +327,8 @@ type JobLocalEvent struct {
 	JobID        string            `json:"job_id"`
 	ShardIndex   int               `json:"shard_index"`
 	TargetNodeID string            `json:"target_node_id"`
+	// why we did what we did e.g. why a job was rejected
+	Reason string `json:"reason,omitempty"`
 }
 
 // we emit these to other nodes so they update their
@@ -238,6 +355,10 @@ type JobEvent struct {
 	VerificationProposal []byte             `json:"verification_proposal"`
 	VerificationResult   VerificationResult `json:"verification_result"`
 	PublishedResult      StorageSpec        `json:"published_results"`
+	// this is only defined in "results_proposed" events
+	ResourceUsage ResourceUsageMeasurement `json:"resource_usage,omitempty"`
+	// this is only defined in "checkpointed" events
+	Checkpoint StorageSpec `json:"checkpoint,omitempty"`
 
 	EventTime       time.Time `json:"event_time"`
 	SenderPublicKey []byte    `json:"public_key"`
@@ -392,6 +513,10 @@ func GetStateFromEvent(eventType JobEventType) JobStateType {
 	case JobEventResultsPublished:
 		return JobStateCompleted
 
+	// the requester has given the shard to another node
+	case JobEventRescheduled:
+		return JobStateCancelled
+
 	default:
 		return jobStateUnknown
 	}
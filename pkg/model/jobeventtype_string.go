@@ -21,12 +21,14 @@ func _() {
 	_ = x[JobEventResultsAccepted-10]
 	_ = x[JobEventResultsRejected-11]
 	_ = x[JobEventResultsPublished-12]
-	_ = x[jobEventDone-13]
+	_ = x[JobEventCheckpointed-13]
+	_ = x[JobEventRescheduled-14]
+	_ = x[jobEventDone-15]
 }
 
-const _JobEventType_name = "jobEventUnknownCreatedDealUpdatedBidBidAcceptedBidRejectedBidCancelledRunningErrorResultsProposedResultsAcceptedResultsRejectedResultsPublishedjobEventDone"
+const _JobEventType_name = "jobEventUnknownCreatedDealUpdatedBidBidAcceptedBidRejectedBidCancelledRunningErrorResultsProposedResultsAcceptedResultsRejectedResultsPublishedCheckpointedRescheduledjobEventDone"
 
-var _JobEventType_index = [...]uint8{0, 15, 22, 33, 36, 47, 58, 70, 77, 82, 97, 112, 127, 143, 155}
+var _JobEventType_index = [...]uint8{0, 15, 22, 33, 36, 47, 58, 70, 77, 82, 97, 112, 127, 143, 155, 166, 178}
 
 func (i JobEventType) String() string {
 	if i < 0 || i >= JobEventType(len(_JobEventType_index)-1) {
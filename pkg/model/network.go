@@ -0,0 +1,42 @@
+package model
+
+import (
+	"fmt"
+)
+
+//go:generate stringer -type=Network --trimprefix=Network
+type Network int
+
+const (
+	// the job has no network access at all - this is the default
+	NetworkNone Network = iota // must be first
+	// the job can only make HTTP(S) requests to the hosts in its allow list
+	NetworkAllowList
+	// the job has unrestricted network access
+	NetworkFull
+	networkDone // must be last
+)
+
+func IsValidNetwork(network Network) bool {
+	return network >= NetworkNone && network < networkDone
+}
+
+func ParseNetwork(str string) (Network, error) {
+	for typ := NetworkNone; typ < networkDone; typ++ {
+		if equal(typ.String(), str) {
+			return typ, nil
+		}
+	}
+
+	return NetworkNone, fmt.Errorf(
+		"network: unknown type '%s'", str)
+}
+
+func Networks() []Network {
+	var res []Network
+	for typ := NetworkNone; typ < networkDone; typ++ {
+		res = append(res, typ)
+	}
+
+	return res
+}
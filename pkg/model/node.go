@@ -0,0 +1,31 @@
+package model
+
+// A snapshot of what a compute node has and what it has handed out
+// to the shards it is currently running
+type ComputeNodeInfo struct {
+	NodeID string `json:"node_id"`
+	// the node is not selecting new jobs
+	Draining bool `json:"draining"`
+	// the total resources this node is allowing jobs to use
+	TotalCapacity ResourceUsageData `json:"total_capacity"`
+	// what is left once bidding and running shards are accounted for
+	FreeCapacity ResourceUsageData `json:"free_capacity"`
+	// the GPU device IDs this node can hand out
+	GPUDevices []string `json:"gpu_devices"`
+	// map of shard ID to the GPU device IDs allocated to it
+	GPUAllocations map[string][]string `json:"gpu_allocations"`
+}
+
+// How far a compute node has got with draining
+type ComputeNodeDrainStatus struct {
+	NodeID string `json:"node_id"`
+	// the node is not selecting new jobs
+	Draining bool `json:"draining"`
+	// the node is draining and has no shards left
+	// so it is safe to shut it down
+	Drained bool `json:"drained"`
+	// shards we bid on and have not heard back about yet
+	BiddingShards []string `json:"bidding_shards"`
+	// shards that are running or publishing their results
+	ExecutingShards []string `json:"executing_shards"`
+}
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ShardProgress is how far through a shard a job has got, as reported by
+// the job itself. Jobs report progress by writing a single line like
+// "42 processing file 3" or "42% processing file 3" to the file named by
+// the BACALHAU_PROGRESS_FILE environment variable. The compute node relays
+// it to the requester in the status of its heartbeats in the same format.
+type ShardProgress struct {
+	// from 0 to 100, or -1 if the job only gave us a message
+	Percent float64 `json:"percent"`
+	// what the job is currently doing
+	Message string `json:"message"`
+}
+
+// ParseShardProgress reads progress in the format described on
+// ShardProgress. If the first word is not a number the whole line is
+// treated as the message.
+func ParseShardProgress(str string) ShardProgress {
+	str = strings.TrimSpace(str)
+	// only the first line counts
+	if i := strings.IndexByte(str, '\n'); i >= 0 {
+		str = strings.TrimSpace(str[:i])
+	}
+
+	progress := ShardProgress{
+		Percent: -1,
+		Message: str,
+	}
+
+	fields := strings.SplitN(str, " ", 2) //nolint:gomnd
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(fields[0], "%"), 64)
+	if err != nil {
+		return progress
+	}
+
+	if percent < 0 {
+		percent = 0
+	} else if percent > 100 { //nolint:gomnd
+		percent = 100
+	}
+	progress.Percent = percent
+	progress.Message = ""
+	if len(fields) > 1 {
+		progress.Message = strings.TrimSpace(fields[1])
+	}
+	return progress
+}
+
+func (p ShardProgress) HasPercent() bool {
+	return p.Percent >= 0
+}
+
+func (p ShardProgress) IsEmpty() bool {
+	return !p.HasPercent() && p.Message == ""
+}
+
+func (p ShardProgress) String() string {
+	if !p.HasPercent() {
+		return p.Message
+	}
+	percent := strconv.FormatFloat(p.Percent, 'f', -1, 64)
+	if p.Message == "" {
+		return fmt.Sprintf("%s%%", percent)
+	}
+	return fmt.Sprintf("%s%% %s", percent, p.Message)
+}
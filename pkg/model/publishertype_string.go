@@ -13,12 +13,13 @@ func _() {
 	_ = x[PublisherIpfs-2]
 	_ = x[PublisherFilecoin-3]
 	_ = x[PublisherEstuary-4]
-	_ = x[publisherDone-5]
+	_ = x[PublisherS3-5]
+	_ = x[publisherDone-6]
 }
 
-const _PublisherType_name = "publisherUnknownNoopIpfsFilecoinEstuarypublisherDone"
+const _PublisherType_name = "publisherUnknownNoopIpfsFilecoinEstuaryS3publisherDone"
 
-var _PublisherType_index = [...]uint8{0, 16, 20, 24, 32, 39, 52}
+var _PublisherType_index = [...]uint8{0, 16, 20, 24, 32, 39, 41, 54}
 
 func (i PublisherType) String() string {
 	if i < 0 || i >= PublisherType(len(_PublisherType_index)-1) {
@@ -1,5 +1,11 @@
 package model
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 // a record for the "amount" of compute resources an entity has / can consume / is using
 
 type ResourceUsageConfig struct {
@@ -11,7 +17,9 @@ type ResourceUsageConfig struct {
 
 	Disk string `json:"disk" yaml:"disk"`
 	GPU  string `json:"gpu" yaml:"gpu"` // unsigned integer string
-
+	// the most function calls a wasm job can make before it is stopped
+	// (unsigned integer string) - empty means no limit
+	Fuel string `json:"fuel,omitempty" yaml:"fuel,omitempty"`
 }
 
 // these are the numeric values in bytes for ResourceUsageConfig
@@ -33,3 +41,32 @@ type ResourceUsageProfile struct {
 	// what is the total amount of resources available to the system
 	SystemTotal ResourceUsageData `json:"system_total"`
 }
+
+// what a shard actually used while it ran, as measured by the executor -
+// zero values mean the executor couldn't measure them
+type ResourceUsageMeasurement struct {
+	// seconds of cpu time across all cores
+	CPUSeconds float64 `json:"cpu_seconds,omitempty"`
+	// the most memory used at once in bytes
+	PeakMemory uint64 `json:"peak_memory,omitempty"`
+	// bytes written to disk, including the outputs
+	DiskWritten uint64 `json:"disk_written,omitempty"`
+	// how long the shard ran for in seconds
+	WallTimeSeconds float64 `json:"wall_time_seconds,omitempty"`
+}
+
+func (m ResourceUsageMeasurement) IsEmpty() bool {
+	return m == ResourceUsageMeasurement{}
+}
+
+// ParseFuel reads the fuel limit of a job - 0 means no limit.
+func ParseFuel(fuel string) (uint64, error) {
+	if fuel == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseUint(strings.TrimSpace(fuel), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid fuel limit %q: must be a whole number of function calls", fuel)
+	}
+	return value, nil
+}
@@ -19,6 +19,9 @@ const (
 	StorageSourceFilecoinUnsealed
 	StorageSourceFilecoin
 	StorageSourceEstuary
+	StorageSourceS3
+	StorageSourceGit
+	StorageSourceInline
 	storageSourceDone // must be last
 )
 
@@ -90,4 +93,7 @@ type StorageSpec struct {
 
 	// Additional properties specific to each driver
 	Metadata map[string]string `json:"metadata" yaml:"metadata"`
+
+	// The content of inline storage, base64 encoded
+	Data string `json:"data,omitempty" yaml:"data,omitempty"`
 }
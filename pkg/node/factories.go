@@ -87,6 +87,10 @@ func (f *StandardStorageProvidersFactory) Get(
 		executor_util.StandardStorageProviderOptions{
 			IPFSMultiaddress:     nodeConfig.IPFSClient.APIAddress(),
 			FilecoinUnsealedPath: nodeConfig.FilecoinUnsealedPath,
+			S3:                   nodeConfig.S3Config,
+			Filecoin:             nodeConfig.FilecoinRetrievalConfig,
+			InputCache:           nodeConfig.InputCache,
+			GitMaxRepoSize:       nodeConfig.GitMaxRepoSize,
 		},
 	)
 }
@@ -104,11 +108,19 @@ func (f *StandardExecutorsFactory) Get(
 		ctx,
 		nodeConfig.CleanupManager,
 		executor_util.StandardExecutorOptions{
-			DockerID:   fmt.Sprintf("bacalhau-%s", nodeConfig.HostID),
-			IsBadActor: nodeConfig.IsBadActor,
+			DockerID:         fmt.Sprintf("bacalhau-%s", nodeConfig.HostID),
+			DockerConfig:     nodeConfig.DockerConfig,
+			LanguageConfig:   nodeConfig.LanguageConfig,
+			PythonWasmConfig: nodeConfig.PythonWasmConfig,
+			NativeConfig:     nodeConfig.NativeConfig,
+			IsBadActor:       nodeConfig.IsBadActor,
 			Storage: executor_util.StandardStorageProviderOptions{
 				IPFSMultiaddress:     nodeConfig.IPFSClient.APIAddress(),
 				FilecoinUnsealedPath: nodeConfig.FilecoinUnsealedPath,
+				S3:                   nodeConfig.S3Config,
+				Filecoin:             nodeConfig.FilecoinRetrievalConfig,
+				InputCache:           nodeConfig.InputCache,
+				GitMaxRepoSize:       nodeConfig.GitMaxRepoSize,
 			},
 		},
 	)
@@ -149,6 +161,7 @@ func (f *StandardPublishersFactory) Get(
 		controller.GetStateResolver(),
 		nodeConfig.IPFSClient.APIAddress(),
 		nodeConfig.EstuaryAPIKey,
+		nodeConfig.S3Config,
 	)
 }
 
@@ -5,12 +5,20 @@ import (
 
 	computenode "github.com/filecoin-project/bacalhau/pkg/computenode"
 	"github.com/filecoin-project/bacalhau/pkg/controller"
+	docker_util "github.com/filecoin-project/bacalhau/pkg/docker"
 	"github.com/filecoin-project/bacalhau/pkg/executor"
+	"github.com/filecoin-project/bacalhau/pkg/executor/docker"
+	"github.com/filecoin-project/bacalhau/pkg/executor/language"
+	"github.com/filecoin-project/bacalhau/pkg/executor/native"
+	pythonwasm "github.com/filecoin-project/bacalhau/pkg/executor/python_wasm"
 	"github.com/filecoin-project/bacalhau/pkg/ipfs"
 	"github.com/filecoin-project/bacalhau/pkg/localdb/inmemory"
 	"github.com/filecoin-project/bacalhau/pkg/model"
 	"github.com/filecoin-project/bacalhau/pkg/publicapi"
 	"github.com/filecoin-project/bacalhau/pkg/requesternode"
+	"github.com/filecoin-project/bacalhau/pkg/storage/cache"
+	"github.com/filecoin-project/bacalhau/pkg/storage/filecoin"
+	"github.com/filecoin-project/bacalhau/pkg/storage/s3"
 	"github.com/filecoin-project/bacalhau/pkg/system"
 	"github.com/filecoin-project/bacalhau/pkg/transport"
 	"github.com/rs/zerolog/log"
@@ -28,8 +36,29 @@ type NodeConfig struct {
 	APIPort              int
 	MetricsPort          int
 	IsBadActor           bool
-	ComputeNodeConfig    computenode.ComputeNodeConfig
-	RequesterNodeConfig  requesternode.RequesterNodeConfig
+	DockerConfig         docker.ExecutorConfig
+	// pin the images of submitted docker jobs to the digest their tag
+	// points to, using the registry credentials in DockerConfig
+	ResolveImageDigests bool
+	// the images non-deterministic language jobs run on
+	LanguageConfig language.ExecutorConfig
+	// where deterministic python jobs get their requirements from
+	PythonWasmConfig pythonwasm.ExecutorConfig
+	// the S3 compatible service s3:// inputs are read from and results
+	// are published to
+	S3Config s3.ClientConfig
+	// the lotus client and price limit filecoin inputs are retrieved with
+	FilecoinRetrievalConfig filecoin.StorageProviderConfig
+	// shares the ipfs and url inputs of jobs between the shards that run
+	// on this node - nil fetches them again for every shard
+	InputCache *cache.Cache
+	// how much disk the bare repositories git inputs are fetched into can
+	// use - 0 uses git.DefaultMaxRepoSize
+	GitMaxRepoSize uint64
+	// whether and how jobs can run as local processes
+	NativeConfig        native.ExecutorConfig
+	ComputeNodeConfig   computenode.ComputeNodeConfig
+	RequesterNodeConfig requesternode.RequesterNodeConfig
 }
 
 // Lazy node dependency injector that generate instances of different
@@ -152,6 +181,20 @@ func NewNode(
 	if err != nil {
 		return nil, err
 	}
+	// checkpoints go to ipfs unless the compute node was given somewhere else
+	computeNodeConfig := config.ComputeNodeConfig
+	if computeNodeConfig.CheckpointStorage == nil {
+		computeNodeConfig.CheckpointStorage = storageProviders[model.StorageSourceIPFS]
+	}
+	// prefetched inputs are only any use if they end up in the cache the
+	// executors read from
+	if computeNodeConfig.PrefetchStorage == nil && computeNodeConfig.PrefetchBudget > 0 {
+		if config.InputCache != nil {
+			computeNodeConfig.PrefetchStorage = storageProviders
+		} else {
+			log.Warn().Msgf("not prefetching inputs because there is no input cache")
+		}
+	}
 	computeNode, err := computenode.NewComputeNode(
 		ctx,
 		config.CleanupManager,
@@ -159,7 +202,7 @@ func NewNode(
 		executors,
 		verifiers,
 		publishers,
-		config.ComputeNodeConfig,
+		computeNodeConfig,
 	)
 	if err != nil {
 		return nil, err
@@ -170,8 +213,12 @@ func NewNode(
 		config.HostAddress,
 		config.APIPort,
 		controller,
+		computeNode,
 		publishers,
 	)
+	if config.ResolveImageDigests {
+		apiServer.ImageResolver = docker_util.NewRegistryClient(config.DockerConfig.RegistryCredentials)
+	}
 
 	node := &Node{
 		CleanupManager: config.CleanupManager,
@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// AllowList is the set of hosts and networks a job is allowed to reach.
+// Entries are either host names (e.g. "pypi.org"), wildcard domains that
+// match any sub domain (e.g. "*.example.com"), IP addresses or CIDRs
+// (e.g. "10.0.0.0/8").
+type AllowList struct {
+	hosts    map[string]bool
+	suffixes []string
+	networks []*net.IPNet
+	// whether jobs can reach the compute node itself - see isLocalIP
+	allowLocal bool
+}
+
+// localNetworks are the addresses that reach whichever host dials them:
+// loopback, unspecified ("this host") and link-local addresses.
+var localNetworks = mustParseCIDRs(
+	"127.0.0.0/8", "::1/128",
+	"0.0.0.0/8", "::/128",
+	"169.254.0.0/16", "fe80::/10",
+)
+
+// ParseAllowList parses the allow list of a job. The egress proxy runs on
+// the compute node so entries that point back at it (local addresses and
+// "localhost") are refused unless the operator has set allowLocal.
+func ParseAllowList(entries []string, allowLocal bool) (AllowList, error) {
+	allowList := AllowList{
+		hosts:      map[string]bool{},
+		allowLocal: allowLocal,
+	}
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+
+		ipNet := parseIPNet(entry)
+		if ipNet != nil {
+			if !allowLocal && overlapsLocalNetworks(ipNet) {
+				return AllowList{}, fmt.Errorf("allow list entry reaches the compute node itself: %s", entry)
+			}
+			allowList.networks = append(allowList.networks, ipNet)
+			continue
+		}
+
+		if !allowLocal && (entry == "localhost" || strings.HasSuffix(entry, ".localhost")) {
+			return AllowList{}, fmt.Errorf("allow list entry reaches the compute node itself: %s", entry)
+		}
+
+		if strings.HasPrefix(entry, "*.") {
+			domain := strings.TrimPrefix(entry, "*")
+			if !isValidHostName(strings.TrimPrefix(domain, ".")) {
+				return AllowList{}, fmt.Errorf("invalid allow list entry: %s", entry)
+			}
+			allowList.suffixes = append(allowList.suffixes, domain)
+			continue
+		}
+
+		if !isValidHostName(entry) {
+			return AllowList{}, fmt.Errorf("invalid allow list entry: %s", entry)
+		}
+		allowList.hosts[entry] = true
+	}
+	return allowList, nil
+}
+
+func (a AllowList) IsEmpty() bool {
+	return len(a.hosts) == 0 && len(a.suffixes) == 0 && len(a.networks) == 0
+}
+
+// AllowsHostName tells you if the host name is allowed by name alone - it
+// does not resolve the name, use AllowsIP for the addresses it resolves to.
+func (a AllowList) AllowsHostName(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if a.hosts[host] {
+		return true
+	}
+	for _, suffix := range a.suffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return a.AllowsIP(ip)
+	}
+	return false
+}
+
+func (a AllowList) AllowsIP(ip net.IP) bool {
+	for _, ipNet := range a.networks {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLocalIP tells you if dialing the IP would reach the compute node
+// itself, either through a local address or one of the node's own (which
+// include the gateways of the job networks).
+func (a AllowList) isLocalIP(ip net.IP, nodeIPs []net.IP) bool {
+	if a.allowLocal {
+		return false
+	}
+	for _, ipNet := range localNetworks {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	for _, nodeIP := range nodeIPs {
+		if nodeIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// an IP address or CIDR, nil if the entry is neither
+func parseIPNet(entry string) *net.IPNet {
+	if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+		return ipNet
+	}
+	if ip := net.ParseIP(entry); ip != nil {
+		return singleIPNet(ip)
+	}
+	return nil
+}
+
+// networks are aligned to their masks, so two of them overlap exactly when
+// one contains the start of the other
+func overlapsLocalNetworks(ipNet *net.IPNet) bool {
+	for _, localNet := range localNetworks {
+		if localNet.Contains(ipNet.IP) || ipNet.Contains(localNet.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	ipNets := []*net.IPNet{}
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		ipNets = append(ipNets, ipNet)
+	}
+	return ipNets
+}
+
+func singleIPNet(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)} //nolint:gomnd
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)} //nolint:gomnd
+}
+
+// host names only - no schemes, ports or paths
+func isValidHostName(host string) bool {
+	if host == "" || len(host) > 253 { //nolint:gomnd
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 { //nolint:gomnd
+			return false
+		}
+		for _, c := range label {
+			isAlphaNumeric := (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')
+			if !isAlphaNumeric && c != '-' && c != '_' {
+				return false
+			}
+		}
+	}
+	return true
+}
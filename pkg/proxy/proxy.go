@@ -0,0 +1,239 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	errNotAllowed = errors.New("destination is not in the allow list")
+	errLocal      = errors.New("destination is the compute node itself")
+)
+
+// headers that only apply to a single hop and must not be forwarded
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// EgressProxy is an HTTP forward proxy that only lets requests through to
+// the destinations in its allow list. It supports plain HTTP requests and
+// CONNECT tunnels so that HTTPS works without us having to see inside it.
+// Jobs that are only allowed to reach certain hosts are put on a network
+// with no route out and given this proxy as their HTTP_PROXY.
+type EgressProxy struct {
+	allowList AllowList
+	resolver  *net.Resolver
+	dialer    *net.Dialer
+	transport *http.Transport
+	server    *http.Server
+}
+
+func NewEgressProxy(allowList AllowList) *EgressProxy {
+	p := &EgressProxy{
+		allowList: allowList,
+		resolver:  net.DefaultResolver,
+		dialer: &net.Dialer{
+			Timeout:   30 * time.Second, //nolint:gomnd
+			KeepAlive: 30 * time.Second, //nolint:gomnd
+		},
+	}
+	p.transport = &http.Transport{
+		// never chain to whatever proxy the compute node itself uses
+		Proxy:       nil,
+		DialContext: p.dial,
+	}
+	p.server = &http.Server{
+		Handler:           p,
+		ReadHeaderTimeout: 30 * time.Second, //nolint:gomnd
+	}
+	return p
+}
+
+// Start listens on the given address (use port 0 to pick a free one) and
+// returns the address the proxy is listening on.
+func (p *EgressProxy) Start(address string) (string, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return "", fmt.Errorf("egress proxy could not listen on %s: %w", address, err)
+	}
+	go func() {
+		err := p.server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Msgf("egress proxy stopped: %s", err)
+		}
+	}()
+	return listener.Addr().String(), nil
+}
+
+func (p *EgressProxy) Stop() error {
+	p.transport.CloseIdleConnections()
+	return p.server.Close()
+}
+
+func (p *EgressProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.handleConnect(w, r)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "this is a forward proxy, requests must use an absolute url", http.StatusBadRequest)
+		return
+	}
+	p.handleHTTP(w, r)
+}
+
+func (p *EgressProxy) handleConnect(w http.ResponseWriter, r *http.Request) {
+	upstream, err := p.dial(r.Context(), "tcp", r.Host)
+	if err != nil {
+		p.writeDialError(w, r.Host, err)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "connection does not support CONNECT", http.StatusInternalServerError)
+		return
+	}
+	client, _, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+	if err != nil {
+		client.Close()
+		upstream.Close()
+		return
+	}
+
+	// pipe both ways until either side hangs up
+	go func() {
+		defer upstream.Close()
+		defer client.Close()
+		_, _ = io.Copy(upstream, client)
+	}()
+	go func() {
+		defer upstream.Close()
+		defer client.Close()
+		_, _ = io.Copy(client, upstream)
+	}()
+}
+
+func (p *EgressProxy) handleHTTP(w http.ResponseWriter, r *http.Request) {
+	outReq := r.Clone(r.Context())
+	outReq.RequestURI = ""
+	removeHopByHopHeaders(outReq.Header)
+
+	resp, err := p.transport.RoundTrip(outReq)
+	if err != nil {
+		p.writeDialError(w, r.URL.Host, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	removeHopByHopHeaders(resp.Header)
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+// connect to the address if the allow list permits it - we resolve the
+// host ourselves and dial the IP we checked so a second lookup can't send
+// us somewhere else. Addresses on the compute node itself are never dialed
+// (unless the allow list allows local addresses) whatever the name
+// resolved to, otherwise a job could reach the services on the node.
+func (p *EgressProxy) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	hostAllowed := p.allowList.AllowsHostName(host)
+
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := p.resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+
+	nodeIPs, err := nodeAddresses()
+	if err != nil {
+		return nil, err
+	}
+
+	refused := errNotAllowed
+	for _, ip := range ips {
+		if !hostAllowed && !p.allowList.AllowsIP(ip) {
+			continue
+		}
+		if p.allowList.isLocalIP(ip, nodeIPs) {
+			refused = errLocal
+			continue
+		}
+		return p.dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+	}
+	return nil, refused
+}
+
+// the addresses of the compute node's own interfaces
+func nodeAddresses() ([]net.IP, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, fmt.Errorf("egress proxy could not list the node's addresses: %w", err)
+	}
+	ips := []net.IP{}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			ips = append(ips, ipNet.IP)
+		}
+	}
+	return ips, nil
+}
+
+func (p *EgressProxy) writeDialError(w http.ResponseWriter, host string, err error) {
+	if errors.Is(err, errNotAllowed) {
+		log.Debug().Msgf("egress proxy blocked request to %s", host)
+		http.Error(w, fmt.Sprintf("%s is not in the job's network allow list", host), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, errLocal) {
+		log.Warn().Msgf("egress proxy blocked request to %s on the compute node", host)
+		http.Error(w, fmt.Sprintf("%s is on the compute node, jobs cannot reach it", host), http.StatusForbidden)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadGateway)
+}
+
+func removeHopByHopHeaders(header http.Header) {
+	for _, name := range hopByHopHeaders {
+		header.Del(name)
+	}
+}
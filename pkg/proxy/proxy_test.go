@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAllowList(t *testing.T) {
+	allowList, err := ParseAllowList([]string{"pypi.org", "*.example.com", "10.0.0.0/8", "192.168.1.1", " "}, false)
+	require.NoError(t, err)
+
+	require.True(t, allowList.AllowsHostName("pypi.org"))
+	require.True(t, allowList.AllowsHostName("PyPI.org."))
+	require.False(t, allowList.AllowsHostName("files.pypi.org"))
+	require.True(t, allowList.AllowsHostName("a.b.example.com"))
+	require.False(t, allowList.AllowsHostName("example.com"))
+	require.False(t, allowList.AllowsHostName("notexample.com"))
+	require.True(t, allowList.AllowsHostName("10.1.2.3"))
+	require.True(t, allowList.AllowsIP(net.ParseIP("192.168.1.1")))
+	require.False(t, allowList.AllowsIP(net.ParseIP("192.168.1.2")))
+
+	for _, entry := range []string{"http://pypi.org", "pypi.org:443", "*.", "bad host"} {
+		_, err := ParseAllowList([]string{entry}, false)
+		require.Error(t, err, entry)
+	}
+
+	// entries that reach the compute node itself need the operator to allow them
+	for _, entry := range []string{"127.0.0.1", "0.0.0.0/0", "0.0.0.0", "::1", "::/0", "169.254.169.254", "fe80::1", "localhost", "*.localhost"} {
+		_, err := ParseAllowList([]string{entry}, false)
+		require.Error(t, err, entry)
+		_, err = ParseAllowList([]string{entry}, true)
+		require.NoError(t, err, entry)
+	}
+
+	empty, err := ParseAllowList(nil, false)
+	require.NoError(t, err)
+	require.True(t, empty.IsEmpty())
+}
+
+// the test servers listen on loopback, so the proxies allow local addresses
+func startProxy(t *testing.T, entries []string) *url.URL {
+	allowList, err := ParseAllowList(entries, true)
+	require.NoError(t, err)
+	return startProxyWithAllowList(t, allowList)
+}
+
+func startProxyWithAllowList(t *testing.T, allowList AllowList) *url.URL {
+	p := NewEgressProxy(allowList)
+	address, err := p.Start("127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = p.Stop()
+	})
+	return &url.URL{Scheme: "http", Host: address}
+}
+
+func TestEgressProxyHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello from upstream"))
+	}))
+	defer server.Close()
+
+	for _, testCase := range []struct {
+		name     string
+		entries  []string
+		expected int
+	}{
+		{name: "allowed", entries: []string{"127.0.0.1"}, expected: http.StatusOK},
+		{name: "denied", entries: []string{"pypi.org"}, expected: http.StatusForbidden},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			client := &http.Client{
+				Transport: &http.Transport{Proxy: http.ProxyURL(startProxy(t, testCase.entries))},
+			}
+			resp, err := client.Get(server.URL)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, testCase.expected, resp.StatusCode)
+
+			if testCase.expected == http.StatusOK {
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				require.Equal(t, "hello from upstream", string(body))
+			}
+		})
+	}
+}
+
+func TestEgressProxyConnect(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello over tls"))
+	}))
+	defer server.Close()
+
+	newClient := func(proxyURL *url.URL) *http.Client {
+		return &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyURL(proxyURL),
+				//nolint:gosec // the test server uses a self signed certificate
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		}
+	}
+
+	resp, err := newClient(startProxy(t, []string{"127.0.0.0/8"})).Get(server.URL)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, "hello over tls", string(body))
+
+	// a refused CONNECT surfaces as an error from the client
+	_, err = newClient(startProxy(t, []string{"10.0.0.0/8"})).Get(server.URL) //nolint:bodyclose
+	require.Error(t, err)
+}
+
+func TestEgressProxyRefusesLocalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("a service on the compute node"))
+	}))
+	defer server.Close()
+
+	// ParseAllowList refuses these entries, but names can resolve to the
+	// node too, so the proxy has to check what it dials whatever is in the
+	// allow list
+	allowList := AllowList{
+		hosts:    map[string]bool{"localhost": true},
+		networks: []*net.IPNet{singleIPNet(net.ParseIP("127.0.0.1"))},
+	}
+	require.True(t, allowList.AllowsHostName("127.0.0.1"))
+
+	client := &http.Client{
+		Transport: &http.Transport{Proxy: http.ProxyURL(startProxyWithAllowList(t, allowList))},
+	}
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+	for _, host := range []string{"127.0.0.1", "localhost"} {
+		resp, err := client.Get("http://" + net.JoinHostPort(host, port))
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusForbidden, resp.StatusCode, host)
+	}
+}
@@ -268,6 +268,57 @@ func (apiClient *APIClient) Version(ctx context.Context) (*model.VersionInfo, er
 	return res.VersionInfo, nil
 }
 
+// NodeInfo returns the capacity and GPU allocations of the node's compute node.
+func (apiClient *APIClient) NodeInfo(ctx context.Context) (model.ComputeNodeInfo, error) {
+	ctx, span := system.GetTracer().Start(ctx, "pkg/publicapi.NodeInfo")
+	defer span.End()
+
+	req := nodeInfoRequest{
+		ClientID: system.GetClientID(),
+	}
+
+	var res nodeInfoResponse
+	if err := apiClient.post(ctx, "node_info", req, &res); err != nil {
+		return model.ComputeNodeInfo{}, err
+	}
+
+	return res.NodeInfo, nil
+}
+
+// Drain stops the node's compute node from selecting new jobs.
+func (apiClient *APIClient) Drain(ctx context.Context) (model.ComputeNodeDrainStatus, error) {
+	ctx, span := system.GetTracer().Start(ctx, "pkg/publicapi.Drain")
+	defer span.End()
+	return apiClient.drainRequest(ctx, "drain")
+}
+
+// Uncordon lets the node's compute node select new jobs again.
+func (apiClient *APIClient) Uncordon(ctx context.Context) (model.ComputeNodeDrainStatus, error) {
+	ctx, span := system.GetTracer().Start(ctx, "pkg/publicapi.Uncordon")
+	defer span.End()
+	return apiClient.drainRequest(ctx, "uncordon")
+}
+
+// DrainStatus reports how far the node's compute node has got with draining.
+func (apiClient *APIClient) DrainStatus(ctx context.Context) (model.ComputeNodeDrainStatus, error) {
+	ctx, span := system.GetTracer().Start(ctx, "pkg/publicapi.DrainStatus")
+	defer span.End()
+	return apiClient.drainRequest(ctx, "drain_status")
+}
+
+func (apiClient *APIClient) drainRequest(ctx context.Context, api string) (model.ComputeNodeDrainStatus, error) {
+	req := drainRequest{
+		ClientID: system.GetClientID(),
+	}
+
+	var res drainResponse
+	if err := apiClient.post(ctx, api, req, &res); err != nil {
+		return model.ComputeNodeDrainStatus{}, err
+	}
+
+	return res.DrainStatus, nil
+}
+
 func (apiClient *APIClient) post(ctx context.Context, api string, reqData, resData interface{}) error {
 	ctx, span := system.GetTracer().Start(ctx, "pkg/publicapi.post")
 	defer span.End()
@@ -0,0 +1,72 @@
+package publicapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+)
+
+type drainRequest struct {
+	ClientID string `json:"client_id"`
+}
+
+type drainResponse struct {
+	DrainStatus model.ComputeNodeDrainStatus `json:"drain_status"`
+}
+
+// stop the compute node from selecting new jobs
+func (apiServer *APIServer) drain(res http.ResponseWriter, req *http.Request) {
+	ctx, span := system.GetSpanFromRequest(req, "apiServer/drain")
+	defer span.End()
+	apiServer.handleDrainRequest(ctx, res, req, func(ctx context.Context) model.ComputeNodeDrainStatus {
+		return apiServer.ComputeNode.Drain(ctx)
+	})
+}
+
+// let the compute node select new jobs again
+func (apiServer *APIServer) uncordon(res http.ResponseWriter, req *http.Request) {
+	ctx, span := system.GetSpanFromRequest(req, "apiServer/uncordon")
+	defer span.End()
+	apiServer.handleDrainRequest(ctx, res, req, func(ctx context.Context) model.ComputeNodeDrainStatus {
+		return apiServer.ComputeNode.Uncordon(ctx)
+	})
+}
+
+// report how far the compute node has got with draining
+func (apiServer *APIServer) drainStatus(res http.ResponseWriter, req *http.Request) {
+	ctx, span := system.GetSpanFromRequest(req, "apiServer/drainStatus")
+	defer span.End()
+	apiServer.handleDrainRequest(ctx, res, req, func(ctx context.Context) model.ComputeNodeDrainStatus {
+		return apiServer.ComputeNode.GetDrainStatus(ctx)
+	})
+}
+
+func (apiServer *APIServer) handleDrainRequest(
+	ctx context.Context,
+	res http.ResponseWriter,
+	req *http.Request,
+	handler func(ctx context.Context) model.ComputeNodeDrainStatus,
+) {
+	var drainReq drainRequest
+	if err := json.NewDecoder(req.Body).Decode(&drainReq); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if apiServer.ComputeNode == nil {
+		http.Error(res, "this server is not running a compute node", http.StatusNotFound)
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(res).Encode(drainResponse{
+		DrainStatus: handler(ctx),
+	})
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
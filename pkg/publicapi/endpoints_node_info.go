@@ -0,0 +1,42 @@
+package publicapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+)
+
+type nodeInfoRequest struct {
+	ClientID string `json:"client_id"`
+}
+
+type nodeInfoResponse struct {
+	NodeInfo model.ComputeNodeInfo `json:"node_info"`
+}
+
+func (apiServer *APIServer) nodeInfo(res http.ResponseWriter, req *http.Request) {
+	ctx, span := system.GetSpanFromRequest(req, "apiServer/nodeInfo")
+	defer span.End()
+
+	var nodeInfoReq nodeInfoRequest
+	if err := json.NewDecoder(req.Body).Decode(&nodeInfoReq); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if apiServer.ComputeNode == nil {
+		http.Error(res, "this server is not running a compute node", http.StatusNotFound)
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(res).Encode(nodeInfoResponse{
+		NodeInfo: apiServer.ComputeNode.GetNodeInfo(ctx),
+	})
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -94,6 +94,19 @@ func (apiServer *APIServer) submit(res http.ResponseWriter, req *http.Request) {
 		})
 	}
 
+	// Pin the image to a digest so the tag can't move under the job:
+	if apiServer.ImageResolver != nil &&
+		submitReq.Data.Spec.Engine == model.EngineDocker &&
+		submitReq.Data.Spec.Docker.PullPolicy != model.PullNever {
+		image, err := apiServer.ImageResolver.ResolveImageDigest(req.Context(), submitReq.Data.Spec.Docker.Image)
+		if err != nil {
+			log.Debug().Msgf("====> ResolveImageDigest error: %s", err)
+			http.Error(res, fmt.Sprintf("could not resolve image digest: %s", err), http.StatusBadRequest)
+			return
+		}
+		submitReq.Data.Spec.Docker.Image = image
+	}
+
 	j, err := apiServer.Controller.SubmitJob(
 		req.Context(),
 		submitReq.Data,
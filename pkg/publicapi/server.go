@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 
 	"github.com/didip/tollbooth"
 	"github.com/didip/tollbooth/limiter"
+	"github.com/filecoin-project/bacalhau/pkg/computenode"
 	"github.com/filecoin-project/bacalhau/pkg/controller"
 	"github.com/filecoin-project/bacalhau/pkg/model"
 	"github.com/filecoin-project/bacalhau/pkg/publisher"
@@ -23,11 +25,21 @@ import (
 
 // APIServer configures a node's public REST API.
 type APIServer struct {
-	Controller  *controller.Controller
+	Controller *controller.Controller
+	// the compute node running alongside this server, if any
+	ComputeNode *computenode.ComputeNode
 	Publishers  map[model.PublisherType]publisher.Publisher
-	Host        string
-	Port        int
-	componentMu sync.Mutex
+	// pins the images of submitted docker jobs to digests, if set
+	ImageResolver ImageResolver
+	Host          string
+	Port          int
+	componentMu   sync.Mutex
+}
+
+// ImageResolver finds out the digest an image tag points to right now so
+// every shard and verifier replica of a job runs exactly the same image.
+type ImageResolver interface {
+	ResolveImageDigest(ctx context.Context, image string) (string, error)
 }
 
 func init() { //nolint:gochecknoinits
@@ -46,13 +58,15 @@ func NewServer(
 	host string,
 	port int,
 	c *controller.Controller,
+	computeNode *computenode.ComputeNode,
 	publishers map[model.PublisherType]publisher.Publisher,
 ) *APIServer {
 	a := &APIServer{
-		Controller: c,
-		Publishers: publishers,
-		Host:       host,
-		Port:       port,
+		Controller:  c,
+		ComputeNode: computeNode,
+		Publishers:  publishers,
+		Host:        host,
+		Port:        port,
 	}
 	a.componentMu.EnableTracerWithOpts(sync.Opts{
 		Threshold: 10 * time.Millisecond,
@@ -89,6 +103,10 @@ func (apiServer *APIServer) ListenAndServe(ctx context.Context, cm *system.Clean
 	sm.Handle("/peers", throttle(instrument("peers", apiServer.peers)))
 	sm.Handle("/submit", throttle(instrument("submit", apiServer.submit)))
 	sm.Handle("/version", throttle(instrument("version", apiServer.version)))
+	sm.Handle("/node_info", throttle(instrument("node_info", apiServer.nodeInfo)))
+	sm.Handle("/drain", throttle(localOnly(instrument("drain", apiServer.drain))))
+	sm.Handle("/uncordon", throttle(localOnly(instrument("uncordon", apiServer.uncordon))))
+	sm.Handle("/drain_status", throttle(instrument("drain_status", apiServer.drainStatus)))
 	sm.Handle("/healthz", throttle(instrument("healthz", apiServer.healthz)))
 	sm.Handle("/logz", throttle(instrument("logz", apiServer.logz)))
 	sm.Handle("/varz", throttle(instrument("varz", apiServer.varz)))
@@ -177,6 +195,21 @@ func verifySubmitRequest(req *submitRequest) error {
 	return nil
 }
 
+// localOnly only lets requests made on the node itself through to h, for
+// endpoints that change how the node behaves rather than submit work to it
+func localOnly(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		host, _, err := net.SplitHostPort(req.RemoteAddr)
+		ip := net.ParseIP(host)
+		// a proxy on the node would make every request look local
+		if err != nil || ip == nil || !ip.IsLoopback() || req.Header.Get("X-Forwarded-For") != "" {
+			http.Error(res, "this endpoint can only be used from the node itself", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(res, req)
+	})
+}
+
 func instrument(name string, fn http.HandlerFunc) http.Handler {
 	return otelhttp.NewHandler(fn, fmt.Sprintf("pkg/publicapi/%s", name))
 }
@@ -5,8 +5,13 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/filecoin-project/bacalhau/pkg/capacitymanager"
+	"github.com/filecoin-project/bacalhau/pkg/computenode"
+	noop_executor "github.com/filecoin-project/bacalhau/pkg/executor/noop"
 	"github.com/filecoin-project/bacalhau/pkg/model"
 	"github.com/filecoin-project/bacalhau/pkg/types"
 	"github.com/stretchr/testify/require"
@@ -134,3 +139,85 @@ func testEndpoint(t *testing.T, endpoint string, contentToCheck string) []byte {
 	require.Contains(t, string(body), contentToCheck, "%s body does not contain '%s'.", endpoint, contentToCheck)
 	return body
 }
+
+func (suite *ServerSuite) TestLocalOnly() {
+	handler := localOnly(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	}))
+	testCases := []struct {
+		remoteAddr string
+		forwarded  string
+		expected   int
+	}{
+		{remoteAddr: "127.0.0.1:1234", expected: http.StatusOK},
+		{remoteAddr: "[::1]:1234", expected: http.StatusOK},
+		{remoteAddr: "10.0.0.1:1234", expected: http.StatusForbidden},
+		{remoteAddr: "127.0.0.1:1234", forwarded: "10.0.0.1", expected: http.StatusForbidden},
+	}
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodPost, "/drain", nil)
+		req.RemoteAddr = testCase.remoteAddr
+		if testCase.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", testCase.forwarded)
+		}
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		require.Equal(suite.T(), testCase.expected, res.Code, testCase.remoteAddr)
+	}
+}
+
+func (suite *ServerSuite) TestNodeInfoGPUAllocations() {
+	ctx := context.Background()
+	started := make(chan model.JobShard, 1)
+	finish := make(chan struct{})
+	c, cm := SetupTestsWithComputeNode(suite.T(), computenode.ComputeNodeConfig{
+		CapacityManagerConfig: capacitymanager.Config{
+			ResourceLimitTotal: model.ResourceUsageConfig{
+				CPU:    "1",
+				Memory: "1gb",
+			},
+			GPUDevices: []string{"GPU-a", "GPU-b"},
+		},
+	}, noop_executor.ExecutorConfig{
+		ExternalHooks: noop_executor.ExecutorConfigExternalHooks{
+			JobHandler: func(ctx context.Context, shard model.JobShard, resultsDir string) error {
+				started <- shard
+				<-finish
+				return nil
+			},
+		},
+	})
+	defer cm.Cleanup()
+
+	info, err := c.NodeInfo(ctx)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), []string{"GPU-a", "GPU-b"}, info.GPUDevices)
+	require.Empty(suite.T(), info.GPUAllocations)
+	require.Equal(suite.T(), uint64(2), info.TotalCapacity.GPU)
+
+	spec, deal := MakeNoopJob()
+	spec.Resources = model.ResourceUsageConfig{CPU: "100m", Memory: "100mb", GPU: "1"}
+	_, err = c.Submit(ctx, spec, deal, nil)
+	require.NoError(suite.T(), err)
+
+	var shard model.JobShard
+	select {
+	case shard = <-started:
+	case <-time.After(10 * time.Second):
+		require.Fail(suite.T(), "the job did not start")
+	}
+
+	// the running shard has one of the devices to itself
+	info, err = c.NodeInfo(ctx)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), info.GPUAllocations, 1)
+	require.Len(suite.T(), info.GPUAllocations[shard.ID()], 1)
+	require.Contains(suite.T(), info.GPUDevices, info.GPUAllocations[shard.ID()][0])
+
+	// and gives it back when it finishes
+	close(finish)
+	require.Eventually(suite.T(), func() bool {
+		info, err = c.NodeInfo(ctx)
+		return err == nil && len(info.GPUAllocations) == 0
+	}, 10*time.Second, 50*time.Millisecond)
+}
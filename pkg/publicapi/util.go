@@ -9,7 +9,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/filecoin-project/bacalhau/pkg/computenode"
 	"github.com/filecoin-project/bacalhau/pkg/controller"
+	noop_executor "github.com/filecoin-project/bacalhau/pkg/executor/noop"
 	"github.com/filecoin-project/bacalhau/pkg/executor/util"
 	"github.com/filecoin-project/bacalhau/pkg/localdb/inmemory"
 	"github.com/filecoin-project/bacalhau/pkg/model"
@@ -31,6 +33,24 @@ const TimeToWaitForHealthy = 50
 
 // SetupTests sets up a client for a requester node's API server, for testing.
 func SetupTests(t *testing.T) (*APIClient, *system.CleanupManager) {
+	return setupTests(t, nil, noop_executor.ExecutorConfig{})
+}
+
+// SetupTestsWithComputeNode is SetupTests for a server that also runs a
+// compute node with the given config, whose jobs run on noop executors.
+func SetupTestsWithComputeNode(
+	t *testing.T,
+	computeNodeConfig computenode.ComputeNodeConfig,
+	executorConfig noop_executor.ExecutorConfig,
+) (*APIClient, *system.CleanupManager) {
+	return setupTests(t, &computeNodeConfig, executorConfig)
+}
+
+func setupTests(
+	t *testing.T,
+	computeNodeConfig *computenode.ComputeNodeConfig,
+	executorConfig noop_executor.ExecutorConfig,
+) (*APIClient, *system.CleanupManager) {
 	err := system.InitConfigForTesting()
 	require.NoError(t, err)
 
@@ -80,11 +100,30 @@ func SetupTests(t *testing.T) (*APIClient, *system.CleanupManager) {
 	)
 	require.NoError(t, err)
 
+	var computeNode *computenode.ComputeNode
+	if computeNodeConfig != nil {
+		noopExecutors, err := util.NewNoopExecutors(ctx, cm, executorConfig)
+		require.NoError(t, err)
+		computeNode, err = computenode.NewComputeNode(
+			ctx,
+			cm,
+			c,
+			noopExecutors,
+			noopVerifiers,
+			noopPublishers,
+			*computeNodeConfig,
+		)
+		require.NoError(t, err)
+		// the compute node only hears about jobs once the transport is going
+		err = c.Start(ctx)
+		require.NoError(t, err)
+	}
+
 	host := "0.0.0.0"
 	port, err := freeport.GetFreePort()
 	require.NoError(t, err)
 
-	s := NewServer(ctx, host, port, c, noopPublishers)
+	s := NewServer(ctx, host, port, c, computeNode, noopPublishers)
 	cl := NewAPIClient(s.GetURI())
 	go func() {
 		require.NoError(t, s.ListenAndServe(context.Background(), cm))
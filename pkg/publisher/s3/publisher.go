@@ -0,0 +1,107 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/filecoin-project/bacalhau/pkg/job"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/publisher"
+	s3storage "github.com/filecoin-project/bacalhau/pkg/storage/s3"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type S3PublisherConfig struct {
+	// the service and credentials of the compute node - the bucket comes
+	// from the job spec and has to be one the config allows
+	Client s3storage.ClientConfig
+}
+
+type S3Publisher struct {
+	StateResolver *job.StateResolver
+	Client        *s3storage.Client
+	config        s3storage.ClientConfig
+}
+
+func NewS3Publisher(
+	cm *system.CleanupManager,
+	resolver *job.StateResolver,
+	config S3PublisherConfig,
+) (*S3Publisher, error) {
+	return &S3Publisher{
+		StateResolver: resolver,
+		Client:        s3storage.NewClient(config.Client),
+		config:        config.Client,
+	}, nil
+}
+
+// IsInstalled is whether the node has credentials to publish with.
+func (s3Publisher *S3Publisher) IsInstalled(ctx context.Context) (bool, error) {
+	return s3Publisher.config.HasCredentials(), nil
+}
+
+func (s3Publisher *S3Publisher) PublishShardResult(
+	ctx context.Context,
+	shard model.JobShard,
+	hostID string,
+	shardResultPath string,
+) (model.StorageSpec, error) {
+	ctx, span := newSpan(ctx, "PublishShardResult")
+	defer span.End()
+
+	target := shard.Job.Spec.S3Publisher
+	if target.Bucket == "" {
+		return model.StorageSpec{}, fmt.Errorf("job %s has no bucket to publish to", shard.Job.ID)
+	}
+	if err := s3Publisher.config.CheckBucket(target.Bucket); err != nil {
+		return model.StorageSpec{}, err
+	}
+	prefix := GetShardPrefix(target.Prefix, shard, hostID)
+	err := s3Publisher.Client.UploadFolder(ctx, target.Bucket, prefix, shardResultPath)
+	if err != nil {
+		return model.StorageSpec{}, err
+	}
+	return model.StorageSpec{
+		Name:   fmt.Sprintf("job-%s-shard-%d-host-%s", shard.Job.ID, shard.Index, hostID),
+		Engine: model.StorageSourceS3,
+		URL:    s3storage.FormatURL(target.Bucket, prefix),
+	}, nil
+}
+
+func (s3Publisher *S3Publisher) ComposeResultReferences(
+	ctx context.Context,
+	jobID string,
+) ([]model.StorageSpec, error) {
+	ctx, span := newSpan(ctx, "ComposeResultReferences")
+	defer span.End()
+
+	system.AddJobIDFromBaggageToSpan(ctx, span)
+
+	results := []model.StorageSpec{}
+	shardResults, err := s3Publisher.StateResolver.GetResults(ctx, jobID)
+	if err != nil {
+		return results, err
+	}
+	for _, shardResult := range shardResults {
+		results = append(results, shardResult.Results)
+	}
+	return results, nil
+}
+
+// GetShardPrefix is where the results of a shard run by a node go:
+// <prefix>/<job id>/shard-<index>/<node id>/
+func GetShardPrefix(prefix string, shard model.JobShard, hostID string) string {
+	shardPrefix := path.Join(prefix, shard.Job.ID, fmt.Sprintf("shard-%d", shard.Index), hostID)
+	// keys don't start with a slash
+	return strings.TrimPrefix(shardPrefix, "/") + "/"
+}
+
+func newSpan(ctx context.Context, apiName string) (context.Context, trace.Span) {
+	return system.Span(ctx, "publisher/s3", apiName)
+}
+
+// Compile-time check that publisher implements the correct interface:
+var _ publisher.Publisher = (*S3Publisher)(nil)
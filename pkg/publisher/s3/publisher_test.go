@@ -0,0 +1,127 @@
+package s3
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	s3storage "github.com/filecoin-project/bacalhau/pkg/storage/s3"
+	"github.com/filecoin-project/bacalhau/pkg/storage/s3/s3test"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishShardResult(t *testing.T) {
+	ctx := context.Background()
+	server := s3test.NewServer()
+	defer server.Close()
+
+	cm := system.NewCleanupManager()
+	defer cm.Cleanup()
+	publisher, err := NewS3Publisher(cm, nil, S3PublisherConfig{
+		Client: s3storage.ClientConfig{
+			Endpoint:        server.URL,
+			AccessKeyID:     "access",
+			SecretAccessKey: "secret",
+			Buckets:         []string{"results"},
+		},
+	})
+	require.NoError(t, err)
+	installed, err := publisher.IsInstalled(ctx)
+	require.NoError(t, err)
+	require.True(t, installed)
+
+	resultsDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(resultsDir, "stdout"), []byte("hello"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(resultsDir, "exitCode"), []byte("0"), 0600))
+	require.NoError(t, os.MkdirAll(filepath.Join(resultsDir, "outputs", "nested"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(resultsDir, "outputs", "nested", "data.csv"), []byte("a,b"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(resultsDir, "outputs", "empty"), []byte{}, 0600))
+
+	shard := model.JobShard{
+		Job: model.Job{
+			ID: "job-id",
+			Spec: model.JobSpec{
+				Publisher:   model.PublisherS3,
+				S3Publisher: model.JobSpecS3Publisher{Bucket: "results", Prefix: "/team/"},
+			},
+		},
+		Index: 2,
+	}
+	spec, err := publisher.PublishShardResult(ctx, shard, "node-id", resultsDir)
+	require.NoError(t, err)
+	require.Equal(t, model.StorageSourceS3, spec.Engine)
+	require.Equal(t, "job-job-id-shard-2-host-node-id", spec.Name)
+	require.Equal(t, "s3://results/team/job-id/shard-2/node-id/", spec.URL)
+	require.Equal(t, []string{
+		"team/job-id/shard-2/node-id/exitCode",
+		"team/job-id/shard-2/node-id/outputs/empty",
+		"team/job-id/shard-2/node-id/outputs/nested/data.csv",
+		"team/job-id/shard-2/node-id/stdout",
+	}, server.Keys("results"))
+
+	// and what bacalhau get does to download them again
+	bucket, prefix, err := s3storage.ParseURL(spec.URL)
+	require.NoError(t, err)
+	downloadDir := t.TempDir()
+	require.NoError(t, publisher.Client.DownloadFolder(ctx, bucket, prefix, downloadDir))
+	contents, err := os.ReadFile(filepath.Join(downloadDir, "outputs", "nested", "data.csv"))
+	require.NoError(t, err)
+	require.Equal(t, "a,b", string(contents))
+	contents, err = os.ReadFile(filepath.Join(downloadDir, "stdout"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(contents))
+}
+
+func TestPublishShardResultNeedsBucket(t *testing.T) {
+	cm := system.NewCleanupManager()
+	defer cm.Cleanup()
+	publisher, err := NewS3Publisher(cm, nil, S3PublisherConfig{})
+	require.NoError(t, err)
+
+	shard := model.JobShard{Job: model.Job{ID: "job-id"}}
+	_, err = publisher.PublishShardResult(context.Background(), shard, "node-id", t.TempDir())
+	require.Error(t, err)
+}
+
+func TestPublishShardResultOnlyToAllowedBuckets(t *testing.T) {
+	ctx := context.Background()
+	server := s3test.NewServer()
+	defer server.Close()
+
+	cm := system.NewCleanupManager()
+	defer cm.Cleanup()
+	publisher, err := NewS3Publisher(cm, nil, S3PublisherConfig{
+		Client: s3storage.ClientConfig{
+			Endpoint:        server.URL,
+			AccessKeyID:     "access",
+			SecretAccessKey: "secret",
+			Buckets:         []string{"results"},
+		},
+	})
+	require.NoError(t, err)
+
+	shard := model.JobShard{
+		Job: model.Job{
+			ID:   "job-id",
+			Spec: model.JobSpec{S3Publisher: model.JobSpecS3Publisher{Bucket: "someone-elses"}},
+		},
+	}
+	_, err = publisher.PublishShardResult(ctx, shard, "node-id", t.TempDir())
+	require.Error(t, err)
+	require.Empty(t, server.Keys("someone-elses"))
+}
+
+func TestNotInstalledWithoutCredentials(t *testing.T) {
+	cm := system.NewCleanupManager()
+	defer cm.Cleanup()
+	publisher, err := NewS3Publisher(cm, nil, S3PublisherConfig{
+		Client: s3storage.ClientConfig{Buckets: []string{"*"}},
+	})
+	require.NoError(t, err)
+	installed, err := publisher.IsInstalled(context.Background())
+	require.NoError(t, err)
+	require.False(t, installed)
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/filecoin-project/bacalhau/pkg/publisher/estuary"
 	"github.com/filecoin-project/bacalhau/pkg/publisher/ipfs"
 	"github.com/filecoin-project/bacalhau/pkg/publisher/noop"
+	"github.com/filecoin-project/bacalhau/pkg/publisher/s3"
+	s3storage "github.com/filecoin-project/bacalhau/pkg/storage/s3"
 	"github.com/filecoin-project/bacalhau/pkg/system"
 )
 
@@ -18,6 +20,7 @@ func NewIPFSPublishers(
 	resolver *job.StateResolver,
 	ipfsMultiAddress string,
 	estuaryAPIKey string,
+	s3Config s3storage.ClientConfig,
 ) (map[model.PublisherType]publisher.Publisher, error) {
 	noopPublisher, err := noop.NewNoopPublisher(ctx, cm, resolver)
 	if err != nil {
@@ -41,10 +44,18 @@ func NewIPFSPublishers(
 		}
 	}
 
+	s3Publisher, err := s3.NewS3Publisher(cm, resolver, s3.S3PublisherConfig{
+		Client: s3Config,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	return map[model.PublisherType]publisher.Publisher{
 		model.PublisherNoop:    noopPublisher,
 		model.PublisherIpfs:    ipfsPublisher,
 		model.PublisherEstuary: estuaryPublisher,
+		model.PublisherS3:      s3Publisher,
 	}, nil
 }
 
@@ -51,6 +51,8 @@ func getLocalShardEvents(
 }
 
 // these are the bids we have heard about
+// bids that the compute node has since cancelled (e.g. because it is
+// draining) are left out so we never accept them
 func getGlobalShardBidEvents(
 	ctx context.Context,
 	controller *controller.Controller,
@@ -61,15 +63,43 @@ func getGlobalShardBidEvents(
 	if err != nil {
 		return nil, err
 	}
+	cancelledNodes := map[string]bool{}
+	for _, globalEvent := range globalEvents { //nolint:gocritic
+		if globalEvent.EventName == model.JobEventBidCancelled && globalEvent.ShardIndex == shardIndex {
+			cancelledNodes[globalEvent.SourceNodeID] = true
+		}
+	}
 	shardGlobalEvents := []model.JobEvent{}
 	for _, globalEvent := range globalEvents { //nolint:gocritic
-		if globalEvent.EventName == model.JobEventBid && globalEvent.ShardIndex == shardIndex {
+		if globalEvent.EventName == model.JobEventBid && globalEvent.ShardIndex == shardIndex &&
+			!cancelledNodes[globalEvent.SourceNodeID] {
 			shardGlobalEvents = append(shardGlobalEvents, globalEvent)
 		}
 	}
 	return shardGlobalEvents, nil
 }
 
+// the nodes a shard has been taken off because they stopped sending
+// heartbeats - the bids we accepted from them no longer count
+func getRescheduledNodes(
+	ctx context.Context,
+	controller *controller.Controller,
+	jobID string,
+	shardIndex int,
+) (map[string]bool, error) {
+	globalEvents, err := controller.GetJobEvents(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	rescheduledNodes := map[string]bool{}
+	for _, globalEvent := range globalEvents { //nolint:gocritic
+		if globalEvent.EventName == model.JobEventRescheduled && globalEvent.ShardIndex == shardIndex {
+			rescheduledNodes[globalEvent.TargetNodeID] = true
+		}
+	}
+	return rescheduledNodes, nil
+}
+
 // filter the global bid events down to ones
 // we've not responded to yet
 // all these lists of events are already filtered down to the shard level
@@ -134,6 +164,19 @@ func processIncomingBid(
 	// from the global bids we've heard, filter out the ones we've already responded to
 	candidateBids := getCandidateBids(ctx, bidsHeard, bidsAccepted, bidsRejected)
 
+	// the shard has been taken off these nodes so there is room for
+	// another one to run it
+	rescheduledNodes, err := getRescheduledNodes(ctx, controller, job.ID, jobEvent.ShardIndex)
+	if err != nil {
+		return nil, err
+	}
+	runningBids := []model.JobLocalEvent{}
+	for _, bidAccepted := range bidsAccepted {
+		if !rescheduledNodes[bidAccepted.TargetNodeID] {
+			runningBids = append(runningBids, bidAccepted)
+		}
+	}
+
 	results := []bidQueueResult{}
 	minBids := job.Deal.MinBids
 	concurrency := job.Deal.Concurrency
@@ -167,7 +210,7 @@ func processIncomingBid(
 		results = []bidQueueResult{
 			{
 				nodeID:   jobEvent.SourceNodeID,
-				accepted: len(bidsAccepted) < concurrency,
+				accepted: len(runningBids) < concurrency,
 			},
 		}
 		return results, nil
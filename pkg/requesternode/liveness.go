@@ -0,0 +1,72 @@
+package requesternode
+
+import (
+	"time"
+
+	sync "github.com/lukemarsden/golang-mutex-tracer"
+)
+
+// a shard running on a particular compute node
+type shardLivenessKey struct {
+	jobID      string
+	nodeID     string
+	shardIndex int
+}
+
+// shardLivenessTracker remembers when we last heard from each compute node
+// about each shard we have accepted its bid for, so we can notice when a
+// node has gone away in the middle of running a shard.
+type shardLivenessTracker struct {
+	lastSeen map[shardLivenessKey]time.Time
+	mu       sync.Mutex
+}
+
+func newShardLivenessTracker() *shardLivenessTracker {
+	tracker := &shardLivenessTracker{
+		lastSeen: map[shardLivenessKey]time.Time{},
+	}
+	tracker.mu.EnableTracerWithOpts(sync.Opts{
+		Threshold: 10 * time.Millisecond,
+		Id:        "RequesterNode.shardLivenessTracker.mu",
+	})
+	return tracker
+}
+
+// start tracking a shard from now
+func (t *shardLivenessTracker) track(key shardLivenessKey) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastSeen[key] = time.Now()
+}
+
+// record a heartbeat for a shard we are already tracking - late heartbeats
+// for shards that have finished are ignored
+func (t *shardLivenessTracker) heartbeat(key shardLivenessKey) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.lastSeen[key]; ok {
+		t.lastSeen[key] = time.Now()
+	}
+}
+
+// stop tracking a shard because the compute node has finished with it
+func (t *shardLivenessTracker) forget(key shardLivenessKey) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.lastSeen, key)
+}
+
+// return (and stop tracking) every shard we've not heard about for
+// longer than the given timeout
+func (t *shardLivenessTracker) expired(timeout time.Duration) []shardLivenessKey {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ret := []shardLivenessKey{}
+	for key, lastSeen := range t.lastSeen {
+		if time.Since(lastSeen) > timeout {
+			ret = append(ret, key)
+			delete(t.lastSeen, key)
+		}
+	}
+	return ret
+}
@@ -17,13 +17,22 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
-type RequesterNodeConfig struct{}
+const DefaultShardHeartbeatTimeout = 60 * time.Second
+const LivenessCheckIntervalMillis = 1000
+
+type RequesterNodeConfig struct {
+	// how long we wait without hearing from a compute node about a shard
+	// it is running before we reschedule the shard (or mark it failed if
+	// no other node can take it) - zero means DefaultShardHeartbeatTimeout
+	ShardHeartbeatTimeout time.Duration
+}
 
 type RequesterNode struct {
 	id             string
 	config         RequesterNodeConfig //nolint:gocritic
 	controller     *controller.Controller
 	verifiers      map[model.VerifierType]verifier.Verifier
+	liveness       *shardLivenessTracker
 	componentMutex sync.Mutex
 	bidMutex       sync.Mutex
 	verifyMutex    sync.Mutex
@@ -43,6 +52,7 @@ func NewRequesterNode(
 		config:     config,
 		controller: c,
 		verifiers:  verifiers,
+		liveness:   newShardLivenessTracker(),
 	}
 	requesterNode.bidMutex.EnableTracerWithOpts(sync.Opts{
 		Threshold: 10 * time.Millisecond,
@@ -54,10 +64,110 @@ func NewRequesterNode(
 	})
 
 	requesterNode.subscriptionSetup()
+	go requesterNode.livenessLoopSetup(ctx, cm)
 
 	return requesterNode, nil
 }
 
+/*
+liveness
+*/
+func (node *RequesterNode) livenessLoopSetup(ctx context.Context, cm *system.CleanupManager) {
+	ticker := time.NewTicker(time.Millisecond * LivenessCheckIntervalMillis)
+	ctx, cancelFunction := context.WithCancel(ctx)
+	cm.RegisterCallback(func() error {
+		cancelFunction()
+		return nil
+	})
+
+	for {
+		select {
+		case <-ticker.C:
+			node.livenessLoopCheckHeartbeats(ctx)
+		case <-ctx.Done():
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+// take every shard whose compute node has stopped sending heartbeats off
+// that node so another node can bid to run it (jobs that checkpoint carry
+// on from their latest checkpoint) - if no other node could take it the
+// shard is marked failed so the job doesn't sit in running forever
+func (node *RequesterNode) livenessLoopCheckHeartbeats(ctx context.Context) {
+	timeout := node.config.ShardHeartbeatTimeout
+	if timeout <= 0 {
+		timeout = DefaultShardHeartbeatTimeout
+	}
+	for _, key := range node.liveness.expired(timeout) {
+		status := fmt.Sprintf("no heartbeat from node %s for %s", key.nodeID, timeout)
+
+		canReschedule, err := node.canRescheduleShard(ctx, key)
+		if err != nil {
+			log.Error().Msgf("could not check where shard %s:%d can be rescheduled: %s", key.jobID, key.shardIndex, err.Error())
+		}
+		if canReschedule {
+			log.Warn().Msgf(
+				"Requester node %s has not heard from node %s about shard %s:%d for %s - rescheduling it",
+				node.id, key.nodeID, key.jobID, key.shardIndex, timeout,
+			)
+			err = node.controller.RescheduleShard(ctx, key.jobID, key.nodeID, key.shardIndex, status)
+			if err != nil {
+				log.Error().Msgf("RescheduleShard failed: %s", err.Error())
+			}
+			continue
+		}
+
+		log.Warn().Msgf(
+			"Requester node %s has not heard from node %s about shard %s:%d for %s - marking it failed",
+			node.id, key.nodeID, key.jobID, key.shardIndex, timeout,
+		)
+		err = node.controller.ShardHeartbeatTimeout(
+			ctx,
+			key.jobID,
+			key.nodeID,
+			key.shardIndex,
+			status,
+		)
+		if err != nil {
+			log.Error().Msgf("ShardHeartbeatTimeout failed: %s", err.Error())
+		}
+	}
+}
+
+// a shard can be rescheduled if another compute node has bid on it that
+// we haven't given it to (the node that went quiet included) and haven't
+// already taken it off
+func (node *RequesterNode) canRescheduleShard(ctx context.Context, key shardLivenessKey) (bool, error) {
+	bids, err := getGlobalShardBidEvents(ctx, node.controller, key.jobID, key.shardIndex)
+	if err != nil {
+		return false, err
+	}
+	localEvents, err := getLocalShardEvents(ctx, node.controller, key.jobID, key.shardIndex)
+	if err != nil {
+		return false, err
+	}
+	rescheduledNodes, err := getRescheduledNodes(ctx, node.controller, key.jobID, key.shardIndex)
+	if err != nil {
+		return false, err
+	}
+
+	excludedNodes := map[string]bool{key.nodeID: true}
+	for nodeID := range rescheduledNodes {
+		excludedNodes[nodeID] = true
+	}
+	for _, bidAccepted := range filterLocalEvents(ctx, localEvents, model.JobLocalEventBidAccepted) {
+		excludedNodes[bidAccepted.TargetNodeID] = true
+	}
+	for _, bid := range bids { //nolint:gocritic
+		if !excludedNodes[bid.SourceNodeID] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 /*
 subscriptions
 */
@@ -72,6 +182,7 @@ func (node *RequesterNode) subscriptionSetup() {
 		if job.RequesterNodeID != node.id {
 			return
 		}
+		node.updateLiveness(jobEvent)
 		switch jobEvent.EventName {
 		case model.JobEventBid:
 			node.subscriptionEventBid(ctx, job, jobEvent)
@@ -83,6 +194,36 @@ func (node *RequesterNode) subscriptionSetup() {
 	})
 }
 
+// keep track of which compute nodes are running which shards and when we
+// last heard from them
+func (node *RequesterNode) updateLiveness(jobEvent model.JobEvent) {
+	switch jobEvent.EventName {
+	case model.JobEventBidAccepted:
+		node.liveness.track(shardLivenessKey{
+			jobID:      jobEvent.JobID,
+			nodeID:     jobEvent.TargetNodeID,
+			shardIndex: jobEvent.ShardIndex,
+		})
+	case model.JobEventRunning:
+		node.liveness.heartbeat(shardLivenessKey{
+			jobID:      jobEvent.JobID,
+			nodeID:     jobEvent.SourceNodeID,
+			shardIndex: jobEvent.ShardIndex,
+		})
+	case model.JobEventResultsProposed, model.JobEventError, model.JobEventBidCancelled:
+		// errors we raise on a node's behalf target that node
+		nodeID := jobEvent.SourceNodeID
+		if jobEvent.TargetNodeID != "" {
+			nodeID = jobEvent.TargetNodeID
+		}
+		node.liveness.forget(shardLivenessKey{
+			jobID:      jobEvent.JobID,
+			nodeID:     nodeID,
+			shardIndex: jobEvent.ShardIndex,
+		})
+	}
+}
+
 func (node *RequesterNode) subscriptionEventBid(
 	ctx context.Context,
 	job model.Job,
@@ -0,0 +1,322 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/filecoin-project/bacalhau/pkg/storage/util"
+)
+
+// Limits stops an archive from filling the disk when it is extracted.
+type Limits struct {
+	// how many bytes the extracted files can add up to
+	MaxSize uint64
+	// how many files and folders the archive can have
+	MaxFiles int
+}
+
+// a file, folder or link in an archive
+type member struct {
+	name     string
+	dir      bool
+	size     uint64
+	linkname string
+	// symlink, or hard link if not
+	symlink bool
+	mode    os.FileMode
+	open    func() (io.ReadCloser, error)
+}
+
+// walk calls fn for each member of the archive in order - the format is
+// worked out from the first bytes of the file
+func walk(archivePath string, fn func(member) error) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("only files can be extracted but %s is not one", archivePath)
+	}
+
+	reader := bufio.NewReader(file)
+	magic, _ := reader.Peek(512) //nolint:gomnd // a tar header
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		return walkZip(file, info.Size(), fn)
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		return walkTar(gzipReader, fn)
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return walkTar(bzip2.NewReader(reader), fn)
+	case len(magic) >= 262 && string(magic[257:262]) == "ustar":
+		return walkTar(reader, fn)
+	default:
+		return fmt.Errorf("%s is not a tar, tar.gz, tar.bz2 or zip archive", filepath.Base(archivePath))
+	}
+}
+
+func walkTar(reader io.Reader, fn func(member) error) error {
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		m := member{
+			name:     header.Name,
+			mode:     header.FileInfo().Mode(),
+			linkname: header.Linkname,
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			m.dir = true
+		case tar.TypeReg, tar.TypeRegA: //nolint:staticcheck // old archives still use it
+			m.size = uint64(header.Size)
+			m.open = func() (io.ReadCloser, error) { return io.NopCloser(tarReader), nil }
+		case tar.TypeSymlink:
+			m.symlink = true
+		case tar.TypeLink:
+		default:
+			// devices, fifos and the like have no place in a dataset
+			continue
+		}
+		if err = fn(m); err != nil {
+			return err
+		}
+	}
+}
+
+func walkZip(file *os.File, size int64, fn func(member) error) error {
+	zipReader, err := zip.NewReader(file, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zipReader.File {
+		f := f
+		m := member{
+			name: f.Name,
+			mode: f.Mode(),
+			dir:  f.FileInfo().IsDir(),
+		}
+		switch {
+		case m.dir:
+		case f.Mode()&os.ModeSymlink != 0:
+			// the target of a zip symlink is its content
+			target, err := readZipLink(f)
+			if err != nil {
+				return err
+			}
+			m.symlink = true
+			m.linkname = target
+		case f.Mode().IsRegular():
+			m.size = f.UncompressedSize64
+			m.open = func() (io.ReadCloser, error) { return f.Open() }
+		default:
+			continue
+		}
+		if err = fn(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readZipLink(f *zip.File) (string, error) {
+	reader, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	target, err := io.ReadAll(io.LimitReader(reader, 4096)) //nolint:gomnd // longer than any real path
+	return string(target), err
+}
+
+// cleanName turns the name of a member into a relative slash separated path
+// that can't leave the folder it is extracted into, or "" for the root
+func cleanName(name string) (string, error) {
+	cleaned := path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+	if strings.Contains(name, "\x00") {
+		return "", fmt.Errorf("invalid archive member name: %q", name)
+	}
+	// path.Clean of an absolute path has already removed any ..
+	return strings.TrimPrefix(cleaned, "/"), nil
+}
+
+// list returns the paths of the files and folders in the archive, including
+// the folders that only exist as the parents of files
+func list(archivePath string, limits Limits) ([]string, error) {
+	seen := map[string]bool{}
+	err := walk(archivePath, func(m member) error {
+		name, err := cleanName(m.name)
+		if err != nil || name == "" {
+			return err
+		}
+		for parent := name; parent != "."; parent = path.Dir(parent) {
+			seen[parent] = true
+		}
+		if limits.MaxFiles > 0 && len(seen) > limits.MaxFiles {
+			return fmt.Errorf("archive has more than %d files", limits.MaxFiles)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// extract writes the members of the archive at or under prefix to target -
+// all of them if prefix is empty
+func extract(archivePath, target, prefix string, limits Limits) error {
+	err := extractMembers(archivePath, target, prefix, limits)
+	if err != nil {
+		return err
+	}
+	if _, err = os.Lstat(target); os.IsNotExist(err) {
+		// nothing was extracted
+		return nil
+	}
+	// a link can stay in the archive on its own but leave it once the links
+	// it goes through are followed, which we can only tell once they are all
+	// on disk
+	return util.RemoveEscapingLinks(target)
+}
+
+func extractMembers(archivePath, target, prefix string, limits Limits) error {
+	var size uint64
+	var files int
+	return walk(archivePath, func(m member) error {
+		name, err := cleanName(m.name)
+		if err != nil || name == "" {
+			return err
+		}
+		if prefix != "" && name != prefix && !strings.HasPrefix(name, prefix+"/") {
+			return nil
+		}
+		files++
+		if limits.MaxFiles > 0 && files > limits.MaxFiles {
+			return fmt.Errorf("archive has more than %d files", limits.MaxFiles)
+		}
+		dest := filepath.Join(target, filepath.FromSlash(name))
+		if err = checkParents(target, name); err != nil {
+			return err
+		}
+
+		switch {
+		case m.dir:
+			return os.MkdirAll(dest, util.OS_ALL_RWX)
+		case m.symlink:
+			// refuse links that obviously leave the archive - the ones that
+			// only leave it through other links are removed afterwards
+			linkTarget := path.Join(path.Dir(name), m.linkname)
+			if path.IsAbs(m.linkname) || linkTarget == ".." || strings.HasPrefix(linkTarget, "../") {
+				return fmt.Errorf("archive member %s links outside the archive to %s", name, m.linkname)
+			}
+			if err = os.MkdirAll(filepath.Dir(dest), util.OS_ALL_RWX); err != nil {
+				return err
+			}
+			return os.Symlink(m.linkname, dest)
+		case m.open == nil:
+			linkTarget, err := cleanName(m.linkname)
+			if err != nil {
+				return err
+			}
+			// only files the archive has already written can be linked to
+			if err = checkParents(target, linkTarget); err != nil {
+				return err
+			}
+			source := filepath.Join(target, filepath.FromSlash(linkTarget))
+			info, err := os.Lstat(source)
+			if err != nil || !info.Mode().IsRegular() {
+				return fmt.Errorf("archive member %s links to %s which is not a file in the archive", name, m.linkname)
+			}
+			if err = os.MkdirAll(filepath.Dir(dest), util.OS_ALL_RWX); err != nil {
+				return err
+			}
+			return os.Link(source, dest)
+		}
+
+		size += m.size
+		if limits.MaxSize > 0 && size > limits.MaxSize {
+			return fmt.Errorf("archive is bigger than %d bytes when extracted", limits.MaxSize)
+		}
+		if err = os.MkdirAll(filepath.Dir(dest), util.OS_ALL_RWX); err != nil {
+			return err
+		}
+		reader, err := m.open()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		// never write through a link an earlier member made
+		file, err := os.OpenFile(dest, os.O_CREATE|os.O_EXCL|os.O_WRONLY, m.mode.Perm()|util.OS_USER_RW)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		// the size in the header can't be trusted so check what we get
+		written, err := io.Copy(file, io.LimitReader(reader, int64(m.size)+1))
+		if err != nil {
+			return err
+		}
+		if uint64(written) != m.size {
+			return fmt.Errorf("archive member %s is not the size it says it is", name)
+		}
+		return nil
+	})
+}
+
+// checkParents makes sure none of the folders between target and name that
+// are already on disk are links - a link an earlier member made could
+// otherwise point anywhere once the links before it are followed
+func checkParents(target, name string) error {
+	dir := target
+	for _, part := range strings.Split(path.Dir(name), "/") {
+		if part == "." {
+			return nil
+		}
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("archive member %s is inside a link", name)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("archive member %s is inside a file", name)
+		}
+	}
+	return nil
+}
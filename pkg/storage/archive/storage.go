@@ -0,0 +1,226 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/filecoin-project/bacalhau/pkg/config"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage"
+	"github.com/filecoin-project/bacalhau/pkg/storage/util"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// a storage driver that extracts the tar, tar.gz, tar.bz2 or zip archive
+// another driver prepares into a local directory in preparation for a job
+// to run - it will remove the extracted files once complete
+//
+// only specs with MetadataExtract set are extracted, everything else is
+// passed straight to the other driver. Explode lists the members of the
+// archive so glob patterns can shard over what is in it, and each shard
+// only gets the members it matched.
+
+const (
+	// MetadataExtract is set to "true" on specs whose archive should be
+	// extracted before the job sees it.
+	MetadataExtract = "extract"
+	// MetadataMember is the path of the file or folder in the archive that
+	// a spec made by Explode is for.
+	MetadataMember = "archive_member"
+)
+
+const (
+	DefaultMaxSize  = 10 * 1024 * 1024 * 1024
+	DefaultMaxFiles = 100000
+)
+
+type StorageProvider struct {
+	Provider storage.StorageProvider
+	LocalDir string
+	Limits   Limits
+}
+
+func NewStorageProvider(cm *system.CleanupManager, provider storage.StorageProvider) (*StorageProvider, error) {
+	dir, err := os.MkdirTemp(config.GetStoragePath(), "bacalhau-archive")
+	if err != nil {
+		return nil, err
+	}
+	cm.RegisterCallback(func() error {
+		return os.RemoveAll(dir)
+	})
+
+	storageHandler := &StorageProvider{
+		Provider: provider,
+		LocalDir: dir,
+		Limits: Limits{
+			MaxSize:  DefaultMaxSize,
+			MaxFiles: DefaultMaxFiles,
+		},
+	}
+
+	log.Debug().Msgf("Archive driver created with output dir: %s", dir)
+	return storageHandler, nil
+}
+
+// IsExtracted is whether the archive of the spec will be extracted.
+func IsExtracted(spec model.StorageSpec) bool {
+	return spec.Metadata[MetadataExtract] == "true"
+}
+
+// Extracted returns a copy of the spec with its archive set to be extracted.
+func Extracted(spec model.StorageSpec) model.StorageSpec {
+	metadata := map[string]string{}
+	for name, value := range spec.Metadata {
+		metadata[name] = value
+	}
+	metadata[MetadataExtract] = "true"
+	spec.Metadata = metadata
+	return spec
+}
+
+// the spec the other driver is given - without our metadata, so every
+// member of an archive is the same download and is cached once
+func archiveSpec(spec model.StorageSpec) model.StorageSpec {
+	var metadata map[string]string
+	for name, value := range spec.Metadata {
+		if name == MetadataExtract || name == MetadataMember {
+			continue
+		}
+		if metadata == nil {
+			metadata = map[string]string{}
+		}
+		metadata[name] = value
+	}
+	spec.Metadata = metadata
+	return spec
+}
+
+func (sp *StorageProvider) IsInstalled(ctx context.Context) (bool, error) {
+	return sp.Provider.IsInstalled(ctx)
+}
+
+func (sp *StorageProvider) HasStorageLocally(ctx context.Context, volume model.StorageSpec) (bool, error) {
+	return sp.Provider.HasStorageLocally(ctx, archiveSpec(volume))
+}
+
+// GetVolumeSize is the size of the archive, which is what gets fetched -
+// the extracted size isn't known until it is extracted
+func (sp *StorageProvider) GetVolumeSize(ctx context.Context, volume model.StorageSpec) (uint64, error) {
+	return sp.Provider.GetVolumeSize(ctx, archiveSpec(volume))
+}
+
+func (sp *StorageProvider) PrepareStorage(ctx context.Context, storageSpec model.StorageSpec) (storage.StorageVolume, error) {
+	ctx, span := newSpan(ctx, "PrepareStorage")
+	defer span.End()
+
+	if !IsExtracted(storageSpec) {
+		return sp.Provider.PrepareStorage(ctx, storageSpec)
+	}
+	member, err := cleanName(storageSpec.Metadata[MetadataMember])
+	if err != nil {
+		return storage.StorageVolume{}, err
+	}
+
+	outputPath, err := os.MkdirTemp(sp.LocalDir, "*")
+	if err != nil {
+		return storage.StorageVolume{}, err
+	}
+	target := filepath.Join(outputPath, "archive")
+	err = sp.withArchive(ctx, storageSpec, func(archivePath string) error {
+		return extract(archivePath, target, member, sp.Limits)
+	})
+	if err == nil {
+		// an archive with nothing in it is still an empty folder
+		err = os.MkdirAll(target, util.OS_ALL_RWX)
+	}
+	source := filepath.Join(target, filepath.FromSlash(member))
+	if err == nil && member != "" {
+		if _, err = os.Lstat(source); os.IsNotExist(err) {
+			err = fmt.Errorf("%s is not in the archive", member)
+		}
+	}
+	if err != nil {
+		_ = os.RemoveAll(outputPath)
+		return storage.StorageVolume{}, fmt.Errorf("could not extract %s: %w", storageSpec.Name, err)
+	}
+
+	return storage.StorageVolume{
+		Type:   storage.StorageVolumeConnectorBind,
+		Source: source,
+		Target: storageSpec.Path,
+	}, nil
+}
+
+//nolint:lll // Exception to the long rule
+func (sp *StorageProvider) CleanupStorage(ctx context.Context, storageSpec model.StorageSpec, volume storage.StorageVolume) error {
+	if !IsExtracted(storageSpec) {
+		return sp.Provider.CleanupStorage(ctx, storageSpec, volume)
+	}
+	// the source is somewhere in the extracted archive
+	relative, err := filepath.Rel(sp.LocalDir, volume.Source)
+	if err != nil || relative == "." || strings.HasPrefix(relative, "..") {
+		return fmt.Errorf("%s was not extracted by this driver", volume.Source)
+	}
+	return os.RemoveAll(filepath.Join(sp.LocalDir, strings.Split(relative, string(filepath.Separator))[0]))
+}
+
+func (sp *StorageProvider) Upload(ctx context.Context, localPath string) (model.StorageSpec, error) {
+	return sp.Provider.Upload(ctx, localPath)
+}
+
+// Explode fetches the archive and returns a spec for each file and folder
+// in it, mounted under the spec's path
+func (sp *StorageProvider) Explode(ctx context.Context, spec model.StorageSpec) ([]model.StorageSpec, error) {
+	ctx, span := newSpan(ctx, "Explode")
+	defer span.End()
+
+	if !IsExtracted(spec) {
+		return sp.Provider.Explode(ctx, spec)
+	}
+	var members []string
+	err := sp.withArchive(ctx, spec, func(archivePath string) error {
+		var err error
+		members, err = list(archivePath, sp.Limits)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not list the files in %s: %w", spec.Name, err)
+	}
+
+	basePath := strings.TrimSuffix(spec.Path, "/")
+	specs := []model.StorageSpec{}
+	for _, member := range members {
+		memberSpec := Extracted(spec)
+		memberSpec.Metadata[MetadataMember] = member
+		memberSpec.Path = basePath + "/" + member
+		specs = append(specs, memberSpec)
+	}
+	return specs, nil
+}
+
+// withArchive has the other driver prepare the archive for as long as fn runs
+func (sp *StorageProvider) withArchive(ctx context.Context, spec model.StorageSpec, fn func(archivePath string) error) error {
+	inner := archiveSpec(spec)
+	volume, err := sp.Provider.PrepareStorage(ctx, inner)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := sp.Provider.CleanupStorage(ctx, inner, volume); err != nil {
+			log.Warn().Msgf("could not clean up the archive of %s: %s", spec.Name, err)
+		}
+	}()
+	return fn(volume.Source)
+}
+
+func newSpan(ctx context.Context, apiName string) (context.Context, trace.Span) {
+	return system.Span(ctx, "storage/archive", apiName)
+}
+
+// Compile time interface check:
+var _ storage.StorageProvider = (*StorageProvider)(nil)
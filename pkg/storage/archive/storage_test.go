@@ -0,0 +1,250 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage/url/urldownload"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	"github.com/stretchr/testify/require"
+)
+
+type tarEntry struct {
+	header  tar.Header
+	content string
+}
+
+func makeTarGz(t *testing.T, entries []tarEntry) []byte {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, entry := range entries {
+		header := entry.header
+		if header.Mode == 0 {
+			header.Mode = 0644
+		}
+		header.Size = int64(len(entry.content))
+		require.NoError(t, tarWriter.WriteHeader(&header))
+		_, err := tarWriter.Write([]byte(entry.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+	return buf.Bytes()
+}
+
+func makeZip(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+	for name, content := range files {
+		writer, err := zipWriter.Create(name)
+		require.NoError(t, err)
+		_, err = writer.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zipWriter.Close())
+	return buf.Bytes()
+}
+
+func writeArchive(t *testing.T, data []byte) string {
+	archivePath := filepath.Join(t.TempDir(), "archive")
+	require.NoError(t, os.WriteFile(archivePath, data, 0600))
+	return archivePath
+}
+
+// a url download driver wrapped to extract what it downloads from server
+func newProvider(t *testing.T, data []byte) (*StorageProvider, model.StorageSpec) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+
+	cm := system.NewCleanupManager()
+	t.Cleanup(cm.Cleanup)
+	urlProvider, err := urldownload.NewStorageProvider(cm)
+	require.NoError(t, err)
+	provider, err := NewStorageProvider(cm, urlProvider)
+	require.NoError(t, err)
+
+	spec := Extracted(model.StorageSpec{
+		Engine: model.StorageSourceURLDownload,
+		URL:    server.URL + "/data.zip",
+		Path:   "/inputs/data",
+	})
+	return provider, spec
+}
+
+func TestPrepareStorageExtracts(t *testing.T) {
+	provider, spec := newProvider(t, makeZip(t, map[string]string{
+		"a.csv":         "a",
+		"nested/b.csv":  "bb",
+		"nested/c.json": "ccc",
+	}))
+	ctx := context.Background()
+
+	volume, err := provider.PrepareStorage(ctx, spec)
+	require.NoError(t, err)
+	require.Equal(t, "/inputs/data", volume.Target)
+	content, err := os.ReadFile(filepath.Join(volume.Source, "nested", "b.csv"))
+	require.NoError(t, err)
+	require.Equal(t, "bb", string(content))
+
+	require.NoError(t, provider.CleanupStorage(ctx, spec, volume))
+	_, err = os.Stat(volume.Source)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestExplodeListsMembers(t *testing.T) {
+	provider, spec := newProvider(t, makeZip(t, map[string]string{
+		"a.csv":         "a",
+		"nested/b.csv":  "bb",
+		"nested/c.json": "ccc",
+	}))
+	ctx := context.Background()
+
+	specs, err := provider.Explode(ctx, spec)
+	require.NoError(t, err)
+	paths := []string{}
+	for _, memberSpec := range specs {
+		paths = append(paths, memberSpec.Path)
+		require.Equal(t, spec.URL, memberSpec.URL)
+		require.True(t, IsExtracted(memberSpec))
+	}
+	require.Equal(t, []string{
+		"/inputs/data/a.csv",
+		"/inputs/data/nested",
+		"/inputs/data/nested/b.csv",
+		"/inputs/data/nested/c.json",
+	}, paths)
+	// the spec we were given is left alone
+	require.Empty(t, spec.Metadata[MetadataMember])
+
+	// a shard only gets the member it is for
+	volume, err := provider.PrepareStorage(ctx, specs[2])
+	require.NoError(t, err)
+	content, err := os.ReadFile(volume.Source)
+	require.NoError(t, err)
+	require.Equal(t, "bb", string(content))
+	_, err = os.Stat(filepath.Join(filepath.Dir(volume.Source), "c.json"))
+	require.True(t, os.IsNotExist(err))
+	require.NoError(t, provider.CleanupStorage(ctx, specs[2], volume))
+}
+
+func TestNotExtractedIsPassedThrough(t *testing.T) {
+	provider, spec := newProvider(t, []byte("not an archive"))
+	ctx := context.Background()
+
+	_, err := provider.PrepareStorage(ctx, spec)
+	require.Error(t, err)
+
+	volume, err := provider.PrepareStorage(ctx, archiveSpec(spec))
+	require.NoError(t, err)
+	content, err := os.ReadFile(volume.Source)
+	require.NoError(t, err)
+	require.Equal(t, "not an archive", string(content))
+	require.NoError(t, provider.CleanupStorage(ctx, archiveSpec(spec), volume))
+}
+
+func TestExtractStaysInTarget(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target")
+	archivePath := writeArchive(t, makeTarGz(t, []tarEntry{
+		{header: tar.Header{Name: "../escaped", Typeflag: tar.TypeReg}, content: "x"},
+		{header: tar.Header{Name: "/absolute", Typeflag: tar.TypeReg}, content: "y"},
+	}))
+	require.NoError(t, extract(archivePath, target, "", Limits{}))
+
+	_, err := os.Stat(filepath.Join(dir, "escaped"))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(target, "escaped"))
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(target, "absolute"))
+	require.NoError(t, err)
+}
+
+func TestExtractRejectsEscapingLinks(t *testing.T) {
+	testCases := []tarEntry{
+		{header: tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../outside"}},
+		{header: tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}},
+		{header: tar.Header{Name: "nested/link", Typeflag: tar.TypeSymlink, Linkname: "../../outside"}},
+	}
+	for _, testCase := range testCases {
+		archivePath := writeArchive(t, makeTarGz(t, []tarEntry{testCase}))
+		require.Error(t, extract(archivePath, t.TempDir(), "", Limits{}), testCase.header.Linkname)
+	}
+
+	// each link stays in the archive on its own, but following one after
+	// the other leaves it
+	dir := t.TempDir()
+	target := filepath.Join(dir, "a", "b", "target")
+	archivePath := writeArchive(t, makeTarGz(t, []tarEntry{
+		{header: tar.Header{Name: "a/l", Typeflag: tar.TypeSymlink, Linkname: ".."}},
+		{header: tar.Header{Name: "a/l/l2", Typeflag: tar.TypeSymlink, Linkname: ".."}},
+		{header: tar.Header{Name: "a/l/l2/pwned", Typeflag: tar.TypeReg}, content: "x"},
+	}))
+	require.Error(t, extract(archivePath, target, "", Limits{}))
+	_, err := os.Stat(filepath.Join(dir, "a", "b", "pwned"))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "a", "pwned"))
+	require.True(t, os.IsNotExist(err))
+
+	// links that only leave the archive once another link is followed are
+	// removed, whatever they look like on their own
+	dir = t.TempDir()
+	target = filepath.Join(dir, "a", "b", "target")
+	archivePath = writeArchive(t, makeTarGz(t, []tarEntry{
+		{header: tar.Header{Name: "d1/d2/up", Typeflag: tar.TypeSymlink, Linkname: "../.."}},
+		{header: tar.Header{Name: "e", Typeflag: tar.TypeSymlink, Linkname: "d1/d2/up/../../b"}},
+		{header: tar.Header{Name: "inside", Typeflag: tar.TypeSymlink, Linkname: "d1/d2/up/d1"}},
+	}))
+	require.NoError(t, extract(archivePath, target, "", Limits{}))
+	_, err = os.Lstat(filepath.Join(target, "e"))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Lstat(filepath.Join(target, "d1", "d2", "up"))
+	require.NoError(t, err)
+	_, err = os.Lstat(filepath.Join(target, "inside"))
+	require.NoError(t, err)
+
+	// hard links can't reach through links either
+	outside := filepath.Join(dir, "secret")
+	require.NoError(t, os.WriteFile(outside, []byte("secret"), 0600))
+	archivePath = writeArchive(t, makeTarGz(t, []tarEntry{
+		{header: tar.Header{Name: "up", Typeflag: tar.TypeSymlink, Linkname: "."}},
+		{header: tar.Header{Name: "copy", Typeflag: tar.TypeLink, Linkname: "up/secret"}},
+		{header: tar.Header{Name: "copy2", Typeflag: tar.TypeLink, Linkname: "missing"}},
+	}))
+	require.Error(t, extract(archivePath, filepath.Join(dir, "target2"), "", Limits{}))
+
+	// links within the archive are fine, but not writing through them
+	archivePath = writeArchive(t, makeTarGz(t, []tarEntry{
+		{header: tar.Header{Name: "data/a.txt", Typeflag: tar.TypeReg}, content: "a"},
+		{header: tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "data/a.txt"}},
+		{header: tar.Header{Name: "link", Typeflag: tar.TypeReg}, content: "overwritten"},
+	}))
+	target = t.TempDir()
+	require.Error(t, extract(archivePath, target, "", Limits{}))
+	content, err := os.ReadFile(filepath.Join(target, "data", "a.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "a", string(content))
+}
+
+func TestExtractLimits(t *testing.T) {
+	archivePath := writeArchive(t, makeTarGz(t, []tarEntry{
+		{header: tar.Header{Name: "a", Typeflag: tar.TypeReg}, content: "12345"},
+		{header: tar.Header{Name: "b", Typeflag: tar.TypeReg}, content: "67890"},
+	}))
+	require.NoError(t, extract(archivePath, t.TempDir(), "", Limits{MaxSize: 10, MaxFiles: 2}))
+	require.Error(t, extract(archivePath, t.TempDir(), "", Limits{MaxSize: 9}))
+	require.Error(t, extract(archivePath, t.TempDir(), "", Limits{MaxFiles: 1}))
+	_, err := list(archivePath, Limits{MaxFiles: 1})
+	require.Error(t, err)
+}
@@ -0,0 +1,186 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/filecoin-project/bacalhau/pkg/config"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	"github.com/rs/zerolog/log"
+)
+
+// Cache keeps the inputs of recent jobs on disk so the next shard that
+// needs them doesn't fetch them again. Entries that are in use by a running
+// shard are never removed - the least recently used of the others are
+// removed once the cache is bigger than its budget.
+type Cache struct {
+	dir     string
+	maxSize uint64
+
+	mutex   sync.Mutex
+	entries map[string]*entry
+	// ready entries, least recently used first
+	lru  *list.List
+	size uint64
+}
+
+type entry struct {
+	key  string
+	path string
+	size uint64
+	// how many shards are using the entry
+	refs int
+	// closed once the entry has been filled, or failed to be
+	ready   chan struct{}
+	err     error
+	element *list.Element
+}
+
+// FillFunc writes the content of an entry to path, as a file or a folder.
+type FillFunc func(ctx context.Context, path string) error
+
+func NewCache(cm *system.CleanupManager, maxSize uint64) (*Cache, error) {
+	dir, err := os.MkdirTemp(config.GetStoragePath(), "bacalhau-input-cache")
+	if err != nil {
+		return nil, err
+	}
+	cm.RegisterCallback(func() error {
+		return os.RemoveAll(dir)
+	})
+
+	log.Debug().Msgf("Input cache created in %s with a budget of %d bytes", dir, maxSize)
+	return &Cache{
+		dir:     dir,
+		maxSize: maxSize,
+		entries: map[string]*entry{},
+		lru:     list.New(),
+	}, nil
+}
+
+// Acquire returns the path of the entry for the key, filling it first if it
+// isn't in the cache. If another shard is already filling it we wait for that
+// rather than fetch it twice, and fill it ourselves if that fails. Every
+// successful Acquire must be followed by a Release once the entry is no
+// longer in use.
+func (c *Cache) Acquire(ctx context.Context, key string, fill FillFunc) (string, error) {
+	c.mutex.Lock()
+	e, ok := c.entries[key]
+	if ok {
+		e.refs++
+		if e.element != nil {
+			c.lru.MoveToBack(e.element)
+		}
+		c.mutex.Unlock()
+		select {
+		case <-e.ready:
+		case <-ctx.Done():
+			c.Release(key)
+			return "", ctx.Err()
+		}
+		// a failed entry has already been forgotten so there is nothing to
+		// release - the fill may have failed because whoever started it gave
+		// up, so we have a go ourselves
+		if e.err != nil {
+			return c.Acquire(ctx, key, fill)
+		}
+		return e.path, nil
+	}
+
+	hash := sha256.Sum256([]byte(key))
+	e = &entry{
+		key:   key,
+		path:  filepath.Join(c.dir, hex.EncodeToString(hash[:])),
+		refs:  1,
+		ready: make(chan struct{}),
+	}
+	c.entries[key] = e
+	c.mutex.Unlock()
+
+	err := fill(ctx, e.path)
+	var size uint64
+	if err == nil {
+		size, err = pathSize(e.path)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	defer close(e.ready)
+	if err != nil {
+		e.err = fmt.Errorf("could not fill cache entry for %s: %w", key, err)
+		delete(c.entries, key)
+		_ = os.RemoveAll(e.path)
+		return "", e.err
+	}
+	e.size = size
+	e.element = c.lru.PushBack(e)
+	c.size += size
+	c.evict()
+	return e.path, nil
+}
+
+// Release says a shard has finished with the entry for the key.
+func (c *Cache) Release(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	e.refs--
+	c.evict()
+}
+
+// Has is whether the entry for the key is in the cache and ready to use.
+func (c *Cache) Has(key string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e, ok := c.entries[key]
+	return ok && e.element != nil
+}
+
+// Size is how many bytes the ready entries use.
+func (c *Cache) Size() uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.size
+}
+
+// evict removes the least recently used entries no one is using until the
+// cache fits its budget - the mutex must be held
+func (c *Cache) evict() {
+	element := c.lru.Front()
+	for c.size > c.maxSize && element != nil {
+		next := element.Next()
+		e := element.Value.(*entry) //nolint:forcetypeassert // only entries go in the list
+		if e.refs <= 0 {
+			log.Debug().Msgf("Removing %s from the input cache", e.key)
+			c.lru.Remove(element)
+			delete(c.entries, e.key)
+			c.size -= e.size
+			if err := os.RemoveAll(e.path); err != nil {
+				log.Warn().Msgf("Could not remove %s from the input cache: %s", e.path, err)
+			}
+		}
+		element = next
+	}
+}
+
+func pathSize(path string) (uint64, error) {
+	var size uint64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += uint64(info.Size())
+		}
+		return nil
+	})
+	return size, err
+}
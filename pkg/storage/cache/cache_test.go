@@ -0,0 +1,266 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage/url/urldownload"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFill(contents string) FillFunc {
+	return func(ctx context.Context, path string) error {
+		return os.WriteFile(path, []byte(contents), 0600)
+	}
+}
+
+func TestAcquireFillsOnce(t *testing.T) {
+	cm := system.NewCleanupManager()
+	defer cm.Cleanup()
+	c, err := NewCache(cm, 100)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	var fills int32
+	fill := func(ctx context.Context, path string) error {
+		atomic.AddInt32(&fills, 1)
+		return os.WriteFile(path, []byte("hello"), 0600)
+	}
+
+	var wg sync.WaitGroup
+	paths := make([]string, 10)
+	for i := range paths {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			path, err := c.Acquire(ctx, "key", fill)
+			require.NoError(t, err)
+			paths[i] = path
+		}(i)
+	}
+	wg.Wait()
+
+	require.Equal(t, int32(1), fills)
+	for _, path := range paths {
+		require.Equal(t, paths[0], path)
+	}
+	require.True(t, c.Has("key"))
+	require.Equal(t, uint64(5), c.Size())
+}
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	cm := system.NewCleanupManager()
+	defer cm.Cleanup()
+	c, err := NewCache(cm, 10)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	pathA, err := c.Acquire(ctx, "a", writeFill("aaaa"))
+	require.NoError(t, err)
+	_, err = c.Acquire(ctx, "b", writeFill("bbbb"))
+	require.NoError(t, err)
+	c.Release("a")
+	c.Release("b")
+	// a is used again so b is now the least recently used
+	_, err = c.Acquire(ctx, "a", writeFill("aaaa"))
+	require.NoError(t, err)
+	c.Release("a")
+
+	_, err = c.Acquire(ctx, "c", writeFill("cccc"))
+	require.NoError(t, err)
+	require.True(t, c.Has("a"))
+	require.False(t, c.Has("b"))
+	require.True(t, c.Has("c"))
+	require.Equal(t, uint64(8), c.Size())
+	require.FileExists(t, pathA)
+}
+
+func TestKeepsEntriesInUse(t *testing.T) {
+	cm := system.NewCleanupManager()
+	defer cm.Cleanup()
+	c, err := NewCache(cm, 4)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	pathA, err := c.Acquire(ctx, "a", writeFill("aaaa"))
+	require.NoError(t, err)
+	pathB, err := c.Acquire(ctx, "b", writeFill("bbbb"))
+	require.NoError(t, err)
+	// both are in use so the cache goes over budget
+	require.FileExists(t, pathA)
+	require.FileExists(t, pathB)
+	require.Equal(t, uint64(8), c.Size())
+
+	c.Release("a")
+	require.False(t, c.Has("a"))
+	require.NoFileExists(t, pathA)
+	require.True(t, c.Has("b"))
+}
+
+func TestFailedFill(t *testing.T) {
+	cm := system.NewCleanupManager()
+	defer cm.Cleanup()
+	c, err := NewCache(cm, 100)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = c.Acquire(ctx, "a", func(ctx context.Context, path string) error {
+		return errors.New("no luck")
+	})
+	require.Error(t, err)
+	require.False(t, c.Has("a"))
+
+	// the next shard tries again
+	path, err := c.Acquire(ctx, "a", writeFill("aaaa"))
+	require.NoError(t, err)
+	require.FileExists(t, path)
+}
+
+func TestStorageProvider(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			atomic.AddInt32(&requests, 1)
+		}
+		_, _ = w.Write([]byte("some data"))
+	}))
+	defer server.Close()
+
+	cm := system.NewCleanupManager()
+	defer cm.Cleanup()
+	c, err := NewCache(cm, 100)
+	require.NoError(t, err)
+	urlStorage, err := urldownload.NewStorageProvider(cm)
+	require.NoError(t, err)
+	sp := NewStorageProvider(urlStorage, c)
+	ctx := context.Background()
+
+	spec := model.StorageSpec{
+		Engine: model.StorageSourceURLDownload,
+		URL:    server.URL + "/data.txt",
+		Path:   "/inputs/data.txt",
+		Metadata: map[string]string{
+			urldownload.MetadataSHA256: fmt.Sprintf("%x", sha256.Sum256([]byte("some data"))),
+		},
+	}
+	local, err := sp.HasStorageLocally(ctx, spec)
+	require.NoError(t, err)
+	require.False(t, local)
+
+	for i := 0; i < 2; i++ {
+		volume, err := sp.PrepareStorage(ctx, spec)
+		require.NoError(t, err)
+		require.Equal(t, "/inputs/data.txt", volume.Target)
+		content, err := os.ReadFile(volume.Source)
+		require.NoError(t, err)
+		require.Equal(t, "some data", string(content))
+		require.NoError(t, sp.CleanupStorage(ctx, spec, volume))
+		// still there for the next shard
+		require.FileExists(t, volume.Source)
+	}
+	require.Equal(t, int32(1), requests)
+
+	local, err = sp.HasStorageLocally(ctx, spec)
+	require.NoError(t, err)
+	require.True(t, local)
+
+	// the driver's own copy was cleaned up after it was moved to the cache
+	leftovers, err := filepath.Glob(filepath.Join(urlStorage.LocalDir, "*", "*"))
+	require.NoError(t, err)
+	require.Empty(t, leftovers)
+
+	// without a checksum the content could change so it is downloaded every time
+	spec.Metadata = nil
+	for i := 0; i < 2; i++ {
+		volume, err := sp.PrepareStorage(ctx, spec)
+		require.NoError(t, err)
+		require.NoError(t, sp.CleanupStorage(ctx, spec, volume))
+	}
+	require.Equal(t, int32(3), requests)
+}
+
+func TestKey(t *testing.T) {
+	_, ok := Key(model.StorageSpec{Engine: model.StorageSourceS3, URL: "s3://bucket/key"})
+	require.False(t, ok)
+
+	key, ok := Key(model.StorageSpec{Engine: model.StorageSourceIPFS, Cid: "Qm123", Path: "/a"})
+	require.True(t, ok)
+	otherKey, _ := Key(model.StorageSpec{Engine: model.StorageSourceIPFS, Cid: "Qm123", Path: "/b"})
+	require.Equal(t, key, otherKey)
+
+	_, ok = Key(model.StorageSpec{Engine: model.StorageSourceURLDownload, URL: "http://a.com/x"})
+	require.False(t, ok)
+	key, ok = Key(model.StorageSpec{
+		Engine:   model.StorageSourceURLDownload,
+		URL:      "http://a.com/x",
+		Metadata: map[string]string{"sha256": "abc"},
+	})
+	require.True(t, ok)
+	otherKey, _ = Key(model.StorageSpec{
+		Engine:   model.StorageSourceURLDownload,
+		URL:      "http://a.com/x",
+		Metadata: map[string]string{"sha256": "def"},
+	})
+	require.NotEqual(t, key, otherKey)
+
+	// lists of URLs need a checksum for every file, and index files can change
+	_, ok = Key(model.StorageSpec{
+		Engine:   model.StorageSourceURLDownload,
+		Metadata: map[string]string{"urls": "http://a.com/x abc\nhttp://a.com/y def"},
+	})
+	require.True(t, ok)
+	_, ok = Key(model.StorageSpec{
+		Engine:   model.StorageSourceURLDownload,
+		Metadata: map[string]string{"urls": "http://a.com/x abc\nhttp://a.com/y"},
+	})
+	require.False(t, ok)
+	_, ok = Key(model.StorageSpec{
+		Engine:   model.StorageSourceURLDownload,
+		URL:      "http://a.com/index.txt",
+		Metadata: map[string]string{"index": "true", "sha256": "abc"},
+	})
+	require.False(t, ok)
+}
+
+func TestWaiterFillsAfterFailure(t *testing.T) {
+	cm := system.NewCleanupManager()
+	defer cm.Cleanup()
+	c, err := NewCache(cm, 100)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	filling := make(chan struct{})
+	giveUp := make(chan struct{})
+	failed := make(chan error)
+	go func() {
+		_, err := c.Acquire(ctx, "a", func(ctx context.Context, path string) error {
+			close(filling)
+			<-giveUp
+			return context.Canceled
+		})
+		failed <- err
+	}()
+
+	<-filling
+	waited := make(chan string)
+	go func() {
+		path, err := c.Acquire(ctx, "a", writeFill("aaaa"))
+		require.NoError(t, err)
+		waited <- path
+	}()
+	close(giveUp)
+	require.Error(t, <-failed)
+	require.FileExists(t, <-waited)
+	require.True(t, c.Has("a"))
+}
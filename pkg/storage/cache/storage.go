@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage"
+	"github.com/filecoin-project/bacalhau/pkg/storage/git"
+	"github.com/filecoin-project/bacalhau/pkg/storage/url/urldownload"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// a storage driver that puts what another driver prepares in the node's
+// input cache, so shards that use the same inputs share one copy of them
+// and the data locality job selection policy sees them as local
+//
+// specs are only cached when we know the same key means the same data -
+// see Key
+
+type StorageProvider struct {
+	Provider storage.StorageProvider
+	Cache    *Cache
+}
+
+func NewStorageProvider(provider storage.StorageProvider, cache *Cache) *StorageProvider {
+	return &StorageProvider{
+		Provider: provider,
+		Cache:    cache,
+	}
+}
+
+// Key is what a spec is cached under and whether it can be cached. IPFS,
+// estuary and filecoin content is addressed by its CID, git checkouts by
+// their repository and commit and downloads by their URL, along with the
+// checksums and lists of URLs in their metadata. Downloads are only cached
+// when we know the SHA-256 of every file, otherwise the content behind the
+// URL could change and later jobs would get the old copy.
+func Key(spec model.StorageSpec) (string, bool) {
+	switch spec.Engine {
+	case model.StorageSourceIPFS, model.StorageSourceEstuary, model.StorageSourceFilecoin:
+		// they all use unixfs so the same CID is the same files
+		return "ipfs:" + spec.Cid, spec.Cid != ""
+	case model.StorageSourceGit:
+		commit := spec.Metadata[git.MetadataCommit]
+		return "git:" + spec.URL + "@" + commit, spec.URL != "" && commit != ""
+	case model.StorageSourceURLDownload:
+		if !urldownload.IsPinned(spec) {
+			return "", false
+		}
+		key := "url:" + spec.URL
+		names := make([]string, 0, len(spec.Metadata))
+		for name := range spec.Metadata {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			key += fmt.Sprintf("\n%s=%s", name, spec.Metadata[name])
+		}
+		return key, true
+	default:
+		return "", false
+	}
+}
+
+func (sp *StorageProvider) IsInstalled(ctx context.Context) (bool, error) {
+	return sp.Provider.IsInstalled(ctx)
+}
+
+func (sp *StorageProvider) HasStorageLocally(ctx context.Context, volume model.StorageSpec) (bool, error) {
+	ctx, span := newSpan(ctx, "HasStorageLocally")
+	defer span.End()
+	if key, ok := Key(volume); ok && sp.Cache.Has(key) {
+		return true, nil
+	}
+	return sp.Provider.HasStorageLocally(ctx, volume)
+}
+
+func (sp *StorageProvider) GetVolumeSize(ctx context.Context, volume model.StorageSpec) (uint64, error) {
+	return sp.Provider.GetVolumeSize(ctx, volume)
+}
+
+func (sp *StorageProvider) PrepareStorage(ctx context.Context, storageSpec model.StorageSpec) (storage.StorageVolume, error) {
+	ctx, span := newSpan(ctx, "PrepareStorage")
+	defer span.End()
+
+	key, ok := Key(storageSpec)
+	if !ok {
+		return sp.Provider.PrepareStorage(ctx, storageSpec)
+	}
+	path, err := sp.Cache.Acquire(ctx, key, func(ctx context.Context, path string) error {
+		volume, err := sp.Provider.PrepareStorage(ctx, storageSpec)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = sp.Provider.CleanupStorage(ctx, storageSpec, volume)
+		}()
+		return moveOrCopy(volume.Source, path)
+	})
+	if err != nil {
+		return storage.StorageVolume{}, err
+	}
+	return storage.StorageVolume{
+		Type:   storage.StorageVolumeConnectorBind,
+		Source: path,
+		Target: storageSpec.Path,
+	}, nil
+}
+
+//nolint:lll // Exception to the long rule
+func (sp *StorageProvider) CleanupStorage(ctx context.Context, storageSpec model.StorageSpec, volume storage.StorageVolume) error {
+	key, ok := Key(storageSpec)
+	if !ok {
+		return sp.Provider.CleanupStorage(ctx, storageSpec, volume)
+	}
+	sp.Cache.Release(key)
+	return nil
+}
+
+func (sp *StorageProvider) Upload(ctx context.Context, localPath string) (model.StorageSpec, error) {
+	return sp.Provider.Upload(ctx, localPath)
+}
+
+func (sp *StorageProvider) Explode(ctx context.Context, spec model.StorageSpec) ([]model.StorageSpec, error) {
+	return sp.Provider.Explode(ctx, spec)
+}
+
+// the drivers prepare storage under the same storage path as the cache so
+// this is normally a rename, but fall back to copying if it isn't
+func moveOrCopy(source, target string) error {
+	if err := os.Rename(source, target); err == nil {
+		return nil
+	}
+	return system.RunCommand("cp", []string{"-r", source, target})
+}
+
+func newSpan(ctx context.Context, apiName string) (context.Context, trace.Span) {
+	return system.Span(ctx, "storage/cache", apiName)
+}
+
+// Compile time interface check:
+var _ storage.StorageProvider = (*StorageProvider)(nil)
@@ -0,0 +1,22 @@
+package storage
+
+import "context"
+
+type progressContextKey struct{}
+
+// WithProgress returns a context that storage providers report how far
+// they have got with preparing a volume to, so the compute node can pass it
+// on while a shard waits for its inputs.
+func WithProgress(ctx context.Context, onProgress func(progress string)) context.Context {
+	return context.WithValue(ctx, progressContextKey{}, onProgress)
+}
+
+// ReportProgress tells whoever is waiting on the volume being prepared with
+// ctx how far it has got - an empty progress says it is done. It does
+// nothing if no one asked.
+func ReportProgress(ctx context.Context, progress string) {
+	onProgress, ok := ctx.Value(progressContextKey{}).(func(string))
+	if ok && onProgress != nil {
+		onProgress(progress)
+	}
+}
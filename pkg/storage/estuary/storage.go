@@ -0,0 +1,283 @@
+package estuary
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/filecoin-project/bacalhau/pkg/config"
+	"github.com/filecoin-project/bacalhau/pkg/ipfs"
+	"github.com/filecoin-project/bacalhau/pkg/ipfs/car"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage"
+	"github.com/filecoin-project/bacalhau/pkg/storage/cache"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// a storage driver for content published to estuary - it downloads the
+// content from the estuary gateway as a CAR file, checks every block against
+// its CID and writes the files into a local directory in preparation for a
+// job to run. It will remove the files once complete.
+//
+// this is what lets the results of a job published with the estuary
+// publisher be the inputs of the next job.
+
+const carContentType = "application/vnd.ipld.car"
+
+type StorageProvider struct {
+	GatewayURL string
+	LocalDir   string
+	HTTPClient *http.Client
+	// when set the CARs we download are kept in it, so sizing, exploding
+	// and preparing the same content only downloads it once
+	CarCache *cache.Cache
+}
+
+func NewStorageProvider(cm *system.CleanupManager) (*StorageProvider, error) {
+	dir, err := os.MkdirTemp(config.GetStoragePath(), "bacalhau-estuary")
+	if err != nil {
+		return nil, err
+	}
+	cm.RegisterCallback(func() error {
+		return os.RemoveAll(dir)
+	})
+
+	storageHandler := &StorageProvider{
+		GatewayURL: getGatewayURL(),
+		LocalDir:   dir,
+		HTTPClient: &http.Client{},
+	}
+
+	log.Debug().Msgf("Estuary driver created with output dir: %s", dir)
+	return storageHandler, nil
+}
+
+func (sp *StorageProvider) IsInstalled(ctx context.Context) (bool, error) {
+	return true, nil
+}
+
+func (sp *StorageProvider) HasStorageLocally(ctx context.Context, volume model.StorageSpec) (bool, error) {
+	return false, nil
+}
+
+// GetVolumeSize adds up the size of the files in the content if we already
+// have it, and otherwise goes by its root block so only that is downloaded
+func (sp *StorageProvider) GetVolumeSize(ctx context.Context, volume model.StorageSpec) (uint64, error) {
+	ctx, span := newSpan(ctx, "GetVolumeSize")
+	defer span.End()
+
+	var size uint64
+	sizeCar := func(dag ipld.DAGService, root cid.Cid) error {
+		var err error
+		size, err = car.Size(ctx, dag, root)
+		return err
+	}
+	if sp.CarCache != nil && sp.CarCache.Has(carCacheKey(volume.Cid)) {
+		err := sp.withCar(ctx, volume.Cid, sizeCar)
+		return size, err
+	}
+
+	root, err := cid.Decode(volume.Cid)
+	if err != nil {
+		return 0, fmt.Errorf("invalid estuary cid %q: %w", volume.Cid, err)
+	}
+	carDir, err := os.MkdirTemp(sp.LocalDir, "car-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(carDir)
+	carFile := filepath.Join(carDir, "root.car")
+	if err = sp.download(ctx, root, carFile, dagScopeBlock); err != nil {
+		return 0, err
+	}
+	dag, closer, err := car.OpenCar(ctx, carFile)
+	if err != nil {
+		return 0, fmt.Errorf("invalid CAR for %s: %w", root, err)
+	}
+	defer closer.Close()
+	return car.RootSize(ctx, dag, root)
+}
+
+func (sp *StorageProvider) PrepareStorage(ctx context.Context, storageSpec model.StorageSpec) (storage.StorageVolume, error) {
+	ctx, span := newSpan(ctx, "PrepareStorage")
+	defer span.End()
+
+	outputPath, err := os.MkdirTemp(sp.LocalDir, "*")
+	if err != nil {
+		return storage.StorageVolume{}, err
+	}
+	source := filepath.Join(outputPath, "data")
+	err = sp.withCar(ctx, storageSpec.Cid, func(dag ipld.DAGService, root cid.Cid) error {
+		return car.Extract(ctx, dag, root, source)
+	})
+	if err != nil {
+		_ = os.RemoveAll(outputPath)
+		return storage.StorageVolume{}, fmt.Errorf("could not get %s from estuary: %w", storageSpec.Cid, err)
+	}
+
+	return storage.StorageVolume{
+		Type:   storage.StorageVolumeConnectorBind,
+		Source: source,
+		Target: storageSpec.Path,
+	}, nil
+}
+
+//nolint:lll // Exception to the long rule
+func (sp *StorageProvider) CleanupStorage(ctx context.Context, storageSpec model.StorageSpec, volume storage.StorageVolume) error {
+	return os.RemoveAll(filepath.Dir(volume.Source))
+}
+
+// content is added to estuary by the estuary publisher
+func (sp *StorageProvider) Upload(ctx context.Context, localPath string) (model.StorageSpec, error) {
+	return model.StorageSpec{}, fmt.Errorf("not implemented")
+}
+
+// Explode downloads the content and returns a spec for each file and folder
+// in it, in the same way as the IPFS driver
+func (sp *StorageProvider) Explode(ctx context.Context, spec model.StorageSpec) ([]model.StorageSpec, error) {
+	ctx, span := newSpan(ctx, "Explode")
+	defer span.End()
+
+	var flatNodes []ipfs.IPLDTreeNode
+	err := sp.withCar(ctx, spec.Cid, func(dag ipld.DAGService, root cid.Cid) error {
+		node, err := dag.Get(ctx, root)
+		if err != nil {
+			return err
+		}
+		treeNode, err := ipfs.GetTreeNode(ctx, ipld.NewNavigableIPLDNode(node, dag), []string{})
+		if err != nil {
+			return err
+		}
+		flatNodes, err = ipfs.FlattenTreeNode(ctx, treeNode)
+		return err
+	})
+	if err != nil {
+		return []model.StorageSpec{}, err
+	}
+
+	basePath := strings.TrimSuffix(spec.Path, "/")
+	specs := []model.StorageSpec{}
+	seenPaths := map[string]bool{}
+	for _, node := range flatNodes {
+		usePath := strings.TrimSuffix(basePath+"/"+strings.Join(node.Path, "/"), "/")
+		if seenPaths[usePath] {
+			continue
+		}
+		seenPaths[usePath] = true
+		specs = append(specs, model.StorageSpec{
+			Name:   spec.Name,
+			Engine: model.StorageSourceEstuary,
+			Cid:    node.Cid.String(),
+			Path:   usePath,
+		})
+	}
+	return specs, nil
+}
+
+// withCar downloads the CAR of the content, or gets it from the CAR cache,
+// for as long as fn runs
+func (sp *StorageProvider) withCar(
+	ctx context.Context,
+	contentCid string,
+	fn func(dag ipld.DAGService, root cid.Cid) error,
+) error {
+	root, err := cid.Decode(contentCid)
+	if err != nil {
+		return fmt.Errorf("invalid estuary cid %q: %w", contentCid, err)
+	}
+	var carFile string
+	if sp.CarCache != nil {
+		key := carCacheKey(contentCid)
+		carFile, err = sp.CarCache.Acquire(ctx, key, func(ctx context.Context, path string) error {
+			return sp.download(ctx, root, path, dagScopeAll)
+		})
+		if err != nil {
+			return err
+		}
+		defer sp.CarCache.Release(key)
+	} else {
+		carDir, err := os.MkdirTemp(sp.LocalDir, "car-*")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(carDir)
+		carFile = filepath.Join(carDir, "content.car")
+		if err = sp.download(ctx, root, carFile, dagScopeAll); err != nil {
+			return err
+		}
+	}
+	dag, closer, err := car.OpenCar(ctx, carFile)
+	if err != nil {
+		return fmt.Errorf("invalid CAR for %s: %w", root, err)
+	}
+	defer closer.Close()
+	return fn(dag, root)
+}
+
+// how much of the DAG under the root the gateway puts in the CAR
+const (
+	dagScopeAll   = "all"
+	dagScopeBlock = "block"
+)
+
+func (sp *StorageProvider) download(ctx context.Context, root cid.Cid, carFile, dagScope string) error {
+	ctx, cancel := context.WithTimeout(ctx, config.GetDownloadCidRequestTimeout())
+	defer cancel()
+
+	url := fmt.Sprintf("%s/ipfs/%s?format=car&dag-scope=%s", sp.GatewayURL, root, dagScope)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", carContentType)
+	res, err := sp.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("estuary gateway returned %d for %s", res.StatusCode, root)
+	}
+
+	file, err := os.Create(carFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	start := time.Now()
+	written, err := io.Copy(file, res.Body)
+	if err != nil {
+		return err
+	}
+	log.Debug().Msgf("downloaded %d bytes of %s from estuary in %s", written, root, time.Since(start))
+	return nil
+}
+
+// the CAR cache is shared with the extracted inputs so it needs its own keys
+func carCacheKey(contentCid string) string {
+	return "estuary-car:" + contentCid
+}
+
+func getGatewayURL() string {
+	gatewayURL := os.Getenv("BACALHAU_ESTUARY_GATEWAY_URL")
+	if gatewayURL == "" {
+		gatewayURL = "https://api.estuary.tech/gw"
+	}
+	return strings.TrimSuffix(gatewayURL, "/")
+}
+
+func newSpan(ctx context.Context, apiName string) (context.Context, trace.Span) {
+	return system.Span(ctx, "storage/estuary", apiName)
+}
+
+// Compile time interface check:
+var _ storage.StorageProvider = (*StorageProvider)(nil)
@@ -0,0 +1,205 @@
+package estuary
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/filecoin-project/bacalhau/pkg/ipfs/car"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage/cache"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car/v2/blockstore"
+	"github.com/stretchr/testify/require"
+)
+
+// makeCar returns the CID and CAR of a folder with the given files, the
+// same way the estuary publisher makes them
+func makeCar(t *testing.T, files map[string]string) (string, []byte) {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, "results", name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	}
+	carFile := filepath.Join(t.TempDir(), "results.car")
+	cid, err := car.CreateCar(context.Background(), dir, carFile, 1)
+	require.NoError(t, err)
+	data, err := os.ReadFile(carFile)
+	require.NoError(t, err)
+	return cid, data
+}
+
+// rootBlockCar returns a CAR with just the root block of the given CAR, as
+// the gateway sends for dag-scope=block
+func rootBlockCar(t *testing.T, rootCid string, data []byte) []byte {
+	root, err := cid.Decode(rootCid)
+	require.NoError(t, err)
+	fullFile := filepath.Join(t.TempDir(), "full.car")
+	require.NoError(t, os.WriteFile(fullFile, data, 0600))
+	full, err := blockstore.OpenReadOnly(fullFile)
+	require.NoError(t, err)
+	defer full.Close()
+	block, err := full.Get(context.Background(), root)
+	require.NoError(t, err)
+
+	rootFile := filepath.Join(t.TempDir(), "root.car")
+	rootOnly, err := blockstore.OpenReadWrite(rootFile, []cid.Cid{root})
+	require.NoError(t, err)
+	require.NoError(t, rootOnly.Put(context.Background(), block))
+	require.NoError(t, rootOnly.Finalize())
+	rootData, err := os.ReadFile(rootFile)
+	require.NoError(t, err)
+	return rootData
+}
+
+// the dag-scope of each request the gateway has had
+type gatewayRequests struct {
+	mu     sync.Mutex
+	scopes []string
+}
+
+func (r *gatewayRequests) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.scopes...)
+}
+
+// newProvider returns a driver using a gateway that serves the given CARs
+func newProvider(t *testing.T, cars map[string][]byte) (*StorageProvider, *gatewayRequests) {
+	requests := &gatewayRequests{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rootCid := filepath.Base(r.URL.Path)
+		data, ok := cars[rootCid]
+		if !ok || r.URL.Query().Get("format") != "car" {
+			http.NotFound(w, r)
+			return
+		}
+		scope := r.URL.Query().Get("dag-scope")
+		requests.mu.Lock()
+		requests.scopes = append(requests.scopes, scope)
+		requests.mu.Unlock()
+		if scope == dagScopeBlock {
+			data = rootBlockCar(t, rootCid, data)
+		}
+		w.Header().Set("Content-Type", carContentType)
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+
+	cm := system.NewCleanupManager()
+	t.Cleanup(cm.Cleanup)
+	provider, err := NewStorageProvider(cm)
+	require.NoError(t, err)
+	provider.GatewayURL = server.URL
+	return provider, requests
+}
+
+func TestPrepareStorage(t *testing.T) {
+	cid, data := makeCar(t, map[string]string{
+		"stdout":           "hello",
+		"outputs/data.csv": "a,b",
+	})
+	provider, _ := newProvider(t, map[string][]byte{cid: data})
+	ctx := context.Background()
+	spec := model.StorageSpec{Engine: model.StorageSourceEstuary, Cid: cid, Path: "/inputs"}
+
+	size, err := provider.GetVolumeSize(ctx, spec)
+	require.NoError(t, err)
+	// the root block of a folder counts the blocks under it as well
+	require.GreaterOrEqual(t, size, uint64(8))
+	require.Less(t, size, uint64(len(data)))
+
+	volume, err := provider.PrepareStorage(ctx, spec)
+	require.NoError(t, err)
+	require.Equal(t, "/inputs", volume.Target)
+	content, err := os.ReadFile(filepath.Join(volume.Source, "results", "outputs", "data.csv"))
+	require.NoError(t, err)
+	require.Equal(t, "a,b", string(content))
+
+	require.NoError(t, provider.CleanupStorage(ctx, spec, volume))
+	_, err = os.Stat(volume.Source)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestExplode(t *testing.T) {
+	cid, data := makeCar(t, map[string]string{
+		"a.txt": "a",
+		"b.txt": "b",
+	})
+	provider, _ := newProvider(t, map[string][]byte{cid: data})
+
+	specs, err := provider.Explode(context.Background(), model.StorageSpec{
+		Engine: model.StorageSourceEstuary,
+		Cid:    cid,
+		Path:   "/inputs/",
+	})
+	require.NoError(t, err)
+	paths := []string{}
+	for _, spec := range specs {
+		require.Equal(t, model.StorageSourceEstuary, spec.Engine)
+		require.NotEmpty(t, spec.Cid)
+		paths = append(paths, spec.Path)
+	}
+	require.Equal(t, []string{"/inputs", "/inputs/results", "/inputs/results/a.txt", "/inputs/results/b.txt"}, paths)
+}
+
+func TestRejectsBadContent(t *testing.T) {
+	cid, data := makeCar(t, map[string]string{"stdout": "the original content"})
+	tampered := bytes.Replace(data, []byte("original"), []byte("tampered"), 1)
+	require.NotEqual(t, data, tampered)
+	provider, _ := newProvider(t, map[string][]byte{cid: tampered})
+	ctx := context.Background()
+
+	_, err := provider.PrepareStorage(ctx, model.StorageSpec{Engine: model.StorageSourceEstuary, Cid: cid, Path: "/inputs"})
+	require.Error(t, err)
+
+	otherCid, _ := makeCar(t, map[string]string{"stdout": "not served"})
+	_, err = provider.PrepareStorage(ctx, model.StorageSpec{Engine: model.StorageSourceEstuary, Cid: otherCid, Path: "/inputs"})
+	require.Error(t, err)
+
+	_, err = provider.PrepareStorage(ctx, model.StorageSpec{Engine: model.StorageSourceEstuary, Cid: "../../etc", Path: "/inputs"})
+	require.Error(t, err)
+
+	// nothing is left behind
+	entries, err := os.ReadDir(provider.LocalDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestCarCache(t *testing.T) {
+	cid, data := makeCar(t, map[string]string{
+		"a.txt": "a",
+		"b.txt": "bb",
+	})
+	provider, requests := newProvider(t, map[string][]byte{cid: data})
+	cm := system.NewCleanupManager()
+	t.Cleanup(cm.Cleanup)
+	carCache, err := cache.NewCache(cm, uint64(len(data)))
+	require.NoError(t, err)
+	provider.CarCache = carCache
+	ctx := context.Background()
+	spec := model.StorageSpec{Engine: model.StorageSourceEstuary, Cid: cid, Path: "/inputs"}
+
+	// sizing only needs the root block
+	_, err = provider.GetVolumeSize(ctx, spec)
+	require.NoError(t, err)
+	require.Equal(t, []string{dagScopeBlock}, requests.get())
+
+	_, err = provider.Explode(ctx, spec)
+	require.NoError(t, err)
+	volume, err := provider.PrepareStorage(ctx, spec)
+	require.NoError(t, err)
+	require.NoError(t, provider.CleanupStorage(ctx, spec, volume))
+	// and once we have the content the size is exact
+	size, err := provider.GetVolumeSize(ctx, spec)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), size)
+	require.Equal(t, []string{dagScopeBlock, dagScopeAll}, requests.get())
+}
@@ -0,0 +1,115 @@
+package filecoin
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// an offer from a miner to retrieve some content, as listed by
+// 'lotus client find'
+type offer struct {
+	miner string
+	// in FIL
+	price *big.Rat
+	// in bytes - lotus rounds it for display so this is close, not exact
+	size uint64
+}
+
+// parseFind reads the output of 'lotus client find', which is a LOCAL line
+// if the lotus node has the content and a line per miner of the form
+// 'RETRIEVAL <miner>@<peer>-<price>-<size>'
+func parseFind(output string) (offers []offer, local bool, err error) {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "LOCAL":
+			local = true
+		case strings.HasPrefix(line, "RETRIEVAL "):
+			parts := strings.Split(strings.TrimPrefix(line, "RETRIEVAL "), "-")
+			if len(parts) != 3 { //nolint:gomnd // the three parts of the line
+				return nil, false, fmt.Errorf("could not read retrieval offer: %s", line)
+			}
+			price, err := ParsePrice(parts[1])
+			if err != nil {
+				return nil, false, err
+			}
+			size, err := parseSize(parts[2])
+			if err != nil {
+				return nil, false, err
+			}
+			offers = append(offers, offer{
+				miner: strings.SplitN(parts[0], "@", 2)[0], //nolint:gomnd // the miner and its peer
+				price: price,
+				size:  size,
+			})
+		}
+	}
+	return offers, local, nil
+}
+
+// parseLocal finds where the lotus node imported the content from in the
+// output of 'lotus client local', which is a line per import of the form
+// '<id>: <cid> @<path> (<source>)'
+func parseLocal(output, contentCid string) (string, bool) {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 3) //nolint:gomnd // the id, cid and the rest
+		if len(fields) != 3 || fields[1] != contentCid || !strings.HasPrefix(fields[2], "@") {
+			continue
+		}
+		importPath := strings.TrimPrefix(fields[2], "@")
+		if i := strings.LastIndex(importPath, " ("); i >= 0 {
+			importPath = importPath[:i]
+		}
+		return importPath, importPath != ""
+	}
+	return "", false
+}
+
+// ParsePrice reads an amount of FIL, with or without the unit.
+func ParsePrice(price string) (*big.Rat, error) {
+	value := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(price), "FIL"))
+	amount, ok := new(big.Rat).SetString(value)
+	if !ok || amount.Sign() < 0 {
+		return nil, fmt.Errorf("invalid FIL amount: %q", price)
+	}
+	return amount, nil
+}
+
+var sizeUnits = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+// parseSize reads sizes such as '2.031 KiB' in the way lotus prints them
+func parseSize(size string) (uint64, error) {
+	fields := strings.Fields(size)
+	if len(fields) != 2 { //nolint:gomnd // the number and its unit
+		return 0, fmt.Errorf("invalid size: %q", size)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size: %q", size)
+	}
+	for _, unit := range sizeUnits {
+		if fields[1] == unit {
+			return uint64(value), nil
+		}
+		value *= 1024
+	}
+	return 0, fmt.Errorf("invalid size unit: %q", size)
+}
+
+// cheapest returns the cheapest offer that costs at most maxPrice
+func cheapest(offers []offer, maxPrice *big.Rat) (offer, bool) {
+	var best offer
+	found := false
+	for _, o := range offers {
+		if o.price.Cmp(maxPrice) > 0 {
+			continue
+		}
+		if !found || o.price.Cmp(best.price) < 0 {
+			best = o
+			found = true
+		}
+	}
+	return best, found
+}
@@ -0,0 +1,303 @@
+package filecoin
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/bacalhau/pkg/config"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	"github.com/ipfs/go-cid"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// a storage driver that makes a retrieval deal through the lotus client
+// for content stored on filecoin, retrieving it into a local directory in
+// preparation for a job to run - it will remove the content once complete
+//
+// it only takes offers that cost at most the max price in its config, and
+// that defaults to nothing so a node doesn't spend FIL unless it is told
+// to. The filecoin unsealed driver is for nodes that have the data on disk.
+
+// DefaultMaxPrice only allows free retrievals.
+const DefaultMaxPrice = "0"
+
+// how often the progress of a retrieval is logged
+const progressLogInterval = 10 * time.Second
+
+type StorageProviderConfig struct {
+	// the lotus binary - found on the path if empty
+	ExecutablePath string
+	// the most this node pays to retrieve an input, in FIL
+	MaxPrice string
+}
+
+type StorageProvider struct {
+	Config   StorageProviderConfig
+	LocalDir string
+	// called with the latest progress line from lotus as content is
+	// retrieved - logs it by default. The progress is also reported to
+	// the shard waiting for it through storage.ReportProgress.
+	OnProgress func(contentCid, progress string)
+
+	maxPrice *big.Rat
+}
+
+func NewStorageProvider(cm *system.CleanupManager, storageConfig StorageProviderConfig) (*StorageProvider, error) {
+	if storageConfig.MaxPrice == "" {
+		storageConfig.MaxPrice = DefaultMaxPrice
+	}
+	maxPrice, err := ParsePrice(storageConfig.MaxPrice)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filecoin retrieval max price: %w", err)
+	}
+
+	dir, err := os.MkdirTemp(config.GetStoragePath(), "bacalhau-filecoin")
+	if err != nil {
+		return nil, err
+	}
+	cm.RegisterCallback(func() error {
+		return os.RemoveAll(dir)
+	})
+
+	storageHandler := &StorageProvider{
+		Config:     storageConfig,
+		LocalDir:   dir,
+		OnProgress: logProgress(),
+		maxPrice:   maxPrice,
+	}
+
+	log.Debug().Msgf("Filecoin driver created with output dir: %s", dir)
+	return storageHandler, nil
+}
+
+func (sp *StorageProvider) IsInstalled(ctx context.Context) (bool, error) {
+	_, err := sp.runLotusCommand(ctx, []string{"version"}, nil)
+	return err == nil, nil
+}
+
+// HasStorageLocally is whether the content has been imported into the lotus
+// node, in which case it is retrieved without a deal
+func (sp *StorageProvider) HasStorageLocally(ctx context.Context, volume model.StorageSpec) (bool, error) {
+	ctx, span := newSpan(ctx, "HasStorageLocally")
+	defer span.End()
+
+	output, err := sp.runLotusCommand(ctx, []string{"client", "local"}, nil)
+	if err != nil {
+		return false, nil
+	}
+	for _, field := range strings.Fields(output) {
+		if field == volume.Cid {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetVolumeSize asks the miners for offers and returns the size of the one
+// that would be taken, or the size of the lotus node's own copy if it has one
+// and we can't afford any of them
+func (sp *StorageProvider) GetVolumeSize(ctx context.Context, volume model.StorageSpec) (uint64, error) {
+	ctx, span := newSpan(ctx, "GetVolumeSize")
+	defer span.End()
+
+	best, local, err := sp.findOffer(ctx, volume.Cid)
+	if err != nil {
+		return 0, err
+	}
+	if best.miner != "" || !local {
+		return best.size, nil
+	}
+	output, err := sp.runLotusCommand(ctx, []string{"client", "local"}, nil)
+	if err != nil {
+		return 0, err
+	}
+	importPath, ok := parseLocal(output, volume.Cid)
+	if !ok {
+		return 0, fmt.Errorf("lotus has %s but does not list where it was imported from", volume.Cid)
+	}
+	size, err := pathSize(importPath)
+	if err != nil {
+		return 0, fmt.Errorf("could not work out the size of %s imported from %s: %w", volume.Cid, importPath, err)
+	}
+	return size, nil
+}
+
+func (sp *StorageProvider) PrepareStorage(ctx context.Context, storageSpec model.StorageSpec) (storage.StorageVolume, error) {
+	ctx, span := newSpan(ctx, "PrepareStorage")
+	defer span.End()
+
+	best, local, err := sp.findOffer(ctx, storageSpec.Cid)
+	if err != nil {
+		return storage.StorageVolume{}, err
+	}
+	outputPath, err := os.MkdirTemp(sp.LocalDir, "*")
+	if err != nil {
+		return storage.StorageVolume{}, err
+	}
+	source := filepath.Join(outputPath, "data")
+
+	args := []string{"client", "retrieve", "--maxPrice", sp.Config.MaxPrice}
+	if local {
+		args = append(args, "--allow-local")
+	} else {
+		args = append(args, "--provider", best.miner)
+	}
+	args = append(args, storageSpec.Cid, source)
+	log.Debug().Msgf("retrieving %s from filecoin (miner: %s, local: %t)", storageSpec.Cid, best.miner, local)
+	_, err = sp.runLotusCommand(ctx, args, func(line string) {
+		progress := strings.TrimPrefix(line, "> ")
+		if progress == line {
+			return
+		}
+		if sp.OnProgress != nil {
+			sp.OnProgress(storageSpec.Cid, progress)
+		}
+		storage.ReportProgress(ctx, fmt.Sprintf("retrieving %s from filecoin: %s", storageSpec.Cid, progress))
+	})
+	storage.ReportProgress(ctx, "")
+	if err != nil {
+		_ = os.RemoveAll(outputPath)
+		return storage.StorageVolume{}, fmt.Errorf("could not retrieve %s from filecoin: %w", storageSpec.Cid, err)
+	}
+
+	return storage.StorageVolume{
+		Type:   storage.StorageVolumeConnectorBind,
+		Source: source,
+		Target: storageSpec.Path,
+	}, nil
+}
+
+//nolint:lll // Exception to the long rule
+func (sp *StorageProvider) CleanupStorage(ctx context.Context, storageSpec model.StorageSpec, volume storage.StorageVolume) error {
+	return os.RemoveAll(filepath.Dir(volume.Source))
+}
+
+// content is stored on filecoin by the lotus publisher
+func (sp *StorageProvider) Upload(ctx context.Context, localPath string) (model.StorageSpec, error) {
+	return model.StorageSpec{}, fmt.Errorf("not implemented")
+}
+
+// a retrieval deal is for the whole of the content so explode always
+// results in the spec
+func (sp *StorageProvider) Explode(ctx context.Context, spec model.StorageSpec) ([]model.StorageSpec, error) {
+	return []model.StorageSpec{spec}, nil
+}
+
+// findOffer returns the cheapest offer we can afford and whether the lotus
+// node has the content itself
+func (sp *StorageProvider) findOffer(ctx context.Context, contentCid string) (offer, bool, error) {
+	if _, err := cid.Decode(contentCid); err != nil {
+		return offer{}, false, fmt.Errorf("invalid filecoin cid %q: %w", contentCid, err)
+	}
+	output, err := sp.runLotusCommand(ctx, []string{"client", "find", contentCid}, nil)
+	if err != nil {
+		return offer{}, false, err
+	}
+	offers, local, err := parseFind(output)
+	if err != nil {
+		return offer{}, false, err
+	}
+	best, ok := cheapest(offers, sp.maxPrice)
+	if !ok && !local {
+		return offer{}, false, fmt.Errorf("none of the %d offers to retrieve %s cost at most %s FIL",
+			len(offers), contentCid, sp.Config.MaxPrice)
+	}
+	// retrieving what the lotus node has is free
+	return best, local, nil
+}
+
+func pathSize(path string) (uint64, error) {
+	var size uint64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += uint64(info.Size())
+		}
+		return nil
+	})
+	return size, err
+}
+
+// runLotusCommand runs the lotus client, passing each line it writes to
+// onLine as it goes
+func (sp *StorageProvider) runLotusCommand(ctx context.Context, args []string, onLine func(string)) (string, error) {
+	ctx, span := newSpan(ctx, "runLotusCommand")
+	defer span.End()
+
+	executablePath := sp.Config.ExecutablePath
+	if executablePath == "" {
+		var err error
+		if executablePath, err = exec.LookPath("lotus"); err != nil {
+			return "", err
+		}
+	}
+	log.Trace().Msgf("Command: %s %s", executablePath, args)
+
+	reader, writer := io.Pipe()
+	cmd := exec.CommandContext(ctx, executablePath, args...)
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	var output strings.Builder
+	scanned := make(chan struct{})
+	go func() {
+		defer close(scanned)
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			output.WriteString(scanner.Text() + "\n")
+			if onLine != nil {
+				onLine(scanner.Text())
+			}
+		}
+		// keep draining so lotus isn't blocked on a line that is too long
+		_, _ = io.Copy(io.Discard, reader)
+	}()
+	err := cmd.Wait()
+	_ = writer.Close()
+	<-scanned
+
+	if err != nil {
+		return output.String(), fmt.Errorf("lotus %s failed: %w: %s",
+			strings.Join(args, " "), err, strings.TrimSpace(output.String()))
+	}
+	return output.String(), nil
+}
+
+// logProgress logs the progress of retrievals, but not every line lotus writes
+func logProgress() func(contentCid, progress string) {
+	var mutex sync.Mutex
+	lastLogged := map[string]time.Time{}
+	return func(contentCid, progress string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if time.Since(lastLogged[contentCid]) < progressLogInterval {
+			return
+		}
+		lastLogged[contentCid] = time.Now()
+		log.Info().Msgf("retrieving %s from filecoin: %s", contentCid, progress)
+	}
+}
+
+func newSpan(ctx context.Context, apiName string) (context.Context, trace.Span) {
+	return system.Span(ctx, "storage/filecoin", apiName)
+}
+
+// Compile time interface check:
+var _ storage.StorageProvider = (*StorageProvider)(nil)
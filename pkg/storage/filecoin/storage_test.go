@@ -0,0 +1,190 @@
+package filecoin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	"github.com/stretchr/testify/require"
+)
+
+const testCid = "QmQEDtn7tSFxgquj5ZHdFVKimSb14w1bmnbGyRQ5ukQLcF"
+
+// newProvider returns a driver using the mock lotus, which retrieves a file
+// with the given content and logs its commands to the returned file
+func newProvider(t *testing.T, maxPrice, offers string) (*StorageProvider, string) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source")
+	require.NoError(t, os.WriteFile(source, []byte("hello"), 0600))
+	logFile := filepath.Join(dir, "logs.txt")
+	t.Setenv("LOTUS_LOGFILE", logFile)
+	t.Setenv("LOTUS_TEST_OFFERS", offers)
+	t.Setenv("LOTUS_TEST_RETRIEVE_SOURCE", source)
+
+	cm := system.NewCleanupManager()
+	t.Cleanup(cm.Cleanup)
+	provider, err := NewStorageProvider(cm, StorageProviderConfig{
+		ExecutablePath: "../../../testdata/mocks/lotus.sh",
+		MaxPrice:       maxPrice,
+	})
+	require.NoError(t, err)
+	return provider, logFile
+}
+
+func readCommands(t *testing.T, logFile string) []string {
+	logs, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	commands := []string{}
+	for _, line := range strings.Split(string(logs), "\n") {
+		if strings.HasPrefix(line, "command: ") {
+			commands = append(commands, strings.TrimPrefix(line, "command: "))
+		}
+	}
+	return commands
+}
+
+func TestParseFind(t *testing.T) {
+	offers, local, err := parseFind(`LOCAL
+RETRIEVAL f01000@12D3KooWPeer1-0.0000001 FIL-2.5 KiB
+ERR f01002@12D3KooWPeer3: deal rejected
+RETRIEVAL f01001@12D3KooWPeer2-0 FIL-10 B
+`)
+	require.NoError(t, err)
+	require.True(t, local)
+	require.Len(t, offers, 2)
+	require.Equal(t, "f01000", offers[0].miner)
+	require.Equal(t, uint64(2560), offers[0].size)
+	require.Equal(t, "1/10000000", offers[0].price.RatString())
+
+	maxPrice, err := ParsePrice("0.000001 FIL")
+	require.NoError(t, err)
+	best, ok := cheapest(offers, maxPrice)
+	require.True(t, ok)
+	require.Equal(t, "f01001", best.miner)
+
+	_, _, err = parseFind("RETRIEVAL f01000@peer-lots-2 KiB")
+	require.Error(t, err)
+	_, err = ParsePrice("-1")
+	require.Error(t, err)
+}
+
+func TestPrepareStorage(t *testing.T) {
+	provider, logFile := newProvider(t, "0.5",
+		"RETRIEVAL f01000@peer1-1 FIL-5 B\nRETRIEVAL f01001@peer2-0.1 FIL-5 B\nRETRIEVAL f01002@peer3-0.2 FIL-5 B")
+	var mutex sync.Mutex
+	progress := []string{}
+	provider.OnProgress = func(contentCid, line string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		progress = append(progress, contentCid+": "+line)
+	}
+	reported := []string{}
+	ctx := storage.WithProgress(context.Background(), func(progress string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		reported = append(reported, progress)
+	})
+	spec := model.StorageSpec{Engine: model.StorageSourceFilecoin, Cid: testCid, Path: "/inputs/data"}
+
+	size, err := provider.GetVolumeSize(ctx, spec)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), size)
+
+	volume, err := provider.PrepareStorage(ctx, spec)
+	require.NoError(t, err)
+	require.Equal(t, "/inputs/data", volume.Target)
+	content, err := os.ReadFile(volume.Source)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(content))
+	require.Len(t, progress, 2)
+	require.True(t, strings.HasPrefix(progress[1], testCid+": Recv: 5 B"), progress[1])
+	// the shard waiting for it hears the same, and when it is done
+	require.Len(t, reported, 3)
+	require.True(t, strings.HasPrefix(reported[1], "retrieving "+testCid+" from filecoin: Recv: 5 B"), reported[1])
+	require.Equal(t, "", reported[2])
+
+	// the cheapest offer within the max price is taken
+	commands := readCommands(t, logFile)
+	require.Equal(t, "client retrieve --maxPrice 0.5 --provider f01001 "+testCid+" "+volume.Source, commands[len(commands)-1])
+
+	require.NoError(t, provider.CleanupStorage(ctx, spec, volume))
+	_, err = os.Stat(volume.Source)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestPriceLimit(t *testing.T) {
+	// the max price defaults to only free retrievals
+	provider, logFile := newProvider(t, "", "RETRIEVAL f01000@peer1-0.0001 FIL-5 B")
+	ctx := context.Background()
+	spec := model.StorageSpec{Engine: model.StorageSourceFilecoin, Cid: testCid, Path: "/inputs"}
+
+	_, err := provider.GetVolumeSize(ctx, spec)
+	require.Error(t, err)
+	_, err = provider.PrepareStorage(ctx, spec)
+	require.Error(t, err)
+	for _, command := range readCommands(t, logFile) {
+		require.False(t, strings.Contains(command, "retrieve"), command)
+	}
+
+	cm := system.NewCleanupManager()
+	defer cm.Cleanup()
+	_, err = NewStorageProvider(cm, StorageProviderConfig{MaxPrice: "a lot"})
+	require.Error(t, err)
+}
+
+func TestRetrieveLocal(t *testing.T) {
+	provider, logFile := newProvider(t, "", "RETRIEVAL f01000@peer1-0.0001 FIL-2 KiB")
+	t.Setenv("LOTUS_TEST_LOCAL_CID", testCid)
+	ctx := context.Background()
+	spec := model.StorageSpec{Engine: model.StorageSourceFilecoin, Cid: testCid, Path: "/inputs"}
+
+	// we can't afford the offer so the size is of what lotus imported
+	t.Setenv("LOTUS_TEST_LOCAL_PATH", os.Getenv("LOTUS_TEST_RETRIEVE_SOURCE"))
+	size, err := provider.GetVolumeSize(ctx, spec)
+	require.NoError(t, err)
+	require.Equal(t, uint64(len("hello")), size)
+	t.Setenv("LOTUS_TEST_LOCAL_PATH", filepath.Join(t.TempDir(), "gone"))
+	_, err = provider.GetVolumeSize(ctx, spec)
+	require.Error(t, err)
+
+	installed, err := provider.IsInstalled(ctx)
+	require.NoError(t, err)
+	require.True(t, installed)
+	hasStorage, err := provider.HasStorageLocally(ctx, spec)
+	require.NoError(t, err)
+	require.True(t, hasStorage)
+
+	volume, err := provider.PrepareStorage(ctx, spec)
+	require.NoError(t, err)
+	commands := readCommands(t, logFile)
+	require.Equal(t, "client retrieve --maxPrice 0 --allow-local "+testCid+" "+volume.Source, commands[len(commands)-1])
+	require.NoError(t, provider.CleanupStorage(ctx, spec, volume))
+
+	hasStorage, err = provider.HasStorageLocally(ctx, model.StorageSpec{Cid: "QmOther"})
+	require.NoError(t, err)
+	require.False(t, hasStorage)
+}
+
+func TestRetrieveFails(t *testing.T) {
+	provider, _ := newProvider(t, "", "RETRIEVAL f01000@peer1-0 FIL-5 B")
+	t.Setenv("LOTUS_TEST_RETRIEVE_SOURCE", "")
+	ctx := context.Background()
+
+	_, err := provider.PrepareStorage(ctx, model.StorageSpec{Engine: model.StorageSourceFilecoin, Cid: testCid, Path: "/inputs"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to retrieve")
+
+	_, err = provider.PrepareStorage(ctx, model.StorageSpec{Engine: model.StorageSourceFilecoin, Cid: "not-a-cid", Path: "/inputs"})
+	require.Error(t, err)
+
+	// nothing is left behind
+	entries, err := os.ReadDir(provider.LocalDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
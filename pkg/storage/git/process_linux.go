@@ -0,0 +1,17 @@
+package git
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// git runs helpers (e.g. git-remote-http) that would keep talking to the
+// remote if we only killed git, so it gets its own process group and we
+// kill all of it
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,66 @@
+package git
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+)
+
+// the commit to check out, as a full hash so it can't change under us
+const MetadataCommit = "commit"
+
+var commitRegex = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// scp like ssh URLs e.g. git@github.com:filecoin-project/bacalhau.git
+var scpURLRegex = regexp.MustCompile(`^([^@/]+@)?[^@/:]+:`)
+
+// NewStorageSpec returns the spec for the repository at the commit, mounted
+// at path.
+func NewStorageSpec(repo, commit, path string) model.StorageSpec {
+	return model.StorageSpec{
+		Engine:   model.StorageSourceGit,
+		URL:      repo,
+		Path:     path,
+		Metadata: map[string]string{MetadataCommit: commit},
+	}
+}
+
+// ParseRef splits a repo@commit reference.
+func ParseRef(ref string) (repo, commit string, err error) {
+	lastInd := strings.LastIndex(ref, "@")
+	if lastInd < 0 {
+		return "", "", fmt.Errorf("expected repo@commit but got: %s", ref)
+	}
+	repo, commit = ref[:lastInd], ref[lastInd+1:]
+	err = ValidateSpec(NewStorageSpec(repo, commit, ""))
+	return repo, commit, err
+}
+
+// ValidateSpec checks the spec has a repository and a full commit hash.
+func ValidateSpec(spec model.StorageSpec) error {
+	if spec.URL == "" || strings.HasPrefix(spec.URL, "-") {
+		return fmt.Errorf("invalid git repository: '%s'", spec.URL)
+	}
+	if commit := spec.Metadata[MetadataCommit]; !commitRegex.MatchString(commit) {
+		return fmt.Errorf("git inputs must be pinned to a full commit hash but got: '%s'", commit)
+	}
+	return nil
+}
+
+// IsLocalURL is whether the repository is on the filesystem of the node
+// rather than a server.
+func IsLocalURL(url string) bool {
+	if strings.HasPrefix(url, "file://") {
+		return true
+	}
+	return !strings.Contains(url, "://") && !scpURLRegex.MatchString(url)
+}
+
+func hashString(s string) string {
+	hash := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,427 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/bacalhau/pkg/config"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage"
+	"github.com/filecoin-project/bacalhau/pkg/storage/util"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// a storage driver that checks out a git repository at a pinned commit
+// into a local directory in preparation for a job to run - it will remove
+// the checkout once complete
+//
+// the spec URL is the repository and the commit is in its metadata. Commits
+// are fetched into a bare repository per URL that is kept while the node
+// runs, so the next job using the same repository only fetches what is new.
+// The least recently used bare repositories are removed once they take up
+// more than MaxRepoSize. The checkout has no .git folder, its files are read
+// only and links that leave it are removed, so every node gives the job the
+// same bytes and nothing else.
+
+// DefaultMaxRepoSize is how much disk the bare repositories can use unless
+// the node says otherwise.
+const DefaultMaxRepoSize = 5 * 1024 * 1024 * 1024
+
+// DefaultFetchTimeout is how long a fetch from a remote can take before we
+// give up on it.
+const DefaultFetchTimeout = 10 * time.Minute
+
+type StorageProvider struct {
+	LocalDir string
+	// whether repositories on this node's filesystem can be used - only
+	// turn this on for testing as it lets jobs read any repository here
+	AllowLocal bool
+	// how many bytes the bare repositories can add up to
+	MaxRepoSize uint64
+	// how long a fetch from a remote can take - the job picks the remote
+	// so it might never answer
+	FetchTimeout time.Duration
+
+	// guards repos and what we know about each repository - it is never
+	// held while git talks to a remote
+	mutex sync.Mutex
+	repos map[string]*bareRepo
+}
+
+type bareRepo struct {
+	// fetches into the repository one at a time, without holding up
+	// fetches into the others
+	fetchMutex sync.Mutex
+
+	size uint64
+	// how many fetches, sizes and checkouts are using it
+	refs     int
+	lastUsed time.Time
+}
+
+func NewStorageProvider(cm *system.CleanupManager) (*StorageProvider, error) {
+	dir, err := os.MkdirTemp(config.GetStoragePath(), "bacalhau-git")
+	if err != nil {
+		return nil, err
+	}
+	cm.RegisterCallback(func() error {
+		return os.RemoveAll(dir)
+	})
+
+	storageHandler := &StorageProvider{
+		LocalDir:     dir,
+		MaxRepoSize:  DefaultMaxRepoSize,
+		FetchTimeout: DefaultFetchTimeout,
+		repos:        map[string]*bareRepo{},
+	}
+
+	log.Debug().Msgf("Git driver created with output dir: %s", dir)
+	return storageHandler, nil
+}
+
+func (sp *StorageProvider) IsInstalled(ctx context.Context) (bool, error) {
+	_, err := exec.LookPath("git")
+	return err == nil, nil
+}
+
+func (sp *StorageProvider) HasStorageLocally(ctx context.Context, volume model.StorageSpec) (bool, error) {
+	ctx, span := newSpan(ctx, "HasStorageLocally")
+	defer span.End()
+	if ValidateSpec(volume) != nil {
+		return false, nil
+	}
+	repoDir := sp.repoDir(volume.URL)
+	if _, err := os.Stat(repoDir); err != nil {
+		return false, nil
+	}
+	return hasCommit(ctx, repoDir, volume.Metadata[MetadataCommit]), nil
+}
+
+// GetVolumeSize fetches the commit and adds up the size of the files in it
+func (sp *StorageProvider) GetVolumeSize(ctx context.Context, volume model.StorageSpec) (uint64, error) {
+	ctx, span := newSpan(ctx, "GetVolumeSize")
+	defer span.End()
+
+	repoDir, err := sp.fetch(ctx, volume)
+	if err != nil {
+		return 0, err
+	}
+	defer sp.release(repoDir)
+	tree, err := runGit(ctx, nil, "--git-dir", repoDir, "ls-tree", "-r", "-l", "--full-tree", volume.Metadata[MetadataCommit])
+	if err != nil {
+		return 0, err
+	}
+	var size uint64
+	for _, line := range strings.Split(strings.TrimSpace(tree), "\n") {
+		// <mode> <type> <object> <size>\t<path> - submodules have no size
+		fields := strings.Fields(strings.SplitN(line, "\t", 2)[0])
+		if len(fields) != 4 || fields[3] == "-" {
+			continue
+		}
+		fileSize, err := strconv.ParseUint(fields[3], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("could not read the size of a file in %s: %s", volume.URL, line)
+		}
+		size += fileSize
+	}
+	return size, nil
+}
+
+func (sp *StorageProvider) PrepareStorage(ctx context.Context, storageSpec model.StorageSpec) (storage.StorageVolume, error) {
+	ctx, span := newSpan(ctx, "PrepareStorage")
+	defer span.End()
+
+	repoDir, err := sp.fetch(ctx, storageSpec)
+	if err != nil {
+		return storage.StorageVolume{}, err
+	}
+	defer sp.release(repoDir)
+
+	outputPath, err := os.MkdirTemp(sp.LocalDir, "checkout-*")
+	if err != nil {
+		return storage.StorageVolume{}, err
+	}
+	source := filepath.Join(outputPath, "repo")
+	err = checkout(ctx, repoDir, storageSpec.Metadata[MetadataCommit], source)
+	if err != nil {
+		_ = os.RemoveAll(outputPath)
+		return storage.StorageVolume{}, fmt.Errorf("could not check out %s at %s: %w",
+			storageSpec.URL, storageSpec.Metadata[MetadataCommit], err)
+	}
+
+	return storage.StorageVolume{
+		Type:   storage.StorageVolumeConnectorBind,
+		Source: source,
+		Target: storageSpec.Path,
+	}, nil
+}
+
+//nolint:lll // Exception to the long rule
+func (sp *StorageProvider) CleanupStorage(ctx context.Context, storageSpec model.StorageSpec, volume storage.StorageVolume) error {
+	// only the files are read only so the folders can still be removed
+	return os.RemoveAll(filepath.Dir(volume.Source))
+}
+
+func (sp *StorageProvider) Upload(ctx context.Context, localPath string) (model.StorageSpec, error) {
+	return model.StorageSpec{}, fmt.Errorf("not implemented")
+}
+
+// a checkout is mounted as a whole so explode always results in the spec
+func (sp *StorageProvider) Explode(ctx context.Context, spec model.StorageSpec) ([]model.StorageSpec, error) {
+	return []model.StorageSpec{
+		{
+			Name:     spec.Name,
+			Engine:   model.StorageSourceGit,
+			Path:     spec.Path,
+			URL:      spec.URL,
+			Metadata: spec.Metadata,
+		},
+	}, nil
+}
+
+// fetch makes sure the bare repository for the spec's URL has its commit,
+// fetching only that commit if the server lets us and everything otherwise.
+// The repository is kept until release is called with what fetch returns.
+func (sp *StorageProvider) fetch(ctx context.Context, spec model.StorageSpec) (string, error) {
+	if err := ValidateSpec(spec); err != nil {
+		return "", err
+	}
+	if !sp.AllowLocal && IsLocalURL(spec.URL) {
+		return "", fmt.Errorf("git repositories on the compute node cannot be used: %s", spec.URL)
+	}
+	commit := spec.Metadata[MetadataCommit]
+
+	repoDir, repo, err := sp.acquire(ctx, spec.URL)
+	if err != nil {
+		return "", err
+	}
+	err = sp.fetchCommit(ctx, repoDir, repo, spec.URL, commit)
+	if err != nil {
+		sp.release(repoDir)
+		return "", err
+	}
+	return repoDir, nil
+}
+
+// acquire returns the bare repository for a URL, creating it if we don't
+// have one, and keeps it until release is called
+func (sp *StorageProvider) acquire(ctx context.Context, url string) (string, *bareRepo, error) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+
+	repoDir := sp.repoDir(url)
+	repo, ok := sp.repos[repoDir]
+	if !ok {
+		if _, err := runGit(ctx, nil, "init", "--quiet", "--bare", repoDir); err != nil {
+			return "", nil, err
+		}
+		repo = &bareRepo{}
+		sp.repos[repoDir] = repo
+	}
+	repo.refs++
+	repo.lastUsed = time.Now()
+	return repoDir, repo, nil
+}
+
+// fetchCommit fetches the commit into the repository if it isn't there
+// already - only fetches into the same repository wait for each other
+func (sp *StorageProvider) fetchCommit(ctx context.Context, repoDir string, repo *bareRepo, url, commit string) error {
+	repo.fetchMutex.Lock()
+	defer repo.fetchMutex.Unlock()
+
+	if hasCommit(ctx, repoDir, commit) {
+		return nil
+	}
+	// whatever happens the repository may have grown
+	defer sp.measure(repoDir, repo)
+
+	timeout := sp.FetchTimeout
+	if timeout <= 0 {
+		timeout = DefaultFetchTimeout
+	}
+	fetchCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err := runGit(fetchCtx, nil, "--git-dir", repoDir, "fetch", "--quiet", "--no-tags", "--depth", "1", url, commit)
+	if err != nil && fetchCtx.Err() == nil {
+		log.Debug().Msgf("could not fetch just %s from %s, fetching everything: %s", commit, url, err)
+		args := []string{"--git-dir", repoDir, "fetch", "--quiet", "--tags"}
+		if _, err = os.Stat(filepath.Join(repoDir, "shallow")); err == nil {
+			args = append(args, "--unshallow")
+		}
+		args = append(args, url, "+refs/heads/*:refs/remotes/origin/*")
+		_, err = runGit(fetchCtx, nil, args...)
+	}
+	if errors.Is(fetchCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("could not fetch %s in %s", url, timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("could not fetch %s: %w", url, err)
+	}
+	if !hasCommit(ctx, repoDir, commit) {
+		return fmt.Errorf("commit %s is not in %s", commit, url)
+	}
+	return nil
+}
+
+// release says the caller of fetch has finished with the repository
+func (sp *StorageProvider) release(repoDir string) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	if repo, ok := sp.repos[repoDir]; ok {
+		repo.refs--
+	}
+	sp.prune()
+}
+
+// measure works out how much disk a repository uses after a fetch
+func (sp *StorageProvider) measure(repoDir string, repo *bareRepo) {
+	size, err := dirSize(repoDir)
+	if err != nil {
+		log.Warn().Msgf("could not work out the size of %s: %s", repoDir, err)
+		return
+	}
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	repo.size = size
+}
+
+// prune removes the least recently used repositories that no one is using
+// until they fit in MaxRepoSize - the mutex must be held
+func (sp *StorageProvider) prune() {
+	var total uint64
+	unused := []string{}
+	for repoDir, repo := range sp.repos {
+		total += repo.size
+		if repo.refs <= 0 {
+			unused = append(unused, repoDir)
+		}
+	}
+	sort.Slice(unused, func(i, j int) bool {
+		return sp.repos[unused[i]].lastUsed.Before(sp.repos[unused[j]].lastUsed)
+	})
+	for _, repoDir := range unused {
+		if total <= sp.MaxRepoSize {
+			return
+		}
+		log.Debug().Msgf("removing git repository %s to stay under %d bytes", repoDir, sp.MaxRepoSize)
+		if err := os.RemoveAll(repoDir); err != nil {
+			log.Warn().Msgf("could not remove git repository %s: %s", repoDir, err)
+			continue
+		}
+		total -= sp.repos[repoDir].size
+		delete(sp.repos, repoDir)
+	}
+}
+
+func dirSize(dir string) (uint64, error) {
+	var size uint64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += uint64(info.Size())
+		}
+		return nil
+	})
+	return size, err
+}
+
+func (sp *StorageProvider) repoDir(url string) string {
+	return filepath.Join(sp.LocalDir, "repos", hashString(url))
+}
+
+func hasCommit(ctx context.Context, repoDir, commit string) bool {
+	_, err := runGit(ctx, nil, "--git-dir", repoDir, "cat-file", "-e", commit+"^{commit}")
+	return err == nil
+}
+
+// checkout writes the files of the commit to target using a throwaway
+// index, so jobs running at the same time don't share one
+func checkout(ctx context.Context, repoDir, commit, target string) error {
+	if err := os.Mkdir(target, util.OS_ALL_RWX); err != nil {
+		return err
+	}
+	env := []string{"GIT_INDEX_FILE=" + filepath.Join(filepath.Dir(target), "index")}
+	if _, err := runGit(ctx, env, "--git-dir", repoDir, "--work-tree", target, "read-tree", commit); err != nil {
+		return err
+	}
+	if _, err := runGit(ctx, env, "--git-dir", repoDir, "--work-tree", target, "checkout-index", "--all", "--force"); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(filepath.Dir(target), "index")); err != nil {
+		return err
+	}
+	if err := util.RemoveEscapingLinks(target); err != nil {
+		return err
+	}
+	return filepath.Walk(target, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		return os.Chmod(path, info.Mode().Perm()&^util.OS_ALL_W)
+	})
+}
+
+// runGit runs git without the node's own git config, which could change
+// the files that are checked out, and without asking for passwords
+func runGit(ctx context.Context, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-c", "core.autocrlf=false"}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_CONFIG_GLOBAL="+os.DevNull,
+	)
+	cmd.Env = append(cmd.Env, env...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	// exec.CommandContext only kills git, and Wait would then wait for its
+	// helpers to close their output
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			killProcessGroup(cmd)
+		case <-done:
+		}
+	}()
+
+	err := cmd.Wait()
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok { //nolint:errorlint // Wait returns it unwrapped
+			return "", fmt.Errorf("git %s failed: %s", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+func newSpan(ctx context.Context, apiName string) (context.Context, trace.Span) {
+	return system.Span(ctx, "storage/git", apiName)
+}
+
+// Compile time interface check:
+var _ storage.StorageProvider = (*StorageProvider)(nil)
@@ -0,0 +1,285 @@
+package git
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	"github.com/stretchr/testify/require"
+)
+
+// a bare repository with two commits, returning their hashes
+func newTestRepo(t *testing.T) (repo, first, second string) {
+	dir := t.TempDir()
+	work := filepath.Join(dir, "work")
+	repo = filepath.Join(dir, "repo.git")
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = work
+		cmd.Env = append(os.Environ(),
+			"GIT_CONFIG_NOSYSTEM=1",
+			"GIT_CONFIG_GLOBAL="+os.DevNull,
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(work, "src"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(work, "README.md"), []byte("hello\r\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(work, "src", "main.py"), []byte("print(1)\n"), 0755))
+	git("init", "--quiet")
+	git("add", ".")
+	git("commit", "--quiet", "-m", "first")
+	first = git("rev-parse", "HEAD")
+	require.NoError(t, os.WriteFile(filepath.Join(work, "src", "main.py"), []byte("print(2)\n"), 0755))
+	git("commit", "--quiet", "-am", "second")
+	second = git("rev-parse", "HEAD")
+	git("clone", "--quiet", "--bare", ".", repo)
+	return repo, first, second
+}
+
+func newTestStorageProvider(t *testing.T) *StorageProvider {
+	cm := system.NewCleanupManager()
+	t.Cleanup(cm.Cleanup)
+	sp, err := NewStorageProvider(cm)
+	require.NoError(t, err)
+	sp.AllowLocal = true
+	return sp
+}
+
+func TestPrepareStorage(t *testing.T) {
+	repo, first, second := newTestRepo(t)
+	sp := newTestStorageProvider(t)
+	ctx := context.Background()
+
+	for commit, main := range map[string]string{first: "print(1)\n", second: "print(2)\n"} {
+		spec := NewStorageSpec(repo, commit, "/code")
+		local, err := sp.HasStorageLocally(ctx, spec)
+		require.NoError(t, err)
+		require.False(t, local)
+
+		volume, err := sp.PrepareStorage(ctx, spec)
+		require.NoError(t, err)
+		require.Equal(t, "/code", volume.Target)
+
+		content, err := os.ReadFile(filepath.Join(volume.Source, "src", "main.py"))
+		require.NoError(t, err)
+		require.Equal(t, main, string(content))
+		// the bytes in the commit, whatever the node's git config says
+		content, err = os.ReadFile(filepath.Join(volume.Source, "README.md"))
+		require.NoError(t, err)
+		require.Equal(t, "hello\r\n", string(content))
+		require.NoDirExists(t, filepath.Join(volume.Source, ".git"))
+
+		info, err := os.Stat(filepath.Join(volume.Source, "src", "main.py"))
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0555), info.Mode().Perm())
+
+		local, err = sp.HasStorageLocally(ctx, spec)
+		require.NoError(t, err)
+		require.True(t, local)
+
+		require.NoError(t, sp.CleanupStorage(ctx, spec, volume))
+		require.NoDirExists(t, filepath.Dir(volume.Source))
+	}
+}
+
+func TestGetVolumeSize(t *testing.T) {
+	repo, first, _ := newTestRepo(t)
+	sp := newTestStorageProvider(t)
+
+	size, err := sp.GetVolumeSize(context.Background(), NewStorageSpec(repo, first, "/code"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(len("hello\r\n")+len("print(1)\n")), size)
+}
+
+func TestMissingCommit(t *testing.T) {
+	repo, _, _ := newTestRepo(t)
+	sp := newTestStorageProvider(t)
+
+	_, err := sp.PrepareStorage(context.Background(), NewStorageSpec(repo, strings.Repeat("a", 40), "/code"))
+	require.Error(t, err)
+}
+
+func TestLocalRepositoriesNotAllowed(t *testing.T) {
+	repo, first, _ := newTestRepo(t)
+	sp := newTestStorageProvider(t)
+	sp.AllowLocal = false
+
+	_, err := sp.PrepareStorage(context.Background(), NewStorageSpec(repo, first, "/code"))
+	require.Error(t, err)
+	_, err = sp.PrepareStorage(context.Background(), NewStorageSpec("file://"+repo, first, "/code"))
+	require.Error(t, err)
+}
+
+func TestCheckoutRemovesEscapingLinks(t *testing.T) {
+	dir := t.TempDir()
+	work := filepath.Join(dir, "work")
+	require.NoError(t, os.MkdirAll(filepath.Join(work, "data"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(work, "data", "a.txt"), []byte("a"), 0644))
+	links := map[string]string{
+		"inside":        "data/a.txt",
+		"absolute":      "/etc/passwd",
+		"up":            "../../..",
+		"data/here":     ".",
+		"data/through":  "here/../../..",
+		"data/dangling": "missing",
+	}
+	for name, link := range links {
+		require.NoError(t, os.Symlink(link, filepath.Join(work, name)))
+	}
+	repo := filepath.Join(dir, "repo.git")
+	run := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = work
+		cmd.Env = append(os.Environ(),
+			"GIT_CONFIG_NOSYSTEM=1",
+			"GIT_CONFIG_GLOBAL="+os.DevNull,
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	run("init", "--quiet")
+	run("add", ".")
+	run("commit", "--quiet", "-m", "links")
+	run("clone", "--quiet", "--bare", ".", repo)
+	out, err := exec.Command("git", "--git-dir", repo, "rev-parse", "HEAD").Output()
+	require.NoError(t, err)
+
+	sp := newTestStorageProvider(t)
+	ctx := context.Background()
+	spec := NewStorageSpec(repo, strings.TrimSpace(string(out)), "/code")
+	volume, err := sp.PrepareStorage(ctx, spec)
+	require.NoError(t, err)
+	defer sp.CleanupStorage(ctx, spec, volume) //nolint:errcheck
+
+	content, err := os.ReadFile(filepath.Join(volume.Source, "inside"))
+	require.NoError(t, err)
+	require.Equal(t, "a", string(content))
+	_, err = os.Lstat(filepath.Join(volume.Source, "data", "here"))
+	require.NoError(t, err)
+	for _, name := range []string{"absolute", "up", "data/through", "data/dangling"} {
+		_, err = os.Lstat(filepath.Join(volume.Source, name))
+		require.True(t, os.IsNotExist(err), name)
+	}
+}
+
+func TestUnusedReposArePruned(t *testing.T) {
+	repo, first, second := newTestRepo(t)
+	otherRepo, otherFirst, _ := newTestRepo(t)
+	sp := newTestStorageProvider(t)
+	ctx := context.Background()
+
+	_, err := sp.GetVolumeSize(ctx, NewStorageSpec(repo, first, "/code"))
+	require.NoError(t, err)
+	// room for one of them but not both
+	sp.MaxRepoSize = sp.repos[sp.repoDir(repo)].size * 3 / 2
+
+	// nothing is using the first one so it goes
+	_, err = sp.GetVolumeSize(ctx, NewStorageSpec(otherRepo, otherFirst, "/code"))
+	require.NoError(t, err)
+	require.NoDirExists(t, sp.repoDir(repo))
+	require.DirExists(t, sp.repoDir(otherRepo))
+
+	// but not while it is being used
+	repoDir, err := sp.fetch(ctx, NewStorageSpec(repo, second, "/code"))
+	require.NoError(t, err)
+	_, err = sp.GetVolumeSize(ctx, NewStorageSpec(otherRepo, otherFirst, "/code"))
+	require.NoError(t, err)
+	require.DirExists(t, repoDir)
+	require.NoDirExists(t, sp.repoDir(otherRepo))
+	sp.release(repoDir)
+	require.DirExists(t, repoDir)
+}
+
+func TestSlowRemoteDoesNotBlockOtherRepos(t *testing.T) {
+	repo, first, _ := newTestRepo(t)
+	sp := newTestStorageProvider(t)
+	sp.FetchTimeout = time.Second * 3
+	ctx := context.Background()
+
+	// a remote that accepts connections and never answers
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	slowErr := make(chan error)
+	go func() {
+		_, err := sp.GetVolumeSize(ctx, NewStorageSpec("http://"+listener.Addr().String()+"/repo.git", first, "/code"))
+		slowErr <- err
+	}()
+	// let the slow fetch start
+	time.Sleep(time.Millisecond * 500)
+
+	started := time.Now()
+	_, err = sp.GetVolumeSize(ctx, NewStorageSpec(repo, first, "/code"))
+	require.NoError(t, err)
+	require.Less(t, time.Since(started), time.Second*2)
+
+	select {
+	case err = <-slowErr:
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "could not fetch")
+	case <-time.After(time.Second * 10):
+		require.Fail(t, "the fetch from the slow remote did not time out")
+	}
+}
+
+func TestParseRef(t *testing.T) {
+	commit := strings.Repeat("0123456789", 4)
+	for ref, expected := range map[string]string{
+		"https://github.com/foo/bar.git@" + commit: "https://github.com/foo/bar.git",
+		"git@github.com:foo/bar.git@" + commit:     "git@github.com:foo/bar.git",
+	} {
+		repo, parsedCommit, err := ParseRef(ref)
+		require.NoError(t, err)
+		require.Equal(t, expected, repo)
+		require.Equal(t, commit, parsedCommit)
+	}
+
+	for _, ref := range []string{
+		"https://github.com/foo/bar.git",
+		"https://github.com/foo/bar.git@main",
+		"https://github.com/foo/bar.git@0123456",
+		"@" + commit,
+		"--upload-pack=touch@" + commit,
+	} {
+		_, _, err := ParseRef(ref)
+		require.Error(t, err, ref)
+	}
+}
+
+func TestIsLocalURL(t *testing.T) {
+	for url, local := range map[string]bool{
+		"https://github.com/foo/bar.git": false,
+		"ssh://git@github.com/foo/bar":   false,
+		"git@github.com:foo/bar.git":     false,
+		"github.com:foo/bar.git":         false,
+		"/srv/repos/bar.git":             true,
+		"../bar.git":                     true,
+		"file:///srv/repos/bar.git":      true,
+	} {
+		require.Equal(t, local, IsLocalURL(url), url)
+	}
+	require.Equal(t, model.StorageSourceGit, NewStorageSpec("a", "b", "c").Engine)
+}
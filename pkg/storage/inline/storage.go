@@ -0,0 +1,152 @@
+package inline
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/filecoin-project/bacalhau/pkg/config"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage"
+	"github.com/filecoin-project/bacalhau/pkg/storage/util"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// a storage driver for small files whose content is in the storage spec
+// itself - it writes the content to a read only file in a local directory
+// in preparation for a job to run and removes it once complete
+
+// MaxSize is how many bytes the inline inputs of a job can add up to - the
+// job spec is sent to every node so they have to be small.
+const MaxSize = 64 * 1024
+
+type StorageProvider struct {
+	LocalDir string
+}
+
+func NewStorageProvider(cm *system.CleanupManager) (*StorageProvider, error) {
+	dir, err := os.MkdirTemp(config.GetStoragePath(), "bacalhau-inline")
+	if err != nil {
+		return nil, err
+	}
+	cm.RegisterCallback(func() error {
+		return os.RemoveAll(dir)
+	})
+
+	storageHandler := &StorageProvider{
+		LocalDir: dir,
+	}
+
+	log.Debug().Msgf("Inline driver created with output dir: %s", dir)
+	return storageHandler, nil
+}
+
+// DefaultPath is where an inline input is mounted when no path is given for
+// it - in /inputs under the name of the local file.
+func DefaultPath(localPath string) string {
+	return "/inputs/" + filepath.Base(localPath)
+}
+
+// NewStorageSpec returns an inline spec with the content of the local file,
+// mounted at path.
+func NewStorageSpec(localPath, path string) (model.StorageSpec, error) {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return model.StorageSpec{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return model.StorageSpec{}, fmt.Errorf("only files can be inline inputs: %s", localPath)
+	}
+	if info.Size() > MaxSize {
+		return model.StorageSpec{}, fmt.Errorf("%s is %d bytes but inline inputs can be at most %d bytes", localPath, info.Size(), MaxSize)
+	}
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return model.StorageSpec{}, err
+	}
+	return model.StorageSpec{
+		Engine: model.StorageSourceInline,
+		Name:   filepath.Base(localPath),
+		Path:   path,
+		Data:   base64.StdEncoding.EncodeToString(data),
+	}, nil
+}
+
+// DecodedSize is how many bytes the content of the spec is.
+func DecodedSize(spec model.StorageSpec) (uint64, error) {
+	data, err := base64.StdEncoding.DecodeString(spec.Data)
+	if err != nil {
+		return 0, fmt.Errorf("invalid inline input %s: %w", spec.Name, err)
+	}
+	return uint64(len(data)), nil
+}
+
+func (sp *StorageProvider) IsInstalled(ctx context.Context) (bool, error) {
+	return true, nil
+}
+
+// the content is in the spec so we always have it
+func (sp *StorageProvider) HasStorageLocally(ctx context.Context, volume model.StorageSpec) (bool, error) {
+	return true, nil
+}
+
+func (sp *StorageProvider) GetVolumeSize(ctx context.Context, volume model.StorageSpec) (uint64, error) {
+	return DecodedSize(volume)
+}
+
+func (sp *StorageProvider) PrepareStorage(ctx context.Context, storageSpec model.StorageSpec) (storage.StorageVolume, error) {
+	_, span := newSpan(ctx, "PrepareStorage")
+	defer span.End()
+
+	data, err := base64.StdEncoding.DecodeString(storageSpec.Data)
+	if err != nil {
+		return storage.StorageVolume{}, fmt.Errorf("invalid inline input %s: %w", storageSpec.Name, err)
+	}
+	if len(data) > MaxSize {
+		return storage.StorageVolume{}, fmt.Errorf("inline input %s is bigger than %d bytes", storageSpec.Name, MaxSize)
+	}
+
+	outputPath, err := os.MkdirTemp(sp.LocalDir, "*")
+	if err != nil {
+		return storage.StorageVolume{}, err
+	}
+	source := filepath.Join(outputPath, "file")
+	err = os.WriteFile(source, data, util.OS_ALL_R)
+	if err != nil {
+		_ = os.RemoveAll(outputPath)
+		return storage.StorageVolume{}, err
+	}
+
+	return storage.StorageVolume{
+		Type:   storage.StorageVolumeConnectorBind,
+		Source: source,
+		Target: storageSpec.Path,
+	}, nil
+}
+
+//nolint:lll // Exception to the long rule
+func (sp *StorageProvider) CleanupStorage(ctx context.Context, storageSpec model.StorageSpec, volume storage.StorageVolume) error {
+	return os.RemoveAll(filepath.Dir(volume.Source))
+}
+
+// Upload turns a small local file into an inline spec mounted at its
+// DefaultPath
+func (sp *StorageProvider) Upload(ctx context.Context, localPath string) (model.StorageSpec, error) {
+	return NewStorageSpec(localPath, DefaultPath(localPath))
+}
+
+// an inline input is a single file so explode always results in the spec
+func (sp *StorageProvider) Explode(ctx context.Context, spec model.StorageSpec) ([]model.StorageSpec, error) {
+	return []model.StorageSpec{spec}, nil
+}
+
+func newSpan(ctx context.Context, apiName string) (context.Context, trace.Span) {
+	return system.Span(ctx, "storage/inline", apiName)
+}
+
+// Compile time interface check:
+var _ storage.StorageProvider = (*StorageProvider)(nil)
@@ -0,0 +1,90 @@
+package inline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepareStorage(t *testing.T) {
+	cm := system.NewCleanupManager()
+	defer cm.Cleanup()
+	sp, err := NewStorageProvider(cm)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	localPath := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(localPath, []byte("answer: 42\n"), 0644))
+	spec, err := NewStorageSpec(localPath, "/config.yaml")
+	require.NoError(t, err)
+	require.Equal(t, model.StorageSourceInline, spec.Engine)
+	require.Equal(t, "config.yaml", spec.Name)
+
+	size, err := sp.GetVolumeSize(ctx, spec)
+	require.NoError(t, err)
+	require.Equal(t, uint64(11), size)
+
+	local, err := sp.HasStorageLocally(ctx, spec)
+	require.NoError(t, err)
+	require.True(t, local)
+
+	volume, err := sp.PrepareStorage(ctx, spec)
+	require.NoError(t, err)
+	require.Equal(t, "/config.yaml", volume.Target)
+	content, err := os.ReadFile(volume.Source)
+	require.NoError(t, err)
+	require.Equal(t, "answer: 42\n", string(content))
+	info, err := os.Stat(volume.Source)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0444), info.Mode().Perm())
+
+	require.NoError(t, sp.CleanupStorage(ctx, spec, volume))
+	require.NoFileExists(t, volume.Source)
+}
+
+func TestUpload(t *testing.T) {
+	cm := system.NewCleanupManager()
+	defer cm.Cleanup()
+	sp, err := NewStorageProvider(cm)
+	require.NoError(t, err)
+
+	localPath := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(localPath, []byte("answer: 42\n"), 0644))
+	spec, err := sp.Upload(context.Background(), localPath)
+	require.NoError(t, err)
+	require.Equal(t, "/inputs/config.yaml", spec.Path)
+
+	volume, err := sp.PrepareStorage(context.Background(), spec)
+	require.NoError(t, err)
+	require.Equal(t, "/inputs/config.yaml", volume.Target)
+	require.NoError(t, sp.CleanupStorage(context.Background(), spec, volume))
+}
+
+func TestNewStorageSpecTooBig(t *testing.T) {
+	localPath := filepath.Join(t.TempDir(), "big.csv")
+	require.NoError(t, os.WriteFile(localPath, []byte(strings.Repeat("a", MaxSize+1)), 0644))
+	_, err := NewStorageSpec(localPath, "/big.csv")
+	require.Error(t, err)
+
+	_, err = NewStorageSpec(t.TempDir(), "/dir")
+	require.Error(t, err)
+}
+
+func TestInvalidData(t *testing.T) {
+	cm := system.NewCleanupManager()
+	defer cm.Cleanup()
+	sp, err := NewStorageProvider(cm)
+	require.NoError(t, err)
+
+	spec := model.StorageSpec{Engine: model.StorageSourceInline, Path: "/file", Data: "not base64!"}
+	_, err = DecodedSize(spec)
+	require.Error(t, err)
+	_, err = sp.PrepareStorage(context.Background(), spec)
+	require.Error(t, err)
+}
@@ -0,0 +1,341 @@
+package s3
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultRegion = "us-east-1"
+
+	signingAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat    = "20060102T150405Z"
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// ClientConfig says which S3 compatible service to talk to and how to
+// authenticate with it.
+type ClientConfig struct {
+	// the base URL of the service e.g. http://localhost:9000 for a local
+	// minio - empty means AWS in the configured region
+	Endpoint string
+	Region   string
+
+	// requests are sent unsigned when there are no credentials, which is
+	// enough for public buckets
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// the buckets jobs can read inputs from and publish results to - jobs
+	// choose the bucket and the node's credentials are used for it, so no
+	// bucket is allowed unless the operator lists it ("*" allows any)
+	Buckets []string
+}
+
+// HasCredentials is whether requests are signed with the node's credentials.
+func (c ClientConfig) HasCredentials() bool {
+	return c.AccessKeyID != "" && c.SecretAccessKey != ""
+}
+
+// CheckBucket returns an error if jobs can't use the bucket.
+func (c ClientConfig) CheckBucket(bucket string) error {
+	if !AllowsBucket(c.Buckets, bucket) {
+		return fmt.Errorf("jobs cannot use the s3 bucket %s on this node", bucket)
+	}
+	return nil
+}
+
+// AllowsBucket is whether the bucket is in the list of allowed buckets.
+func AllowsBucket(buckets []string, bucket string) bool {
+	for _, allowed := range buckets {
+		if allowed == "*" || allowed == bucket {
+			return true
+		}
+	}
+	return false
+}
+
+// Client is the little bit of the S3 API we need. Buckets are always
+// addressed by path (endpoint/bucket/key) because that is what every S3
+// compatible service supports.
+type Client struct {
+	config     ClientConfig
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+// Object is an object in a bucket.
+type Object struct {
+	Key  string `xml:"Key"`
+	Size uint64 `xml:"Size"`
+}
+
+type listBucketResult struct {
+	Contents              []Object `xml:"Contents"`
+	IsTruncated           bool     `xml:"IsTruncated"`
+	NextContinuationToken string   `xml:"NextContinuationToken"`
+}
+
+type errorResponse struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// NewClientConfigFromEnv reads the endpoint, region and credentials from
+// the environment variables the AWS tools use.
+func NewClientConfigFromEnv() ClientConfig {
+	return ClientConfig{
+		Endpoint:        os.Getenv("AWS_ENDPOINT_URL"),
+		Region:          os.Getenv("AWS_REGION"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+func NewClient(config ClientConfig) *Client {
+	if config.Region == "" {
+		config.Region = DefaultRegion
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	return &Client{
+		config:     config,
+		httpClient: http.DefaultClient,
+		now:        time.Now,
+	}
+}
+
+// CheckBucket returns an error if jobs can't use the bucket.
+func (c *Client) CheckBucket(bucket string) error {
+	return c.config.CheckBucket(bucket)
+}
+
+// ListObjects returns every object in the bucket whose key starts with the
+// prefix, following the pages of results.
+func (c *Client) ListObjects(ctx context.Context, bucket, prefix string) ([]Object, error) {
+	objects := []Object{}
+	continuationToken := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+		res, err := c.do(ctx, http.MethodGet, bucket, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(res.Body).Decode(&result)
+		res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("could not read the objects in s3://%s/%s: %w", bucket, prefix, err)
+		}
+		objects = append(objects, result.Contents...)
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		continuationToken = result.NextContinuationToken
+	}
+}
+
+// GetObject streams the contents of an object - the caller must close it.
+func (c *Client) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	res, err := c.do(ctx, http.MethodGet, bucket, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// PutObject uploads the contents of body to an object - the body is read
+// twice, once to sign it and once to send it.
+func (c *Client) PutObject(ctx context.Context, bucket, key string, body io.ReadSeeker) error {
+	res, err := c.do(ctx, http.MethodPut, bucket, key, nil, body)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+func (c *Client) do(
+	ctx context.Context,
+	method, bucket, key string,
+	query url.Values,
+	body io.ReadSeeker,
+) (*http.Response, error) {
+	requestURL := c.config.Endpoint + "/" + encodePath(bucket)
+	if key != "" {
+		requestURL += "/" + encodePath(key)
+	}
+	if len(query) > 0 {
+		requestURL += "?" + encodeQuery(query)
+	}
+	payloadHash := emptyPayloadHash
+	var requestBody io.Reader = http.NoBody
+	var contentLength int64
+	if body != nil {
+		hash := sha256.New()
+		written, err := io.Copy(hash, body)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = body.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		payloadHash = hex.EncodeToString(hash.Sum(nil))
+		contentLength = written
+		// go sends a zero length body of unknown type chunked
+		if contentLength > 0 {
+			requestBody = body
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, requestBody)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = contentLength
+	c.sign(req, payloadHash)
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		defer res.Body.Close()
+		var s3Error errorResponse
+		if xml.NewDecoder(res.Body).Decode(&s3Error) == nil && s3Error.Code != "" {
+			return nil, fmt.Errorf("s3 request for s3://%s/%s failed: %s: %s", bucket, key, s3Error.Code, s3Error.Message)
+		}
+		return nil, fmt.Errorf("s3 request for s3://%s/%s failed: %s", bucket, key, res.Status)
+	}
+	return res, nil
+}
+
+// sign adds an AWS signature version 4 authorization header to the request,
+// signing the host and every header already set on it.
+func (c *Client) sign(req *http.Request, payloadHash string) {
+	if c.config.AccessKeyID == "" {
+		return
+	}
+	now := c.now().UTC()
+	amzDate := now.Format(amzDateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.config.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	headerNames := make([]string, 0, len(headers))
+	for name := range headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+	var canonicalHeaders strings.Builder
+	for _, name := range headerNames {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		encodePath(req.URL.Path),
+		encodeQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	date := now.Format("20060102")
+	scope := strings.Join([]string{date, c.config.Region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		signingAlgorithm,
+		amzDate,
+		scope,
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+c.config.SecretAccessKey), date)
+	for _, part := range []string{c.config.Region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signingAlgorithm, c.config.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// S3 wants everything but the unreserved characters percent encoded,
+// leaving the slashes between path segments alone
+func encodePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func encodeQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := []string{}
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, uriEncode(key)+"="+uriEncode(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func uriEncode(s string) string {
+	var encoded strings.Builder
+	for _, b := range []byte(s) {
+		if ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z') || ('0' <= b && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return encoded.String()
+}
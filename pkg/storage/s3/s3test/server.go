@@ -0,0 +1,158 @@
+// Package s3test provides an in memory stand-in for an S3 compatible
+// service so the s3 storage code can be tested without one.
+package s3test
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Server answers the list, get and put object requests of the s3 client
+// with path style addressing (/bucket/key).
+type Server struct {
+	*httptest.Server
+
+	// how many objects a list request returns before it has to be continued
+	PageSize int
+
+	mutex   sync.Mutex
+	objects map[string]map[string][]byte
+	// the authorization header of every request, in order
+	authorizations []string
+}
+
+type listObject struct {
+	Key  string `xml:"Key"`
+	Size int    `xml:"Size"`
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name     `xml:"ListBucketResult"`
+	Contents              []listObject `xml:"Contents"`
+	IsTruncated           bool         `xml:"IsTruncated"`
+	NextContinuationToken string       `xml:"NextContinuationToken,omitempty"`
+}
+
+type errorResponse struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+func NewServer() *Server {
+	server := &Server{
+		PageSize: 1000,
+		objects:  map[string]map[string][]byte{},
+	}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.handle))
+	return server
+}
+
+// PutObject adds an object to a bucket, creating the bucket if need be.
+func (s *Server) PutObject(bucket, key string, contents []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.objects[bucket]; !ok {
+		s.objects[bucket] = map[string][]byte{}
+	}
+	s.objects[bucket][key] = contents
+}
+
+// GetObject returns the contents of an object and whether it exists.
+func (s *Server) GetObject(bucket, key string) ([]byte, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	contents, ok := s.objects[bucket][key]
+	return contents, ok
+}
+
+// Keys lists the keys in a bucket in order.
+func (s *Server) Keys(bucket string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	keys := []string{}
+	for key := range s.objects[bucket] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Authorizations returns the authorization header of every request so far.
+func (s *Server) Authorizations() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.authorizations...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	s.authorizations = append(s.authorizations, r.Header.Get("Authorization"))
+	s.mutex.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		s.listObjects(w, r, bucket)
+	case r.Method == http.MethodGet:
+		contents, ok := s.GetObject(bucket, key)
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(contents)))
+		_, _ = w.Write(contents)
+	case r.Method == http.MethodPut && key != "":
+		contents, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		s.PutObject(bucket, key, contents)
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed.")
+	}
+}
+
+func (s *Server) listObjects(w http.ResponseWriter, r *http.Request, bucket string) {
+	prefix := r.URL.Query().Get("prefix")
+	keys := []string{}
+	for _, key := range s.Keys(bucket) {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	// continuation tokens are just the index of the next key
+	start, _ := strconv.Atoi(r.URL.Query().Get("continuation-token"))
+	if start > len(keys) {
+		start = len(keys)
+	}
+	end := start + s.PageSize
+	result := listBucketResult{}
+	if end < len(keys) {
+		result.IsTruncated = true
+		result.NextContinuationToken = strconv.Itoa(end)
+	} else {
+		end = len(keys)
+	}
+	for _, key := range keys[start:end] {
+		contents, _ := s.GetObject(bucket, key)
+		result.Contents = append(result.Contents, listObject{Key: key, Size: len(contents)})
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(errorResponse{Code: code, Message: message})
+}
@@ -0,0 +1,244 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/filecoin-project/bacalhau/pkg/config"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// a storage driver that downloads objects from an S3 compatible bucket
+// into a local directory in preparation for a job to run - it will remove
+// the folder once complete
+//
+// a spec points at either a single object or, like a folder, everything
+// under a prefix: s3://bucket/path/to/object or s3://bucket/path/to/folder/
+//
+// only the buckets the operator allows can be read - see ClientConfig.Buckets
+
+type StorageProvider struct {
+	LocalDir string
+	Client   *Client
+}
+
+func NewStorageProvider(cm *system.CleanupManager, clientConfig ClientConfig) (*StorageProvider, error) {
+	dir, err := os.MkdirTemp(config.GetStoragePath(), "bacalhau-s3")
+	if err != nil {
+		return nil, err
+	}
+	cm.RegisterCallback(func() error {
+		return os.RemoveAll(dir)
+	})
+
+	storageHandler := &StorageProvider{
+		LocalDir: dir,
+		Client:   NewClient(clientConfig),
+	}
+
+	log.Debug().Msgf("S3 driver created with endpoint %s and output dir: %s", storageHandler.Client.config.Endpoint, dir)
+	return storageHandler, nil
+}
+
+func (sp *StorageProvider) IsInstalled(ctx context.Context) (bool, error) {
+	return true, nil
+}
+
+func (sp *StorageProvider) HasStorageLocally(ctx context.Context, volume model.StorageSpec) (bool, error) {
+	return false, nil
+}
+
+func (sp *StorageProvider) GetVolumeSize(ctx context.Context, volume model.StorageSpec) (uint64, error) {
+	ctx, span := newSpan(ctx, "GetVolumeSize")
+	defer span.End()
+
+	_, _, objects, err := sp.listSpec(ctx, volume)
+	if err != nil {
+		return 0, err
+	}
+	var size uint64
+	for _, object := range objects {
+		size += object.Size
+	}
+	return size, nil
+}
+
+// PrepareStorage downloads only the objects the spec points at, which for a
+// sharded job is the part of the bucket its shard was given
+func (sp *StorageProvider) PrepareStorage(ctx context.Context, storageSpec model.StorageSpec) (storage.StorageVolume, error) {
+	ctx, span := newSpan(ctx, "PrepareStorage")
+	defer span.End()
+
+	bucket, prefix, objects, err := sp.listSpec(ctx, storageSpec)
+	if err != nil {
+		return storage.StorageVolume{}, err
+	}
+
+	outputPath, err := os.MkdirTemp(sp.LocalDir, "*")
+	if err != nil {
+		return storage.StorageVolume{}, err
+	}
+
+	// a single object is mounted as a file and a prefix as a folder
+	var source string
+	if len(objects) == 1 && objects[0].Key == prefix {
+		source = filepath.Join(outputPath, path.Base(prefix))
+		err = sp.Client.DownloadObject(ctx, bucket, objects[0].Key, source)
+	} else {
+		source = filepath.Join(outputPath, "data")
+		err = sp.Client.downloadObjects(ctx, bucket, prefix, objects, source)
+	}
+	if err != nil {
+		_ = os.RemoveAll(outputPath)
+		return storage.StorageVolume{}, err
+	}
+
+	return storage.StorageVolume{
+		Type:   storage.StorageVolumeConnectorBind,
+		Source: source,
+		Target: storageSpec.Path,
+	}, nil
+}
+
+func (sp *StorageProvider) CleanupStorage(
+	ctx context.Context,
+	storageSpec model.StorageSpec,
+	volume storage.StorageVolume,
+) error {
+	_, span := newSpan(ctx, "CleanupStorage")
+	defer span.End()
+
+	pathToCleanup := filepath.Dir(volume.Source)
+	log.Debug().Msgf("Cleaning up: %s", pathToCleanup)
+	return os.RemoveAll(pathToCleanup)
+}
+
+func (sp *StorageProvider) Upload(ctx context.Context, localPath string) (model.StorageSpec, error) {
+	return model.StorageSpec{}, fmt.Errorf("not implemented")
+}
+
+// Explode lists every object and folder under the spec so that sharding
+// glob patterns can be applied to them - the path of each is the path of
+// the spec followed by the key below the prefix
+func (sp *StorageProvider) Explode(ctx context.Context, spec model.StorageSpec) ([]model.StorageSpec, error) {
+	ctx, span := newSpan(ctx, "Explode")
+	defer span.End()
+
+	bucket, prefix, objects, err := sp.listSpec(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 1 && objects[0].Key == prefix {
+		return []model.StorageSpec{spec}, nil
+	}
+
+	basePath := strings.TrimSuffix(spec.Path, "/")
+	seenPaths := map[string]bool{}
+	specs := []model.StorageSpec{}
+	addSpec := func(relativePath string, isFolder bool) {
+		usePath := basePath + "/" + strings.TrimSuffix(relativePath, "/")
+		if seenPaths[usePath] {
+			return
+		}
+		seenPaths[usePath] = true
+		key := prefix + relativePath
+		if isFolder {
+			key = strings.TrimSuffix(key, "/") + "/"
+		}
+		specs = append(specs, model.StorageSpec{
+			Engine: model.StorageSourceS3,
+			Name:   spec.Name,
+			URL:    FormatURL(bucket, key),
+			Path:   usePath,
+		})
+	}
+	for _, object := range objects {
+		relativePath := strings.TrimPrefix(object.Key, prefix)
+		if relativePath == "" {
+			continue
+		}
+		// every folder the object is in is a volume of its own
+		parts := strings.Split(strings.TrimSuffix(relativePath, "/"), "/")
+		for i := 1; i < len(parts); i++ {
+			addSpec(strings.Join(parts[:i], "/"), true)
+		}
+		addSpec(relativePath, strings.HasSuffix(relativePath, "/"))
+	}
+	sort.Slice(specs, func(i, j int) bool {
+		return specs[i].Path < specs[j].Path
+	})
+	return specs, nil
+}
+
+// listSpec lists the objects a spec points at - the returned prefix is the
+// key of the object or, for a folder, the key ending in a slash
+func (sp *StorageProvider) listSpec(ctx context.Context, spec model.StorageSpec) (string, string, []Object, error) {
+	bucket, key, err := ParseURL(spec.URL)
+	if err != nil {
+		return "", "", nil, err
+	}
+	if err = sp.Client.CheckBucket(bucket); err != nil {
+		return "", "", nil, err
+	}
+	objects, err := sp.Client.ListObjects(ctx, bucket, key)
+	if err != nil {
+		return "", "", nil, err
+	}
+	// s3://bucket/prefix could be an object or a folder - and listing it
+	// also finds objects like prefix-other that are neither
+	for _, object := range objects {
+		if object.Key == key && !strings.HasSuffix(key, "/") {
+			return bucket, key, []Object{object}, nil
+		}
+	}
+	if key != "" && !strings.HasSuffix(key, "/") {
+		key += "/"
+	}
+	inFolder := []Object{}
+	for _, object := range objects {
+		if strings.HasPrefix(object.Key, key) {
+			inFolder = append(inFolder, object)
+		}
+	}
+	if len(inFolder) == 0 {
+		return "", "", nil, fmt.Errorf("no objects found at %s", spec.URL)
+	}
+	return bucket, key, inFolder, nil
+}
+
+// ParseURL splits s3://bucket/key into the bucket and the key.
+func ParseURL(rawURL string) (string, string, error) {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", err
+	}
+	if parsedURL.Scheme != "s3" || parsedURL.Host == "" {
+		return "", "", fmt.Errorf("not an s3 url, expected s3://bucket/key: %s", rawURL)
+	}
+	return parsedURL.Host, strings.TrimPrefix(parsedURL.Path, "/"), nil
+}
+
+func FormatURL(bucket, key string) string {
+	return fmt.Sprintf("s3://%s/%s", bucket, key)
+}
+
+func IsS3URL(rawURL string) bool {
+	return strings.HasPrefix(rawURL, "s3://")
+}
+
+func newSpan(ctx context.Context, apiName string) (context.Context, trace.Span) {
+	return system.Span(ctx, "storage/s3", apiName)
+}
+
+// Compile time interface check:
+var _ storage.StorageProvider = (*StorageProvider)(nil)
@@ -0,0 +1,157 @@
+package s3
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage/s3/s3test"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStorageProvider(t *testing.T) (*StorageProvider, *s3test.Server) {
+	server := s3test.NewServer()
+	t.Cleanup(server.Close)
+	// make the client follow continuation tokens
+	server.PageSize = 2
+	server.PutObject("data", "images/a/1.png", []byte("one"))
+	server.PutObject("data", "images/a/2.png", []byte("two"))
+	server.PutObject("data", "images/b/3.png", []byte("three"))
+	server.PutObject("data", "images/readme.txt", []byte("readme"))
+	server.PutObject("data", "images-old/4.png", []byte("four"))
+
+	cm := system.NewCleanupManager()
+	t.Cleanup(cm.Cleanup)
+	sp, err := NewStorageProvider(cm, ClientConfig{
+		Endpoint:        server.URL,
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+		Buckets:         []string{"data"},
+	})
+	require.NoError(t, err)
+	return sp, server
+}
+
+func TestParseURL(t *testing.T) {
+	bucket, key, err := ParseURL("s3://data/images/a/")
+	require.NoError(t, err)
+	require.Equal(t, "data", bucket)
+	require.Equal(t, "images/a/", key)
+
+	_, _, err = ParseURL("https://data/images")
+	require.Error(t, err)
+	_, _, err = ParseURL("s3:///images")
+	require.Error(t, err)
+}
+
+func TestGetVolumeSize(t *testing.T) {
+	sp, server := newTestStorageProvider(t)
+	ctx := context.Background()
+
+	size, err := sp.GetVolumeSize(ctx, model.StorageSpec{URL: "s3://data/images"})
+	require.NoError(t, err)
+	require.Equal(t, uint64(len("one")+len("two")+len("three")+len("readme")), size)
+
+	size, err = sp.GetVolumeSize(ctx, model.StorageSpec{URL: "s3://data/images/b/3.png"})
+	require.NoError(t, err)
+	require.Equal(t, uint64(len("three")), size)
+
+	_, err = sp.GetVolumeSize(ctx, model.StorageSpec{URL: "s3://data/missing"})
+	require.Error(t, err)
+
+	for _, authorization := range server.Authorizations() {
+		require.True(t, strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=access/"), authorization)
+	}
+}
+
+func TestOnlyAllowedBucketsAreUsed(t *testing.T) {
+	sp, server := newTestStorageProvider(t)
+	server.PutObject("private", "secrets.txt", []byte("secret"))
+	ctx := context.Background()
+	spec := model.StorageSpec{URL: "s3://private/secrets.txt", Path: "/inputs/secrets.txt"}
+
+	_, err := sp.GetVolumeSize(ctx, spec)
+	require.Error(t, err)
+	_, err = sp.PrepareStorage(ctx, spec)
+	require.Error(t, err)
+	_, err = sp.Explode(ctx, spec)
+	require.Error(t, err)
+	require.Empty(t, server.Authorizations())
+
+	require.True(t, AllowsBucket([]string{"data", "private"}, "private"))
+	require.True(t, AllowsBucket([]string{"*"}, "private"))
+	require.False(t, AllowsBucket(nil, "private"))
+}
+
+func TestExplode(t *testing.T) {
+	sp, _ := newTestStorageProvider(t)
+
+	specs, err := sp.Explode(context.Background(), model.StorageSpec{
+		Engine: model.StorageSourceS3,
+		URL:    "s3://data/images/",
+		Path:   "/inputs",
+	})
+	require.NoError(t, err)
+
+	exploded := map[string]string{}
+	for _, spec := range specs {
+		require.Equal(t, model.StorageSourceS3, spec.Engine)
+		exploded[spec.Path] = spec.URL
+	}
+	require.Equal(t, map[string]string{
+		"/inputs/a":          "s3://data/images/a/",
+		"/inputs/a/1.png":    "s3://data/images/a/1.png",
+		"/inputs/a/2.png":    "s3://data/images/a/2.png",
+		"/inputs/b":          "s3://data/images/b/",
+		"/inputs/b/3.png":    "s3://data/images/b/3.png",
+		"/inputs/readme.txt": "s3://data/images/readme.txt",
+	}, exploded)
+}
+
+func TestPrepareStorage(t *testing.T) {
+	sp, _ := newTestStorageProvider(t)
+	ctx := context.Background()
+
+	t.Run("object", func(t *testing.T) {
+		spec := model.StorageSpec{URL: "s3://data/images/readme.txt", Path: "/inputs/readme.txt"}
+		volume, err := sp.PrepareStorage(ctx, spec)
+		require.NoError(t, err)
+		require.Equal(t, "/inputs/readme.txt", volume.Target)
+
+		contents, err := os.ReadFile(volume.Source)
+		require.NoError(t, err)
+		require.Equal(t, "readme", string(contents))
+
+		require.NoError(t, sp.CleanupStorage(ctx, spec, volume))
+		require.NoDirExists(t, filepath.Dir(volume.Source))
+	})
+
+	t.Run("prefix", func(t *testing.T) {
+		spec := model.StorageSpec{URL: "s3://data/images/a", Path: "/inputs"}
+		volume, err := sp.PrepareStorage(ctx, spec)
+		require.NoError(t, err)
+
+		// only the objects under the prefix are downloaded
+		files := []string{}
+		err = filepath.Walk(volume.Source, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				relativePath, _ := filepath.Rel(volume.Source, path)
+				files = append(files, relativePath)
+			}
+			return err
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"1.png", "2.png"}, files)
+
+		require.NoError(t, sp.CleanupStorage(ctx, spec, volume))
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := sp.PrepareStorage(ctx, model.StorageSpec{URL: "s3://data/nothing/here", Path: "/inputs"})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,112 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/filecoin-project/bacalhau/pkg/storage/util"
+)
+
+// DownloadObject writes the contents of an object to a local file.
+func (c *Client) DownloadObject(ctx context.Context, bucket, key, target string) error {
+	err := os.MkdirAll(filepath.Dir(target), util.OS_ALL_RWX)
+	if err != nil {
+		return err
+	}
+	body, err := c.GetObject(ctx, bucket, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, util.OS_ALL_RW)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("could not download %s: %w", FormatURL(bucket, key), err)
+	}
+	return nil
+}
+
+// DownloadFolder writes every object under the prefix to the local folder,
+// keeping the part of their keys after the prefix as their path.
+func (c *Client) DownloadFolder(ctx context.Context, bucket, prefix, dir string) error {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	objects, err := c.ListObjects(ctx, bucket, prefix)
+	if err != nil {
+		return err
+	}
+	return c.downloadObjects(ctx, bucket, prefix, objects, dir)
+}
+
+func (c *Client) downloadObjects(ctx context.Context, bucket, prefix string, objects []Object, dir string) error {
+	err := os.MkdirAll(dir, util.OS_ALL_RWX)
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		relativePath := strings.TrimPrefix(object.Key, prefix)
+		if relativePath == "" || strings.HasSuffix(relativePath, "/") {
+			// folder placeholders that some tools create
+			continue
+		}
+		target, err := safeJoin(dir, relativePath)
+		if err != nil {
+			return err
+		}
+		err = c.DownloadObject(ctx, bucket, object.Key, target)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UploadFolder uploads every file in the local folder to an object under
+// the prefix named after its path in the folder.
+func (c *Client) UploadFolder(ctx context.Context, bucket, prefix, dir string) error {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		relativePath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		key := prefix + filepath.ToSlash(relativePath)
+		err = c.PutObject(ctx, bucket, key, file)
+		if err != nil {
+			return fmt.Errorf("could not upload %s to %s: %w", path, FormatURL(bucket, key), err)
+		}
+		return nil
+	})
+}
+
+// keys can contain anything, so make sure they can't escape the folder
+// they are downloaded into
+func safeJoin(dir, relativePath string) (string, error) {
+	target := filepath.Join(dir, filepath.FromSlash(relativePath))
+	if target != dir && !strings.HasPrefix(target, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("object key %s is outside of the prefix", relativePath)
+	}
+	return target, nil
+}
@@ -0,0 +1,180 @@
+package urldownload
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/filecoin-project/bacalhau/pkg/storage/util"
+	"github.com/rs/zerolog/log"
+)
+
+// errors that another attempt won't fix
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// GetFileSize asks the server how big the file at the URL is with a HEAD
+// request - it is 0 if the server doesn't say.
+func (sp *StorageProvider) GetFileSize(ctx context.Context, rawURL string) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, sp.RequestTimeout)
+	defer cancel()
+	res, err := sp.HTTPClient.R().SetContext(ctx).Head(rawURL)
+	if err != nil {
+		// not every server answers HEAD requests, the download will find
+		// out if the file is really there
+		log.Debug().Msgf("could not get the size of %s: %s", rawURL, err)
+		return 0, nil
+	}
+	switch {
+	case res.StatusCode() == http.StatusMethodNotAllowed || res.StatusCode() == http.StatusNotImplemented:
+		return 0, nil
+	case res.StatusCode() >= http.StatusBadRequest:
+		return 0, fmt.Errorf("could not get the size of %s: %s", rawURL, res.Status())
+	case res.RawResponse.ContentLength < 0:
+		return 0, nil
+	}
+	size := uint64(res.RawResponse.ContentLength)
+	if size > sp.MaxFileSize {
+		return 0, fmt.Errorf("%s is %d bytes which is more than the %d bytes that can be downloaded", rawURL, size, sp.MaxFileSize)
+	}
+	return size, nil
+}
+
+// downloadFile downloads the URL to the target file, carrying on from where
+// it got to if the connection drops, and checks the file has the expected
+// SHA-256 if one is given.
+func (sp *StorageProvider) downloadFile(ctx context.Context, rawURL, target, expectedSHA256 string) error {
+	var err error
+	for attempt := 0; attempt <= sp.MaxRetries; attempt++ {
+		if attempt > 0 {
+			log.Debug().Msgf("retrying download of %s after: %s", rawURL, err)
+			select {
+			case <-time.After(sp.RetryDelay * time.Duration(attempt)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		err = sp.downloadFileAttempt(ctx, rawURL, target)
+		if err == nil || errors.As(err, &permanentError{}) || ctx.Err() != nil {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("could not download %s: %w", rawURL, err)
+	}
+
+	if expectedSHA256 == "" {
+		return nil
+	}
+	actualSHA256, err := fileSHA256(target)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(actualSHA256, expectedSHA256) {
+		_ = os.Remove(target)
+		return fmt.Errorf("%s has SHA-256 %s but %s was expected", rawURL, actualSHA256, expectedSHA256)
+	}
+	return nil
+}
+
+// downloadFileAttempt asks for the part of the file we don't have yet
+func (sp *StorageProvider) downloadFileAttempt(ctx context.Context, rawURL, target string) error {
+	ctx, cancel := context.WithTimeout(ctx, sp.RequestTimeout)
+	defer cancel()
+
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY, util.OS_ALL_RW)
+	if err != nil {
+		return permanentError{err}
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return permanentError{err}
+	}
+	offset := info.Size()
+
+	req := sp.HTTPClient.R().SetContext(ctx).SetDoNotParseResponse(true)
+	if offset > 0 {
+		req.SetHeader("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	res, err := req.Get(rawURL)
+	if err != nil {
+		return err
+	}
+	body := res.RawBody()
+	defer body.Close()
+
+	switch res.StatusCode() {
+	case http.StatusPartialContent:
+		if !strings.HasPrefix(res.Header().Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			// start again rather than stitch the wrong bits together
+			return startAgain(file, fmt.Errorf("server sent the wrong range: %s", res.Header().Get("Content-Range")))
+		}
+	case http.StatusOK:
+		// the server doesn't do ranges so we get the whole file again
+		offset = 0
+		if err = file.Truncate(0); err != nil {
+			return permanentError{err}
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// we already have all of it
+		if res.Header().Get("Content-Range") == fmt.Sprintf("bytes */%d", offset) {
+			return nil
+		}
+		return startAgain(file, fmt.Errorf("server could not send the rest of the file"))
+	default:
+		err = fmt.Errorf("server responded with %s", res.Status())
+		if res.StatusCode() >= http.StatusBadRequest && res.StatusCode() < http.StatusInternalServerError &&
+			res.StatusCode() != http.StatusRequestTimeout && res.StatusCode() != http.StatusTooManyRequests {
+			return permanentError{err}
+		}
+		return err
+	}
+
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		return permanentError{err}
+	}
+	// read one byte more than we allow so we can tell if the file is too big
+	remaining := int64(sp.MaxFileSize) - offset
+	written, err := io.Copy(file, io.LimitReader(body, remaining+1))
+	if written > remaining {
+		return permanentError{fmt.Errorf("file is bigger than the %d bytes that can be downloaded", sp.MaxFileSize)}
+	}
+	return err
+}
+
+func startAgain(file *os.File, reason error) error {
+	if err := file.Truncate(0); err != nil {
+		return permanentError{err}
+	}
+	return reason
+}
+
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -5,11 +5,15 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/url"
+	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/filecoin-project/bacalhau/pkg/config"
 	"github.com/filecoin-project/bacalhau/pkg/model"
 	"github.com/filecoin-project/bacalhau/pkg/storage"
+	"github.com/filecoin-project/bacalhau/pkg/storage/util"
 	"github.com/filecoin-project/bacalhau/pkg/system"
 	"github.com/go-resty/resty/v2"
 	"github.com/rs/zerolog/log"
@@ -19,10 +23,28 @@ import (
 // from a public URL source and copies it to
 // a local directory in preparation for
 // a job to run - it will remove the folder/file once complete
+//
+// a spec can also list several URLs, or point at an index file that does,
+// which are downloaded into a folder and can be sharded
+
+const (
+	// the biggest file we will download
+	DefaultMaxFileSize uint64 = 10 * 1024 * 1024 * 1024
+	// how many times we carry on with a download after the connection drops
+	DefaultMaxRetries = 3
+	DefaultRetryDelay = time.Second
+)
 
 type StorageProvider struct {
-	LocalDir   string
-	HTTPClient *resty.Client
+	LocalDir    string
+	HTTPClient  *resty.Client
+	MaxFileSize uint64
+	MaxRetries  int
+	// how long to wait before the first retry - it grows with each one
+	RetryDelay time.Duration
+	// how long a single request, or attempt at a download, can take - a
+	// download that is cut off carries on from where it got to
+	RequestTimeout time.Duration
 }
 
 func NewStorageProvider(cm *system.CleanupManager) (*StorageProvider, error) {
@@ -32,13 +54,13 @@ func NewStorageProvider(cm *system.CleanupManager) (*StorageProvider, error) {
 		return nil, err
 	}
 
-	client := resty.New()
-	// Setting output directory path, If directory not exists then resty creates one
-	client.SetOutputDirectory(dir)
-
 	storageHandler := &StorageProvider{
-		HTTPClient: client,
-		LocalDir:   dir,
+		HTTPClient:     resty.New(),
+		LocalDir:       dir,
+		MaxFileSize:    DefaultMaxFileSize,
+		MaxRetries:     DefaultMaxRetries,
+		RetryDelay:     DefaultRetryDelay,
+		RequestTimeout: config.GetDownloadURLRequestTimeout(),
 	}
 
 	log.Debug().Msgf("URL download driver created with output dir: %s", dir)
@@ -53,16 +75,32 @@ func (sp *StorageProvider) HasStorageLocally(ctx context.Context, volume model.S
 	return false, nil
 }
 
-// Could do a HEAD request and check Content-Length, but in some cases that's not guaranteed to be the real end file size
+// GetVolumeSize adds up the Content-Length of a HEAD request for each file -
+// servers don't always send it so this can be less than the real size
 func (sp *StorageProvider) GetVolumeSize(ctx context.Context, volume model.StorageSpec) (uint64, error) {
-	return 0, nil
+	ctx, span := system.GetTracer().Start(ctx, "pkg/storage/url/urldownload.GetVolumeSize")
+	defer span.End()
+
+	files, err := sp.getRemoteFiles(ctx, volume)
+	if err != nil {
+		return 0, err
+	}
+	var size uint64
+	for _, file := range files {
+		fileSize, err := sp.GetFileSize(ctx, file.url)
+		if err != nil {
+			return 0, err
+		}
+		size += fileSize
+	}
+	return size, nil
 }
 
 func (sp *StorageProvider) PrepareStorage(ctx context.Context, storageSpec model.StorageSpec) (storage.StorageVolume, error) {
-	_, span := system.GetTracer().Start(ctx, "pkg/storage/url/urldownload.PrepareStorage")
+	ctx, span := system.GetTracer().Start(ctx, "pkg/storage/url/urldownload.PrepareStorage")
 	defer span.End()
 
-	_, err := IsURLSupported(storageSpec.URL)
+	files, err := sp.getRemoteFiles(ctx, storageSpec)
 	if err != nil {
 		return storage.StorageVolume{}, err
 	}
@@ -72,17 +110,30 @@ func (sp *StorageProvider) PrepareStorage(ctx context.Context, storageSpec model
 		return storage.StorageVolume{}, err
 	}
 
-	sp.HTTPClient.SetTimeout(config.GetDownloadURLRequestTimeout())
-	_, err = sp.HTTPClient.R().
-		SetOutput(outputPath + "/file").
-		Get(storageSpec.URL)
+	// a single URL is mounted as a file and a list of them as a folder
+	source := filepath.Join(outputPath, "file")
+	if isMultiFile(storageSpec) {
+		source = filepath.Join(outputPath, "files")
+		err = os.Mkdir(source, util.OS_ALL_RWX)
+	}
+	for _, file := range files {
+		if err != nil {
+			break
+		}
+		target := source
+		if isMultiFile(storageSpec) {
+			target = filepath.Join(source, file.name)
+		}
+		err = sp.downloadFile(ctx, file.url, target, file.sha256)
+	}
 	if err != nil {
+		_ = os.RemoveAll(outputPath)
 		return storage.StorageVolume{}, err
 	}
 
 	volume := storage.StorageVolume{
 		Type:   storage.StorageVolumeConnectorBind,
-		Source: outputPath + "/file",
+		Source: source,
 		Target: storageSpec.Path,
 	}
 
@@ -111,17 +162,40 @@ func (sp *StorageProvider) Upload(ctx context.Context, localPath string) (model.
 	return model.StorageSpec{}, fmt.Errorf("not implemented")
 }
 
-// for the url download - explode will always result in a single item
-// mounted at the path specified in the spec
+// for the url download - explode results in a single item mounted at the
+// path specified in the spec, or for a list of URLs one item per URL
+// mounted in the folder at that path
 func (sp *StorageProvider) Explode(ctx context.Context, spec model.StorageSpec) ([]model.StorageSpec, error) {
-	return []model.StorageSpec{
-		{
+	if !isMultiFile(spec) {
+		return []model.StorageSpec{
+			{
+				Name:     spec.Name,
+				Engine:   model.StorageSourceURLDownload,
+				Path:     spec.Path,
+				URL:      spec.URL,
+				Metadata: spec.Metadata,
+			},
+		}, nil
+	}
+
+	files, err := sp.getRemoteFiles(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	specs := []model.StorageSpec{}
+	for _, file := range files {
+		fileSpec := model.StorageSpec{
 			Name:   spec.Name,
 			Engine: model.StorageSourceURLDownload,
-			Path:   spec.Path,
-			URL:    spec.URL,
-		},
-	}, nil
+			Path:   strings.TrimSuffix(spec.Path, "/") + "/" + file.name,
+			URL:    file.url,
+		}
+		if file.sha256 != "" {
+			fileSpec.Metadata = map[string]string{MetadataSHA256: file.sha256}
+		}
+		specs = append(specs, fileSpec)
+	}
+	return specs, nil
 }
 
 func IsURLSupported(rawURL string) (bool, error) {
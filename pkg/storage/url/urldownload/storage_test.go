@@ -2,16 +2,23 @@ package urldownload
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/filecoin-project/bacalhau/pkg/model"
 	"github.com/filecoin-project/bacalhau/pkg/system"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewStorageProvider(t *testing.T) {
@@ -108,3 +115,227 @@ func TestPrepareStorage(t *testing.T) {
 		t.Errorf("Should be \"%s\", but is \"%s\"", testString, text)
 	}
 }
+
+func newTestStorageProvider(t *testing.T) *StorageProvider {
+	sp, err := NewStorageProvider(system.NewCleanupManager())
+	require.NoError(t, err)
+	sp.RetryDelay = time.Millisecond
+	return sp
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestGetVolumeSize(t *testing.T) {
+	ts := httptest.NewServer(http.FileServer(http.FS(fstest.MapFS{
+		"small": {Data: []byte("12345")},
+		"big":   {Data: []byte("1234567890")},
+	})))
+	defer ts.Close()
+
+	sp := newTestStorageProvider(t)
+	ctx := context.Background()
+
+	size, err := sp.GetVolumeSize(ctx, model.StorageSpec{URL: ts.URL + "/small"})
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), size)
+
+	size, err = sp.GetVolumeSize(ctx, model.StorageSpec{
+		Metadata: map[string]string{MetadataURLs: ts.URL + "/small\n" + ts.URL + "/big"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(15), size)
+
+	sp.MaxFileSize = 8
+	_, err = sp.GetVolumeSize(ctx, model.StorageSpec{URL: ts.URL + "/big"})
+	require.Error(t, err)
+
+	_, err = sp.GetVolumeSize(ctx, model.StorageSpec{URL: ts.URL + "/missing"})
+	require.Error(t, err)
+}
+
+func TestPrepareStorageChecksum(t *testing.T) {
+	testString := "Here's your data"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(testString))
+	}))
+	defer ts.Close()
+
+	sp := newTestStorageProvider(t)
+	ctx := context.Background()
+
+	volume, err := sp.PrepareStorage(ctx, model.StorageSpec{
+		URL:      ts.URL + "/testfile",
+		Path:     "/foo",
+		Metadata: map[string]string{MetadataSHA256: sha256Hex(testString)},
+	})
+	require.NoError(t, err)
+	content, err := os.ReadFile(volume.Source)
+	require.NoError(t, err)
+	require.Equal(t, testString, string(content))
+
+	_, err = sp.PrepareStorage(ctx, model.StorageSpec{
+		URL:      ts.URL + "/testfile",
+		Path:     "/foo",
+		Metadata: map[string]string{MetadataSHA256: sha256Hex("something else")},
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "SHA-256")
+}
+
+func TestPrepareStorageResumes(t *testing.T) {
+	testString := "the first half and the second half"
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			// promise the whole file but hang up half way through
+			w.Header().Set("Content-Length", strconv.Itoa(len(testString)))
+			_, _ = w.Write([]byte(testString[:10]))
+			return
+		}
+		http.ServeContent(w, r, "testfile", time.Time{}, strings.NewReader(testString))
+	}))
+	defer ts.Close()
+
+	sp := newTestStorageProvider(t)
+	volume, err := sp.PrepareStorage(context.Background(), model.StorageSpec{
+		URL:  ts.URL + "/testfile",
+		Path: "/foo",
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, requests)
+	content, err := os.ReadFile(volume.Source)
+	require.NoError(t, err)
+	require.Equal(t, testString, string(content))
+}
+
+func TestPrepareStorageTimeoutIsPerAttempt(t *testing.T) {
+	testString := "one chunk, two chunks, three chunks"
+	chunk := 12
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		offset := 0
+		if r.Header.Get("Range") != "" {
+			_, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &offset)
+			require.NoError(t, err)
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(testString)-1, len(testString)))
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		end := offset + chunk
+		if end >= len(testString) {
+			_, _ = w.Write([]byte(testString[offset:]))
+			return
+		}
+		// send a chunk and then stall until the client gives up
+		_, _ = w.Write([]byte(testString[offset:end]))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	sp := newTestStorageProvider(t)
+	sp.RequestTimeout = 200 * time.Millisecond
+	start := time.Now()
+	volume, err := sp.PrepareStorage(context.Background(), model.StorageSpec{
+		URL:  ts.URL + "/testfile",
+		Path: "/foo",
+	})
+	require.NoError(t, err)
+	// every attempt got its own timeout, so all of them together took longer
+	// than one would be allowed
+	require.Equal(t, 3, requests)
+	require.Greater(t, time.Since(start), 2*sp.RequestTimeout)
+	content, err := os.ReadFile(volume.Source)
+	require.NoError(t, err)
+	require.Equal(t, testString, string(content))
+}
+
+func TestPrepareStorageTooBig(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("1234567890"))
+	}))
+	defer ts.Close()
+
+	sp := newTestStorageProvider(t)
+	sp.MaxFileSize = 8
+	_, err := sp.PrepareStorage(context.Background(), model.StorageSpec{
+		URL:  ts.URL + "/testfile",
+		Path: "/foo",
+	})
+	require.Error(t, err)
+}
+
+func TestURLIndex(t *testing.T) {
+	files := fstest.MapFS{
+		"a.txt":     {Data: []byte("a")},
+		"dir/b.txt": {Data: []byte("b")},
+		"index.txt": {},
+	}
+	ts := httptest.NewServer(http.FileServer(http.FS(files)))
+	defer ts.Close()
+	files["index.txt"] = &fstest.MapFile{Data: []byte(fmt.Sprintf(
+		"# inputs\n%s/a.txt %s\n\n%s/dir/b.txt\n", ts.URL, sha256Hex("a"), ts.URL,
+	))}
+
+	sp := newTestStorageProvider(t)
+	ctx := context.Background()
+	spec := model.StorageSpec{
+		Engine:   model.StorageSourceURLDownload,
+		URL:      ts.URL + "/index.txt",
+		Path:     "/inputs",
+		Metadata: map[string]string{MetadataIndex: "true"},
+	}
+
+	specs, err := sp.Explode(ctx, spec)
+	require.NoError(t, err)
+	require.Equal(t, []model.StorageSpec{
+		{
+			Engine:   model.StorageSourceURLDownload,
+			URL:      ts.URL + "/a.txt",
+			Path:     "/inputs/a.txt",
+			Metadata: map[string]string{MetadataSHA256: sha256Hex("a")},
+		},
+		{
+			Engine: model.StorageSourceURLDownload,
+			URL:    ts.URL + "/dir/b.txt",
+			Path:   "/inputs/b.txt",
+		},
+	}, specs)
+
+	volume, err := sp.PrepareStorage(ctx, spec)
+	require.NoError(t, err)
+	require.Equal(t, "/inputs", volume.Target)
+	for name, contents := range map[string]string{"a.txt": "a", "b.txt": "b"} {
+		content, err := os.ReadFile(filepath.Join(volume.Source, name))
+		require.NoError(t, err)
+		require.Equal(t, contents, string(content))
+	}
+	require.NoError(t, sp.CleanupStorage(ctx, spec, volume))
+	_, err = os.Stat(volume.Source)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestParseURLList(t *testing.T) {
+	_, err := parseURLList("")
+	require.Error(t, err)
+
+	_, err = parseURLList("http://a.com/x.txt\nhttp://b.com/x.txt")
+	require.Error(t, err, "two URLs with the same file name")
+
+	_, err = parseURLList("http://a.com/x.txt abc def")
+	require.Error(t, err)
+
+	_, err = parseURLList("ftp://a.com/x.txt")
+	require.Error(t, err)
+
+	files, err := parseURLList("http://a.com/\nhttp://a.com/x.txt")
+	require.NoError(t, err)
+	require.Equal(t, []remoteFile{
+		{url: "http://a.com/", name: "file-0"},
+		{url: "http://a.com/x.txt", name: "x.txt"},
+	}, files)
+}
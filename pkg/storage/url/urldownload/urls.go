@@ -0,0 +1,166 @@
+package urldownload
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/filecoin-project/bacalhau/pkg/model"
+)
+
+const (
+	// the SHA-256 the downloaded file must have, in hex
+	MetadataSHA256 = "sha256"
+	// a list of URLs to download into the folder at the path of the spec
+	// instead of a single one - one per line, optionally followed by the
+	// SHA-256 of the file
+	MetadataURLs = "urls"
+	// set to "true" when the URL of the spec is an index file listing the
+	// URLs to download, in the same format as MetadataURLs
+	MetadataIndex = "index"
+
+	// index files are lists of URLs so there is no reason for them to be big
+	maxIndexSize = 16 * 1024 * 1024
+)
+
+// a file a spec asks us to download
+type remoteFile struct {
+	url    string
+	sha256 string
+	// what it is called in the folder when a spec has more than one
+	name string
+}
+
+// isMultiFile is whether the spec is a list of URLs rather than a single one
+func isMultiFile(spec model.StorageSpec) bool {
+	return spec.Metadata[MetadataURLs] != "" || spec.Metadata[MetadataIndex] == "true"
+}
+
+// IsPinned is whether we know the SHA-256 of every file the spec downloads,
+// so downloading it again always gives the same files. Specs with an index
+// file never are because the index can change.
+func IsPinned(spec model.StorageSpec) bool {
+	if !isMultiFile(spec) {
+		return spec.Metadata[MetadataSHA256] != ""
+	}
+	if spec.Metadata[MetadataIndex] == "true" {
+		return false
+	}
+	files, err := parseURLList(spec.Metadata[MetadataURLs])
+	if err != nil {
+		return false
+	}
+	for _, file := range files {
+		if file.sha256 == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// getRemoteFiles lists the files a spec asks us to download, fetching the
+// index file if it has one
+func (sp *StorageProvider) getRemoteFiles(ctx context.Context, spec model.StorageSpec) ([]remoteFile, error) {
+	if !isMultiFile(spec) {
+		if _, err := IsURLSupported(spec.URL); err != nil {
+			return nil, err
+		}
+		return []remoteFile{{
+			url:    spec.URL,
+			sha256: spec.Metadata[MetadataSHA256],
+			name:   fileName(spec.URL, 0),
+		}}, nil
+	}
+
+	list := spec.Metadata[MetadataURLs]
+	if spec.Metadata[MetadataIndex] == "true" {
+		index, err := sp.getIndex(ctx, spec.URL)
+		if err != nil {
+			return nil, err
+		}
+		list = index
+	}
+	return parseURLList(list)
+}
+
+func (sp *StorageProvider) getIndex(ctx context.Context, rawURL string) (string, error) {
+	if _, err := IsURLSupported(rawURL); err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, sp.RequestTimeout)
+	defer cancel()
+	res, err := sp.HTTPClient.R().SetContext(ctx).SetDoNotParseResponse(true).Get(rawURL)
+	if err != nil {
+		return "", err
+	}
+	body := res.RawBody()
+	defer body.Close()
+	if res.StatusCode() != http.StatusOK {
+		return "", fmt.Errorf("could not get index file %s: %s", rawURL, res.Status())
+	}
+	index, err := io.ReadAll(io.LimitReader(body, maxIndexSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(index) > maxIndexSize {
+		return "", fmt.Errorf("index file %s is bigger than %d bytes", rawURL, maxIndexSize)
+	}
+	return string(index), nil
+}
+
+// parseURLList reads one URL per line, optionally followed by its SHA-256,
+// skipping blank lines and # comments
+func parseURLList(list string) ([]remoteFile, error) {
+	files := []remoteFile{}
+	names := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("expected a URL and an optional SHA-256 but got: %s", line)
+		}
+		if _, err := IsURLSupported(fields[0]); err != nil {
+			return nil, err
+		}
+		file := remoteFile{
+			url:  fields[0],
+			name: fileName(fields[0], len(files)),
+		}
+		if len(fields) == 2 {
+			file.sha256 = fields[1]
+		}
+		if otherURL, ok := names[file.name]; ok {
+			return nil, fmt.Errorf("%s and %s would both be downloaded to %s", otherURL, file.url, file.name)
+		}
+		names[file.name] = file.url
+		files = append(files, file)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no URLs to download")
+	}
+	return files, nil
+}
+
+// files are named after the last part of their URL path
+func fileName(rawURL string, index int) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err == nil {
+		name := path.Base(parsedURL.Path)
+		if name != "." && name != "/" && name != ".." {
+			return name
+		}
+	}
+	return fmt.Sprintf("file-%d", index)
+}
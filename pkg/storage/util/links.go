@@ -0,0 +1,33 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// RemoveEscapingLinks removes the links under target that point outside it,
+// or at nothing, so whatever reads the folder (the job, or the node itself
+// when it copies or caches it) only sees the files in it. The links are
+// followed rather than read as a link to a folder changes where the .. in
+// the links after it go.
+func RemoveEscapingLinks(target string) error {
+	root, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(target, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			return err
+		}
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil && (resolved == root || strings.HasPrefix(resolved, root+string(filepath.Separator))) {
+			return nil
+		}
+		link, _ := os.Readlink(path)
+		log.Debug().Msgf("removing link %s to %s as it is not in %s", path, link, target)
+		return os.Remove(path)
+	})
+}
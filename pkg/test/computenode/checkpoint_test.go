@@ -0,0 +1,156 @@
+package computenode
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/bacalhau/pkg/computenode"
+	noop_executor "github.com/filecoin-project/bacalhau/pkg/executor/noop"
+	"github.com/filecoin-project/bacalhau/pkg/job"
+	_ "github.com/filecoin-project/bacalhau/pkg/logger"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	noop_storage "github.com/filecoin-project/bacalhau/pkg/storage/noop"
+	"github.com/filecoin-project/bacalhau/pkg/storage/util"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	testutils "github.com/filecoin-project/bacalhau/pkg/test/utils"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ComputeNodeCheckpointSuite struct {
+	suite.Suite
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestComputeNodeCheckpointSuite(t *testing.T) {
+	suite.Run(t, new(ComputeNodeCheckpointSuite))
+}
+
+// Before each test
+func (suite *ComputeNodeCheckpointSuite) SetupTest() {
+	err := system.InitConfigForTesting()
+	require.NoError(suite.T(), err)
+}
+
+// TestCheckpointsAreUploaded tests that the checkpoints a job writes are
+// uploaded while it runs and are not left in its results
+func (suite *ComputeNodeCheckpointSuite) TestCheckpointsAreUploaded() {
+	ctx := context.Background()
+	cm := system.NewCleanupManager()
+	defer cm.Cleanup()
+
+	uploaded := make(chan string, 10)
+	checkpointStorage, err := noop_storage.NewStorageProvider(ctx, cm, noop_storage.StorageConfig{
+		ExternalHooks: noop_storage.StorageConfigExternalHooks{
+			Upload: func(ctx context.Context, localPath string) (model.StorageSpec, error) {
+				contents, err := os.ReadFile(filepath.Join(localPath, "state"))
+				if err != nil {
+					return model.StorageSpec{}, err
+				}
+				uploaded <- string(contents)
+				return model.StorageSpec{
+					Engine: model.StorageSourceIPFS,
+					Cid:    "checkpoint-cid",
+				}, nil
+			},
+		},
+	})
+	require.NoError(suite.T(), err)
+
+	resultsDirs := make(chan string, 1)
+	computeNodeConfig := computenode.NewDefaultComputeNodeConfig()
+	computeNodeConfig.CheckpointStorage = checkpointStorage
+	computeNodeConfig.CheckpointInterval = time.Millisecond * 100
+	stack := testutils.NewNoopStack(ctx, suite.T(), computeNodeConfig, noop_executor.ExecutorConfig{
+		ExternalHooks: noop_executor.ExecutorConfigExternalHooks{
+			JobHandler: func(ctx context.Context, shard model.JobShard, resultsDir string) error {
+				resultsDirs <- resultsDir
+				checkpointDir := filepath.Join(resultsDir, "checkpoints")
+				err := os.MkdirAll(checkpointDir, util.OS_ALL_RWX)
+				if err != nil {
+					return err
+				}
+				err = os.WriteFile(filepath.Join(checkpointDir, "state"), []byte("step 1"), util.OS_USER_RW)
+				if err != nil {
+					return err
+				}
+				// keep running until the checkpoint has been uploaded
+				select {
+				case contents := <-uploaded:
+					uploaded <- contents
+				case <-time.After(time.Second * 10):
+				}
+				return nil
+			},
+		},
+	})
+	defer stack.Node.CleanupManager.Cleanup()
+
+	jobSpec, jobDeal, err := job.ConstructDockerJob(
+		model.EngineNoop,
+		model.VerifierNoop,
+		model.PublisherNoop,
+		"", "", "0",
+		[]string{}, []string{}, []string{}, []string{}, []string{},
+		"",
+		1, // concurrency
+		0, // confidence
+		0, // min bids
+		[]string{},
+		"",
+		"", // sharding base path
+		"", // sharding glob pattern
+		1,  // sharding batch size
+		true,
+	)
+	require.NoError(suite.T(), err)
+	jobSpec.Checkpoint = model.JobSpecCheckpoint{
+		Path:        "/checkpoint",
+		RestorePath: "/checkpoint_restore",
+	}
+	j, err := stack.Node.Controller.SubmitJob(ctx, model.JobCreatePayload{
+		ClientID: "123",
+		Spec:     *jobSpec,
+		Deal:     *jobDeal,
+	})
+	require.NoError(suite.T(), err)
+
+	var checkpointEvent model.JobEvent
+	waiter := &system.FunctionWaiter{
+		Name:        "wait for the checkpoint event",
+		MaxAttempts: 100,
+		Delay:       time.Millisecond * 100,
+		Handler: func() (bool, error) {
+			events, err := stack.Node.Controller.GetJobEvents(ctx, j.ID)
+			if err != nil {
+				return false, err
+			}
+			for _, event := range events { //nolint:gocritic
+				if event.EventName == model.JobEventCheckpointed {
+					checkpointEvent = event
+					return true, nil
+				}
+			}
+			return false, nil
+		},
+	}
+	require.NoError(suite.T(), waiter.Wait())
+	require.Equal(suite.T(), "checkpoint-cid", checkpointEvent.Checkpoint.Cid)
+	require.Equal(suite.T(), "step 1", <-uploaded)
+
+	resultsDir := <-resultsDirs
+	waiter = &system.FunctionWaiter{
+		Name:        "wait for the checkpoints to be removed from the results",
+		MaxAttempts: 100,
+		Delay:       time.Millisecond * 100,
+		Handler: func() (bool, error) {
+			_, err := os.Stat(filepath.Join(resultsDir, "checkpoints"))
+			return os.IsNotExist(err), nil
+		},
+	}
+	require.NoError(suite.T(), waiter.Wait())
+}
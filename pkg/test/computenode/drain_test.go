@@ -0,0 +1,128 @@
+package computenode
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/bacalhau/pkg/computenode"
+	noop_executor "github.com/filecoin-project/bacalhau/pkg/executor/noop"
+	"github.com/filecoin-project/bacalhau/pkg/job"
+	_ "github.com/filecoin-project/bacalhau/pkg/logger"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	testutils "github.com/filecoin-project/bacalhau/pkg/test/utils"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ComputeNodeDrainSuite struct {
+	suite.Suite
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestComputeNodeDrainSuite(t *testing.T) {
+	suite.Run(t, new(ComputeNodeDrainSuite))
+}
+
+// Before each test
+func (suite *ComputeNodeDrainSuite) SetupTest() {
+	err := system.InitConfigForTesting()
+	require.NoError(suite.T(), err)
+}
+
+// TestDrainLetsRunningShardsFinish tests that a draining compute node
+// finishes the shard it is running, does not pick up new jobs until it
+// is uncordoned and reports itself as drained once it is idle
+func (suite *ComputeNodeDrainSuite) TestDrainLetsRunningShardsFinish() {
+	ctx := context.Background()
+
+	started := make(chan string, 10)
+	release := make(chan struct{})
+
+	jobHandler := func(ctx context.Context, shard model.JobShard, resultsDir string) error {
+		started <- shard.Job.ID
+		<-release
+		return nil
+	}
+
+	stack := testutils.NewNoopStack(ctx, suite.T(), computenode.NewDefaultComputeNodeConfig(), noop_executor.ExecutorConfig{
+		ExternalHooks: noop_executor.ExecutorConfigExternalHooks{
+			JobHandler: jobHandler,
+		},
+	})
+	computeNode, cm := stack.Node.ComputeNode, stack.Node.CleanupManager
+	defer cm.Cleanup()
+
+	submitJob := func() model.Job {
+		jobSpec, jobDeal, err := job.ConstructDockerJob(
+			model.EngineNoop,
+			model.VerifierNoop,
+			model.PublisherNoop,
+			"", "", "0",
+			[]string{}, []string{}, []string{}, []string{}, []string{},
+			"",
+			1, // concurrency
+			0, // confidence
+			0, // min bids
+			[]string{},
+			"",
+			"", // sharding base path
+			"", // sharding glob pattern
+			1,  // sharding batch size
+			true,
+		)
+		require.NoError(suite.T(), err)
+		j, err := stack.Node.Controller.SubmitJob(ctx, model.JobCreatePayload{
+			ClientID: "123",
+			Spec:     *jobSpec,
+			Deal:     *jobDeal,
+		})
+		require.NoError(suite.T(), err)
+		return j
+	}
+
+	waitForStart := func(expectedJobID string) {
+		select {
+		case jobID := <-started:
+			require.Equal(suite.T(), expectedJobID, jobID)
+		case <-time.After(time.Second * 10):
+			require.Fail(suite.T(), "timed out waiting for the job to start")
+		}
+	}
+
+	runningJob := submitJob()
+	waitForStart(runningJob.ID)
+
+	status := computeNode.Drain(ctx)
+	require.True(suite.T(), status.Draining)
+	require.False(suite.T(), status.Drained)
+	require.Equal(suite.T(), []string{model.JobShard{Job: runningJob, Index: 0}.ID()}, status.ExecutingShards)
+
+	// a job that arrives while draining is never selected
+	submitJob()
+	select {
+	case jobID := <-started:
+		require.Fail(suite.T(), "draining node started a new job", jobID)
+	case <-time.After(time.Second * 1):
+	}
+
+	close(release)
+
+	waiter := &system.FunctionWaiter{
+		Name:        "wait for node to drain",
+		MaxAttempts: 100,
+		Delay:       time.Millisecond * 100,
+		Handler: func() (bool, error) {
+			return computeNode.GetDrainStatus(ctx).Drained, nil
+		},
+	}
+	require.NoError(suite.T(), waiter.Wait())
+
+	status = computeNode.Uncordon(ctx)
+	require.False(suite.T(), status.Draining)
+
+	newJob := submitJob()
+	waitForStart(newJob.ID)
+}
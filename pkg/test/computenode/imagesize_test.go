@@ -0,0 +1,106 @@
+package computenode
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/filecoin-project/bacalhau/pkg/capacitymanager"
+	"github.com/filecoin-project/bacalhau/pkg/computenode"
+	noop_executor "github.com/filecoin-project/bacalhau/pkg/executor/noop"
+	_ "github.com/filecoin-project/bacalhau/pkg/logger"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	testutils "github.com/filecoin-project/bacalhau/pkg/test/utils"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ComputeNodeImageSizeSuite struct {
+	suite.Suite
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestComputeNodeImageSizeSuite(t *testing.T) {
+	suite.Run(t, new(ComputeNodeImageSizeSuite))
+}
+
+// Before each test
+func (suite *ComputeNodeImageSizeSuite) SetupTest() {
+	err := system.InitConfigForTesting()
+	require.NoError(suite.T(), err)
+}
+
+// TestImageSizeCountsAgainstDisk tests that the size of the image we would
+// have to pull is added to the disk space a job needs
+func (suite *ComputeNodeImageSizeSuite) TestImageSizeCountsAgainstDisk() {
+	ctx := context.Background()
+
+	runTest := func(imageSize uint64, expected bool) {
+		stack := testutils.NewNoopStack(ctx, suite.T(), computenode.ComputeNodeConfig{
+			CapacityManagerConfig: capacitymanager.Config{
+				ResourceLimitTotal: model.ResourceUsageConfig{
+					CPU:    "1",
+					Memory: "1gb",
+					Disk:   "1mb",
+				},
+			},
+		}, noop_executor.ExecutorConfig{
+			ExternalHooks: noop_executor.ExecutorConfigExternalHooks{
+				GetImageSize: func(ctx context.Context, spec model.JobSpec) (uint64, error) {
+					return imageSize, nil
+				},
+			},
+		})
+		defer stack.Node.CleanupManager.Cleanup()
+
+		job := GetProbeData("")
+		job.Spec.Resources = model.ResourceUsageConfig{
+			CPU:    "100m",
+			Memory: "100mb",
+		}
+
+		result, _, err := stack.Node.ComputeNode.SelectJob(ctx, job)
+		require.NoError(suite.T(), err)
+		require.Equal(suite.T(), expected, result, "image size %d", imageSize)
+	}
+
+	runTest(1024, true)
+	runTest(10*1024*1024, false)
+}
+
+// TestImageSizeIsCachedPerJob tests that we only ask for the size of a
+// job's image once however many times we look at the job
+func (suite *ComputeNodeImageSizeSuite) TestImageSizeIsCachedPerJob() {
+	ctx := context.Background()
+
+	requests := map[string]int{}
+	var requestsMu sync.Mutex
+	stack := testutils.NewNoopStack(ctx, suite.T(), computenode.ComputeNodeConfig{}, noop_executor.ExecutorConfig{
+		ExternalHooks: noop_executor.ExecutorConfigExternalHooks{
+			GetImageSize: func(ctx context.Context, spec model.JobSpec) (uint64, error) {
+				requestsMu.Lock()
+				defer requestsMu.Unlock()
+				requests[spec.Docker.Image]++
+				return 1024, nil
+			},
+		},
+	})
+	defer stack.Node.CleanupManager.Cleanup()
+
+	selectJob := func(jobID, image string) {
+		job := GetProbeData("")
+		job.JobID = jobID
+		job.Spec.Docker.Image = image
+		result, _, err := stack.Node.ComputeNode.SelectJob(ctx, job)
+		require.NoError(suite.T(), err)
+		require.True(suite.T(), result)
+	}
+
+	selectJob("job-1", "ubuntu:latest")
+	selectJob("job-1", "ubuntu:latest")
+	selectJob("job-2", "alpine:latest")
+	selectJob("job-2", "alpine:latest")
+	require.Equal(suite.T(), map[string]int{"ubuntu:latest": 1, "alpine:latest": 1}, requests)
+}
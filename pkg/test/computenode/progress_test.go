@@ -0,0 +1,143 @@
+package computenode
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/bacalhau/pkg/computenode"
+	noop_executor "github.com/filecoin-project/bacalhau/pkg/executor/noop"
+	"github.com/filecoin-project/bacalhau/pkg/job"
+	_ "github.com/filecoin-project/bacalhau/pkg/logger"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/storage"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	testutils "github.com/filecoin-project/bacalhau/pkg/test/utils"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ComputeNodeProgressSuite struct {
+	suite.Suite
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestComputeNodeProgressSuite(t *testing.T) {
+	suite.Run(t, new(ComputeNodeProgressSuite))
+}
+
+// Before each test
+func (suite *ComputeNodeProgressSuite) SetupTest() {
+	err := system.InitConfigForTesting()
+	require.NoError(suite.T(), err)
+}
+
+// runProgressJob runs a job on a noop stack that sends heartbeats often
+func (suite *ComputeNodeProgressSuite) runProgressJob(
+	hooks noop_executor.ExecutorConfigExternalHooks) (*testutils.TestStack, model.Job) {
+	ctx := context.Background()
+	computeNodeConfig := computenode.NewDefaultComputeNodeConfig()
+	computeNodeConfig.HeartbeatInterval = time.Millisecond * 100
+	stack := testutils.NewNoopStack(ctx, suite.T(), computeNodeConfig, noop_executor.ExecutorConfig{
+		ExternalHooks: hooks,
+	})
+
+	jobSpec, jobDeal, err := job.ConstructDockerJob(
+		model.EngineNoop,
+		model.VerifierNoop,
+		model.PublisherNoop,
+		"", "", "0",
+		[]string{}, []string{}, []string{}, []string{}, []string{},
+		"",
+		1, // concurrency
+		0, // confidence
+		0, // min bids
+		[]string{},
+		"",
+		"", // sharding base path
+		"", // sharding glob pattern
+		1,  // sharding batch size
+		true,
+	)
+	require.NoError(suite.T(), err)
+	j, err := stack.Node.Controller.SubmitJob(ctx, model.JobCreatePayload{
+		ClientID: "123",
+		Spec:     *jobSpec,
+		Deal:     *jobDeal,
+	})
+	require.NoError(suite.T(), err)
+	return stack, j
+}
+
+// TestProgressIsRelayedInHeartbeats tests that the progress a job reports
+// through its executor ends up in the status of the shard on the requester
+func (suite *ComputeNodeProgressSuite) TestProgressIsRelayedInHeartbeats() {
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	stack, j := suite.runProgressJob(noop_executor.ExecutorConfigExternalHooks{
+		JobHandler: func(ctx context.Context, shard model.JobShard, resultsDir string) error {
+			<-release
+			return nil
+		},
+		GetShardProgress: func(ctx context.Context, shard model.JobShard) (model.ShardProgress, bool, error) {
+			return model.ParseShardProgress("42 halfway there"), true, nil
+		},
+	})
+	defer stack.Node.CleanupManager.Cleanup()
+
+	resolver := stack.Node.Controller.GetStateResolver()
+	waiter := &system.FunctionWaiter{
+		Name:        "wait for progress to be relayed",
+		MaxAttempts: 100,
+		Delay:       time.Millisecond * 100,
+		Handler: func() (bool, error) {
+			summary, err := resolver.ProgressSummary(ctx, j.ID)
+			return summary == "0: 42%", err
+		},
+	}
+	require.NoError(suite.T(), waiter.Wait())
+
+	shards, err := resolver.GetShards(ctx, j.ID)
+	require.NoError(suite.T(), err)
+	require.Len(suite.T(), shards, 1)
+	require.True(suite.T(), strings.HasPrefix(shards[0].Status, "42% halfway there (running for"), shards[0].Status)
+}
+
+// TestInputProgressIsRelayedInHeartbeats tests that what the storage
+// providers say about fetching the inputs of a shard is relayed until the
+// job reports progress of its own
+func (suite *ComputeNodeProgressSuite) TestInputProgressIsRelayedInHeartbeats() {
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	stack, j := suite.runProgressJob(noop_executor.ExecutorConfigExternalHooks{
+		JobHandler: func(ctx context.Context, shard model.JobShard, resultsDir string) error {
+			storage.ReportProgress(ctx, "retrieving Qm123 from filecoin: Recv: 5 B")
+			<-release
+			return nil
+		},
+	})
+	defer stack.Node.CleanupManager.Cleanup()
+
+	resolver := stack.Node.Controller.GetStateResolver()
+	waiter := &system.FunctionWaiter{
+		Name:        "wait for input progress to be relayed",
+		MaxAttempts: 100,
+		Delay:       time.Millisecond * 100,
+		Handler: func() (bool, error) {
+			shards, err := resolver.GetShards(ctx, j.ID)
+			if err != nil || len(shards) != 1 {
+				return false, err
+			}
+			return strings.HasPrefix(shards[0].Status, "retrieving Qm123 from filecoin: Recv: 5 B (running for"), nil
+		},
+	}
+	require.NoError(suite.T(), waiter.Wait())
+}
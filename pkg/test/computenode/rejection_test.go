@@ -0,0 +1,99 @@
+package computenode
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/bacalhau/pkg/computenode"
+	"github.com/filecoin-project/bacalhau/pkg/controller"
+	noop_executor "github.com/filecoin-project/bacalhau/pkg/executor/noop"
+	"github.com/filecoin-project/bacalhau/pkg/job"
+	_ "github.com/filecoin-project/bacalhau/pkg/logger"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	testutils "github.com/filecoin-project/bacalhau/pkg/test/utils"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ComputeNodeRejectionSuite struct {
+	suite.Suite
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestComputeNodeRejectionSuite(t *testing.T) {
+	suite.Run(t, new(ComputeNodeRejectionSuite))
+}
+
+// Before each test
+func (suite *ComputeNodeRejectionSuite) SetupTest() {
+	err := system.InitConfigForTesting()
+	require.NoError(suite.T(), err)
+}
+
+// TestDeniedImageIsRecorded tests that a job using a denied image is not
+// bid on and the reason ends up in a local event
+func (suite *ComputeNodeRejectionSuite) TestDeniedImageIsRecorded() {
+	ctx := context.Background()
+
+	computeNodeConfig := computenode.NewDefaultComputeNodeConfig()
+	computeNodeConfig.JobSelectionPolicy.Images = computenode.JobSelectionImagePolicy{
+		DeniedRepositories: []string{"evil/**"},
+	}
+	stack := testutils.NewNoopStack(ctx, suite.T(), computeNodeConfig, noop_executor.ExecutorConfig{})
+	defer stack.Node.CleanupManager.Cleanup()
+
+	jobSpec, jobDeal, err := job.ConstructDockerJob(
+		model.EngineDocker,
+		model.VerifierNoop,
+		model.PublisherNoop,
+		"", "", "0",
+		[]string{}, []string{}, []string{}, []string{}, []string{},
+		"evil/miner:latest",
+		1, // concurrency
+		0, // confidence
+		0, // min bids
+		[]string{},
+		"",
+		"", // sharding base path
+		"", // sharding glob pattern
+		1,  // sharding batch size
+		true,
+	)
+	require.NoError(suite.T(), err)
+	j, err := stack.Node.Controller.SubmitJob(ctx, model.JobCreatePayload{
+		ClientID: "123",
+		Spec:     *jobSpec,
+		Deal:     *jobDeal,
+	})
+	require.NoError(suite.T(), err)
+
+	var rejection model.JobLocalEvent
+	waiter := &system.FunctionWaiter{
+		Name:        "wait for the job to be rejected",
+		MaxAttempts: 50,
+		Delay:       time.Millisecond * 100,
+		Handler: func() (bool, error) {
+			events, err := stack.Node.Controller.GetJobLocalEvents(ctx, j.ID)
+			if err != nil {
+				return false, err
+			}
+			for _, event := range events {
+				if event.EventName == model.JobLocalEventRejected {
+					rejection = event
+					return true, nil
+				}
+			}
+			return false, nil
+		},
+	}
+	require.NoError(suite.T(), waiter.Wait())
+	require.True(suite.T(), strings.Contains(rejection.Reason, `"evil/**"`), rejection.Reason)
+
+	hasBid, err := stack.Node.Controller.HasLocalEvent(ctx, j.ID, controller.EventFilterByType(model.JobLocalEventBid))
+	require.NoError(suite.T(), err)
+	require.False(suite.T(), hasBid)
+}
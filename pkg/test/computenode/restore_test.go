@@ -0,0 +1,130 @@
+package computenode
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/bacalhau/pkg/computenode"
+	noop_executor "github.com/filecoin-project/bacalhau/pkg/executor/noop"
+	"github.com/filecoin-project/bacalhau/pkg/job"
+	_ "github.com/filecoin-project/bacalhau/pkg/logger"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	testutils "github.com/filecoin-project/bacalhau/pkg/test/utils"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ComputeNodeRestoreSuite struct {
+	suite.Suite
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestComputeNodeRestoreSuite(t *testing.T) {
+	suite.Run(t, new(ComputeNodeRestoreSuite))
+}
+
+// Before each test
+func (suite *ComputeNodeRestoreSuite) SetupTest() {
+	err := system.InitConfigForTesting()
+	require.NoError(suite.T(), err)
+}
+
+// TestRestoreShardStates tests that a compute node picks up the shards it
+// was working on before a restart - publishing results that were already
+// finished and reporting an error for executions it can't reattach to
+func (suite *ComputeNodeRestoreSuite) TestRestoreShardStates() {
+	ctx := context.Background()
+
+	store, err := computenode.NewFileShardStateStore(suite.T().TempDir())
+	require.NoError(suite.T(), err)
+
+	newShard := func(jobID string) model.JobShard {
+		jobSpec, jobDeal, err := job.ConstructDockerJob(
+			model.EngineNoop,
+			model.VerifierNoop,
+			model.PublisherNoop,
+			"", "", "0",
+			[]string{}, []string{}, []string{}, []string{}, []string{},
+			"",
+			1, // concurrency
+			0, // confidence
+			0, // min bids
+			[]string{},
+			"",
+			"", // sharding base path
+			"", // sharding glob pattern
+			1,  // sharding batch size
+			true,
+		)
+		require.NoError(suite.T(), err)
+		return model.JobShard{
+			Job: model.Job{
+				ID:        jobID,
+				ClientID:  "123",
+				Spec:      *jobSpec,
+				Deal:      *jobDeal,
+				CreatedAt: time.Now(),
+			},
+			Index: 0,
+		}
+	}
+
+	// results that were written before the restart
+	oldResultsDir := suite.T().TempDir()
+	err = os.WriteFile(filepath.Join(oldResultsDir, "stdout"), []byte("hello"), 0600)
+	require.NoError(suite.T(), err)
+
+	finishedShard := newShard("finished-job")
+	err = store.Save(ctx, computenode.ShardStateRecord{
+		Shard:      finishedShard,
+		State:      "PublishingToRequester",
+		BidSent:    true,
+		ResultsDir: oldResultsDir,
+	})
+	require.NoError(suite.T(), err)
+
+	// the noop executor can't reattach to executions
+	runningShard := newShard("running-job")
+	err = store.Save(ctx, computenode.ShardStateRecord{
+		Shard:      runningShard,
+		State:      "Running",
+		BidSent:    true,
+		ResultsDir: oldResultsDir,
+	})
+	require.NoError(suite.T(), err)
+
+	computeNodeConfig := computenode.NewDefaultComputeNodeConfig()
+	computeNodeConfig.ShardStateStore = store
+	stack := testutils.NewNoopStack(ctx, suite.T(), computeNodeConfig, noop_executor.ExecutorConfig{})
+	defer stack.Node.CleanupManager.Cleanup()
+
+	hasEvent := func(jobID string, eventName model.JobEventType) bool {
+		events, err := stack.Node.Controller.GetJobEvents(ctx, jobID)
+		require.NoError(suite.T(), err)
+		for _, event := range events {
+			if event.EventName == eventName {
+				return true
+			}
+		}
+		return false
+	}
+
+	waiter := &system.FunctionWaiter{
+		Name:        "wait for restored shards to complete",
+		MaxAttempts: 100,
+		Delay:       time.Millisecond * 100,
+		Handler: func() (bool, error) {
+			records, err := store.List(ctx)
+			return len(records) == 0, err
+		},
+	}
+	require.NoError(suite.T(), waiter.Wait())
+
+	require.True(suite.T(), hasEvent(finishedShard.Job.ID, model.JobEventResultsPublished))
+	require.True(suite.T(), hasEvent(runningShard.Job.ID, model.JobEventError))
+}
@@ -0,0 +1,273 @@
+package requesternode
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/bacalhau/pkg/computenode"
+	noop_executor "github.com/filecoin-project/bacalhau/pkg/executor/noop"
+	"github.com/filecoin-project/bacalhau/pkg/job"
+	_ "github.com/filecoin-project/bacalhau/pkg/logger"
+	"github.com/filecoin-project/bacalhau/pkg/model"
+	"github.com/filecoin-project/bacalhau/pkg/requesternode"
+	"github.com/filecoin-project/bacalhau/pkg/system"
+	testutils "github.com/filecoin-project/bacalhau/pkg/test/utils"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type RequesterNodeHeartbeatSuite struct {
+	suite.Suite
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestRequesterNodeHeartbeatSuite(t *testing.T) {
+	suite.Run(t, new(RequesterNodeHeartbeatSuite))
+}
+
+// Before each test
+func (suite *RequesterNodeHeartbeatSuite) SetupTest() {
+	err := system.InitConfigForTesting()
+	require.NoError(suite.T(), err)
+}
+
+func (suite *RequesterNodeHeartbeatSuite) runBlockingJob(
+	heartbeatInterval, heartbeatTimeout time.Duration,
+	checkpoint model.JobSpecCheckpoint,
+	jobHandler noop_executor.ExecutorHandlerJobHandler,
+) (*testutils.TestStack, model.Job) {
+	ctx := context.Background()
+
+	computeNodeConfig := computenode.NewDefaultComputeNodeConfig()
+	computeNodeConfig.HeartbeatInterval = heartbeatInterval
+	stack := testutils.NewNoopStackWithRequesterConfig(ctx, suite.T(), computeNodeConfig, requesternode.RequesterNodeConfig{
+		ShardHeartbeatTimeout: heartbeatTimeout,
+	}, noop_executor.ExecutorConfig{
+		ExternalHooks: noop_executor.ExecutorConfigExternalHooks{
+			JobHandler: jobHandler,
+		},
+	})
+
+	jobSpec, jobDeal, err := job.ConstructDockerJob(
+		model.EngineNoop,
+		model.VerifierNoop,
+		model.PublisherNoop,
+		"", "", "0",
+		[]string{}, []string{}, []string{}, []string{}, []string{},
+		"",
+		1, // concurrency
+		0, // confidence
+		0, // min bids
+		[]string{},
+		"",
+		"", // sharding base path
+		"", // sharding glob pattern
+		1,  // sharding batch size
+		true,
+	)
+	require.NoError(suite.T(), err)
+	jobSpec.Checkpoint = checkpoint
+	j, err := stack.Node.Controller.SubmitJob(ctx, model.JobCreatePayload{
+		ClientID: "123",
+		Spec:     *jobSpec,
+		Deal:     *jobDeal,
+	})
+	require.NoError(suite.T(), err)
+	return stack, j
+}
+
+func (suite *RequesterNodeHeartbeatSuite) countEvents(
+	stack *testutils.TestStack, jobID string, filter func(model.JobEvent) bool) int {
+	events, err := stack.Node.Controller.GetJobEvents(context.Background(), jobID)
+	require.NoError(suite.T(), err)
+	count := 0
+	for _, event := range events { //nolint:gocritic
+		if filter(event) {
+			count++
+		}
+	}
+	return count
+}
+
+// standbyNodeID is a compute node that only exists as the bids we publish
+// for it, so the requester has somewhere to reschedule shards to
+const standbyNodeID = "standby-node"
+
+// bid on the job's shard as the standby node once the requester has given
+// the shard to the real compute node, and wait for the bid to be turned down
+func (suite *RequesterNodeHeartbeatSuite) standbyBid(stack *testutils.TestStack, jobID string) {
+	suite.waitForEvent(stack, jobID, "wait for the shard to be given to the compute node", func(ev model.JobEvent) bool {
+		return ev.EventName == model.JobEventBidAccepted && ev.TargetNodeID == stack.Node.ComputeNode.ID
+	})
+	err := stack.Node.Transport.Publish(context.Background(), model.JobEvent{
+		SourceNodeID: standbyNodeID,
+		JobID:        jobID,
+		EventName:    model.JobEventBid,
+		EventTime:    time.Now(),
+	})
+	require.NoError(suite.T(), err)
+	suite.waitForEvent(stack, jobID, "wait for the standby bid to be rejected", func(ev model.JobEvent) bool {
+		return ev.EventName == model.JobEventBidRejected && ev.TargetNodeID == standbyNodeID
+	})
+}
+
+func (suite *RequesterNodeHeartbeatSuite) waitForEvent(
+	stack *testutils.TestStack, jobID, name string, filter func(model.JobEvent) bool) {
+	waiter := &system.FunctionWaiter{
+		Name:        name,
+		MaxAttempts: 100,
+		Delay:       time.Millisecond * 100,
+		Handler: func() (bool, error) {
+			return suite.countEvents(stack, jobID, filter) > 0, nil
+		},
+	}
+	require.NoError(suite.T(), waiter.Wait())
+}
+
+// TestHeartbeatsKeepShardAlive tests that a shard that takes longer than the
+// heartbeat timeout is not failed as long as the compute node keeps sending
+// heartbeats
+func (suite *RequesterNodeHeartbeatSuite) TestHeartbeatsKeepShardAlive() {
+	stack, j := suite.runBlockingJob(time.Millisecond*200, time.Second*2, model.JobSpecCheckpoint{}, func(
+		ctx context.Context, shard model.JobShard, resultsDir string) error {
+		time.Sleep(time.Second * 4)
+		return nil
+	})
+	defer stack.Node.CleanupManager.Cleanup()
+
+	waiter := &system.FunctionWaiter{
+		Name:        "wait for shard to complete",
+		MaxAttempts: 100,
+		Delay:       time.Millisecond * 100,
+		Handler: func() (bool, error) {
+			return suite.countEvents(stack, j.ID, func(ev model.JobEvent) bool {
+				return ev.EventName == model.JobEventResultsPublished
+			}) > 0, nil
+		},
+	}
+	require.NoError(suite.T(), waiter.Wait())
+
+	require.Greater(suite.T(), suite.countEvents(stack, j.ID, func(ev model.JobEvent) bool {
+		return ev.EventName == model.JobEventRunning
+	}), 1)
+	require.Equal(suite.T(), 0, suite.countEvents(stack, j.ID, func(ev model.JobEvent) bool {
+		return ev.EventName == model.JobEventError
+	}))
+}
+
+// TestMissingHeartbeatsFailShard tests that the requester marks a shard as
+// failed when the compute node running it stops sending heartbeats and no
+// other node can take it, and that the compute node stops running it when
+// it hears about that
+func (suite *RequesterNodeHeartbeatSuite) TestMissingHeartbeatsFailShard() {
+	release := make(chan struct{})
+	defer close(release)
+	cancelled := make(chan struct{})
+
+	// only the first heartbeat is sent before the timeout
+	stack, j := suite.runBlockingJob(time.Hour, time.Second*1, model.JobSpecCheckpoint{}, func(
+		ctx context.Context, shard model.JobShard, resultsDir string) error {
+		select {
+		case <-release:
+		case <-ctx.Done():
+			close(cancelled)
+		}
+		return nil
+	})
+	defer stack.Node.CleanupManager.Cleanup()
+	computeNodeID := stack.Node.ComputeNode.ID
+
+	waiter := &system.FunctionWaiter{
+		Name:        "wait for shard to be marked failed",
+		MaxAttempts: 100,
+		Delay:       time.Millisecond * 100,
+		Handler: func() (bool, error) {
+			return suite.countEvents(stack, j.ID, func(ev model.JobEvent) bool {
+				return ev.EventName == model.JobEventError && ev.TargetNodeID == computeNodeID
+			}) > 0, nil
+		},
+	}
+	require.NoError(suite.T(), waiter.Wait())
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second * 5):
+		require.Fail(suite.T(), "the compute node kept running the failed shard")
+	}
+
+	// nothing the compute node says afterwards changes the shard
+	time.Sleep(time.Millisecond * 500)
+	jobState, err := stack.Node.Controller.GetJobState(context.Background(), j.ID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), model.JobStateError, jobState.Nodes[computeNodeID].Shards[0].State)
+	require.Equal(suite.T(), 0, suite.countEvents(stack, j.ID, func(ev model.JobEvent) bool {
+		return ev.EventName == model.JobEventResultsProposed
+	}))
+}
+
+// TestMissingHeartbeatsRescheduleShard tests that the shard of a job that
+// checkpoints is taken off a compute node that stops sending heartbeats,
+// and that the node stops running it when it hears about that
+func (suite *RequesterNodeHeartbeatSuite) TestMissingHeartbeatsRescheduleShard() {
+	suite.testMissingHeartbeatsRescheduleShard(model.JobSpecCheckpoint{
+		Path:        "/checkpoint",
+		RestorePath: "/restore",
+	})
+}
+
+// TestMissingHeartbeatsRescheduleShardWithoutCheckpoint tests that shards
+// of jobs that don't checkpoint are rescheduled too (and start over)
+func (suite *RequesterNodeHeartbeatSuite) TestMissingHeartbeatsRescheduleShardWithoutCheckpoint() {
+	suite.testMissingHeartbeatsRescheduleShard(model.JobSpecCheckpoint{})
+}
+
+func (suite *RequesterNodeHeartbeatSuite) testMissingHeartbeatsRescheduleShard(checkpoint model.JobSpecCheckpoint) {
+	release := make(chan struct{})
+	defer close(release)
+	cancelled := make(chan struct{})
+
+	stack, j := suite.runBlockingJob(time.Hour, time.Second*2, checkpoint, func(
+		ctx context.Context, shard model.JobShard, resultsDir string) error {
+		select {
+		case <-release:
+		case <-ctx.Done():
+			close(cancelled)
+		}
+		return nil
+	})
+	defer stack.Node.CleanupManager.Cleanup()
+	computeNodeID := stack.Node.ComputeNode.ID
+	suite.standbyBid(stack, j.ID)
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second * 10):
+		require.Fail(suite.T(), "the compute node kept running the rescheduled shard")
+	}
+	require.Equal(suite.T(), 1, suite.countEvents(stack, j.ID, func(ev model.JobEvent) bool {
+		return ev.EventName == model.JobEventRescheduled && ev.TargetNodeID == computeNodeID
+	}))
+
+	// nothing the compute node says afterwards changes the shard
+	time.Sleep(time.Millisecond * 500)
+	jobState, err := stack.Node.Controller.GetJobState(context.Background(), j.ID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), model.JobStateCancelled, jobState.Nodes[computeNodeID].Shards[0].State)
+	require.Equal(suite.T(), 0, suite.countEvents(stack, j.ID, func(ev model.JobEvent) bool {
+		return ev.EventName == model.JobEventResultsProposed || ev.EventName == model.JobEventError
+	}))
+
+	// the standby node hears the shard was rescheduled and bids again
+	err = stack.Node.Transport.Publish(context.Background(), model.JobEvent{
+		SourceNodeID: standbyNodeID,
+		JobID:        j.ID,
+		EventName:    model.JobEventBid,
+		EventTime:    time.Now(),
+	})
+	require.NoError(suite.T(), err)
+	suite.waitForEvent(stack, j.ID, "wait for the shard to be given to the standby node", func(ev model.JobEvent) bool {
+		return ev.EventName == model.JobEventBidAccepted && ev.TargetNodeID == standbyNodeID
+	})
+}
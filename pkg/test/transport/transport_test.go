@@ -243,6 +243,7 @@ func (suite *TransportSuite) TestTransportEvents() {
 		model.JobEventCreated.String(),
 		model.JobEventBid.String(),
 		model.JobEventBidAccepted.String(),
+		model.JobEventRunning.String(),
 		model.JobEventResultsProposed.String(),
 		model.JobEventResultsAccepted.String(),
 		model.JobEventResultsPublished.String(),
@@ -251,8 +252,14 @@ func (suite *TransportSuite) TestTransportEvents() {
 
 	time.Sleep(time.Second * 5)
 
+	// running shards send a heartbeat event every so often, so only check
+	// which events there were rather than how many of each
+	seenEventNames := map[string]bool{}
 	for _, event := range transport.GetEvents() {
-		actualEventNames = append(actualEventNames, event.EventName.String())
+		if !seenEventNames[event.EventName.String()] {
+			seenEventNames[event.EventName.String()] = true
+			actualEventNames = append(actualEventNames, event.EventName.String())
+		}
 	}
 
 	sort.Strings(expectedEventNames)
@@ -97,6 +97,18 @@ func NewNoopStack(
 	t *testing.T,
 	computeNodeconfig computenode.ComputeNodeConfig,
 	noopExecutorConfig noop_executor.ExecutorConfig,
+) *TestStack {
+	return NewNoopStackWithRequesterConfig(
+		ctx, t, computeNodeconfig, requesternode.RequesterNodeConfig{}, noopExecutorConfig)
+}
+
+// same as NewNoopStack but lets you configure the requester node too
+func NewNoopStackWithRequesterConfig(
+	ctx context.Context,
+	t *testing.T,
+	computeNodeconfig computenode.ComputeNodeConfig,
+	requesterNodeConfig requesternode.RequesterNodeConfig,
+	noopExecutorConfig noop_executor.ExecutorConfig,
 ) *TestStack {
 	cm := system.NewCleanupManager()
 
@@ -107,7 +119,7 @@ func NewNoopStack(
 		CleanupManager:      cm,
 		Transport:           transport,
 		ComputeNodeConfig:   computeNodeconfig,
-		RequesterNodeConfig: requesternode.RequesterNodeConfig{},
+		RequesterNodeConfig: requesterNodeConfig,
 	}
 
 	injector := devstack.NewNoopNodeDepdencyInjector()
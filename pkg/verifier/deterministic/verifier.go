@@ -3,7 +3,12 @@ package deterministic
 import (
 	"context"
 	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/filecoin-project/bacalhau/pkg/executor"
 	"github.com/filecoin-project/bacalhau/pkg/job"
 	"github.com/filecoin-project/bacalhau/pkg/model"
 	"github.com/filecoin-project/bacalhau/pkg/system"
@@ -62,7 +67,7 @@ func (deterministicVerifier *DeterministicVerifier) GetShardProposal(
 	if len(job.RequesterPublicKey) == 0 {
 		return nil, errors.New("no RequesterPublicKey found in the job")
 	}
-	dirHash, err := dirhash.HashDir(shardResultPath, "results", dirhash.Hash1)
+	dirHash, err := hashResults(shardResultPath)
 	if err != nil {
 		return nil, err
 	}
@@ -73,6 +78,25 @@ func (deterministicVerifier *DeterministicVerifier) GetShardProposal(
 	return encryptedHash, nil
 }
 
+// hashResults hashes the results of a shard apart from the resource usage,
+// which is different on every node
+func hashResults(shardResultPath string) (string, error) {
+	files, err := dirhash.DirFiles(shardResultPath, "results")
+	if err != nil {
+		return "", err
+	}
+	usageFile := "results/" + executor.ResourceUsageFileName
+	hashedFiles := []string{}
+	for _, file := range files {
+		if file != usageFile {
+			hashedFiles = append(hashedFiles, file)
+		}
+	}
+	return dirhash.Hash1(hashedFiles, func(name string) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(shardResultPath, strings.TrimPrefix(name, "results/")))
+	})
+}
+
 // each shard must have >= concurrency states
 // and they must be either JobStateError or JobStateVerifying
 func (deterministicVerifier *DeterministicVerifier) IsExecutionComplete(
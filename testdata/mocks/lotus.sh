@@ -5,6 +5,10 @@ IFS=$'\n\t'
 export LOTUS_LOGFILE=${LOTUS_LOGFILE:="/tmp/bacalhau_lotus_mock_log.txt"}
 export LOTUS_TEST_CONTENT_CID=${LOTUS_TEST_CONTENT_CID:="test-content-cid"}
 export LOTUS_TEST_DEAL_CID=${LOTUS_TEST_DEAL_CID:="test-deal-cid"}
+export LOTUS_TEST_LOCAL_CID=${LOTUS_TEST_LOCAL_CID:=""}
+export LOTUS_TEST_LOCAL_PATH=${LOTUS_TEST_LOCAL_PATH:="/tmp/imported"}
+export LOTUS_TEST_OFFERS=${LOTUS_TEST_OFFERS:=""}
+export LOTUS_TEST_RETRIEVE_SOURCE=${LOTUS_TEST_RETRIEVE_SOURCE:=""}
 
 function version() {
   echo "0.0.1"
@@ -22,9 +26,51 @@ Deal (${MINER_ADDRESS}) CID: ${LOTUS_TEST_DEAL_CID}
 EOF
 }
 
+function list_local() {
+  if [[ -n "${LOTUS_TEST_LOCAL_CID}" ]]; then
+    echo "1: ${LOTUS_TEST_LOCAL_CID} @${LOTUS_TEST_LOCAL_PATH} (import)"
+  fi
+}
+
+function find() {
+  if [[ -n "${LOTUS_TEST_LOCAL_CID}" && "$1" == "${LOTUS_TEST_LOCAL_CID}" ]]; then
+    echo "LOCAL"
+  fi
+  if [[ -n "${LOTUS_TEST_OFFERS}" ]]; then
+    echo "${LOTUS_TEST_OFFERS}"
+  fi
+}
+
+function retrieve() {
+  local DATA_CID=""
+  local OUTPUT_PATH=""
+  while [[ $# -gt 0 ]]; do
+    case "$1" in
+      --maxPrice|--provider) shift 2 ;;
+      --allow-local) shift ;;
+      *)
+        if [[ -z "${DATA_CID}" ]]; then DATA_CID="$1"; else OUTPUT_PATH="$1"; fi
+        shift
+        ;;
+    esac
+  done
+  if [[ -z "${LOTUS_TEST_RETRIEVE_SOURCE}" ]]; then
+    echo "ERROR: failed to retrieve ${DATA_CID}"
+    return 1
+  fi
+  echo "> Recv: 0 B, Paid 0 FIL, ClientEventOpen (DealStatusNew)"
+  cp -r "${LOTUS_TEST_RETRIEVE_SOURCE}" "${OUTPUT_PATH}"
+  echo "> Recv: 5 B, Paid 0 FIL, ClientEventBlocksReceived (DealStatusOngoing)"
+  echo "Success"
+}
+
 function client() {
-  eval "$@"
+  case "$1" in
+    # local is a bash builtin
+    local) list_local ;;
+    *) eval "$@" ;;
+  esac
 }
 
 echo "command: $@" >> "$LOTUS_LOGFILE"
-eval "$@" | tee -a "$LOTUS_LOGFILE"
\ No newline at end of file
+eval "$@" | tee -a "$LOTUS_LOGFILE"